@@ -17,7 +17,10 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"time"
+
 	loggingv1 "github.com/openshift/cluster-logging-operator/apis/logging/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -27,18 +30,549 @@ import (
 // ClusterLogForwarderTemplateSpec defines the desired state of ClusterLogForwarderTemplate
 type ClusterLogForwarderTemplateSpec struct {
 	Template loggingv1.ClusterLogForwarderSpec `json:"template"`
+
+	// ClusterLogForwarderName is the name of the CLF generated in the HCP namespaces, the name of the template
+	// if empty. It may hold ${key} tokens substituted with the values of each hosted cluster. A CLF of the same
+	// name not generated from the template is never overwritten
+	// +kubebuilder:validation:MaxLength=253
+	// +optional
+	ClusterLogForwarderName string `json:"clusterLogForwarderName,omitempty"`
+
+	// OutputDefaults are merged into every output of the template,
+	// the settings of an output take precedence over the defaults
+	// +optional
+	OutputDefaults *OutputDefaults `json:"outputDefaults,omitempty"`
+
+	// OutputOptions holds the settings of the template outputs not covered
+	// by the ClusterLogForwarder API, matched by output name
+	// +optional
+	OutputOptions []OutputOptions `json:"outputOptions,omitempty"`
+
+	// CABundle is the CA bundle trusted by all the TLS outputs of the template, e.g. the internal CA
+	// of the enterprise. It is propagated into the HCP namespace along with the output secrets
+	// +optional
+	CABundle *CABundleReference `json:"caBundle,omitempty"`
+
+	// Environments tune the outputs for the hosted clusters of an environment, selected by the
+	// logging.managed.openshift.io/environment label of the HostedCluster, e.g. larger batches and
+	// longer retries in prod than in dev. The hosted clusters of no listed environment are not tuned
+	// +optional
+	Environments []EnvironmentTuning `json:"environments,omitempty"`
+
+	// PipelineOptions holds the settings of the template pipelines not covered
+	// by the ClusterLogForwarder API, matched by pipeline name
+	// +optional
+	PipelineOptions []PipelineOptions `json:"pipelineOptions,omitempty"`
+
+	// PlatformOutputs selects outputs by the platform of the hosted cluster,
+	// the outputs of the matching platform are rendered along with the template outputs
+	// +optional
+	PlatformOutputs []PlatformOutputs `json:"platformOutputs,omitempty"`
+
+	// Multiline enables the detection and join of multiline errors, e.g. stack traces,
+	// on the pipelines forwarding application logs
+	// +optional
+	Multiline *MultilineOptions `json:"multiline,omitempty"`
+
+	// CollectionSources are extra inputs of the host logs collected from the hosted control plane nodes,
+	// e.g. the journald logs, referenced by name in the template pipelines
+	// +optional
+	CollectionSources []CollectionSource `json:"collectionSources,omitempty"`
+
+	// NamespaceRateLimits are inputs of the application logs of a single namespace capped in throughput,
+	// referenced by name in the template pipelines instead of the application input, which does not cap them
+	// +optional
+	NamespaceRateLimits []NamespaceRateLimit `json:"namespaceRateLimits,omitempty"`
+
+	// PodSelectors are inputs of the application logs of the pods selected by their labels, e.g. the pods
+	// of a tenant spanning several namespaces, referenced by name in the template pipelines
+	// +optional
+	PodSelectors []PodSelector `json:"podSelectors,omitempty"`
+
+	// HCPAudit enables the input-httpserver input receiving the audit logs of the hosted control plane
+	// API server. It is left out of the CLF unless enabled, the other inputs are rendered regardless
+	// +optional
+	HCPAudit *HCPAuditOptions `json:"hcpAudit,omitempty"`
+
+	// SystemNamespaces configures the drop of the application logs of the system namespaces,
+	// kube-* and openshift-* are dropped by default
+	// +optional
+	SystemNamespaces *SystemNamespacesOptions `json:"systemNamespaces,omitempty"`
+
+	// Transforms adds static fields to and removes fields from the records of every pipeline of the template
+	// +optional
+	Transforms *TransformOptions `json:"transforms,omitempty"`
+
+	// CollectorType is how the collector of the ClusterLogForwarder is deployed in the HCP namespace,
+	// a DaemonSet unless set. Deployment requires cluster-logging 5.8 or later
+	// +kubebuilder:validation:Enum=DaemonSet;Deployment
+	// +optional
+	CollectorType string `json:"collectorType,omitempty"`
+
+	// CollectorLogLevel is the log level of the collector of the ClusterLogForwarder, e.g. debug to troubleshoot
+	// the collection. It is left out of the CLF on the cluster-logging versions without it
+	// +kubebuilder:validation:Enum=trace;debug;info;warn;error;off
+	// +optional
+	CollectorLogLevel string `json:"collectorLogLevel,omitempty"`
+
+	// Default makes the template the default forwarding config, applied to every ready hosted cluster
+	// unless its HostedControlPlane opts out with the logging.managed.openshift.io/skip-default-templates
+	// annotation set to "true". The CLF is removed from the clusters opting out or no longer ready
+	// +optional
+	Default bool `json:"default,omitempty"`
+
+	// SelfTest periodically checks the logs forwarded by the template reach an output, by injecting
+	// a marker audit log into the collector of a hosted cluster and querying it from the output
+	// +optional
+	SelfTest *SelfTestOptions `json:"selfTest,omitempty"`
+
+	// Export writes the CLF rendered for every hosted cluster as YAML into a ConfigMap of the HCP namespace,
+	// with the credentials redacted, e.g. to review the per-cluster config in a GitOps repository
+	// +optional
+	Export *ExportOptions `json:"export,omitempty"`
+}
+
+// CABundleReference references the CA bundle of a secret or a ConfigMap of the template namespace,
+// exactly one of them is set
+type CABundleReference struct {
+	// SecretName is the name of the secret holding the CA bundle
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+
+	// ConfigMapName is the name of the ConfigMap holding the CA bundle
+	// +optional
+	ConfigMapName string `json:"configMapName,omitempty"`
+
+	// Key is the key of the PEM encoded CA bundle in the secret or the ConfigMap, ca-bundle.crt if not set
+	// +optional
+	Key string `json:"key,omitempty"`
+}
+
+// GetKey returns the key of the CA bundle, ca-bundle.crt if not set
+func (r *CABundleReference) GetKey() string {
+	if r.Key == "" {
+		return "ca-bundle.crt"
+	}
+	return r.Key
+}
+
+// HCPAuditOptions defines the collection of the audit logs of the hosted control plane API server
+type HCPAuditOptions struct {
+	// Enabled renders the input-httpserver input, referenced by the template pipelines forwarding the audit logs
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+}
+
+// ExportOptions defines the export of the rendered ClusterLogForwarders
+type ExportOptions struct {
+	// Enabled writes the rendered CLF into the <template>-rendered ConfigMap of the HCP namespace
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+}
+
+// SelfTestOptions defines the round-trip check of the log delivery of the template
+type SelfTestOptions struct {
+	// Enabled runs the self-test, the marker is injected through the input-httpserver input
+	// which requires the hosted control plane audit to be enabled
+	Enabled bool `json:"enabled"`
+
+	// Output is the template output queried for the marker, a loki output forwarding the input-httpserver input
+	Output string `json:"output"`
+
+	// Interval between two self-tests, one hour if not set
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+}
+
+// GetInterval returns the interval between two self-tests, one hour if not set
+func (o *SelfTestOptions) GetInterval() time.Duration {
+	if o.Interval == nil {
+		return time.Hour
+	}
+	return o.Interval.Duration
+}
+
+// TransformOptions defines the fields added to and removed from the forwarded records
+type TransformOptions struct {
+	// AddFields are static fields set on every record under .openshift.labels, e.g. the datacenter
+	// or the cluster id. The labels of the pipelines and of the pipeline options take precedence
+	// +optional
+	AddFields map[string]string `json:"addFields,omitempty"`
+
+	// RemoveFields are the paths of the fields removed from every record, e.g. .kubernetes.annotations,
+	// the .log_type and .message fields cannot be removed
+	// +optional
+	RemoveFields []string `json:"removeFields,omitempty"`
+}
+
+// SystemNamespacesOptions defines the namespaces whose records are dropped from the application pipelines,
+// the patterns are namespace names optionally ending with * to match any suffix
+type SystemNamespacesOptions struct {
+	// Disabled keeps the application logs of all the namespaces
+	// +optional
+	Disabled bool `json:"disabled,omitempty"`
+
+	// Add are namespaces dropped along with the default ones
+	// +optional
+	Add []string `json:"add,omitempty"`
+
+	// Remove are namespaces kept in the application logs, either a default pattern, e.g. kube-*,
+	// or a namespace matching one, e.g. openshift-monitoring
+	// +optional
+	Remove []string `json:"remove,omitempty"`
+}
+
+// NamespaceRateLimit defines an input of the application logs of a namespace with a flow control limit
+type NamespaceRateLimit struct {
+	// Name of the input referenced by the template pipelines
+	Name string `json:"name"`
+
+	// Namespace of the hosted control plane whose application logs are collected
+	Namespace string `json:"namespace"`
+
+	// MaxRecordsPerSecond is the maximum number of records collected per second from all the containers
+	// of the namespace, the records over the limit are dropped
+	// +kubebuilder:validation:Minimum=1
+	MaxRecordsPerSecond int64 `json:"maxRecordsPerSecond"`
+}
+
+// PodSelector defines an input of the application logs of the pods matching labels
+type PodSelector struct {
+	// Name of the input referenced by the template pipelines
+	Name string `json:"name"`
+
+	// MatchLabels select the pods carrying all the labels, at least one label is required as cluster-logging
+	// only matches the pods by their labels
+	MatchLabels map[string]string `json:"matchLabels"`
+
+	// Namespaces limits the pods selected to the namespaces, the pods of all the namespaces are selected if empty
+	// +optional
+	Namespaces []string `json:"namespaces,omitempty"`
+}
+
+// CollectionSource defines an extra input of the collector, limited to the sources allowed by the operator
+type CollectionSource struct {
+	// Name of the input referenced by the template pipelines
+	Name string `json:"name"`
+
+	// Type of the logs collected from the sources
+	// +kubebuilder:validation:Enum=infrastructure;audit
+	Type string `json:"type"`
+
+	// Sources collected by the input, node for the journald logs or container for the infrastructure
+	// containers, auditd, kubeAPI, openshiftAPI or ovn for the audit logs
+	Sources []string `json:"sources"`
+}
+
+// MultilineOptions defines the pipelines joining the multiline errors of the application logs
+type MultilineOptions struct {
+	// Enabled turns on the multiline error detection of the ClusterLogForwarder
+	Enabled bool `json:"enabled"`
+
+	// PipelinePatterns are regular expressions selecting the application pipelines by name,
+	// all the application pipelines are selected if empty
+	// +optional
+	PipelinePatterns []string `json:"pipelinePatterns,omitempty"`
+}
+
+// DefaultPlatform matches the hosted cluster platforms without their own PlatformOutputs
+const DefaultPlatform = "Default"
+
+// PlatformOutputs defines the outputs rendered for the hosted clusters of a platform
+type PlatformOutputs struct {
+	// Platform is the platform type of the hosted cluster, e.g. AWS or Azure,
+	// or Default for the platforms without their own entry
+	Platform string `json:"platform"`
+
+	// Outputs rendered for the hosted clusters of the platform
+	Outputs []loggingv1.OutputSpec `json:"outputs"`
+}
+
+// OutputOptions defines the operator settings of a template output
+type OutputOptions struct {
+	// Name of the output in the template or in the platform outputs
+	Name string `json:"name"`
+
+	// Compression of the data sent to the output, the supported algorithms depend on the output type
+	// +kubebuilder:validation:Enum=none;gzip;snappy;zlib;zstd;lz4
+	// +optional
+	Compression string `json:"compression,omitempty"`
+
+	// Timeout of the requests sent to the output, between 1s and 10m.
+	// Only supported by the http outputs
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+
+	// MinRetryDuration is the delay before retrying a failed delivery to the output, between 1s and 1h.
+	// The delay grows on each retry up to MaxRetryDuration
+	// +optional
+	MinRetryDuration *metav1.Duration `json:"minRetryDuration,omitempty"`
+
+	// MaxRetryDuration is the longest delay between the retries of a failed delivery, between 1s and 1h
+	// +optional
+	MaxRetryDuration *metav1.Duration `json:"maxRetryDuration,omitempty"`
+
+	// MaxWrite is the largest batch of records sent to the output in a single request, between 1Ki and 10Mi.
+	// Larger batches favor the throughput, smaller ones the latency. The batches are flushed by the collector
+	// at its own interval, which cluster-logging does not expose
+	// +optional
+	MaxWrite *resource.Quantity `json:"maxWrite,omitempty"`
+
+	// Fallback is the name of a secondary output added to every pipeline forwarding to this output.
+	// The ClusterLogForwarder has no failover: the pipeline fans out, so the fallback receives all the
+	// records at all times, not only while this output is unreachable. The outputs buffer independently,
+	// an unreachable output does not block the delivery to the other one until its buffer is full.
+	// The fallback cannot have a fallback itself
+	// +optional
+	Fallback string `json:"fallback,omitempty"`
+
+	// SecretByReference uses the secret of the output from the HCP namespace as is, for the credentials already
+	// living there, instead of copying it from the template namespace. The hosted cluster is not applied until
+	// the secret exists in its HCP namespace, and the secret is not completed with the CA bundle of the template
+	// +optional
+	SecretByReference bool `json:"secretByReference,omitempty"`
+
+	// SecretNamespace is the namespace the secret of the output is copied from instead of the template namespace,
+	// e.g. the namespace of the team owning the output. It must be one of the secret namespaces of the operator,
+	// and cannot be set along with SecretByReference
+	// +optional
+	SecretNamespace string `json:"secretNamespace,omitempty"`
+}
+
+// EnvironmentTuning defines the output settings of the hosted clusters of an environment
+type EnvironmentTuning struct {
+	// Environment is the value of the logging.managed.openshift.io/environment label of the HostedCluster
+	Environment string `json:"environment"`
+
+	// OutputDefaults replace the output defaults of the template for the environment
+	// +optional
+	OutputDefaults *OutputDefaults `json:"outputDefaults,omitempty"`
+
+	// OutputOptions are merged into the output options of the template by output name,
+	// the settings of the environment take precedence
+	// +optional
+	OutputOptions []OutputOptions `json:"outputOptions,omitempty"`
+}
+
+// PipelineOptions defines the operator settings of a template pipeline
+type PipelineOptions struct {
+	// Name of the pipeline in the template
+	Name string `json:"name"`
+
+	// Enabled set to false excludes the pipeline from the rendered ClusterLogForwarder
+	// while keeping it in the template, the secrets of the outputs forwarded to by no other
+	// pipeline are then not propagated. Defaults to true
+	// +optional
+	Enabled *bool `json:"enabled,omitempty"`
+
+	// MinSeverity drops the records of the pipeline less severe than the given level,
+	// either textual (e.g. warn, warning) or the syslog numeric level (e.g. 4).
+	// The records without a known level are kept
+	// +optional
+	MinSeverity string `json:"minSeverity,omitempty"`
+
+	// FilterOrder is the order the filters of the pipeline are applied in, e.g. parse before drop.
+	// It may list the filters added by the operator, e.g. hlo-<pipeline>-min-severity. The filters not listed
+	// are applied after the listed ones, in their rendered order
+	// +optional
+	FilterOrder []string `json:"filterOrder,omitempty"`
+
+	// Labels are static labels added to the records of the pipeline, e.g. data_classification=restricted
+	// for compliance tagging. They take precedence over the labels of the template pipeline
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// IsEnabled returns true unless the pipeline is explicitly disabled
+func (o *PipelineOptions) IsEnabled() bool {
+	return o == nil || o.Enabled == nil || *o.Enabled
+}
+
+// GetPlatformOutputs returns the outputs for the platform, falling back to the Default platform.
+// The second return value is false if neither is defined
+func (s *ClusterLogForwarderTemplateSpec) GetPlatformOutputs(platform string) ([]loggingv1.OutputSpec, bool) {
+	var defaults *PlatformOutputs
+	for i := range s.PlatformOutputs {
+		switch s.PlatformOutputs[i].Platform {
+		case platform:
+			return s.PlatformOutputs[i].Outputs, true
+		case DefaultPlatform:
+			defaults = &s.PlatformOutputs[i]
+		}
+	}
+	if defaults != nil {
+		return defaults.Outputs, true
+	}
+	return nil, false
+}
+
+// GetOutputOptions returns the options of the named output, nil if there is none
+func (s *ClusterLogForwarderTemplateSpec) GetOutputOptions(name string) *OutputOptions {
+	for i := range s.OutputOptions {
+		if s.OutputOptions[i].Name == name {
+			return &s.OutputOptions[i]
+		}
+	}
+	return nil
+}
+
+// IsHCPAuditEnabled returns true if the audit logs of the hosted control plane API server are collected
+func (s *ClusterLogForwarderTemplateSpec) IsHCPAuditEnabled() bool {
+	return s.HCPAudit != nil && s.HCPAudit.Enabled
+}
+
+// IsExportEnabled returns true if the rendered CLF is exported into a ConfigMap of the HCP namespace
+func (s *ClusterLogForwarderTemplateSpec) IsExportEnabled() bool {
+	return s.Export != nil && s.Export.Enabled
+}
+
+// IsSelfTestEnabled returns true if the self-test of the log delivery is enabled
+func (s *ClusterLogForwarderTemplateSpec) IsSelfTestEnabled() bool {
+	return s.SelfTest != nil && s.SelfTest.Enabled
+}
+
+// GetPipelineOptions returns the options of the named pipeline, nil if there is none
+func (s *ClusterLogForwarderTemplateSpec) GetPipelineOptions(name string) *PipelineOptions {
+	for i := range s.PipelineOptions {
+		if s.PipelineOptions[i].Name == name {
+			return &s.PipelineOptions[i]
+		}
+	}
+	return nil
+}
+
+// OutputDefaults defines the settings shared by all outputs of a template
+type OutputDefaults struct {
+	// TLS is the default TLS configuration, applied to the outputs using a secure URL
+	// +optional
+	TLS *loggingv1.OutputTLSSpec `json:"tls,omitempty"`
+
+	// Secret is the default secret of the outputs, e.g. holding a shared CA bundle
+	// +optional
+	Secret *loggingv1.OutputSecretSpec `json:"secret,omitempty"`
+
+	// Limit is the default rate limit of the outputs
+	// +optional
+	Limit *loggingv1.LimitSpec `json:"limit,omitempty"`
+}
+
+// ReadyCondition reports whether the template is applied to all the hosted clusters
+const ReadyCondition = "Ready"
+
+// Reasons of the ReadyCondition
+const (
+	AppliedReason         = "Applied"
+	InvalidTemplateReason = "InvalidTemplate"
+	ApplyFailedReason     = "ApplyFailed"
+	// StrictValidationFailedReason reports a hosted cluster whose CLF would only be applied best-effort,
+	// refused by the strict mode of the operator
+	StrictValidationFailedReason = "StrictValidationFailed"
+)
+
+// RenderedCondition reports whether the template renders into a valid ClusterLogForwarder
+const (
+	RenderedCondition = "Rendered"
+	RenderedReason    = "Rendered"
+)
+
+// AppliedToGuestCondition reports whether the ClusterLogForwarders rendered from the template are applied
+// and accepted by cluster-logging for all the hosted clusters, the reasons of the ReadyCondition report
+// the template failing to be rendered or applied
+const (
+	AppliedToGuestCondition = "AppliedToGuest"
+	AcceptedReason          = "Accepted"
+	PendingReason           = "Pending"
+)
+
+// OrphanedOutputsCondition reports the outputs of the template referenced by no pipeline
+const (
+	OrphanedOutputsCondition  = "OrphanedOutputs"
+	UnreferencedOutputsReason = "UnreferencedOutputs"
+)
+
+// UnmanagedCondition reports the generated ClusterLogForwarders annotated as unmanaged, which are left intact
+const (
+	UnmanagedCondition        = "Unmanaged"
+	UnmanagedAnnotationReason = "UnmanagedAnnotation"
+)
+
+// NameConflictCondition reports the hosted clusters with a ClusterLogForwarder of the generated name not generated
+// from the template, e.g. created by hand, which is left intact instead of the template being applied
+const (
+	NameConflictCondition            = "NameConflict"
+	ForeignClusterLogForwarderReason = "ForeignClusterLogForwarder"
+)
+
+// LogDeliveryCondition reports whether the marker log of the last self-test reached the output
+const (
+	LogDeliveryCondition = "LogDelivery"
+	DeliveredReason      = "Delivered"
+	NotDeliveredReason   = "NotDelivered"
+	SelfTestFailedReason = "SelfTestFailed"
+)
+
+// DeliveryErrorsCondition reports the outputs whose collector reported delivery errors since it started, e.g. the
+// records rejected by the backend, when the delivery errors are read from the collectors of the hosted clusters
+const (
+	DeliveryErrorsCondition = "DeliveryErrors"
+	RecordsRejectedReason   = "RecordsRejected"
+	NoDeliveryErrorsReason  = "NoDeliveryErrors"
+)
+
+// SelfTestStatus is the last self-test of the log delivery of the template
+type SelfTestStatus struct {
+	// Marker is the unique message of the log injected
+	Marker string `json:"marker"`
+
+	// Namespace is the HCP namespace of the collector the marker is injected into
+	Namespace string `json:"namespace"`
+
+	// InjectedTime is the time the marker was injected
+	InjectedTime metav1.Time `json:"injectedTime"`
+
+	// CompletedTime is the time the marker was found in the output or given up on, the self-test is running if not set
+	// +optional
+	CompletedTime *metav1.Time `json:"completedTime,omitempty"`
+}
+
+// ClusterLogForwarderTemplateStatus defines the observed state of ClusterLogForwarderTemplate
+type ClusterLogForwarderTemplateStatus struct {
+	// AppliedClusters is the number of hosted clusters the ClusterLogForwarder is applied to
+	// +optional
+	AppliedClusters int32 `json:"appliedClusters"`
+
+	// ObservedGeneration is the generation of the template last reconciled
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// LastUpdateTime is the last time the status changed
+	// +optional
+	LastUpdateTime *metav1.Time `json:"lastUpdateTime,omitempty"`
+
+	// Conditions of the template
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// SelfTest is the last self-test of the log delivery, set when the self-test is enabled
+	// +optional
+	SelfTest *SelfTestStatus `json:"selfTest,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
 //+kubebuilder:resource:shortName=clft
+//+kubebuilder:printcolumn:name="Applied",type=integer,JSONPath=`.status.appliedClusters`
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Last Update",type=date,JSONPath=`.status.lastUpdateTime`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // ClusterLogForwarderTemplate is the Schema for the clusterlogforwardertemplates API
 type ClusterLogForwarderTemplate struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
-	Spec ClusterLogForwarderTemplateSpec `json:"spec,omitempty"`
+	Spec   ClusterLogForwarderTemplateSpec   `json:"spec,omitempty"`
+	Status ClusterLogForwarderTemplateStatus `json:"status,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -29,11 +29,50 @@ type HyperShiftLogForwarderSpec struct {
 // HyperShiftLogForwarderStatus defines the observed state of HyperShiftLogForwarder
 type HyperShiftLogForwarderStatus struct {
 	loggingv1.ClusterLogForwarderStatus `json:",inline"`
+
+	// Collector reports the pods of the collector running in the HCP namespace
+	// +optional
+	Collector *CollectorStatus `json:"collector,omitempty"`
+
+	// Health summarizes the conditions of the HyperShiftLogForwarder. It is Degraded if any condition reports
+	// a failure, Unknown if the forwarding cannot be vouched for, e.g. the CLF is unmanaged, and Healthy otherwise
+	// +kubebuilder:validation:Enum=Healthy;Degraded;Unknown
+	// +optional
+	Health HealthState `json:"health,omitempty"`
+}
+
+// HealthState is the summary of the conditions of a HyperShiftLogForwarder
+type HealthState string
+
+const (
+	// HealthyState reports the logs of the hosted cluster are forwarded as desired
+	HealthyState HealthState = "Healthy"
+	// DegradedState reports a condition failing the forwarding of the logs
+	DegradedState HealthState = "Degraded"
+	// UnknownState reports the conditions are not conclusive on the forwarding of the logs
+	UnknownState HealthState = "Unknown"
+)
+
+// CollectorStatus defines the observed state of the collector pods
+type CollectorStatus struct {
+	// Desired is the number of collector pods desired
+	Desired int32 `json:"desired"`
+
+	// Ready is the number of collector pods ready
+	Ready int32 `json:"ready"`
+
+	// Restarts is the total number of container restarts of the collector pods
+	Restarts int32 `json:"restarts"`
+
+	// Restarting is the number of collector pods with restarted containers
+	Restarting int32 `json:"restarting"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
 //+kubebuilder:resource:shortName=hlf
+//+kubebuilder:printcolumn:name="Health",type=string,JSONPath=`.status.health`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // HyperShiftLogForwarder is the Schema for the hypershiftlogforwarders API
 type HyperShiftLogForwarder struct {
@@ -6,15 +6,33 @@
 package v1alpha1
 
 import (
+	"github.com/openshift/cluster-logging-operator/apis/logging/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CABundleReference) DeepCopyInto(out *CABundleReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CABundleReference.
+func (in *CABundleReference) DeepCopy() *CABundleReference {
+	if in == nil {
+		return nil
+	}
+	out := new(CABundleReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterLogForwarderTemplate) DeepCopyInto(out *ClusterLogForwarderTemplate) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterLogForwarderTemplate.
@@ -71,6 +89,93 @@ func (in *ClusterLogForwarderTemplateList) DeepCopyObject() runtime.Object {
 func (in *ClusterLogForwarderTemplateSpec) DeepCopyInto(out *ClusterLogForwarderTemplateSpec) {
 	*out = *in
 	in.Template.DeepCopyInto(&out.Template)
+	if in.OutputDefaults != nil {
+		in, out := &in.OutputDefaults, &out.OutputDefaults
+		*out = new(OutputDefaults)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.OutputOptions != nil {
+		in, out := &in.OutputOptions, &out.OutputOptions
+		*out = make([]OutputOptions, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.CABundle != nil {
+		in, out := &in.CABundle, &out.CABundle
+		*out = new(CABundleReference)
+		**out = **in
+	}
+	if in.Environments != nil {
+		in, out := &in.Environments, &out.Environments
+		*out = make([]EnvironmentTuning, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.PipelineOptions != nil {
+		in, out := &in.PipelineOptions, &out.PipelineOptions
+		*out = make([]PipelineOptions, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.PlatformOutputs != nil {
+		in, out := &in.PlatformOutputs, &out.PlatformOutputs
+		*out = make([]PlatformOutputs, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Multiline != nil {
+		in, out := &in.Multiline, &out.Multiline
+		*out = new(MultilineOptions)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CollectionSources != nil {
+		in, out := &in.CollectionSources, &out.CollectionSources
+		*out = make([]CollectionSource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.NamespaceRateLimits != nil {
+		in, out := &in.NamespaceRateLimits, &out.NamespaceRateLimits
+		*out = make([]NamespaceRateLimit, len(*in))
+		copy(*out, *in)
+	}
+	if in.PodSelectors != nil {
+		in, out := &in.PodSelectors, &out.PodSelectors
+		*out = make([]PodSelector, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.HCPAudit != nil {
+		in, out := &in.HCPAudit, &out.HCPAudit
+		*out = new(HCPAuditOptions)
+		**out = **in
+	}
+	if in.SystemNamespaces != nil {
+		in, out := &in.SystemNamespaces, &out.SystemNamespaces
+		*out = new(SystemNamespacesOptions)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Transforms != nil {
+		in, out := &in.Transforms, &out.Transforms
+		*out = new(TransformOptions)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SelfTest != nil {
+		in, out := &in.SelfTest, &out.SelfTest
+		*out = new(SelfTestOptions)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Export != nil {
+		in, out := &in.Export, &out.Export
+		*out = new(ExportOptions)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterLogForwarderTemplateSpec.
@@ -83,6 +188,129 @@ func (in *ClusterLogForwarderTemplateSpec) DeepCopy() *ClusterLogForwarderTempla
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterLogForwarderTemplateStatus) DeepCopyInto(out *ClusterLogForwarderTemplateStatus) {
+	*out = *in
+	if in.LastUpdateTime != nil {
+		in, out := &in.LastUpdateTime, &out.LastUpdateTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.SelfTest != nil {
+		in, out := &in.SelfTest, &out.SelfTest
+		*out = new(SelfTestStatus)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterLogForwarderTemplateStatus.
+func (in *ClusterLogForwarderTemplateStatus) DeepCopy() *ClusterLogForwarderTemplateStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterLogForwarderTemplateStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CollectionSource) DeepCopyInto(out *CollectionSource) {
+	*out = *in
+	if in.Sources != nil {
+		in, out := &in.Sources, &out.Sources
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CollectionSource.
+func (in *CollectionSource) DeepCopy() *CollectionSource {
+	if in == nil {
+		return nil
+	}
+	out := new(CollectionSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CollectorStatus) DeepCopyInto(out *CollectorStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CollectorStatus.
+func (in *CollectorStatus) DeepCopy() *CollectorStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CollectorStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EnvironmentTuning) DeepCopyInto(out *EnvironmentTuning) {
+	*out = *in
+	if in.OutputDefaults != nil {
+		in, out := &in.OutputDefaults, &out.OutputDefaults
+		*out = new(OutputDefaults)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.OutputOptions != nil {
+		in, out := &in.OutputOptions, &out.OutputOptions
+		*out = make([]OutputOptions, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EnvironmentTuning.
+func (in *EnvironmentTuning) DeepCopy() *EnvironmentTuning {
+	if in == nil {
+		return nil
+	}
+	out := new(EnvironmentTuning)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExportOptions) DeepCopyInto(out *ExportOptions) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExportOptions.
+func (in *ExportOptions) DeepCopy() *ExportOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(ExportOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HCPAuditOptions) DeepCopyInto(out *HCPAuditOptions) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HCPAuditOptions.
+func (in *HCPAuditOptions) DeepCopy() *HCPAuditOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(HCPAuditOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HyperShiftLogForwarder) DeepCopyInto(out *HyperShiftLogForwarder) {
 	*out = *in
@@ -162,6 +390,11 @@ func (in *HyperShiftLogForwarderSpec) DeepCopy() *HyperShiftLogForwarderSpec {
 func (in *HyperShiftLogForwarderStatus) DeepCopyInto(out *HyperShiftLogForwarderStatus) {
 	*out = *in
 	in.ClusterLogForwarderStatus.DeepCopyInto(&out.ClusterLogForwarderStatus)
+	if in.Collector != nil {
+		in, out := &in.Collector, &out.Collector
+		*out = new(CollectorStatus)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HyperShiftLogForwarderStatus.
@@ -173,3 +406,276 @@ func (in *HyperShiftLogForwarderStatus) DeepCopy() *HyperShiftLogForwarderStatus
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MultilineOptions) DeepCopyInto(out *MultilineOptions) {
+	*out = *in
+	if in.PipelinePatterns != nil {
+		in, out := &in.PipelinePatterns, &out.PipelinePatterns
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MultilineOptions.
+func (in *MultilineOptions) DeepCopy() *MultilineOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(MultilineOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NamespaceRateLimit) DeepCopyInto(out *NamespaceRateLimit) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NamespaceRateLimit.
+func (in *NamespaceRateLimit) DeepCopy() *NamespaceRateLimit {
+	if in == nil {
+		return nil
+	}
+	out := new(NamespaceRateLimit)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OutputDefaults) DeepCopyInto(out *OutputDefaults) {
+	*out = *in
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = new(v1.OutputTLSSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Secret != nil {
+		in, out := &in.Secret, &out.Secret
+		*out = new(v1.OutputSecretSpec)
+		**out = **in
+	}
+	if in.Limit != nil {
+		in, out := &in.Limit, &out.Limit
+		*out = new(v1.LimitSpec)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OutputDefaults.
+func (in *OutputDefaults) DeepCopy() *OutputDefaults {
+	if in == nil {
+		return nil
+	}
+	out := new(OutputDefaults)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OutputOptions) DeepCopyInto(out *OutputOptions) {
+	*out = *in
+	if in.Timeout != nil {
+		in, out := &in.Timeout, &out.Timeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.MinRetryDuration != nil {
+		in, out := &in.MinRetryDuration, &out.MinRetryDuration
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.MaxRetryDuration != nil {
+		in, out := &in.MaxRetryDuration, &out.MaxRetryDuration
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.MaxWrite != nil {
+		in, out := &in.MaxWrite, &out.MaxWrite
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OutputOptions.
+func (in *OutputOptions) DeepCopy() *OutputOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(OutputOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PipelineOptions) DeepCopyInto(out *PipelineOptions) {
+	*out = *in
+	if in.Enabled != nil {
+		in, out := &in.Enabled, &out.Enabled
+		*out = new(bool)
+		**out = **in
+	}
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.FilterOrder != nil {
+		in, out := &in.FilterOrder, &out.FilterOrder
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PipelineOptions.
+func (in *PipelineOptions) DeepCopy() *PipelineOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(PipelineOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformOutputs) DeepCopyInto(out *PlatformOutputs) {
+	*out = *in
+	if in.Outputs != nil {
+		in, out := &in.Outputs, &out.Outputs
+		*out = make([]v1.OutputSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformOutputs.
+func (in *PlatformOutputs) DeepCopy() *PlatformOutputs {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformOutputs)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodSelector) DeepCopyInto(out *PodSelector) {
+	*out = *in
+	if in.MatchLabels != nil {
+		in, out := &in.MatchLabels, &out.MatchLabels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Namespaces != nil {
+		in, out := &in.Namespaces, &out.Namespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodSelector.
+func (in *PodSelector) DeepCopy() *PodSelector {
+	if in == nil {
+		return nil
+	}
+	out := new(PodSelector)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SelfTestOptions) DeepCopyInto(out *SelfTestOptions) {
+	*out = *in
+	if in.Interval != nil {
+		in, out := &in.Interval, &out.Interval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SelfTestOptions.
+func (in *SelfTestOptions) DeepCopy() *SelfTestOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(SelfTestOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SelfTestStatus) DeepCopyInto(out *SelfTestStatus) {
+	*out = *in
+	in.InjectedTime.DeepCopyInto(&out.InjectedTime)
+	if in.CompletedTime != nil {
+		in, out := &in.CompletedTime, &out.CompletedTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SelfTestStatus.
+func (in *SelfTestStatus) DeepCopy() *SelfTestStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SelfTestStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SystemNamespacesOptions) DeepCopyInto(out *SystemNamespacesOptions) {
+	*out = *in
+	if in.Add != nil {
+		in, out := &in.Add, &out.Add
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Remove != nil {
+		in, out := &in.Remove, &out.Remove
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SystemNamespacesOptions.
+func (in *SystemNamespacesOptions) DeepCopy() *SystemNamespacesOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(SystemNamespacesOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TransformOptions) DeepCopyInto(out *TransformOptions) {
+	*out = *in
+	if in.AddFields != nil {
+		in, out := &in.AddFields, &out.AddFields
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.RemoveFields != nil {
+		in, out := &in.RemoveFields, &out.RemoveFields
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TransformOptions.
+func (in *TransformOptions) DeepCopy() *TransformOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(TransformOptions)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,156 @@
+package clusterlogforwardertemplate
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	loggingv1 "github.com/openshift/cluster-logging-operator/apis/logging/v1"
+	hyperv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	hlov1alpha1 "github.com/openshift/hypershift-logging-operator/api/v1alpha1"
+	"github.com/openshift/hypershift-logging-operator/pkg/clusterlogforwarder"
+	"github.com/openshift/hypershift-logging-operator/pkg/constants"
+)
+
+// auditCollectorComponent is the component label of the RBAC granting the collector the audit logs
+const auditCollectorComponent = "audit-collector"
+
+// auditCollectorRules grant collecting the audit logs, checked by cluster-logging on the service account of the CLF
+var auditCollectorRules = []rbacv1.PolicyRule{{
+	APIGroups:     []string{loggingv1.GroupVersion.Group},
+	Resources:     []string{"logs"},
+	ResourceNames: []string{loggingv1.InputNameAudit},
+	Verbs:         []string{"collect"},
+}}
+
+// applyAuditRBAC grants the service account of the CLF the collection of the audit logs in the HCP namespace
+// when the template collects the hosted control plane audit, and removes the grant otherwise
+func (r *ClusterLogForwarderTemplateReconciler) applyAuditRBAC(
+	ctx context.Context,
+	template *hlov1alpha1.ClusterLogForwarderTemplate,
+	hcp *hyperv1beta1.HostedControlPlane,
+	clf *loggingv1.ClusterLogForwarder,
+) error {
+	if !template.Spec.IsHCPAuditEnabled() || clf.Spec.ServiceAccountName == "" {
+		return r.deleteAuditRBAC(ctx, template, hcp.Namespace)
+	}
+
+	role := r.buildAuditRole(template, hcp)
+	if err := controllerutil.SetOwnerReference(hcp, role, r.Scheme); err != nil {
+		return err
+	}
+	existingRole := &rbacv1.Role{}
+	err := r.Get(ctx, types.NamespacedName{Name: role.Name, Namespace: role.Namespace}, existingRole)
+	if errors.IsNotFound(err) {
+		if err := r.Create(ctx, role); err != nil {
+			return fmt.Errorf("failed to create the audit collector role: %w", err)
+		}
+	} else if err != nil {
+		return err
+	} else if !reflect.DeepEqual(existingRole.Rules, role.Rules) {
+		existingRole.Rules = role.Rules
+		if err := r.Update(ctx, existingRole); err != nil {
+			return fmt.Errorf("failed to update the audit collector role: %w", err)
+		}
+	}
+
+	binding := r.buildAuditRoleBinding(template, hcp, clf.Spec.ServiceAccountName)
+	if err := controllerutil.SetOwnerReference(hcp, binding, r.Scheme); err != nil {
+		return err
+	}
+	existing := &rbacv1.RoleBinding{}
+	err = r.Get(ctx, types.NamespacedName{Name: binding.Name, Namespace: binding.Namespace}, existing)
+	if errors.IsNotFound(err) {
+		if err := r.Create(ctx, binding); err != nil {
+			return fmt.Errorf("failed to create the audit collector role binding: %w", err)
+		}
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if reflect.DeepEqual(existing.Subjects, binding.Subjects) {
+		return nil
+	}
+	// The role of the binding is immutable, only the service account changes
+	existing.Subjects = binding.Subjects
+	if err := r.Update(ctx, existing); err != nil {
+		return fmt.Errorf("failed to update the audit collector role binding: %w", err)
+	}
+	return nil
+}
+
+// deleteAuditRBAC removes the role and the role binding of the audit collector of the template from the namespace
+func (r *ClusterLogForwarderTemplateReconciler) deleteAuditRBAC(
+	ctx context.Context,
+	template *hlov1alpha1.ClusterLogForwarderTemplate,
+	namespace string,
+) error {
+	labels := client.MatchingLabels(auditCollectorLabels(template))
+	if err := r.DeleteAllOf(ctx, &rbacv1.RoleBinding{}, client.InNamespace(namespace), labels); err != nil {
+		return fmt.Errorf("failed to delete the audit collector role binding: %w", err)
+	}
+	if err := r.DeleteAllOf(ctx, &rbacv1.Role{}, client.InNamespace(namespace), labels); err != nil {
+		return fmt.Errorf("failed to delete the audit collector role: %w", err)
+	}
+	return nil
+}
+
+func auditCollectorName(template *hlov1alpha1.ClusterLogForwarderTemplate) string {
+	return fmt.Sprintf("%s-%s", template.Name, auditCollectorComponent)
+}
+
+// auditCollectorLabels returns the labels of the audit collector RBAC, managed by the operator for the template
+func auditCollectorLabels(template *hlov1alpha1.ClusterLogForwarderTemplate) map[string]string {
+	labels := clusterlogforwarder.ManagedLabels(constants.TemplateLabel, template.Name)
+	labels["app.kubernetes.io/component"] = auditCollectorComponent
+	return labels
+}
+
+func (r *ClusterLogForwarderTemplateReconciler) buildAuditRole(
+	template *hlov1alpha1.ClusterLogForwarderTemplate,
+	hcp *hyperv1beta1.HostedControlPlane,
+) *rbacv1.Role {
+	role := &rbacv1.Role{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      auditCollectorName(template),
+			Namespace: hcp.Namespace,
+			Labels:    auditCollectorLabels(template),
+		},
+		Rules: auditCollectorRules,
+	}
+	r.CommonMetadata.Apply(role)
+	return role
+}
+
+func (r *ClusterLogForwarderTemplateReconciler) buildAuditRoleBinding(
+	template *hlov1alpha1.ClusterLogForwarderTemplate,
+	hcp *hyperv1beta1.HostedControlPlane,
+	serviceAccount string,
+) *rbacv1.RoleBinding {
+	binding := &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      auditCollectorName(template),
+			Namespace: hcp.Namespace,
+			Labels:    auditCollectorLabels(template),
+		},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "Role",
+			Name:     auditCollectorName(template),
+		},
+		Subjects: []rbacv1.Subject{{
+			Kind:      rbacv1.ServiceAccountKind,
+			Name:      serviceAccount,
+			Namespace: hcp.Namespace,
+		}},
+	}
+	r.CommonMetadata.Apply(binding)
+	return binding
+}
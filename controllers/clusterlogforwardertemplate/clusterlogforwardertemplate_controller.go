@@ -18,37 +18,111 @@ package clusterlogforwardertemplate
 
 import (
 	"context"
+	goerrors "errors"
+	"fmt"
 	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-logr/logr"
 	loggingv1 "github.com/openshift/cluster-logging-operator/apis/logging/v1"
 	hyperv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
 
 	hlov1alpha1 "github.com/openshift/hypershift-logging-operator/api/v1alpha1"
 	"github.com/openshift/hypershift-logging-operator/pkg/clusterlogforwarder"
+	"github.com/openshift/hypershift-logging-operator/pkg/collector"
 	"github.com/openshift/hypershift-logging-operator/pkg/constants"
+	hloerrors "github.com/openshift/hypershift-logging-operator/pkg/errors"
 	"github.com/openshift/hypershift-logging-operator/pkg/hostedcluster"
+	"github.com/openshift/hypershift-logging-operator/pkg/metrics"
+	"github.com/openshift/hypershift-logging-operator/pkg/selftest"
 )
 
+const controllerName = "clusterlogforwardertemplate-controller"
+
 // ClusterLogForwarderTemplateReconciler reconciles a ClusterLogForwarderTemplate object
 type ClusterLogForwarderTemplateReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
-	log    logr.Logger
+	// CommonMetadata is stamped on all the generated CLFs
+	CommonMetadata clusterlogforwarder.CommonMetadata
+	// Limits caps the CLFs rendered from the templates
+	Limits clusterlogforwarder.Limits
+	// RejectOrphanedOutputs rejects the templates with outputs referenced by no pipeline,
+	// they are only reported on the template status otherwise
+	RejectOrphanedOutputs bool
+	// Strict fails the apply of a hosted cluster whose CLF would be applied best-effort: with template tokens
+	// without value, without the options the cluster-logging version does not support, or with output secrets
+	// neither in the template namespace nor used by reference. It also rejects the orphaned outputs
+	Strict bool
+	// Values are substituted into the template tokens of all the hosted clusters,
+	// they take precedence over the values of the hosted control planes
+	Values map[string]string
+	// EventRouterImage is the image of the event router forwarding the guest cluster events,
+	// DefaultEventRouterImage if empty
+	EventRouterImage string
+	// LoggingVersion is the version of the cluster-logging operator collecting the logs of the hosted
+	// control planes, the options it does not support are not rendered. It is overridden by the version detected
+	// in each guest cluster, recorded on its HostedCluster. The latest version is assumed if empty
+	LoggingVersion string
+	// Paused pauses the reconciliation of all the templates, the generated resources are left untouched.
+	// The reconciliation is also paused by the PauseConfigMapName ConfigMap of the operator namespace
+	Paused bool
+	// PropagationWorkers is the number of hosted clusters the secrets and the CLF of a template are propagated to
+	// concurrently, so that a rotated secret shared by many hosted clusters does not spike the API load. 1 if not set
+	PropagationWorkers int
+	// SelfTester injects and queries the marker logs of the templates enabling the self-test of their log delivery,
+	// the self-tests are not run if nil
+	SelfTester selftest.Tester
+	// DeliveryErrors reads the delivery errors of the outputs, e.g. the records rejected by the backend, from the
+	// collectors of the accepted CLFs on every reconcile. They are not read if nil
+	DeliveryErrors collector.ErrorReader
+	// SecretNamespaces are the namespaces the output secrets are copied from besides the template namespace,
+	// e.g. the namespaces of the teams storing their own credentials. The secret of an output is read from the
+	// template namespace then from the secret namespaces in order, unless the output sets its own secret namespace
+	SecretNamespaces []string
+	// ResyncInterval is how often the templates are reconciled again, so that the propagated secrets deleted
+	// out-of-band while not watched, e.g. during a restart of the operator, are recreated. Not resynced if 0
+	ResyncInterval time.Duration
+	// DisabledLabel set to "true" on a HostedCluster removes the CLFs of all the templates from its HCP namespace
+	// and keeps them from being applied. Not checked if empty
+	DisabledLabel string
+	// HostedClusterCache is the cache the HostedClusters are read and watched from, shared with the HostedCluster
+	// controller so that it is scoped to the same namespaces. The cache of the manager is used if nil
+	HostedClusterCache cache.Cache
+	log                logr.Logger
 }
 
 //+kubebuilder:rbac:groups=logging.managed.openshift.io,resources=clusterlogforwardertemplates,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=logging.managed.openshift.io,resources=clusterlogforwardertemplates/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=logging.managed.openshift.io,resources=clusterlogforwardertemplates/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;delete
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;delete;deletecollection
+//+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;delete;deletecollection
+//+kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=roles;rolebindings,verbs=get;list;watch;create;update;delete;deletecollection
+//+kubebuilder:rbac:groups=logging.openshift.io,resources=logs,resourceNames=audit,verbs=collect
+//+kubebuilder:rbac:groups=logging.openshift.io,resources=clusterlogforwarders,verbs=get;list;watch;create;update;delete;deletecollection
+//+kubebuilder:rbac:groups=hypershift.openshift.io,resources=hostedcontrolplanes,verbs=get;list;watch
+//+kubebuilder:rbac:groups=coordination.k8s.io,namespace=openshift-hypershift-logging-operator,resources=leases,verbs=get;list;watch;create;update
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -58,6 +132,14 @@ func (r *ClusterLogForwarderTemplateReconciler) Reconcile(
 ) (ctrl.Result, error) {
 	r.log = ctrllog.FromContext(ctx).WithName("controller")
 
+	// The pause state failing to be read does not block the reconciliation, it is read again by the next one
+	if paused, err := hostedcluster.IsPaused(ctx, r.Client, r.Paused); err != nil {
+		r.log.Error(err, "failed to read the pause state", "Name", req.Name)
+	} else if paused {
+		r.log.V(1).Info("reconciliation paused", "Name", req.Name)
+		return ctrl.Result{RequeueAfter: constants.PausedRequeueInterval}, nil
+	}
+
 	hcpList, err := hostedcluster.GetHostedControlPlanes(r.Client, ctx, false)
 	if err != nil {
 		return ctrl.Result{}, err
@@ -72,88 +154,703 @@ func (r *ClusterLogForwarderTemplateReconciler) Reconcile(
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
-	deletion := false
+	deletion := !template.ObjectMeta.DeletionTimestamp.IsZero()
 
-	if !template.ObjectMeta.DeletionTimestamp.IsZero() {
-		deletion = true
-		controllerutil.RemoveFinalizer(template, constants.ManagedLoggingFinalizer)
+	if !deletion && !controllerutil.ContainsFinalizer(template, constants.ManagedLoggingFinalizer) {
+		controllerutil.AddFinalizer(template, constants.ManagedLoggingFinalizer)
 		err = r.Client.Update(ctx, template)
 		if err != nil {
 			return ctrl.Result{}, err
 		}
-	} else {
-		controllerutil.AddFinalizer(template, constants.ManagedLoggingFinalizer)
-		err = r.Client.Update(ctx, template)
+	}
+
+	if !deletion {
+		if err := r.validateTemplate(template); err != nil {
+			r.log.Error(err, "invalid template", "Name", template.Name)
+			observeRenderError(err)
+			r.updateStatus(ctx, template, 0, nil, nil, nil, hlov1alpha1.InvalidTemplateReason, err)
+			return resultFor(err)
+		}
+		// The CA bundle is checked before any propagation, so that an invalid bundle rejects the template
+		if _, err := r.caBundleSecret(ctx, template); goerrors.Is(err, hloerrors.ErrInvalidTemplate) {
+			r.log.Error(err, "invalid CA bundle", "Name", template.Name)
+			observeRenderError(err)
+			r.updateStatus(ctx, template, 0, nil, nil, nil, hlov1alpha1.InvalidTemplateReason, err)
+			return resultFor(err)
+		} else if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	applied := int32(0)
+	var unmanaged, conflicts, pending, accepted []string
+	for i, result := range r.reconcileHostedControlPlanes(ctx, template, hcpList, deletion) {
+		hcp := &hcpList[i]
+		outcome, err := result.outcome, result.err
+		switch outcome {
+		case hcpApplyFailed:
+			metrics.ObserveClusterReconcile(hcp.Namespace, err)
+			r.log.Error(err, "failed to apply the CLF", "Name", template.Name, "Namespace", hcp.Namespace)
+			observeRenderError(err)
+			reason := hlov1alpha1.ApplyFailedReason
+			if goerrors.Is(err, hloerrors.ErrStrictValidation) {
+				reason = hlov1alpha1.StrictValidationFailedReason
+			}
+			r.updateStatus(ctx, template, applied, unmanaged, conflicts, pending, reason, err)
+			return resultFor(err)
+		case hcpUnmanaged:
+			unmanaged = append(unmanaged, hcp.Namespace)
+		case hcpConflict:
+			conflicts = append(conflicts, hcp.Namespace)
+		case hcpApplied:
+			metrics.ObserveClusterReconcile(hcp.Namespace, nil)
+			applied++
+			accepted = append(accepted, hcp.Namespace)
+		case hcpPending:
+			metrics.ObserveClusterReconcile(hcp.Namespace, nil)
+			applied++
+			pending = append(pending, hcp.Namespace)
+		}
 		if err != nil {
 			return ctrl.Result{}, err
 		}
 	}
 
-	for _, hcp := range hcpList {
+	if deletion {
+		metrics.ForgetTemplate(template.Name)
+		// The finalizer is removed once the template is cleaned up from every hosted control plane, a failed
+		// cleanup returns above and is retried
+		if controllerutil.ContainsFinalizer(template, constants.ManagedLoggingFinalizer) {
+			controllerutil.RemoveFinalizer(template, constants.ManagedLoggingFinalizer)
+			if err := r.Client.Update(ctx, template); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+	} else {
+		metrics.SetTemplatePendingApplies(template.Name, len(pending))
+		r.updateStatus(ctx, template, applied, unmanaged, conflicts, pending, hlov1alpha1.AppliedReason, nil)
+		r.reconcileDeliveryErrors(ctx, template, accepted)
+		requeue := r.reconcileSelfTest(ctx, template, accepted)
+		if r.ResyncInterval > 0 && (requeue == 0 || r.ResyncInterval < requeue) {
+			requeue = r.ResyncInterval
+		}
+		return ctrl.Result{RequeueAfter: requeue}, nil
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// validateTemplate returns an ErrInvalidTemplate error if the template cannot be rendered, or is rejected
+// by the limits and the options of the operator
+func (r *ClusterLogForwarderTemplateReconciler) validateTemplate(template *hlov1alpha1.ClusterLogForwarderTemplate) error {
+	if err := clusterlogforwarder.ValidateTemplate(template); err != nil {
+		return hloerrors.Wrap(hloerrors.ErrInvalidTemplate, err)
+	}
+	if err := clusterlogforwarder.ValidateLimits(template, r.Limits); err != nil {
+		return hloerrors.Wrap(hloerrors.ErrInvalidTemplate, err)
+	}
+	if err := clusterlogforwarder.ValidateCollectorType(template, r.LoggingVersion); err != nil {
+		return hloerrors.Wrap(hloerrors.ErrInvalidTemplate, err)
+	}
+	if err := clusterlogforwarder.ValidateNetworkLogs(template, r.LoggingVersion); err != nil {
+		return hloerrors.Wrap(hloerrors.ErrInvalidTemplate, err)
+	}
+	if err := clusterlogforwarder.ValidateSecretNamespaces(template, r.SecretNamespaces); err != nil {
+		return hloerrors.Wrap(hloerrors.ErrInvalidTemplate, err)
+	}
+	if r.RejectOrphanedOutputs || r.Strict {
+		if err := clusterlogforwarder.ValidateOrphanedOutputs(template); err != nil {
+			return hloerrors.Wrap(hloerrors.ErrInvalidTemplate, err)
+		}
+	}
+	return nil
+}
+
+// observeRenderError counts the error in the render errors of its reason, the errors of the API or of the cluster
+// failing the apply are not render errors
+func observeRenderError(err error) {
+	switch {
+	case goerrors.Is(err, hloerrors.ErrInterpolation):
+		metrics.ObserveTemplateRenderError(metrics.InterpolationRenderError)
+	case goerrors.Is(err, hloerrors.ErrMergeConflict):
+		metrics.ObserveTemplateRenderError(metrics.MergeConflictRenderError)
+	case hloerrors.IsTerminal(err):
+		metrics.ObserveTemplateRenderError(metrics.ValidationRenderError)
+	}
+}
+
+// resultFor returns the result of a failed reconcile, the transient errors are requeued. The terminal ones are not,
+// they are reported on the template status and the change of the template triggers the next reconcile
+func resultFor(err error) (ctrl.Result, error) {
+	if hloerrors.IsTerminal(err) {
+		return ctrl.Result{}, nil
+	}
+	return ctrl.Result{}, err
+}
+
+// appliesTo returns true if the template is applied to the hosted control plane. A default template is applied
+// to the ready hosted control planes not opted out with the SkipDefaultTemplatesAnnotation, the others to every one
+func appliesTo(template *hlov1alpha1.ClusterLogForwarderTemplate, hcp *hyperv1beta1.HostedControlPlane) bool {
+	if !template.Spec.Default {
+		return true
+	}
+	return hcp.Status.Ready && hcp.Annotations[constants.SkipDefaultTemplatesAnnotation] != "true"
+}
+
+// hcpOutcome is the result of the reconcile of a template for a hosted control plane
+type hcpOutcome int
 
-		// Declare the CLF resource in each iteration
-		clf := &loggingv1.ClusterLogForwarder{}
+const (
+	hcpDeleted hcpOutcome = iota
+	hcpUnmanaged
+	// hcpConflict is the outcome of a CLF of the generated name not generated from the template, left intact
+	hcpConflict
+	hcpApplied
+	// hcpPending is the outcome of the CLF applied but not yet accepted by cluster-logging
+	hcpPending
+	hcpApplyFailed
+	// hcpSkipped is the outcome of the hosted control planes left once the reconcile of another one failed
+	hcpSkipped
+)
+
+// hcpResult is the outcome and the error of the reconcile of a template for a hosted control plane
+type hcpResult struct {
+	outcome hcpOutcome
+	err     error
+}
 
-		found := false
-		err = r.Get(ctx, types.NamespacedName{Name: req.Name, Namespace: hcp.Namespace}, clf)
+// reconcileHostedControlPlanes reconciles the template for the hosted control planes with PropagationWorkers
+// workers and returns the results in the order of the hosted control planes. Once a reconcile fails, the hosted
+// control planes not reconciled yet are skipped, they are reconciled by the retry
+func (r *ClusterLogForwarderTemplateReconciler) reconcileHostedControlPlanes(
+	ctx context.Context,
+	template *hlov1alpha1.ClusterLogForwarderTemplate,
+	hcps []hyperv1beta1.HostedControlPlane,
+	deletion bool,
+) []hcpResult {
+	results := make([]hcpResult, len(hcps))
+	workers := r.PropagationWorkers
+	if workers < 1 {
+		workers = 1
+	}
+
+	var failed atomic.Bool
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < len(hcps); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if failed.Load() {
+					results[i] = hcpResult{outcome: hcpSkipped}
+					continue
+				}
+				hcp := &hcps[i]
+				// The default templates are removed from the hosted clusters they no longer apply to, all the
+				// templates from the hosted clusters excluded from logging
+				outcome := hcpDeleted
+				disabled, err := r.loggingDisabled(ctx, hcp)
+				if err == nil {
+					outcome, err = r.reconcileHostedControlPlane(ctx, template, hcp, deletion || disabled || !appliesTo(template, hcp))
+				}
+				if err != nil {
+					failed.Store(true)
+				}
+				results[i] = hcpResult{outcome: outcome, err: err}
+			}
+		}()
+	}
+	for i := range hcps {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return results
+}
+
+// reconcileHostedControlPlane applies the CLF of the template in the HCP namespace, or deletes it along with
+// the resources generated from the template when the template is being deleted or does not apply to the cluster. The CLFs of the hosted cluster
+// are locked meanwhile, so that they are not written concurrently by the HyperShiftLogForwarder controller
+func (r *ClusterLogForwarderTemplateReconciler) reconcileHostedControlPlane(
+	ctx context.Context,
+	template *hlov1alpha1.ClusterLogForwarderTemplate,
+	hcp *hyperv1beta1.HostedControlPlane,
+	deletion bool,
+) (hcpOutcome, error) {
+	defer hostedcluster.LockCluster(hcp.Namespace)()
+
+	// Declare the CLF resource for each hosted control plane, the shadow CLF is applied instead in shadow mode
+	clf := &loggingv1.ClusterLogForwarder{}
+	shadow := !deletion && isShadow(template)
+
+	// The CLFs generated under a name failing to render are still cleaned up by their labels
+	name, err := r.clfName(ctx, template, hcp, shadow)
+	if err != nil && !deletion {
+		return hcpApplyFailed, err
+	}
+	found := false
+	if name != "" {
+		err = r.Get(ctx, types.NamespacedName{Name: name, Namespace: hcp.Namespace}, clf)
 		if errors.IsNotFound(err) {
 			found = false
 		} else if err != nil {
-			return ctrl.Result{}, err
+			return hcpDeleted, err
 		} else {
 			found = true
 		}
-		// If CLFT is deleted, and the CLF exists in the HCP namespace, do clean up
-		if deletion && found {
-			err = r.Delete(ctx, clf)
-			if err != nil {
-				return ctrl.Result{}, err
+	}
+	// The CLF annotated as unmanaged is left intact along with the secret copies it reads, the other resources
+	// generated from the template are still cleaned up
+	if found && clusterlogforwarder.IsUnmanaged(clf) {
+		r.log.V(1).Info("skip unmanaged CLF", "Name", clf.Name, "Namespace", clf.Namespace)
+		if deletion {
+			return hcpUnmanaged, r.deleteGenerated(ctx, template, hcp.Namespace)
+		}
+		return hcpUnmanaged, nil
+	}
+	// The CLF of the same name not generated from the template, e.g. created by hand or generated from another
+	// template, is never overwritten nor deleted
+	foreign := found && !isGeneratedFrom(clf, template)
+	if foreign && !deletion {
+		r.log.Info("skip CLF not generated from the template", "Name", clf.Name, "Namespace", clf.Namespace,
+			"Template", template.Name)
+		return hcpConflict, nil
+	}
+	// If CLFT is deleted or does not apply, clean up every CLF generated from it in the HCP namespace
+	if deletion {
+		if found && !foreign {
+			if err := r.Delete(ctx, clf); err != nil {
+				return hcpDeleted, err
 			}
 		}
+		err = r.DeleteAllOf(ctx, &loggingv1.ClusterLogForwarder{},
+			client.InNamespace(hcp.Namespace),
+			client.MatchingLabels(clusterlogforwarder.ManagedLabels(constants.TemplateLabel, template.Name)),
+		)
+		if err != nil {
+			return hcpDeleted, err
+		}
+		if err := r.releaseSecrets(ctx, template, hcp.Namespace); err != nil {
+			return hcpDeleted, err
+		}
+		return hcpDeleted, r.deleteGenerated(ctx, template, hcp.Namespace)
+	}
 
-		// If CLFT is not deleting, recreate the CLF in the HCP namespace
-		if !deletion {
-			r.log.V(1).Info("Status", "Deletion", false, "Found", found)
+	// If CLFT is not deleting, recreate the CLF in the HCP namespace
+	r.log.V(1).Info("Status", "Deletion", false, "Found", found)
+	accepted, err := r.applyClusterLogForwarder(ctx, template, hcp, clf, name, found, shadow)
+	if err != nil {
+		return hcpApplyFailed, err
+	}
+	if err := r.deleteStaleClusterLogForwarders(ctx, template, hcp.Namespace, name, shadow); err != nil {
+		return hcpApplyFailed, err
+	}
+	if !accepted {
+		return hcpPending, nil
+	}
+	return hcpApplied, nil
+}
 
-			// Build the CLF from the current template
-			newClf := r.buildClusterLogForwarder(template, hcp.Namespace)
+// deleteGenerated deletes the resources generated from the template in the HCP namespace besides the CLF and the
+// secret copies, i.e. the event router, the export and the audit RBAC
+func (r *ClusterLogForwarderTemplateReconciler) deleteGenerated(
+	ctx context.Context,
+	template *hlov1alpha1.ClusterLogForwarderTemplate,
+	namespace string,
+) error {
+	if err := r.deleteEventRouter(ctx, template, namespace); err != nil {
+		return err
+	}
+	if err := r.deleteExport(ctx, template, namespace); err != nil {
+		return err
+	}
+	return r.deleteAuditRBAC(ctx, template, namespace)
+}
 
-			if found {
-				// If the existing CLF is the same as the new one, skip
-				if reflect.DeepEqual(newClf.Spec, clf.Spec) {
-					continue
-				} else {
-					// If the existing CLF is not the same as the new built one, delete existing
-					err = r.Delete(ctx, clf)
-					if err != nil {
-						return ctrl.Result{}, err
-					}
-				}
-			}
-			err = r.Create(ctx, newClf)
-			if err != nil {
-				return ctrl.Result{}, err
-			}
+// isShadow returns true if the template is applied to its shadow CLF, annotated with ShadowAnnotation
+func isShadow(template *hlov1alpha1.ClusterLogForwarderTemplate) bool {
+	return template.Annotations[constants.ShadowAnnotation] == "true"
+}
+
+// clfName returns the name of the CLF generated from the template for the hosted cluster, the ClusterLogForwarderName
+// of the template rendered with the values of the cluster or the name of the template, with ShadowSuffix for the
+// shadow CLF if shadow is set
+func (r *ClusterLogForwarderTemplateReconciler) clfName(
+	ctx context.Context,
+	template *hlov1alpha1.ClusterLogForwarderTemplate,
+	hcp *hyperv1beta1.HostedControlPlane,
+	shadow bool,
+) (string, error) {
+	name := template.Name
+	if template.Spec.ClusterLogForwarderName != "" {
+		values, err := r.templateValues(ctx, hcp)
+		if err != nil {
+			return "", err
+		}
+		name, err = clusterlogforwarder.RenderName(template.Spec.ClusterLogForwarderName, values)
+		if err != nil {
+			return "", hloerrors.Wrap(hloerrors.ErrInvalidTemplate, hloerrors.Wrap(hloerrors.ErrInterpolation, err))
 		}
 	}
+	if shadow {
+		name += constants.ShadowSuffix
+	}
+	return name, nil
+}
 
-	return ctrl.Result{}, nil
+// isGeneratedFrom returns true if the CLF is managed by the operator and generated from the template
+func isGeneratedFrom(clf *loggingv1.ClusterLogForwarder, template *hlov1alpha1.ClusterLogForwarderTemplate) bool {
+	name, ok := clusterlogforwarder.SourceName(clf, constants.TemplateLabel)
+	return ok && name == template.Name
+}
+
+// deleteStaleClusterLogForwarders deletes the CLFs generated from the template left in the namespace besides the
+// applied one, e.g. under the previous name of the CLF or the shadow CLF once the shadow mode is turned off. The CLF
+// of the template is kept while its shadow CLF is applied, the unmanaged ones are left intact
+func (r *ClusterLogForwarderTemplateReconciler) deleteStaleClusterLogForwarders(
+	ctx context.Context,
+	template *hlov1alpha1.ClusterLogForwarderTemplate,
+	namespace string,
+	applied string,
+	shadow bool,
+) error {
+	clfList := &loggingv1.ClusterLogForwarderList{}
+	if err := r.List(ctx, clfList,
+		client.InNamespace(namespace),
+		client.MatchingLabels(clusterlogforwarder.ManagedLabels(constants.TemplateLabel, template.Name)),
+	); err != nil {
+		return err
+	}
+	for i := range clfList.Items {
+		clf := &clfList.Items[i]
+		if clf.Name == applied || clusterlogforwarder.IsUnmanaged(clf) || (shadow && clf.Labels[constants.ShadowLabel] != "true") {
+			continue
+		}
+		if err := r.Delete(ctx, clf); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// generatedClusterLogForwarder returns the CLF generated from the template in the namespace, not its shadow CLF
+func (r *ClusterLogForwarderTemplateReconciler) generatedClusterLogForwarder(
+	ctx context.Context,
+	template *hlov1alpha1.ClusterLogForwarderTemplate,
+	namespace string,
+) (*loggingv1.ClusterLogForwarder, error) {
+	clfList := &loggingv1.ClusterLogForwarderList{}
+	if err := r.List(ctx, clfList,
+		client.InNamespace(namespace),
+		client.MatchingLabels(clusterlogforwarder.ManagedLabels(constants.TemplateLabel, template.Name)),
+	); err != nil {
+		return nil, err
+	}
+	for i := range clfList.Items {
+		if clfList.Items[i].Labels[constants.ShadowLabel] != "true" {
+			return &clfList.Items[i], nil
+		}
+	}
+	return nil, errors.NewNotFound(loggingv1.GroupVersion.WithResource("clusterlogforwarders").GroupResource(), template.Name)
+}
+
+// applyClusterLogForwarder builds the CLF from the template and applies it under the name in the HCP namespace,
+// as the shadow CLF of the template if shadow is set
+func (r *ClusterLogForwarderTemplateReconciler) applyClusterLogForwarder(
+	ctx context.Context,
+	template *hlov1alpha1.ClusterLogForwarderTemplate,
+	hcp *hyperv1beta1.HostedControlPlane,
+	clf *loggingv1.ClusterLogForwarder,
+	name string,
+	found bool,
+	shadow bool,
+) (bool, error) {
+	// Build the CLF from the current template, tuned for the environment of the hosted cluster
+	environment, err := r.environment(ctx, hcp)
+	if err != nil {
+		return false, err
+	}
+	tuned := clusterlogforwarder.ForEnvironment(template, environment)
+	// The CLF is rendered for the cluster-logging version of the hosted cluster, and rendered again once upgraded
+	loggingVersion, err := r.loggingVersion(ctx, hcp)
+	if err != nil {
+		return false, err
+	}
+	newClf, err := r.buildClusterLogForwarder(tuned, hcp, loggingVersion)
+	if err != nil {
+		return false, hloerrors.Wrap(hloerrors.ErrInvalidTemplate, err)
+	}
+	newClf.Name = name
+	if shadow {
+		newClf.Labels[constants.ShadowLabel] = "true"
+	}
+
+	// Substitute the values of the cluster into the template tokens
+	values, err := r.templateValues(ctx, hcp)
+	if err != nil {
+		return false, err
+	}
+	newClf, missing, err := clusterlogforwarder.SubstituteValues(newClf, values)
+	if err != nil {
+		return false, hloerrors.Wrap(hloerrors.ErrInvalidTemplate, hloerrors.Wrap(hloerrors.ErrInterpolation, err))
+	}
+	if len(missing) > 0 {
+		if r.Strict {
+			return false, hloerrors.Wrap(hloerrors.ErrStrictValidation, hloerrors.Wrap(hloerrors.ErrInterpolation,
+				fmt.Errorf("template tokens without value in %s: %s", hcp.Namespace, strings.Join(missing, ", "))))
+		}
+		r.log.Info("template tokens without value are left intact", "Name", template.Name,
+			"Namespace", hcp.Namespace, "Keys", missing)
+	}
+	if err := clusterlogforwarder.ValidateSubstitutedURLs(newClf.Spec.Outputs); err != nil {
+		return false, hloerrors.Wrap(hloerrors.ErrInvalidTemplate, hloerrors.Wrap(hloerrors.ErrInterpolation, err))
+	}
+	// The size is measured once rendered, with the platform outputs and the values of the hosted cluster
+	if err := clusterlogforwarder.ValidateSize(newClf, r.Limits); err != nil {
+		return false, hloerrors.Wrap(hloerrors.ErrInvalidTemplate, err)
+	}
+
+	// Tie the CLF to the HCP so it is garbage-collected along with the hosted cluster
+	if err = controllerutil.SetOwnerReference(hcp, newClf, r.Scheme); err != nil {
+		return false, err
+	}
+
+	// The secrets are refreshed even if the CLF is up to date
+	if err = r.propagateSecrets(ctx, tuned, hcp, newClf); err != nil {
+		return false, err
+	}
+	// The event router, the audit RBAC, the export and the secret copies are shared with the CLF of the template,
+	// the shadow CLF leaves them as the CLF needs them
+	if !shadow {
+		if err = r.deleteStaleSecrets(ctx, tuned, hcp, newClf); err != nil {
+			return false, err
+		}
+		if err = r.applyEventRouter(ctx, template, hcp, newClf); err != nil {
+			return false, err
+		}
+		if err = r.applyAuditRBAC(ctx, template, hcp, newClf); err != nil {
+			return false, err
+		}
+		if err = r.applyExport(ctx, template, hcp, newClf); err != nil {
+			return false, err
+		}
+	}
+
+	if found {
+		// If the existing CLF is the same as the new one, skip
+		if clusterlogforwarder.IsUpToDate(clf, newClf) {
+			return clusterlogforwarder.IsReady(clf), nil
+		} else if reflect.DeepEqual(clf.Spec, newClf.Spec) {
+			// Only the metadata changed, update it in place
+			clusterlogforwarder.MergeMetadata(clf, newClf)
+			clusterlogforwarder.StampLastAppliedTime(clf)
+			return clusterlogforwarder.IsReady(clf), r.Update(ctx, clf)
+		}
+		// If the existing CLF is not the same as the new built one, delete existing
+		if err = r.Delete(ctx, clf); err != nil {
+			return false, err
+		}
+	}
+	// The CLF created is pending until cluster-logging accepts it
+	clusterlogforwarder.StampLastAppliedTime(newClf)
+	return false, r.Create(ctx, newClf)
+}
+
+// templateValues returns the values of the cluster substituted into the templates. The values of the hosted
+// control plane, e.g. its region, are overridden by the values of the operator, themselves overridden by the
+// values of the ConfigMap in the HCP namespace
+func (r *ClusterLogForwarderTemplateReconciler) templateValues(ctx context.Context, hcp *hyperv1beta1.HostedControlPlane) (map[string]string, error) {
+	cm := &corev1.ConfigMap{}
+	err := r.Get(ctx, types.NamespacedName{Name: constants.TemplateValuesConfigMapName, Namespace: hcp.Namespace}, cm)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to get the template values: %w", err)
+	}
+	return clusterlogforwarder.MergeValues(hostedcluster.TemplateValues(hcp), r.Values, cm.Data), nil
+}
+
+// updateStatus records the applied clusters, the unmanaged and the conflicting ClusterLogForwarders, the orphaned outputs, the readiness
+// of the template, whether it renders and whether its ClusterLogForwarders are accepted through the status subresource,
+// the status is only written when it changed
+func (r *ClusterLogForwarderTemplateReconciler) updateStatus(
+	ctx context.Context,
+	template *hlov1alpha1.ClusterLogForwarderTemplate,
+	applied int32,
+	unmanaged []string,
+	conflicts []string,
+	pending []string,
+	reason string,
+	reconcileErr error,
+) {
+	status := template.Status.DeepCopy()
+	status.AppliedClusters = applied
+	status.ObservedGeneration = template.Generation
+
+	condition := metav1.Condition{
+		Type:               hlov1alpha1.ReadyCondition,
+		Status:             metav1.ConditionTrue,
+		Reason:             reason,
+		Message:            fmt.Sprintf("applied to %d hosted clusters", applied),
+		ObservedGeneration: template.Generation,
+	}
+	if reconcileErr != nil {
+		condition.Status = metav1.ConditionFalse
+		condition.Message = reconcileErr.Error()
+	}
+	meta.SetStatusCondition(&status.Conditions, condition)
+
+	// The template renders unless it is invalid, the CLFs rendered are then applied and accepted
+	// by cluster-logging for each hosted cluster
+	rendered := metav1.Condition{
+		Type:               hlov1alpha1.RenderedCondition,
+		Status:             metav1.ConditionTrue,
+		Reason:             hlov1alpha1.RenderedReason,
+		Message:            "the template renders into a valid ClusterLogForwarder",
+		ObservedGeneration: template.Generation,
+	}
+	// The CLFs applied include the ones pending acceptance
+	accepted := int(applied) - len(pending)
+	appliedToGuest := metav1.Condition{
+		Type:               hlov1alpha1.AppliedToGuestCondition,
+		Status:             metav1.ConditionTrue,
+		Reason:             hlov1alpha1.AcceptedReason,
+		Message:            fmt.Sprintf("accepted by %d hosted clusters", accepted),
+		ObservedGeneration: template.Generation,
+	}
+	switch {
+	case reason == hlov1alpha1.InvalidTemplateReason:
+		rendered.Status, rendered.Reason, rendered.Message = metav1.ConditionFalse, reason, reconcileErr.Error()
+		appliedToGuest.Status, appliedToGuest.Reason, appliedToGuest.Message = metav1.ConditionFalse, reason, "the template is not rendered"
+	case reconcileErr != nil:
+		appliedToGuest.Status, appliedToGuest.Reason, appliedToGuest.Message = metav1.ConditionFalse, reason, reconcileErr.Error()
+	case len(pending) > 0:
+		appliedToGuest.Status, appliedToGuest.Reason = metav1.ConditionFalse, hlov1alpha1.PendingReason
+		appliedToGuest.Message = fmt.Sprintf("accepted by %d hosted clusters, pending acceptance by %d in namespaces: %s",
+			accepted, len(pending), strings.Join(pending, ", "))
+	}
+	meta.SetStatusCondition(&status.Conditions, rendered)
+	meta.SetStatusCondition(&status.Conditions, appliedToGuest)
+
+	if len(unmanaged) > 0 {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               hlov1alpha1.UnmanagedCondition,
+			Status:             metav1.ConditionTrue,
+			Reason:             hlov1alpha1.UnmanagedAnnotationReason,
+			Message:            fmt.Sprintf("unmanaged ClusterLogForwarders in namespaces: %s", strings.Join(unmanaged, ", ")),
+			ObservedGeneration: template.Generation,
+		})
+	} else {
+		meta.RemoveStatusCondition(&status.Conditions, hlov1alpha1.UnmanagedCondition)
+	}
+
+	if len(conflicts) > 0 {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               hlov1alpha1.NameConflictCondition,
+			Status:             metav1.ConditionTrue,
+			Reason:             hlov1alpha1.ForeignClusterLogForwarderReason,
+			Message:            fmt.Sprintf("ClusterLogForwarders not generated from the template in namespaces: %s", strings.Join(conflicts, ", ")),
+			ObservedGeneration: template.Generation,
+		})
+	} else {
+		meta.RemoveStatusCondition(&status.Conditions, hlov1alpha1.NameConflictCondition)
+	}
+
+	if orphaned := clusterlogforwarder.OrphanedOutputs(template); len(orphaned) > 0 {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               hlov1alpha1.OrphanedOutputsCondition,
+			Status:             metav1.ConditionTrue,
+			Reason:             hlov1alpha1.UnreferencedOutputsReason,
+			Message:            fmt.Sprintf("outputs referenced by no pipeline: %s", strings.Join(orphaned, ", ")),
+			ObservedGeneration: template.Generation,
+		})
+	} else {
+		meta.RemoveStatusCondition(&status.Conditions, hlov1alpha1.OrphanedOutputsCondition)
+	}
+
+	if reflect.DeepEqual(*status, template.Status) {
+		return
+	}
+
+	now := metav1.Now()
+	status.LastUpdateTime = &now
+	template.Status = *status
+	if err := r.Status().Update(ctx, template); err != nil {
+		r.log.Error(err, "failed to update the template status", "Name", template.Name)
+	}
 }
 
 func (r *ClusterLogForwarderTemplateReconciler) buildClusterLogForwarder(template *hlov1alpha1.ClusterLogForwarderTemplate,
-	ns string) *loggingv1.ClusterLogForwarder {
+	hcp *hyperv1beta1.HostedControlPlane, loggingVersion string) (*loggingv1.ClusterLogForwarder, error) {
 
 	clf := &loggingv1.ClusterLogForwarder{}
 
 	clf.Name = template.Name
-	clf.Namespace = ns
+	clf.Namespace = hcp.Namespace
+	clf.Labels = clusterlogforwarder.ManagedLabels(constants.TemplateLabel, template.Name)
+	clusterlogforwarder.SetAuditAnnotations(clf,
+		fmt.Sprintf("ClusterLogForwarderTemplate/%s/%s", template.Namespace, template.Name),
+		template.Generation,
+		controllerName,
+	)
+	r.CommonMetadata.Apply(clf)
+	if loggingVersion != "" {
+		clf.Annotations[constants.LoggingVersionAnnotation] = loggingVersion
+	}
+	// The collector runs with the service account of the template, granted the audit logs by applyAuditRBAC
+	clf.Spec.ServiceAccountName = template.Spec.Template.ServiceAccountName
 
 	clf = clusterlogforwarder.BuildInputsFromTemplate(template, clf)
 	clf = clusterlogforwarder.BuildOutputsFromTemplate(template, clf)
+	clf, err := clusterlogforwarder.BuildPlatformOutputsFromTemplate(template, clf, string(hcp.Spec.Platform.Type))
+	if err != nil {
+		return nil, err
+	}
 	clf = clusterlogforwarder.BuildPipelinesFromTemplate(template, clf)
+	clf = clusterlogforwarder.BuildFallbackOutputsFromTemplate(template, clf)
+	clf = clusterlogforwarder.BuildCABundleFromTemplate(template, clf)
+	clf = clusterlogforwarder.BuildEventsInput(clf, template.Name)
+	clf = clusterlogforwarder.BuildNetworkLogsInput(clf)
+	// The multiline error detection is left out of the CLF on the cluster-logging versions without it
+	if clusterlogforwarder.SupportsMultiline(loggingVersion) {
+		clf, err = clusterlogforwarder.BuildMultilineFromTemplate(template, clf)
+		if err != nil {
+			return nil, err
+		}
+	} else if template.Spec.Multiline != nil && template.Spec.Multiline.Enabled {
+		if r.Strict {
+			return nil, hloerrors.Wrap(hloerrors.ErrStrictValidation, fmt.Errorf(
+				"multiline error detection is not supported by the cluster-logging version %s", loggingVersion))
+		}
+		r.log.Info("multiline error detection is not supported by the cluster-logging version, skipped",
+			"Name", template.Name, "Namespace", hcp.Namespace, "Version", loggingVersion,
+			"MinVersion", clusterlogforwarder.MinMultilineVersion.String())
+	}
 	clf = clusterlogforwarder.BuildFiltersFromTemplate(template, clf)
+	clf, err = clusterlogforwarder.BuildSeverityFiltersFromTemplate(template, clf)
+	if err != nil {
+		return nil, err
+	}
+	clf = clusterlogforwarder.BuildSystemNamespacesFilterFromTemplate(template, clf)
+	clf = clusterlogforwarder.BuildTransformsFromTemplate(template, clf)
+	clf, err = clusterlogforwarder.BuildFilterOrderFromTemplate(template, clf)
+	if err != nil {
+		return nil, err
+	}
+	clf = clusterlogforwarder.BuildCollectorTypeFromTemplate(template, clf)
+	// The collector log level is left out of the CLF on the cluster-logging versions without it
+	if clusterlogforwarder.SupportsCollectorLogLevel(loggingVersion) {
+		clf = clusterlogforwarder.BuildCollectorLogLevelFromTemplate(template, clf)
+	} else if template.Spec.CollectorLogLevel != "" {
+		if r.Strict {
+			return nil, hloerrors.Wrap(hloerrors.ErrStrictValidation, fmt.Errorf(
+				"collector log level is not supported by the cluster-logging version %s", loggingVersion))
+		}
+		r.log.Info("collector log level is not supported by the cluster-logging version, skipped",
+			"Name", template.Name, "Namespace", hcp.Namespace, "Version", loggingVersion,
+			"MinVersion", clusterlogforwarder.MinCollectorLogLevelVersion.String())
+	}
 
-	return clf
+	return clf, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
@@ -161,5 +858,43 @@ func (r *ClusterLogForwarderTemplateReconciler) SetupWithManager(mgr ctrl.Manage
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&hlov1alpha1.ClusterLogForwarderTemplate{}).
 		Watches(&source.Kind{Type: &hyperv1beta1.HostedControlPlane{}}, &enqueueRequestForHostedControlPlane{Client: mgr.GetClient()}).
+		Watches(&source.Kind{Type: &corev1.Secret{}}, handler.EnqueueRequestsFromMapFunc(r.templatesForSecret),
+			builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+				return obj.GetNamespace() == constants.OperatorNamespace || r.isSecretNamespace(obj.GetNamespace())
+			}))).
+		Watches(&source.Kind{Type: &corev1.ConfigMap{}}, handler.EnqueueRequestsFromMapFunc(r.templatesForConfigMap),
+			builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+				return obj.GetNamespace() == constants.OperatorNamespace
+			}))).
+		Watches(r.hostedClusterSource(), &enqueueRequestForHostedCluster{r: r}).
+		// The propagated secrets deleted out-of-band are propagated again
+		Watches(&source.Kind{Type: &corev1.Secret{}}, handler.EnqueueRequestsFromMapFunc(templatesForSecretCopy),
+			builder.WithPredicates(clusterlogforwarder.DeletedPredicate(constants.TemplateLabel))).
+		Watches(&source.Kind{Type: &loggingv1.ClusterLogForwarder{}}, handler.EnqueueRequestsFromMapFunc(templateForGenerated),
+			builder.WithPredicates(predicate.Or(clusterlogforwarder.DeletedPredicate(constants.TemplateLabel),
+				clusterlogforwarder.ReadinessChangedPredicate(constants.TemplateLabel)))).
 		Complete(r)
 }
+
+// templatesForSecretCopy maps a secret copy to all the templates referencing it, the copy deleted by hand is
+// propagated again by every template using it
+func templatesForSecretCopy(obj client.Object) []reconcile.Request {
+	if _, ok := clusterlogforwarder.SourceName(obj, constants.TemplateLabel); !ok {
+		return nil
+	}
+	var reqs []reconcile.Request
+	for _, name := range clusterlogforwarder.SecretReferences(obj) {
+		reqs = append(reqs, reconcile.Request{NamespacedName: types.NamespacedName{Name: name}})
+	}
+	return reqs
+}
+
+// templateForGenerated maps a CLF generated from a template to the template, the CLF deleted by hand is created
+// again and the CLF accepted by cluster-logging is reported in the status of the template
+func templateForGenerated(obj client.Object) []reconcile.Request {
+	name, ok := clusterlogforwarder.SourceName(obj, constants.TemplateLabel)
+	if !ok {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: name}}}
+}
@@ -0,0 +1,94 @@
+package clusterlogforwardertemplate
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	hlov1alpha1 "github.com/openshift/hypershift-logging-operator/api/v1alpha1"
+	"github.com/openshift/hypershift-logging-operator/pkg/metrics"
+)
+
+// reconcileDeliveryErrors reads the delivery errors from the collectors of the accepted CLFs of the template, records
+// them in the delivery errors metric and reports the outputs with errors in the DeliveryErrorsCondition. The
+// collectors whose metrics cannot be read are skipped, so that a collector rolling out does not fail the reconcile
+func (r *ClusterLogForwarderTemplateReconciler) reconcileDeliveryErrors(
+	ctx context.Context,
+	template *hlov1alpha1.ClusterLogForwarderTemplate,
+	accepted []string,
+) {
+	status := template.Status.DeepCopy()
+	if r.DeliveryErrors == nil {
+		meta.RemoveStatusCondition(&status.Conditions, hlov1alpha1.DeliveryErrorsCondition)
+	} else {
+		setDeliveryErrorsCondition(template, status, r.readDeliveryErrors(ctx, template, accepted))
+	}
+
+	if reflect.DeepEqual(*status, template.Status) {
+		return
+	}
+	now := metav1.Now()
+	status.LastUpdateTime = &now
+	template.Status = *status
+	if err := r.Status().Update(ctx, template); err != nil {
+		r.log.Error(err, "failed to update the delivery errors status", "Name", template.Name)
+	}
+}
+
+// readDeliveryErrors returns the outputs with delivery errors of the CLFs of the namespaces as namespace/output,
+// sorted. Only the outputs with errors are listed, not their number, so that the status changes with them only
+func (r *ClusterLogForwarderTemplateReconciler) readDeliveryErrors(
+	ctx context.Context,
+	template *hlov1alpha1.ClusterLogForwarderTemplate,
+	namespaces []string,
+) []string {
+	var failing []string
+	for _, namespace := range namespaces {
+		clf, err := r.generatedClusterLogForwarder(ctx, template, namespace)
+		if err != nil {
+			r.log.Error(err, "failed to get the CLF", "Name", template.Name, "Namespace", namespace)
+			continue
+		}
+		errors, err := r.DeliveryErrors.DeliveryErrors(ctx, clf)
+		if err != nil {
+			r.log.Error(err, "failed to read the delivery errors of the collector", "Name", template.Name, "Namespace", namespace)
+			continue
+		}
+		metrics.SetOutputDeliveryErrors(template.Name, namespace, errors)
+		for output := range errors {
+			failing = append(failing, fmt.Sprintf("%s/%s", namespace, output))
+		}
+	}
+	sort.Strings(failing)
+	return failing
+}
+
+// setDeliveryErrorsCondition reports the outputs with delivery errors, as namespace/output, in the DeliveryErrorsCondition
+func setDeliveryErrorsCondition(
+	template *hlov1alpha1.ClusterLogForwarderTemplate,
+	status *hlov1alpha1.ClusterLogForwarderTemplateStatus,
+	failing []string,
+) {
+	if len(failing) == 0 {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               hlov1alpha1.DeliveryErrorsCondition,
+			Status:             metav1.ConditionFalse,
+			Reason:             hlov1alpha1.NoDeliveryErrorsReason,
+			Message:            "no delivery error reported by the collectors",
+			ObservedGeneration: template.Generation,
+		})
+		return
+	}
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               hlov1alpha1.DeliveryErrorsCondition,
+		Status:             metav1.ConditionTrue,
+		Reason:             hlov1alpha1.RecordsRejectedReason,
+		Message:            fmt.Sprintf("outputs with delivery errors reported by the collectors: %s", strings.Join(failing, ", ")),
+		ObservedGeneration: template.Generation,
+	})
+}
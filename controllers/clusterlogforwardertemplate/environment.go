@@ -0,0 +1,167 @@
+package clusterlogforwardertemplate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	hyperv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	hlov1alpha1 "github.com/openshift/hypershift-logging-operator/api/v1alpha1"
+	"github.com/openshift/hypershift-logging-operator/pkg/constants"
+	"github.com/openshift/hypershift-logging-operator/pkg/hostedcluster"
+)
+
+// environment returns the environment label of the HostedCluster of the HCP, empty if the HCP does not
+// reference its HostedCluster or the HostedCluster is gone
+func (r *ClusterLogForwarderTemplateReconciler) environment(ctx context.Context, hcp *hyperv1beta1.HostedControlPlane) (string, error) {
+	hc, err := r.hostedCluster(ctx, hcp)
+	if hc == nil || err != nil {
+		return "", err
+	}
+	return hc.Labels[constants.EnvironmentLabel], nil
+}
+
+// loggingVersion returns the version of cluster-logging detected in the guest cluster of the HCP, recorded on its
+// HostedCluster, LoggingVersion if it is not detected
+func (r *ClusterLogForwarderTemplateReconciler) loggingVersion(ctx context.Context, hcp *hyperv1beta1.HostedControlPlane) (string, error) {
+	hc, err := r.hostedCluster(ctx, hcp)
+	if err != nil {
+		return "", err
+	}
+	if hc != nil && hc.Annotations[constants.LoggingVersionAnnotation] != "" {
+		return hc.Annotations[constants.LoggingVersionAnnotation], nil
+	}
+	return r.LoggingVersion, nil
+}
+
+// loggingDisabled returns true if the HostedCluster of the HCP is labeled with DisabledLabel, false if the HCP
+// does not reference its HostedCluster or the HostedCluster is gone
+func (r *ClusterLogForwarderTemplateReconciler) loggingDisabled(ctx context.Context, hcp *hyperv1beta1.HostedControlPlane) (bool, error) {
+	if r.DisabledLabel == "" {
+		return false, nil
+	}
+	hc, err := r.hostedCluster(ctx, hcp)
+	if hc == nil || err != nil {
+		return false, err
+	}
+	return hostedcluster.IsLoggingDisabled(hc, r.DisabledLabel), nil
+}
+
+// hostedCluster returns the HostedCluster referenced by the HCP, nil if the HCP does not reference it or it is gone
+func (r *ClusterLogForwarderTemplateReconciler) hostedCluster(
+	ctx context.Context,
+	hcp *hyperv1beta1.HostedControlPlane,
+) (*hyperv1beta1.HostedCluster, error) {
+	namespace, name, found := strings.Cut(hcp.Annotations[constants.HostedClusterAnnotation], "/")
+	if !found || namespace == "" || name == "" {
+		return nil, nil
+	}
+	hc := &hyperv1beta1.HostedCluster{}
+	err := r.hostedClusterReader().Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, hc)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get the hosted cluster %s/%s: %w", namespace, name, err)
+	}
+	return hc, nil
+}
+
+// hostedClusterReader reads the HostedClusters from the cache shared with the HostedCluster controller
+func (r *ClusterLogForwarderTemplateReconciler) hostedClusterReader() client.Reader {
+	if r.HostedClusterCache != nil {
+		return r.HostedClusterCache
+	}
+	return r.Client
+}
+
+// hostedClusterSource watches the HostedClusters from the cache shared with the HostedCluster controller
+func (r *ClusterLogForwarderTemplateReconciler) hostedClusterSource() source.Source {
+	if r.HostedClusterCache != nil {
+		return source.NewKindWithCache(&hyperv1beta1.HostedCluster{}, r.HostedClusterCache)
+	}
+	return &source.Kind{Type: &hyperv1beta1.HostedCluster{}}
+}
+
+var _ handler.EventHandler = &enqueueRequestForHostedCluster{}
+
+// enqueueRequestForHostedCluster enqueues the templates concerned by the labels changed on a HostedCluster, or by
+// its cluster-logging version. The other changes of the HostedCluster are ignored
+type enqueueRequestForHostedCluster struct {
+	r *ClusterLogForwarderTemplateReconciler
+}
+
+func (e *enqueueRequestForHostedCluster) mapAndEnqueue(q workqueue.RateLimitingInterface, oldObj, newObj client.Object) {
+	disabled := loggingDisabledLabel(oldObj, e.r.DisabledLabel) != loggingDisabledLabel(newObj, e.r.DisabledLabel)
+	environment := labelOf(oldObj, constants.EnvironmentLabel) != labelOf(newObj, constants.EnvironmentLabel)
+	upgraded := annotationOf(oldObj, constants.LoggingVersionAnnotation) != annotationOf(newObj, constants.LoggingVersionAnnotation)
+	if !disabled && !environment && !upgraded {
+		return
+	}
+	for _, req := range e.r.templatesForHostedCluster(disabled || upgraded) {
+		q.Add(req)
+	}
+}
+
+func (e *enqueueRequestForHostedCluster) Create(evt event.CreateEvent, q workqueue.RateLimitingInterface) {
+	e.mapAndEnqueue(q, nil, evt.Object)
+}
+
+func (e *enqueueRequestForHostedCluster) Update(evt event.UpdateEvent, q workqueue.RateLimitingInterface) {
+	e.mapAndEnqueue(q, evt.ObjectOld, evt.ObjectNew)
+}
+
+func (e *enqueueRequestForHostedCluster) Delete(evt event.DeleteEvent, q workqueue.RateLimitingInterface) {
+	e.mapAndEnqueue(q, evt.Object, nil)
+}
+
+func (e *enqueueRequestForHostedCluster) Generic(evt event.GenericEvent, q workqueue.RateLimitingInterface) {
+	e.mapAndEnqueue(q, nil, evt.Object)
+}
+
+// labelOf returns the value of the label on the object, empty for a nil object
+func labelOf(obj client.Object, label string) string {
+	if obj == nil {
+		return ""
+	}
+	return obj.GetLabels()[label]
+}
+
+// annotationOf returns the value of the annotation on the object, empty for a nil object
+func annotationOf(obj client.Object, annotation string) string {
+	if obj == nil {
+		return ""
+	}
+	return obj.GetAnnotations()[annotation]
+}
+
+// loggingDisabledLabel returns true if the object is labeled with the disabled label, as IsLoggingDisabled
+func loggingDisabledLabel(obj client.Object, label string) bool {
+	return label != "" && labelOf(obj, label) == "true"
+}
+
+// templatesForHostedCluster maps a HostedCluster to the templates tuned by environment, the CLFs of the
+// templates are rendered again when the environment of the cluster changes. All the templates are mapped
+// when the cluster is labeled or unlabeled with DisabledLabel, their CLFs are removed from the hosted
+// clusters excluded from logging, or when its cluster-logging version changes, their CLFs are rendered again
+func (r *ClusterLogForwarderTemplateReconciler) templatesForHostedCluster(all bool) []reconcile.Request {
+	templateList := &hlov1alpha1.ClusterLogForwarderTemplateList{}
+	if err := r.List(context.TODO(), templateList, client.InNamespace(constants.OperatorNamespace)); err != nil {
+		return nil
+	}
+	var reqs []reconcile.Request
+	for _, template := range templateList.Items {
+		if all || len(template.Spec.Environments) > 0 {
+			reqs = append(reqs, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&template)})
+		}
+	}
+	return reqs
+}
@@ -15,6 +15,7 @@ import (
 
 	hlov1alpha1 "github.com/openshift/hypershift-logging-operator/api/v1alpha1"
 	"github.com/openshift/hypershift-logging-operator/pkg/constants"
+	"github.com/openshift/hypershift-logging-operator/pkg/metrics"
 )
 
 var _ handler.EventHandler = &enqueueRequestForHostedControlPlane{}
@@ -49,9 +50,19 @@ func (e *enqueueRequestForHostedControlPlane) mapToRequests(obj client.Object) [
 		return reqs
 	}
 
-	// Build the request from every hcp namespace and only when the CLF with the template name does not exist
+	// Build the request from every hcp namespace and only when the CLF with the template name does not exist,
+	// the default templates are always requested as they depend on the readiness and annotations of the hcp
 	for _, t := range templateList.Items {
 		for _, h := range hcpList.Items {
+			if t.Spec.Default {
+				reqs = append(reqs, reconcile.Request{
+					NamespacedName: types.NamespacedName{
+						Name:      t.Name,
+						Namespace: h.Namespace,
+					},
+				})
+				continue
+			}
 			clf := &loggingv1.ClusterLogForwarder{}
 			err = e.Client.Get(context.TODO(), types.NamespacedName{Namespace: h.Namespace, Name: t.Name}, clf)
 			if errors.IsNotFound(err) {
@@ -80,6 +91,8 @@ func (e *enqueueRequestForHostedControlPlane) Update(evt event.UpdateEvent, q wo
 }
 
 func (e *enqueueRequestForHostedControlPlane) Delete(evt event.DeleteEvent, q workqueue.RateLimitingInterface) {
+	// The reconciles of the templates observed in the HCP namespace are forgotten with the HCP
+	metrics.ForgetCluster(evt.Object.GetNamespace())
 	reqs := map[reconcile.Request]struct{}{}
 	e.mapAndEnqueue(q, evt.Object, reqs)
 }
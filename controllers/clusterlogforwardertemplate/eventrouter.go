@@ -0,0 +1,210 @@
+package clusterlogforwardertemplate
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	loggingv1 "github.com/openshift/cluster-logging-operator/apis/logging/v1"
+	hyperv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	hlov1alpha1 "github.com/openshift/hypershift-logging-operator/api/v1alpha1"
+	"github.com/openshift/hypershift-logging-operator/pkg/clusterlogforwarder"
+	"github.com/openshift/hypershift-logging-operator/pkg/constants"
+)
+
+const (
+	// DefaultEventRouterImage is the image of the event router unless another one is configured
+	DefaultEventRouterImage = "registry.redhat.io/openshift-logging/eventrouter-rhel8:v0.4"
+
+	// eventRouterConfig makes the event router write the events to its standard output
+	eventRouterConfig     = `{"sink": "stdout"}`
+	eventRouterConfigKey  = "config.json"
+	eventRouterConfigPath = "/etc/eventrouter"
+)
+
+// applyEventRouter deploys the event router of the template in the HCP namespace when the CLF forwards the
+// guest cluster events, and removes it otherwise
+func (r *ClusterLogForwarderTemplateReconciler) applyEventRouter(
+	ctx context.Context,
+	template *hlov1alpha1.ClusterLogForwarderTemplate,
+	hcp *hyperv1beta1.HostedControlPlane,
+	clf *loggingv1.ClusterLogForwarder,
+) error {
+	if !clusterlogforwarder.UsesEventsInput(clf) {
+		return r.deleteEventRouter(ctx, template, hcp.Namespace)
+	}
+
+	cm := r.buildEventRouterConfigMap(template, hcp)
+	if err := controllerutil.SetOwnerReference(hcp, cm, r.Scheme); err != nil {
+		return err
+	}
+	existingCM := &corev1.ConfigMap{}
+	err := r.Get(ctx, types.NamespacedName{Name: cm.Name, Namespace: cm.Namespace}, existingCM)
+	if errors.IsNotFound(err) {
+		if err := r.Create(ctx, cm); err != nil {
+			return fmt.Errorf("failed to create the event router config: %w", err)
+		}
+	} else if err != nil {
+		return err
+	} else if existingCM.Data[eventRouterConfigKey] != eventRouterConfig {
+		existingCM.Data = cm.Data
+		if err := r.Update(ctx, existingCM); err != nil {
+			return fmt.Errorf("failed to update the event router config: %w", err)
+		}
+	}
+
+	deployment := r.buildEventRouterDeployment(template, hcp)
+	if err := controllerutil.SetOwnerReference(hcp, deployment, r.Scheme); err != nil {
+		return err
+	}
+	existing := &appsv1.Deployment{}
+	err = r.Get(ctx, types.NamespacedName{Name: deployment.Name, Namespace: deployment.Namespace}, existing)
+	if errors.IsNotFound(err) {
+		if err := r.Create(ctx, deployment); err != nil {
+			return fmt.Errorf("failed to create the event router: %w", err)
+		}
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// The spec, the labels and the owner changed out-of-band are restored, the fields defaulted by the API
+	// server are ignored
+	owned := existing.DeepCopy()
+	if err := controllerutil.SetOwnerReference(hcp, owned, r.Scheme); err != nil {
+		return err
+	}
+	if equality.Semantic.DeepDerivative(deployment.Spec, existing.Spec) &&
+		equality.Semantic.DeepDerivative(deployment.Labels, existing.Labels) &&
+		reflect.DeepEqual(owned.OwnerReferences, existing.OwnerReferences) {
+		return nil
+	}
+	owned.Spec = deployment.Spec
+	if owned.Labels == nil {
+		owned.Labels = map[string]string{}
+	}
+	for k, v := range deployment.Labels {
+		owned.Labels[k] = v
+	}
+	if err := r.Update(ctx, owned); err != nil {
+		return fmt.Errorf("failed to update the event router: %w", err)
+	}
+	return nil
+}
+
+// deleteEventRouter removes the event router of the template and its config from the namespace
+func (r *ClusterLogForwarderTemplateReconciler) deleteEventRouter(
+	ctx context.Context,
+	template *hlov1alpha1.ClusterLogForwarderTemplate,
+	namespace string,
+) error {
+	labels := client.MatchingLabels(eventRouterLabels(template))
+	if err := r.DeleteAllOf(ctx, &appsv1.Deployment{}, client.InNamespace(namespace), labels); err != nil {
+		return fmt.Errorf("failed to delete the event router: %w", err)
+	}
+	if err := r.DeleteAllOf(ctx, &corev1.ConfigMap{}, client.InNamespace(namespace), labels); err != nil {
+		return fmt.Errorf("failed to delete the event router config: %w", err)
+	}
+	return nil
+}
+
+// eventRouterImage returns the configured image of the event router, the default one if unset
+func (r *ClusterLogForwarderTemplateReconciler) eventRouterImage() string {
+	if r.EventRouterImage != "" {
+		return r.EventRouterImage
+	}
+	return DefaultEventRouterImage
+}
+
+func eventRouterName(template *hlov1alpha1.ClusterLogForwarderTemplate) string {
+	return fmt.Sprintf("%s-%s", template.Name, clusterlogforwarder.EventRouterComponent)
+}
+
+// eventRouterLabels returns the labels of the event router resources, managed by the operator for the template
+func eventRouterLabels(template *hlov1alpha1.ClusterLogForwarderTemplate) map[string]string {
+	labels := clusterlogforwarder.ManagedLabels(constants.TemplateLabel, template.Name)
+	for k, v := range clusterlogforwarder.EventRouterLabels(template.Name) {
+		labels[k] = v
+	}
+	return labels
+}
+
+func (r *ClusterLogForwarderTemplateReconciler) buildEventRouterConfigMap(
+	template *hlov1alpha1.ClusterLogForwarderTemplate,
+	hcp *hyperv1beta1.HostedControlPlane,
+) *corev1.ConfigMap {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      eventRouterName(template),
+			Namespace: hcp.Namespace,
+			Labels:    eventRouterLabels(template),
+		},
+		Data: map[string]string{eventRouterConfigKey: eventRouterConfig},
+	}
+	r.CommonMetadata.Apply(cm)
+	return cm
+}
+
+func (r *ClusterLogForwarderTemplateReconciler) buildEventRouterDeployment(
+	template *hlov1alpha1.ClusterLogForwarderTemplate,
+	hcp *hyperv1beta1.HostedControlPlane,
+) *appsv1.Deployment {
+	podLabels := clusterlogforwarder.EventRouterLabels(template.Name)
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      eventRouterName(template),
+			Namespace: hcp.Namespace,
+			Labels:    eventRouterLabels(template),
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: pointer.Int32(1),
+			Selector: &metav1.LabelSelector{MatchLabels: podLabels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: podLabels},
+				Spec: corev1.PodSpec{
+					// The events are read from the guest cluster, not the management cluster
+					AutomountServiceAccountToken: pointer.Bool(false),
+					Containers: []corev1.Container{{
+						Name:  clusterlogforwarder.EventRouterComponent,
+						Image: r.eventRouterImage(),
+						// The events are read with the guest service account granted to read them only
+						Env: []corev1.EnvVar{{
+							Name:  "KUBECONFIG",
+							Value: fmt.Sprintf("%s/kubeconfig", constants.EventRouterKubeConfigPath),
+						}},
+						VolumeMounts: []corev1.VolumeMount{
+							{Name: "config", MountPath: eventRouterConfigPath, ReadOnly: true},
+							{Name: "kubeconfig", MountPath: constants.EventRouterKubeConfigPath, ReadOnly: true},
+						},
+					}},
+					Volumes: []corev1.Volume{
+						{
+							Name: "config",
+							VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{
+								LocalObjectReference: corev1.LocalObjectReference{Name: eventRouterName(template)},
+							}},
+						},
+						{
+							Name: "kubeconfig",
+							VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{
+								SecretName: constants.EventRouterKubeConfigSecretName,
+							}},
+						},
+					},
+				},
+			},
+		},
+	}
+	r.CommonMetadata.Apply(deployment)
+	return deployment
+}
@@ -0,0 +1,92 @@
+package clusterlogforwardertemplate
+
+import (
+	"context"
+	"fmt"
+
+	loggingv1 "github.com/openshift/cluster-logging-operator/apis/logging/v1"
+	hyperv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	hlov1alpha1 "github.com/openshift/hypershift-logging-operator/api/v1alpha1"
+	"github.com/openshift/hypershift-logging-operator/pkg/clusterlogforwarder"
+	"github.com/openshift/hypershift-logging-operator/pkg/constants"
+)
+
+// applyExport writes the CLF rendered for the hosted cluster into the export ConfigMap of the HCP namespace
+// when the template exports it, and removes the ConfigMap otherwise
+func (r *ClusterLogForwarderTemplateReconciler) applyExport(
+	ctx context.Context,
+	template *hlov1alpha1.ClusterLogForwarderTemplate,
+	hcp *hyperv1beta1.HostedControlPlane,
+	clf *loggingv1.ClusterLogForwarder,
+) error {
+	if !template.Spec.IsExportEnabled() {
+		return r.deleteExport(ctx, template, hcp.Namespace)
+	}
+
+	rendered, err := clusterlogforwarder.RenderExport(clf)
+	if err != nil {
+		return fmt.Errorf("failed to render the CLF export: %w", err)
+	}
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      exportName(template),
+			Namespace: hcp.Namespace,
+			Labels:    exportLabels(template),
+		},
+		Data: map[string]string{clusterlogforwarder.ExportKey: string(rendered)},
+	}
+	r.CommonMetadata.Apply(cm)
+	if err := controllerutil.SetOwnerReference(hcp, cm, r.Scheme); err != nil {
+		return err
+	}
+
+	existing := &corev1.ConfigMap{}
+	err = r.Get(ctx, types.NamespacedName{Name: cm.Name, Namespace: cm.Namespace}, existing)
+	if errors.IsNotFound(err) {
+		if err := r.Create(ctx, cm); err != nil {
+			return fmt.Errorf("failed to create the CLF export: %w", err)
+		}
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if existing.Data[clusterlogforwarder.ExportKey] == cm.Data[clusterlogforwarder.ExportKey] {
+		return nil
+	}
+	existing.Data = cm.Data
+	if err := r.Update(ctx, existing); err != nil {
+		return fmt.Errorf("failed to update the CLF export: %w", err)
+	}
+	return nil
+}
+
+// deleteExport removes the export ConfigMap of the template from the namespace
+func (r *ClusterLogForwarderTemplateReconciler) deleteExport(
+	ctx context.Context,
+	template *hlov1alpha1.ClusterLogForwarderTemplate,
+	namespace string,
+) error {
+	err := r.DeleteAllOf(ctx, &corev1.ConfigMap{}, client.InNamespace(namespace), client.MatchingLabels(exportLabels(template)))
+	if err != nil {
+		return fmt.Errorf("failed to delete the CLF export: %w", err)
+	}
+	return nil
+}
+
+func exportName(template *hlov1alpha1.ClusterLogForwarderTemplate) string {
+	return fmt.Sprintf("%s-%s", template.Name, clusterlogforwarder.ExportComponent)
+}
+
+// exportLabels returns the labels of the export ConfigMap, managed by the operator for the template
+func exportLabels(template *hlov1alpha1.ClusterLogForwarderTemplate) map[string]string {
+	labels := clusterlogforwarder.ManagedLabels(constants.TemplateLabel, template.Name)
+	labels["app.kubernetes.io/component"] = clusterlogforwarder.ExportComponent
+	return labels
+}
@@ -0,0 +1,517 @@
+package clusterlogforwardertemplate
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	loggingv1 "github.com/openshift/cluster-logging-operator/apis/logging/v1"
+	hyperv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	hlov1alpha1 "github.com/openshift/hypershift-logging-operator/api/v1alpha1"
+	"github.com/openshift/hypershift-logging-operator/pkg/clusterlogforwarder"
+	"github.com/openshift/hypershift-logging-operator/pkg/constants"
+	hloerrors "github.com/openshift/hypershift-logging-operator/pkg/errors"
+	"github.com/openshift/hypershift-logging-operator/pkg/metrics"
+)
+
+// certificateExpiryWarning is how long before the expiry of an output certificate it is warned about
+const certificateExpiryWarning = 30 * 24 * time.Hour
+
+// propagateSecrets copies the secrets referenced by the outputs of the CLF from their source namespaces into the
+// HCP namespace, where the collector reads them, except the secrets of the outputs of disabled pipelines only. The secrets of
+// the Azure Monitor outputs are required, the others are copied when they exist in a source namespace and are expected in the HCP namespace otherwise,
+// unless in strict mode. The secrets used by reference are not copied, they are required in the HCP namespace.
+// All the secrets are read before any is copied, so that a missing one leaves the HCP namespace untouched.
+// The CLF is annotated with the hash of the copied and the referenced secrets, so that a rotation changes the CLF
+// and the collector is rolled out by cluster-logging with the new certificates
+func (r *ClusterLogForwarderTemplateReconciler) propagateSecrets(
+	ctx context.Context,
+	template *hlov1alpha1.ClusterLogForwarderTemplate,
+	hcp *hyperv1beta1.HostedControlPlane,
+	clf *loggingv1.ClusterLogForwarder,
+) error {
+	var copied, referenced []*corev1.Secret
+	disabled := clusterlogforwarder.DisabledOutputs(template)
+	caBundle, err := r.caBundleSecret(ctx, template)
+	if err != nil {
+		return err
+	}
+	// The CA bundle is copied once into the HCP namespace, the TLS outputs without secret reference it
+	// and the secrets of the other TLS outputs are completed with it
+	tlsSecrets := map[string]bool{}
+	if caBundle != nil {
+		copied = append(copied, caBundle)
+		for _, output := range clf.Spec.Outputs {
+			if !disabled[output.Name] && output.Secret != nil && clusterlogforwarder.IsTLSOutput(output) {
+				tlsSecrets[output.Secret.Name] = true
+			}
+		}
+	}
+
+	// The copies are named after their source secrets, the sources of the same name must come from the same namespace
+	sourceNamespaces := map[string]string{}
+	for _, output := range clf.Spec.Outputs {
+		if disabled[output.Name] || output.Secret == nil || (caBundle != nil && output.Secret.Name == caBundle.Name) {
+			continue
+		}
+		if opts := template.Spec.GetOutputOptions(output.Name); opts != nil && opts.SecretByReference {
+			secret, err := r.referencedSecret(ctx, hcp, output)
+			if err != nil {
+				return err
+			}
+			referenced = append(referenced, secret)
+			continue
+		}
+
+		namespaces := r.secretSourceNamespaces(template, output.Name)
+		source, err := r.sourceSecret(ctx, output.Secret.Name, namespaces)
+		if errors.IsNotFound(err) && output.Type != loggingv1.OutputTypeAzureMonitor {
+			if r.Strict {
+				return hloerrors.Wrap(hloerrors.ErrStrictValidation, fmt.Errorf("secret %s of output %s is neither in %s nor used by reference",
+					output.Secret.Name, output.Name, strings.Join(namespaces, ", ")))
+			}
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to get the secret %s of output %s: %w", output.Secret.Name, output.Name, err)
+		}
+		if namespace, ok := sourceNamespaces[source.Name]; ok && namespace != source.Namespace {
+			return hloerrors.Wrap(hloerrors.ErrInvalidTemplate, hloerrors.Wrap(hloerrors.ErrMergeConflict, fmt.Errorf(
+				"secret %s of output %s is copied from both %s and %s", source.Name, output.Name, namespace, source.Namespace)))
+		}
+		sourceNamespaces[source.Name] = source.Namespace
+		if output.Type == loggingv1.OutputTypeAzureMonitor && len(source.Data[clusterlogforwarder.AzureMonitorSharedKey]) == 0 {
+			return fmt.Errorf("secret %s of output %s has no %s", source.Name, output.Name, clusterlogforwarder.AzureMonitorSharedKey)
+		}
+		r.observeCertificateExpiry(source)
+		if tlsSecrets[source.Name] {
+			source = withCABundle(source, caBundle)
+		}
+		copied = append(copied, source)
+	}
+
+	for _, source := range copied {
+		if err := r.applySecret(ctx, template, hcp, source); err != nil {
+			return err
+		}
+	}
+	if hashed := append(copied, referenced...); len(hashed) > 0 {
+		if clf.Annotations == nil {
+			clf.Annotations = map[string]string{}
+		}
+		clf.Annotations[constants.SecretsHashAnnotation] = secretsHash(hashed)
+	}
+	return nil
+}
+
+// deleteStaleSecrets releases the secret copies referenced by the template in the HCP namespace and used by no output
+// of the CLF left enabled, e.g. once the pipelines of their output are disabled or the output is removed. The CA
+// bundle copy is kept
+func (r *ClusterLogForwarderTemplateReconciler) deleteStaleSecrets(
+	ctx context.Context,
+	template *hlov1alpha1.ClusterLogForwarderTemplate,
+	hcp *hyperv1beta1.HostedControlPlane,
+	clf *loggingv1.ClusterLogForwarder,
+) error {
+	kept := map[string]bool{}
+	if template.Spec.CABundle != nil {
+		kept[clusterlogforwarder.CABundleSecretName(template)] = true
+	}
+	disabled := clusterlogforwarder.DisabledOutputs(template)
+	for _, output := range clf.Spec.Outputs {
+		if !disabled[output.Name] && output.Secret != nil {
+			kept[output.Secret.Name] = true
+		}
+	}
+
+	secrets, err := r.referencedSecretCopies(ctx, template, hcp.Namespace)
+	if err != nil {
+		return err
+	}
+	for _, secret := range secrets {
+		if kept[secret.Name] {
+			continue
+		}
+		if err := r.releaseSecret(ctx, template, secret); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// releaseSecrets releases every secret copy referenced by the template in the HCP namespace, the CA bundle copy
+// included, once the template is deleted or no longer applies to the hosted cluster
+func (r *ClusterLogForwarderTemplateReconciler) releaseSecrets(
+	ctx context.Context,
+	template *hlov1alpha1.ClusterLogForwarderTemplate,
+	namespace string,
+) error {
+	secrets, err := r.referencedSecretCopies(ctx, template, namespace)
+	if err != nil {
+		return err
+	}
+	for _, secret := range secrets {
+		if err := r.releaseSecret(ctx, template, secret); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// referencedSecretCopies returns the secret copies of the namespace referenced by the template
+func (r *ClusterLogForwarderTemplateReconciler) referencedSecretCopies(
+	ctx context.Context,
+	template *hlov1alpha1.ClusterLogForwarderTemplate,
+	namespace string,
+) ([]*corev1.Secret, error) {
+	secretList := &corev1.SecretList{}
+	if err := r.List(ctx, secretList, client.InNamespace(namespace),
+		client.MatchingLabels{constants.ManagedByLabel: constants.ManagedByLabelValue},
+		client.HasLabels{constants.TemplateLabel},
+	); err != nil {
+		return nil, fmt.Errorf("failed to list the secret copies: %w", err)
+	}
+	var secrets []*corev1.Secret
+	for i := range secretList.Items {
+		if containsString(clusterlogforwarder.SecretReferences(&secretList.Items[i]), template.Name) {
+			secrets = append(secrets, &secretList.Items[i])
+		}
+	}
+	return secrets, nil
+}
+
+// releaseSecret removes the reference of the template from the secret copy, the copy is deleted once no template
+// references it. The copy left to other templates is labeled with one of them, so that its deletion by hand is
+// mapped to a template still using it
+func (r *ClusterLogForwarderTemplateReconciler) releaseSecret(
+	ctx context.Context,
+	template *hlov1alpha1.ClusterLogForwarderTemplate,
+	secret *corev1.Secret,
+) error {
+	var references []string
+	for _, name := range clusterlogforwarder.SecretReferences(secret) {
+		if name != template.Name {
+			references = append(references, name)
+		}
+	}
+	if len(references) == 0 {
+		if err := r.Delete(ctx, secret); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete the secret copy %s: %w", secret.Name, err)
+		}
+		r.log.Info("deleted the secret copy", "Name", template.Name, "Namespace", secret.Namespace, "Secret", secret.Name)
+		return nil
+	}
+	clusterlogforwarder.SetSecretReferences(secret, references)
+	if secret.Labels[constants.TemplateLabel] == template.Name {
+		secret.Labels[constants.TemplateLabel] = references[0]
+	}
+	if err := r.Update(ctx, secret); err != nil {
+		return fmt.Errorf("failed to release the secret copy %s: %w", secret.Name, err)
+	}
+	return nil
+}
+
+// containsString returns true if the value is one of the values
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// secretSourceNamespaces returns the namespaces the secret of the output is copied from, by precedence: the secret
+// namespace of the output alone if set, the template namespace then the secret namespaces of the operator otherwise
+func (r *ClusterLogForwarderTemplateReconciler) secretSourceNamespaces(
+	template *hlov1alpha1.ClusterLogForwarderTemplate,
+	output string,
+) []string {
+	if opts := template.Spec.GetOutputOptions(output); opts != nil && opts.SecretNamespace != "" {
+		return []string{opts.SecretNamespace}
+	}
+	namespaces := []string{template.Namespace}
+	for _, namespace := range r.SecretNamespaces {
+		if namespace != template.Namespace {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	return namespaces
+}
+
+// sourceSecret returns the secret of the name from the first of the namespaces holding it, a not found error
+// if none does
+func (r *ClusterLogForwarderTemplateReconciler) sourceSecret(ctx context.Context, name string, namespaces []string) (*corev1.Secret, error) {
+	var err error
+	for _, namespace := range namespaces {
+		secret := &corev1.Secret{}
+		if err = r.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, secret); err == nil {
+			return secret, nil
+		} else if !errors.IsNotFound(err) {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+// isSecretNamespace returns true if the output secrets are copied from the namespace besides the template namespace
+func (r *ClusterLogForwarderTemplateReconciler) isSecretNamespace(namespace string) bool {
+	for _, ns := range r.SecretNamespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// referencedSecret returns the secret of the output used by reference from the HCP namespace, it must exist
+// there as it is not copied. The secret of an Azure Monitor output must hold the shared key
+func (r *ClusterLogForwarderTemplateReconciler) referencedSecret(
+	ctx context.Context,
+	hcp *hyperv1beta1.HostedControlPlane,
+	output loggingv1.OutputSpec,
+) (*corev1.Secret, error) {
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: output.Secret.Name, Namespace: hcp.Namespace}, secret)
+	if errors.IsNotFound(err) {
+		return nil, fmt.Errorf("secret %s of output %s is used by reference but missing in %s",
+			output.Secret.Name, output.Name, hcp.Namespace)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get the secret %s of output %s: %w", output.Secret.Name, output.Name, err)
+	}
+	if output.Type == loggingv1.OutputTypeAzureMonitor && len(secret.Data[clusterlogforwarder.AzureMonitorSharedKey]) == 0 {
+		return nil, fmt.Errorf("secret %s of output %s has no %s", secret.Name, output.Name, clusterlogforwarder.AzureMonitorSharedKey)
+	}
+	r.observeCertificateExpiry(secret)
+	return secret, nil
+}
+
+// caBundleSecret returns the secret propagating the CA bundle of the template into the HCP namespaces, nil if the
+// template has no CA bundle. The CA bundle is read from the secret or the ConfigMap of the template namespace and
+// its expiry is recorded, a CA bundle without a valid certificate is rejected
+func (r *ClusterLogForwarderTemplateReconciler) caBundleSecret(
+	ctx context.Context,
+	template *hlov1alpha1.ClusterLogForwarderTemplate,
+) (*corev1.Secret, error) {
+	ref := template.Spec.CABundle
+	if ref == nil {
+		return nil, nil
+	}
+
+	var bundle []byte
+	var source string
+	if ref.SecretName != "" {
+		secret := &corev1.Secret{}
+		if err := r.Get(ctx, types.NamespacedName{Name: ref.SecretName, Namespace: template.Namespace}, secret); err != nil {
+			return nil, fmt.Errorf("failed to get the CA bundle secret %s: %w", ref.SecretName, err)
+		}
+		bundle, source = secret.Data[ref.GetKey()], ref.SecretName
+	} else {
+		cm := &corev1.ConfigMap{}
+		if err := r.Get(ctx, types.NamespacedName{Name: ref.ConfigMapName, Namespace: template.Namespace}, cm); err != nil {
+			return nil, fmt.Errorf("failed to get the CA bundle ConfigMap %s: %w", ref.ConfigMapName, err)
+		}
+		bundle, source = []byte(cm.Data[ref.GetKey()]), ref.ConfigMapName
+	}
+	expiry, err := certificateExpiry(bundle)
+	if err != nil {
+		return nil, hloerrors.Wrap(hloerrors.ErrInvalidTemplate,
+			fmt.Errorf("invalid CA bundle %s of %s: %w", ref.GetKey(), source, err))
+	}
+	metrics.SetCertificateExpiry(template.Namespace, source, expiry)
+
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: clusterlogforwarder.CABundleSecretName(template), Namespace: template.Namespace},
+		Type:       corev1.SecretTypeOpaque,
+		Data:       map[string][]byte{clusterlogforwarder.CABundleKey: bundle},
+	}, nil
+}
+
+// withCABundle returns a copy of the secret completed with the CA bundle, the CA bundle of the secret
+// takes precedence
+func withCABundle(secret *corev1.Secret, caBundle *corev1.Secret) *corev1.Secret {
+	if _, ok := secret.Data[clusterlogforwarder.CABundleKey]; ok {
+		return secret
+	}
+	completed := secret.DeepCopy()
+	if completed.Data == nil {
+		completed.Data = map[string][]byte{}
+	}
+	completed.Data[clusterlogforwarder.CABundleKey] = caBundle.Data[clusterlogforwarder.CABundleKey]
+	return completed
+}
+
+// observeCertificateExpiry records the expiry of the TLS certificate of the secret, if any, and warns
+// when it is close to expire
+func (r *ClusterLogForwarderTemplateReconciler) observeCertificateExpiry(secret *corev1.Secret) {
+	pemData, ok := secret.Data[corev1.TLSCertKey]
+	if !ok {
+		return
+	}
+	expiry, err := certificateExpiry(pemData)
+	if err != nil {
+		r.log.Error(err, "invalid certificate", "Secret", secret.Name, "Namespace", secret.Namespace)
+		return
+	}
+	metrics.SetCertificateExpiry(secret.Namespace, secret.Name, expiry)
+	if time.Until(expiry) < certificateExpiryWarning {
+		r.log.Info("certificate expires soon", "Secret", secret.Name, "Namespace", secret.Namespace,
+			"Expiry", expiry.Format(time.RFC3339))
+	}
+}
+
+// certificateExpiry returns the earliest expiry of the certificates of the PEM chain
+func certificateExpiry(pemData []byte) (time.Time, error) {
+	var expiry time.Time
+	for block, rest := pem.Decode(pemData); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if expiry.IsZero() || cert.NotAfter.Before(expiry) {
+			expiry = cert.NotAfter
+		}
+	}
+	if expiry.IsZero() {
+		return time.Time{}, fmt.Errorf("no certificate found")
+	}
+	return expiry, nil
+}
+
+// templatesForSecret maps a secret of the operator namespace or of a secret namespace to the templates whose outputs
+// reference it, so that its rotation is propagated to the HCP namespaces
+func (r *ClusterLogForwarderTemplateReconciler) templatesForSecret(obj client.Object) []reconcile.Request {
+	templateList := &hlov1alpha1.ClusterLogForwarderTemplateList{}
+	if err := r.List(context.TODO(), templateList, client.InNamespace(constants.OperatorNamespace)); err != nil {
+		return nil
+	}
+	var reqs []reconcile.Request
+	for _, template := range templateList.Items {
+		if referencesSecret(&template, obj.GetName()) {
+			reqs = append(reqs, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&template)})
+		}
+	}
+	return reqs
+}
+
+// referencesSecret returns true if an output of the template, its platform outputs, defaults or CA bundle use the secret
+func referencesSecret(template *hlov1alpha1.ClusterLogForwarderTemplate, name string) bool {
+	if ref := template.Spec.CABundle; ref != nil && ref.SecretName == name {
+		return true
+	}
+	if defaults := template.Spec.OutputDefaults; defaults != nil && defaults.Secret != nil && defaults.Secret.Name == name {
+		return true
+	}
+	outputs := template.Spec.Template.Outputs
+	for _, platform := range template.Spec.PlatformOutputs {
+		outputs = append(outputs, platform.Outputs...)
+	}
+	for _, output := range outputs {
+		if output.Secret != nil && output.Secret.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// templatesForConfigMap maps a ConfigMap of the operator namespace to the templates reading their CA bundle
+// from it, so that its rotation is propagated to the HCP namespaces
+func (r *ClusterLogForwarderTemplateReconciler) templatesForConfigMap(obj client.Object) []reconcile.Request {
+	templateList := &hlov1alpha1.ClusterLogForwarderTemplateList{}
+	if err := r.List(context.TODO(), templateList, client.InNamespace(obj.GetNamespace())); err != nil {
+		return nil
+	}
+	var reqs []reconcile.Request
+	for _, template := range templateList.Items {
+		if ref := template.Spec.CABundle; ref != nil && ref.ConfigMapName == obj.GetName() {
+			reqs = append(reqs, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&template)})
+		}
+	}
+	return reqs
+}
+
+// secretsHash returns a hash of the names and the data of the secrets
+func secretsHash(secrets []*corev1.Secret) string {
+	sorted := append([]*corev1.Secret{}, secrets...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	h := sha256.New()
+	for _, secret := range sorted {
+		keys := make([]string, 0, len(secret.Data))
+		for k := range secret.Data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		h.Write([]byte(secret.Name))
+		for _, k := range keys {
+			h.Write([]byte(k))
+			h.Write(secret.Data[k])
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// applySecret creates or updates the copy of the source secret in the HCP namespace and records the reference of
+// the template on it. A secret of the same name which is not a copy generated from a template, e.g. a secret of
+// HyperShift, is never overwritten
+func (r *ClusterLogForwarderTemplateReconciler) applySecret(
+	ctx context.Context,
+	template *hlov1alpha1.ClusterLogForwarderTemplate,
+	hcp *hyperv1beta1.HostedControlPlane,
+	source *corev1.Secret,
+) error {
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: source.Name, Namespace: hcp.Namespace}, secret)
+	if errors.IsNotFound(err) {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      source.Name,
+				Namespace: hcp.Namespace,
+				Labels:    clusterlogforwarder.ManagedLabels(constants.TemplateLabel, template.Name),
+			},
+			Type: source.Type,
+			Data: source.Data,
+		}
+		clusterlogforwarder.SetSecretReferences(secret, []string{template.Name})
+		r.CommonMetadata.Apply(secret)
+		if err := controllerutil.SetOwnerReference(hcp, secret, r.Scheme); err != nil {
+			return err
+		}
+		return r.Create(ctx, secret)
+	} else if err != nil {
+		return err
+	}
+
+	if _, ok := clusterlogforwarder.SourceName(secret, constants.TemplateLabel); !ok {
+		return hloerrors.Wrap(hloerrors.ErrInvalidTemplate, fmt.Errorf(
+			"secret %s in %s is not a copy generated from a template, it is not overwritten", secret.Name, hcp.Namespace))
+	}
+	references := clusterlogforwarder.SecretReferences(secret)
+	referenced := containsString(references, template.Name)
+	if referenced && reflect.DeepEqual(secret.Data, source.Data) {
+		return nil
+	}
+	if !referenced {
+		clusterlogforwarder.SetSecretReferences(secret, append(references, template.Name))
+	}
+	secret.Data = source.Data
+	return r.Update(ctx, secret)
+}
@@ -0,0 +1,173 @@
+package clusterlogforwardertemplate
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	hlov1alpha1 "github.com/openshift/hypershift-logging-operator/api/v1alpha1"
+	"github.com/openshift/hypershift-logging-operator/pkg/clusterlogforwarder"
+)
+
+const (
+	// selfTestPollInterval is the delay between two queries of the marker log of a running self-test
+	selfTestPollInterval = 30 * time.Second
+	// selfTestTimeout is how long the marker log is queried before it is reported not delivered
+	selfTestTimeout = 5 * time.Minute
+)
+
+// reconcileSelfTest runs the self-test of the log delivery of the template one step at a time, so that the
+// reconciliation does not wait for the marker log: the marker is injected into the collector of the first
+// accepted CLF, then queried from the output until it is found or the self-test times out. It returns the
+// delay until the next step, 0 if the template has no self-test
+func (r *ClusterLogForwarderTemplateReconciler) reconcileSelfTest(
+	ctx context.Context,
+	template *hlov1alpha1.ClusterLogForwarderTemplate,
+	accepted []string,
+) time.Duration {
+	status := template.Status.DeepCopy()
+	requeue := time.Duration(0)
+	if r.SelfTester == nil || !template.Spec.IsSelfTestEnabled() {
+		status.SelfTest = nil
+		meta.RemoveStatusCondition(&status.Conditions, hlov1alpha1.LogDeliveryCondition)
+	} else {
+		requeue = r.runSelfTest(ctx, template, status, accepted)
+	}
+
+	if reflect.DeepEqual(*status, template.Status) {
+		return requeue
+	}
+	now := metav1.Now()
+	status.LastUpdateTime = &now
+	template.Status = *status
+	if err := r.Status().Update(ctx, template); err != nil {
+		r.log.Error(err, "failed to update the self-test status", "Name", template.Name)
+	}
+	return requeue
+}
+
+// runSelfTest moves the self-test of the status to its next step and returns the delay until the following one
+func (r *ClusterLogForwarderTemplateReconciler) runSelfTest(
+	ctx context.Context,
+	template *hlov1alpha1.ClusterLogForwarderTemplate,
+	status *hlov1alpha1.ClusterLogForwarderTemplateStatus,
+	accepted []string,
+) time.Duration {
+	interval := template.Spec.SelfTest.GetInterval()
+	now := metav1.Now()
+	selfTest := status.SelfTest
+
+	// The last self-test completed recently, the next one starts after the interval
+	if selfTest != nil && selfTest.CompletedTime != nil {
+		if elapsed := now.Sub(selfTest.CompletedTime.Time); elapsed < interval {
+			return interval - elapsed
+		}
+		selfTest = nil
+	}
+
+	if selfTest == nil {
+		// The marker is injected once a CLF is accepted, its readiness change triggers the reconciliation
+		if len(accepted) == 0 {
+			return 0
+		}
+		namespaces := append([]string{}, accepted...)
+		sort.Strings(namespaces)
+		status.SelfTest = &hlov1alpha1.SelfTestStatus{
+			Marker:       clusterlogforwarder.SelfTestMarker(template.Name, now.Time),
+			Namespace:    namespaces[0],
+			InjectedTime: now,
+		}
+		if err := r.injectSelfTestMarker(ctx, template, status.SelfTest); err != nil {
+			r.log.Error(err, "failed to inject the self-test marker log", "Name", template.Name, "Namespace", namespaces[0])
+			completeSelfTest(template, status, now, metav1.ConditionFalse, hlov1alpha1.SelfTestFailedReason,
+				fmt.Sprintf("failed to inject the marker log in namespace %s: %v", namespaces[0], err))
+			return interval
+		}
+		return selfTestPollInterval
+	}
+
+	output := template.Spec.SelfTest.Output
+	delivered, err := r.selfTestDelivered(ctx, template, selfTest)
+	switch {
+	case err != nil:
+		r.log.Error(err, "failed to query the self-test marker log", "Name", template.Name, "Output", output)
+		completeSelfTest(template, status, now, metav1.ConditionFalse, hlov1alpha1.SelfTestFailedReason,
+			fmt.Sprintf("failed to query the marker log from the output %s: %v", output, err))
+	case delivered:
+		completeSelfTest(template, status, now, metav1.ConditionTrue, hlov1alpha1.DeliveredReason,
+			fmt.Sprintf("the marker log injected in namespace %s reached the output %s", selfTest.Namespace, output))
+	case now.Sub(selfTest.InjectedTime.Time) >= selfTestTimeout:
+		completeSelfTest(template, status, now, metav1.ConditionFalse, hlov1alpha1.NotDeliveredReason,
+			fmt.Sprintf("the marker log injected in namespace %s did not reach the output %s within %s",
+				selfTest.Namespace, output, selfTestTimeout))
+	default:
+		return selfTestPollInterval
+	}
+	return interval
+}
+
+// completeSelfTest records the result of the self-test in the LogDeliveryCondition
+func completeSelfTest(
+	template *hlov1alpha1.ClusterLogForwarderTemplate,
+	status *hlov1alpha1.ClusterLogForwarderTemplateStatus,
+	now metav1.Time,
+	conditionStatus metav1.ConditionStatus,
+	reason string,
+	message string,
+) {
+	status.SelfTest.CompletedTime = &now
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               hlov1alpha1.LogDeliveryCondition,
+		Status:             conditionStatus,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: template.Generation,
+	})
+}
+
+// injectSelfTestMarker injects the marker log into the collector of the CLF of the template in the self-test namespace
+func (r *ClusterLogForwarderTemplateReconciler) injectSelfTestMarker(
+	ctx context.Context,
+	template *hlov1alpha1.ClusterLogForwarderTemplate,
+	selfTest *hlov1alpha1.SelfTestStatus,
+) error {
+	clf, err := r.generatedClusterLogForwarder(ctx, template, selfTest.Namespace)
+	if err != nil {
+		return err
+	}
+	return r.SelfTester.Inject(ctx, clf, selfTest.Marker)
+}
+
+// selfTestDelivered queries the marker log from the output as rendered in the CLF of the self-test namespace,
+// with the secret of the output propagated there
+func (r *ClusterLogForwarderTemplateReconciler) selfTestDelivered(
+	ctx context.Context,
+	template *hlov1alpha1.ClusterLogForwarderTemplate,
+	selfTest *hlov1alpha1.SelfTestStatus,
+) (bool, error) {
+	clf, err := r.generatedClusterLogForwarder(ctx, template, selfTest.Namespace)
+	if err != nil {
+		return false, err
+	}
+	for _, output := range clf.Spec.Outputs {
+		if output.Name != template.Spec.SelfTest.Output {
+			continue
+		}
+		var secret *corev1.Secret
+		if output.Secret != nil {
+			secret = &corev1.Secret{}
+			if err := r.Get(ctx, types.NamespacedName{Name: output.Secret.Name, Namespace: selfTest.Namespace}, secret); err != nil {
+				return false, err
+			}
+		}
+		return r.SelfTester.Delivered(ctx, output, secret, selfTest.Marker)
+	}
+	return false, fmt.Errorf("output %s not found in the ClusterLogForwarder", template.Spec.SelfTest.Output)
+}
@@ -0,0 +1,76 @@
+package clusterlogforwardertemplate
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	loggingv1 "github.com/openshift/cluster-logging-operator/apis/logging/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	hlov1alpha1 "github.com/openshift/hypershift-logging-operator/api/v1alpha1"
+	"github.com/openshift/hypershift-logging-operator/pkg/clusterlogforwarder"
+	"github.com/openshift/hypershift-logging-operator/pkg/constants"
+)
+
+//+kubebuilder:webhook:path=/validate-logging-managed-openshift-io-v1alpha1-clusterlogforwardertemplate,mutating=false,failurePolicy=fail,sideEffects=None,groups=logging.managed.openshift.io,resources=clusterlogforwardertemplates,verbs=delete,versions=v1alpha1,name=vclusterlogforwardertemplate.logging.managed.openshift.io,admissionReviewVersions=v1
+
+// TemplateValidator blocks the deletion of the templates still applied to hosted clusters,
+// unless they are annotated to force the deletion
+type TemplateValidator struct {
+	Client client.Reader
+}
+
+var _ admission.CustomValidator = &TemplateValidator{}
+
+// SetupWebhookWithManager registers the validating webhook of the templates with the Manager.
+func (v *TemplateValidator) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&hlov1alpha1.ClusterLogForwarderTemplate{}).
+		WithValidator(v).
+		Complete()
+}
+
+// ValidateCreate allows all the creations
+func (v *TemplateValidator) ValidateCreate(_ context.Context, _ runtime.Object) error {
+	return nil
+}
+
+// ValidateUpdate allows all the updates
+func (v *TemplateValidator) ValidateUpdate(_ context.Context, _ runtime.Object, _ runtime.Object) error {
+	return nil
+}
+
+// ValidateDelete denies the deletion of a template with generated CLFs, the namespaces of the CLFs are reported
+func (v *TemplateValidator) ValidateDelete(ctx context.Context, obj runtime.Object) error {
+	template, ok := obj.(*hlov1alpha1.ClusterLogForwarderTemplate)
+	if !ok {
+		return fmt.Errorf("expected a ClusterLogForwarderTemplate, got %T", obj)
+	}
+	if template.Annotations[constants.ForceDeleteAnnotation] == "true" {
+		return nil
+	}
+
+	clfList := &loggingv1.ClusterLogForwarderList{}
+	if err := v.Client.List(ctx, clfList,
+		client.MatchingLabels(clusterlogforwarder.ManagedLabels(constants.TemplateLabel, template.Name)),
+	); err != nil {
+		return fmt.Errorf("failed to list the ClusterLogForwarders of template %s: %w", template.Name, err)
+	}
+	if len(clfList.Items) == 0 {
+		return nil
+	}
+
+	namespaces := make([]string, 0, len(clfList.Items))
+	for _, clf := range clfList.Items {
+		namespaces = append(namespaces, clf.Namespace)
+	}
+	sort.Strings(namespaces)
+
+	return fmt.Errorf("template %s is still applied to the hosted clusters in namespaces: %s, annotate it with %s=true to force the deletion",
+		template.Name, strings.Join(namespaces, ", "), constants.ForceDeleteAnnotation)
+}
@@ -0,0 +1,92 @@
+package hostedcluster
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	hyperv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/openshift/hypershift-logging-operator/pkg/hostedcluster"
+	"github.com/openshift/hypershift-logging-operator/pkg/metrics"
+)
+
+const (
+	// admissionRequeueInterval is how long a hosted cluster queued beyond MaxManagedClusters waits before
+	// its admission is checked again
+	admissionRequeueInterval = 30 * time.Second
+	// ManagedClustersLimitReason is the reason of the event of a hosted cluster queued beyond MaxManagedClusters
+	ManagedClustersLimitReason = "ManagedClustersLimit"
+)
+
+// admitted returns true if a guest manager may be started for the hosted cluster within MaxManagedClusters.
+// The ready hosted clusters without a guest manager are admitted in a deterministic order into the slots left
+// by the registered ones: the ones recovered after a restart of the operator first, so that the same hosted
+// clusters are managed again, then the oldest ready, then by namespace and name. The hosted clusters left out
+// are recorded in the queued clusters metric
+func (r *HostedClusterReconciler) admitted(ctx context.Context, hostedCluster *hyperv1beta1.HostedCluster) (bool, error) {
+	if r.MaxManagedClusters <= 0 {
+		return true, nil
+	}
+
+	hcList := &hyperv1beta1.HostedClusterList{}
+	if err := r.reader().List(ctx, hcList); err != nil {
+		return false, fmt.Errorf("failed to list the hosted clusters: %w", err)
+	}
+	var queue []hyperv1beta1.HostedCluster
+	for _, hc := range hcList.Items {
+		if !r.inWatchedNamespace(hc.Namespace) || !hc.DeletionTimestamp.IsZero() || !hostedcluster.IsEligibleHostedCluster(hc, r.RequiredConditions) ||
+			hostedcluster.IsLoggingDisabled(&hc, r.DisabledLabel) {
+			continue
+		}
+		if !r.inHCPNamespaces(fmt.Sprintf("%s-%s", hc.Namespace, hc.Name)) {
+			continue
+		}
+		if _, registered := hostedClusters.Get(client.ObjectKeyFromObject(&hc)); registered {
+			continue
+		}
+		queue = append(queue, hc)
+	}
+	sort.Slice(queue, func(i, j int) bool {
+		recoveredI := hostedClusters.IsRecovered(client.ObjectKeyFromObject(&queue[i]))
+		if recoveredJ := hostedClusters.IsRecovered(client.ObjectKeyFromObject(&queue[j])); recoveredI != recoveredJ {
+			return recoveredI
+		}
+		readyI, readyJ := hostedcluster.ReadySince(&queue[i]), hostedcluster.ReadySince(&queue[j])
+		if !readyI.Equal(readyJ) {
+			return readyI.Before(readyJ)
+		}
+		if queue[i].Namespace != queue[j].Namespace {
+			return queue[i].Namespace < queue[j].Namespace
+		}
+		return queue[i].Name < queue[j].Name
+	})
+
+	free := r.MaxManagedClusters - hostedClusters.Len()
+	if free < 0 {
+		free = 0
+	}
+	queued := len(queue) - free
+	if queued < 0 {
+		queued = 0
+	}
+	metrics.SetQueuedClusters(queued)
+	for i := 0; i < free && i < len(queue); i++ {
+		if queue[i].Namespace == hostedCluster.Namespace && queue[i].Name == hostedCluster.Name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// queue records the hosted cluster is queued beyond MaxManagedClusters with a Warning event
+func (r *HostedClusterReconciler) queue(hostedCluster *hyperv1beta1.HostedCluster) {
+	if r.Recorder == nil {
+		return
+	}
+	r.Recorder.Eventf(hostedCluster, corev1.EventTypeWarning, ManagedClustersLimitReason,
+		"The operator manages the maximum of %d hosted clusters, the onboarding is queued", r.MaxManagedClusters)
+}
@@ -0,0 +1,66 @@
+package hostedcluster
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// circuitBreaker counts the consecutive reconcile failures of the hosted clusters,
+// keyed by the namespace/name of the HostedCluster
+type circuitBreaker struct {
+	mu       sync.Mutex
+	failures map[types.NamespacedName]*failureRecord
+}
+
+// failureRecord is the number of consecutive failures and the time of the last one
+type failureRecord struct {
+	count int
+	last  time.Time
+}
+
+func newCircuitBreaker() *circuitBreaker {
+	return &circuitBreaker{
+		failures: map[types.NamespacedName]*failureRecord{},
+	}
+}
+
+// Failures returns the consecutive failures of the key and the time of the last one
+func (b *circuitBreaker) Failures(key types.NamespacedName) (int, time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if record, ok := b.failures[key]; ok {
+		return record.count, record.last
+	}
+	return 0, time.Time{}
+}
+
+// RecordFailure counts a failure of the key and returns the consecutive failures
+func (b *circuitBreaker) RecordFailure(key types.NamespacedName) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	record, ok := b.failures[key]
+	if !ok {
+		record = &failureRecord{}
+		b.failures[key] = record
+	}
+	record.count++
+	record.last = time.Now()
+	return record.count
+}
+
+// Reset clears the failures of the key after a success and returns the consecutive failures before it
+func (b *circuitBreaker) Reset(key types.NamespacedName) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	count := 0
+	if record, ok := b.failures[key]; ok {
+		count = record.count
+	}
+	delete(b.failures, key)
+	return count
+}
@@ -0,0 +1,60 @@
+package hostedcluster
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/openshift/hypershift-logging-operator/controllers/hypershiftlogforwarder"
+)
+
+const (
+	// guestStartBaseDelay is how long to wait before restarting a guest manager failing to start the first time
+	guestStartBaseDelay = 5 * time.Second
+	// guestStartMaxDelay caps the backoff between the restarts of a guest manager
+	guestStartMaxDelay = 5 * time.Minute
+)
+
+// guestStartBackoff counts the failed starts of the guest managers, keyed by the namespace/name of the HostedCluster
+var guestStartBackoff = workqueue.NewItemExponentialFailureRateLimiter(guestStartBaseDelay, guestStartMaxDelay)
+
+// runGuestManager runs the guest manager of the hosted cluster until the hosted cluster is stopped.
+//
+// A manager failing to start, e.g. when its caches do not sync within CacheSyncTimeout on a slow
+// guest cluster, stops the hosted cluster and the HostedCluster is reconciled again after a backoff,
+// starting a fresh manager
+func (r *HostedClusterReconciler) runGuestManager(
+	ctx context.Context,
+	key types.NamespacedName,
+	hc *hypershiftlogforwarder.HostedCluster,
+	start func(ctx context.Context) error,
+) {
+	err := start(ctx)
+	if err == nil || ctx.Err() != nil {
+		// The hosted cluster was stopped on purpose
+		guestStartBackoff.Forget(key)
+		return
+	}
+
+	delay := guestStartBackoff.When(key)
+	r.log.Error(err, "problem running HostedCluster manager, restarting", "Name", key, "after", delay)
+	hc.CancelFunc()
+	r.retryAfter(key, delay)
+}
+
+// retryAfter reconciles the HostedCluster again once the delay has passed, unless the leadership is lost by
+// then. The new leader reconciles all the HostedClusters anyway
+func (r *HostedClusterReconciler) retryAfter(key types.NamespacedName, delay time.Duration) {
+	if r.retries == nil {
+		return
+	}
+	leaderCtx, isLeader := r.leaderContext()
+	if !isLeader {
+		return
+	}
+	time.AfterFunc(delay, func() {
+		_ = r.requeue(leaderCtx, key)
+	})
+}
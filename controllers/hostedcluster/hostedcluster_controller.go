@@ -15,44 +15,141 @@ package hostedcluster
 
 import (
 	"context"
+	goerrors "errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
+	loggingv1 "github.com/openshift/cluster-logging-operator/apis/logging/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/cluster"
+	ctrlconfig "sigs.k8s.io/controller-runtime/pkg/config/v1alpha1"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	"github.com/openshift/hypershift-logging-operator/api/v1alpha1"
 	"github.com/openshift/hypershift-logging-operator/controllers/hypershiftlogforwarder"
 	hypershiftsa "github.com/openshift/hypershift-logging-operator/controllers/serviceaccount"
+	"github.com/openshift/hypershift-logging-operator/pkg/clusterlogforwarder"
 	constants "github.com/openshift/hypershift-logging-operator/pkg/constants"
+	hloerrors "github.com/openshift/hypershift-logging-operator/pkg/errors"
 	"github.com/openshift/hypershift-logging-operator/pkg/hostedcluster"
+	"github.com/openshift/hypershift-logging-operator/pkg/metrics"
 	hyperv1beta1 "github.com/openshift/hypershift/api/v1beta1"
 	corev1 "k8s.io/api/core/v1"
-	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+)
+
+const (
+	// managerStopRequeueInterval is how long to wait before checking again on a stopping sub manager
+	managerStopRequeueInterval = 5 * time.Second
+	// kubeConfigRequeueInterval is how long to wait for the kubeconfig secret of a provisioning hosted cluster
+	kubeConfigRequeueInterval = 30 * time.Second
+	// leaderRequeueInterval is how long to wait before starting a guest manager on an operator which is not the leader
+	leaderRequeueInterval = 30 * time.Second
 )
 
 var (
-	clusterScheme  = runtime.NewScheme()
-	hostedClusters = map[string]hypershiftlogforwarder.HostedCluster{}
+	hostedClusters = newClusterRegistry()
+	clusterBreaker = newCircuitBreaker()
+	// guestSchemeBuilder registers the types read from the guest clusters
+	guestSchemeBuilder = runtime.NewSchemeBuilder(
+		clientgoscheme.AddToScheme,
+		hyperv1beta1.AddToScheme,
+		v1alpha1.AddToScheme,
+	)
 )
 
+// newGuestScheme returns the scheme of the types read from the guest clusters
+func newGuestScheme() (*runtime.Scheme, error) {
+	s := runtime.NewScheme()
+	if err := guestSchemeBuilder.AddToScheme(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
 // HostedClusterReconciler reconciles a HostedCluster object
 type HostedClusterReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
 	log    logr.Logger
 	Mgr    ctrl.Manager
+	// WatchNamespaces restricts the reconciled HostedClusters to the given namespaces, all namespaces if empty
+	WatchNamespaces []string
+	// HCPNamespaces restricts the onboarded hosted clusters to the ones of the given HCP namespaces, where the
+	// namespace-scoped operator is granted its permissions. All the hosted clusters are onboarded if empty
+	HCPNamespaces []string
+	// FailureThreshold is the number of consecutive failures suspending a hosted cluster, never suspended if 0
+	FailureThreshold int
+	// SuspendInterval is how long a suspended hosted cluster waits before it is retried
+	SuspendInterval time.Duration
+	// CommonMetadata is stamped on all the resources generated for the hosted clusters
+	CommonMetadata clusterlogforwarder.CommonMetadata
+	// UserAgent is set on all the API calls to the guest clusters
+	UserAgent string
+	// CacheSyncTimeout is how long the guest controllers wait for their caches to sync
+	// before the guest manager is restarted, the controller-runtime default if 0
+	CacheSyncTimeout time.Duration
+	// FinalizerGracePeriod is how long the cleanup of a deleted HLF is retried before its finalizer is removed anyway
+	FinalizerGracePeriod time.Duration
+	// MinClusterAge is how long a hosted cluster has to be ready before it is onboarded, onboarded once ready if 0
+	MinClusterAge time.Duration
+	// RequiredConditions are the conditions of a ready hosted cluster to be true before it is onboarded, e.g. to
+	// skip the partially provisioned ones. A hosted cluster losing one of them is offboarded as when not ready
+	RequiredConditions []string
+	// DisabledLabel set to "true" on a hosted cluster excludes it from all logging: its guest manager is stopped,
+	// the CLFs generated from its HLFs are deleted and it is not onboarded. Not checked if empty
+	DisabledLabel string
+	// Paused pauses the reconciliation of the HLFs of all the hosted clusters
+	Paused bool
+	// RequeueJitter is the fraction of the interval added at random to the periodic requeues of each hosted
+	// cluster, so that the hosted clusters are not retried or refreshed at the same time
+	RequeueJitter float64
+	// ForwarderResyncInterval is how often the applied HLFs are reconciled again to restore the CLFs changed
+	// out-of-band, not resynced if 0
+	ForwarderResyncInterval time.Duration
+	// LoggingVersion is the version of the cluster-logging operator assumed for the guest clusters it is not
+	// detected in, the CLFs applied for another version are re-rendered. The latest version is assumed if empty
+	LoggingVersion string
+	// MaxManagedClusters caps the number of hosted clusters with a running guest manager, the others are queued
+	// until a slot is released. Not capped if 0
+	MaxManagedClusters int
+	// Recorder records the events of the hosted clusters, e.g. queued beyond MaxManagedClusters
+	Recorder record.EventRecorder
+	// HostedClusterCache is the cache the HostedClusters are read and watched from, shared with the other
+	// controllers watching them. It is created by NewHostedClusterCache if nil
+	HostedClusterCache cache.Cache
+	// hostedClusterReader reads the HostedClusters from the cache scoped to WatchNamespaces
+	hostedClusterReader client.Reader
+	// retries receives the HostedClusters to reconcile again after their guest manager failed to start
+	retries chan event.GenericEvent
+	// leader tracks the leadership of the operator, the guest managers are started regardless if nil
+	leader *leaderGate
 }
 
 // +kubebuilder:rbac:groups=hypershift.openshift.io,resources=hostedclusters,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=hypershift.openshift.io,resources=hostedclusters/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=hypershift.openshift.io,resources=hostedclusters/finalizers,verbs=update
+// +kubebuilder:rbac:groups=logging.openshift.io,resources=clusterlogforwarders,verbs=get;list;delete
+// +kubebuilder:rbac:groups=authorization.k8s.io,resources=selfsubjectaccessreviews,verbs=create
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 // Reconcile actions for newly created hosted clusters and deleted hosted clusters.
 //
 // If it's a new hosted cluster, Reconciler creates a new manager
@@ -60,34 +157,162 @@ type HostedClusterReconciler struct {
 //
 // If it's a deleted cluster, Reconciler cancel the sub-manager context,
 // which leads to stopping the hypershift-log-forwarder controller and sub-manager
+//
+// A hosted cluster failing FailureThreshold times in a row is suspended and only retried
+// every SuspendInterval, until a reconcile succeeds again
 func (r *HostedClusterReconciler) Reconcile(
 	ctx context.Context,
 	req ctrl.Request,
 ) (ctrl.Result, error) {
+	if r.FailureThreshold <= 0 {
+		return r.reconcile(ctx, req)
+	}
+
+	log := ctrllog.FromContext(ctx).WithName("hostedcluster-controller")
+
+	if failures, last := clusterBreaker.Failures(req.NamespacedName); failures >= r.FailureThreshold {
+		if wait := r.SuspendInterval - time.Since(last); wait > 0 {
+			log.V(3).Info("skip suspended hosted cluster", "Name", req.NamespacedName, "retry after", wait)
+			return ctrl.Result{RequeueAfter: wait}, nil
+		}
+	}
+
+	result, err := r.reconcile(ctx, req)
+	if err != nil {
+		failures := clusterBreaker.RecordFailure(req.NamespacedName)
+		if failures < r.FailureThreshold {
+			return result, err
+		}
+		log.Error(err, "suspending hosted cluster after consecutive failures", "Name", req.NamespacedName, "failures", failures)
+		r.setSuspendedCondition(ctx, req.NamespacedName, metav1.Condition{
+			Type:    constants.SuspendedCondition,
+			Status:  metav1.ConditionTrue,
+			Reason:  constants.ConsecutiveFailuresReason,
+			Message: fmt.Sprintf("suspended after %d consecutive failures: %v", failures, err),
+		})
+		return ctrl.Result{RequeueAfter: hostedcluster.JitterInterval(r.SuspendInterval, r.RequeueJitter)}, nil
+	}
+
+	if failures := clusterBreaker.Reset(req.NamespacedName); failures >= r.FailureThreshold {
+		log.Info("resuming suspended hosted cluster", "Name", req.NamespacedName)
+		r.setSuspendedCondition(ctx, req.NamespacedName, metav1.Condition{
+			Type:    constants.SuspendedCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  constants.RecoveredReason,
+			Message: "reconciled successfully",
+		})
+	}
+
+	return result, nil
+}
+
+func (r *HostedClusterReconciler) reconcile(
+	ctx context.Context,
+	req ctrl.Request,
+) (ctrl.Result, error) {
+
+	log := ctrllog.FromContext(ctx).WithName("hostedcluster-controller")
+	r.log = log
 
-	log := logr.Logger{}.WithName("hostedcluster-controller")
+	if !r.inWatchedNamespace(req.Namespace) {
+		r.log.V(3).Info("ignore hosted cluster out of the watched namespaces", "Name", req.NamespacedName)
+		return ctrl.Result{}, nil
+	}
 
 	hostedCluster := &hyperv1beta1.HostedCluster{}
-	found := false
-	err := r.Get(ctx, req.NamespacedName, hostedCluster)
-	if err != nil && errors.IsNotFound(err) {
-		found = false
-	} else if err == nil {
-		found = true
-	} else {
+	err := r.reader().Get(ctx, req.NamespacedName, hostedCluster)
+	if errors.IsNotFound(err) {
+		// A hosted cluster gone is torn down, its metrics are forgotten even if it had no manager
+		r.log.V(1).Info("hosted cluster is gone, stop its manager", "Name", req.NamespacedName)
+		return r.teardown(req.NamespacedName, hcpNamespaceOf(req.NamespacedName, nil)), nil
+	} else if err != nil {
 		return ctrl.Result{}, err
 	}
 
-	_, exist := hostedClusters[req.NamespacedName.Name]
+	// A hosted cluster being deleted is torn down right away, no manager is started for it
+	if !hostedCluster.DeletionTimestamp.IsZero() {
+		r.log.V(1).Info("hosted cluster is being deleted, stop its manager", "Name", req.NamespacedName)
+		return r.teardown(req.NamespacedName, hcpNamespaceOf(req.NamespacedName, hostedCluster)), nil
+	}
 
-	hcpNamespace := fmt.Sprintf("%s-%s", hostedCluster.Namespace, hostedCluster.Name)
-	isReadyCluster := hostedcluster.IsReadyHostedCluster(*hostedCluster)
+	registered, exist := hostedClusters.Get(req.NamespacedName)
+
+	// The hosted cluster was deleted and recreated with the same name, stop the manager of the old one
+	if exist && registered.UID != hostedCluster.UID {
+		r.log.V(1).Info("hosted cluster recreated, stop the old manager", "Name", req.NamespacedName)
+		registered.CancelFunc()
+	}
+
+	// A fresh manager is started only after the previous one has fully stopped
+	if exist && registered.Stopping() {
+		if !registered.Stopped() {
+			r.log.V(1).Info("waiting for the manager to stop", "Name", req.NamespacedName)
+			return ctrl.Result{RequeueAfter: managerStopRequeueInterval}, nil
+		}
+		hostedClusters.Delete(req.NamespacedName)
+		exist = false
+	}
+
+	hcpNamespace := hostedcluster.HCPNamespace(hostedCluster)
+	// The hosted clusters out of the scope of the namespace-scoped operator are not onboarded, it is not granted
+	// their HCP namespace
+	if !r.inHCPNamespaces(hcpNamespace) {
+		r.log.V(3).Info("ignore hosted cluster out of the HCP namespaces", "Name", req.NamespacedName, "Namespace", hcpNamespace)
+		return ctrl.Result{}, nil
+	}
+	// The hosted cluster excluded from all logging is torn down, its forwarding is removed once its manager stopped
+	if hostedcluster.IsLoggingDisabled(hostedCluster, r.DisabledLabel) {
+		r.log.V(1).Info("logging disabled for the hosted cluster, tear down its forwarding", "Name", req.NamespacedName)
+		if result := r.teardown(req.NamespacedName, hcpNamespace); !result.IsZero() {
+			return result, nil
+		}
+		return ctrl.Result{}, r.deleteForwarders(ctx, hcpNamespace)
+	}
+	isReadyCluster := hostedcluster.IsEligibleHostedCluster(*hostedCluster, r.RequiredConditions)
+	kubeConfigSecret := hostedcluster.GuestKubeConfigSecret(hostedCluster, hcpNamespace)
+
+	r.recordHCPNamespace(ctx, hostedCluster, hcpNamespace)
 
 	if !exist {
 		// check hosted cluster status, if it's new created and ready, start the reconcile
 
 		if isReadyCluster {
-			restConfig, err := hostedcluster.BuildGuestKubeConfig(r.Client, hcpNamespace, r.log)
+			// The clusters torn down shortly after they are ready, e.g. in CI, are not onboarded
+			if wait := r.MinClusterAge - time.Since(hostedcluster.ReadySince(hostedCluster)); r.MinClusterAge > 0 && wait > 0 {
+				log.V(1).Info("hosted cluster not ready for long enough, the onboarding is deferred",
+					"Name", req.NamespacedName, "Wait", wait)
+				return ctrl.Result{RequeueAfter: wait}, nil
+			}
+
+			// The guest managers run within the leadership of the operator
+			leaderCtx, isLeader := r.leaderContext()
+			if !isLeader {
+				log.V(1).Info("not the leader, the guest manager is not started", "Name", req.NamespacedName)
+				return ctrl.Result{RequeueAfter: hostedcluster.JitterInterval(leaderRequeueInterval, r.RequeueJitter)}, nil
+			}
+
+			admitted, err := r.admitted(ctx, hostedCluster)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			if !admitted {
+				log.Info("maximum of managed hosted clusters reached, the onboarding is queued",
+					"Name", req.NamespacedName, "MaxManagedClusters", r.MaxManagedClusters)
+				r.queue(hostedCluster)
+				return ctrl.Result{RequeueAfter: hostedcluster.JitterInterval(admissionRequeueInterval, r.RequeueJitter)}, nil
+			}
+
+			if err := r.checkPermissions(ctx, hostedCluster, hcpNamespace, kubeConfigSecret); err != nil {
+				log.Error(err, "checking permissions in HCP namespace", "Namespace", hcpNamespace)
+				return ctrl.Result{}, err
+			}
+
+			restConfig, err := hostedcluster.BuildGuestKubeConfig(r.Client, kubeConfigSecret, hcpNamespace, r.UserAgent, r.log)
+			if goerrors.Is(err, hloerrors.ErrKubeconfigMissing) {
+				// The kubeconfig secret is not published yet early in the provisioning
+				log.V(1).Info("waiting for the kubeconfig secret", "Secret", kubeConfigSecret)
+				return ctrl.Result{RequeueAfter: hostedcluster.JitterInterval(kubeConfigRequeueInterval, r.RequeueJitter)}, nil
+			}
 			if err != nil {
 				log.Error(err, "getting guest cluster kubeconfig")
 				return ctrl.Result{}, err
@@ -99,39 +324,71 @@ func (r *HostedClusterReconciler) Reconcile(
 				return ctrl.Result{}, err
 			}
 
-			hsCluster, err := cluster.New(restConfig)
+			// The guest cluster, its manager and the reconcilers share a single scheme. A registration
+			// failure only fails the onboarding of this hosted cluster, which is retried
+			clusterScheme, err := newGuestScheme()
+			if err != nil {
+				log.Error(err, "registering the guest cluster types")
+				return ctrl.Result{}, err
+			}
+
+			hsCluster, err := newGuestCluster(restConfig, clusterScheme)
 			if err != nil {
+				// The unreachable guest clusters are retried with a backoff, and suspended by the FailureThreshold
 				log.Error(err, "creating guest cluster kubeconfig")
 				return ctrl.Result{}, err
 			}
-			clusterScheme := hsCluster.GetScheme()
-			utilruntime.Must(hyperv1beta1.AddToScheme(clusterScheme))
-			utilruntime.Must(v1alpha1.AddToScheme(clusterScheme))
 
-			ctx := context.Background()
-			ctx, cancelFunc := context.WithCancel(ctx)
+			ctx, cancelFunc := context.WithCancel(leaderCtx)
 
-			newHostedCluster := hypershiftlogforwarder.HostedCluster{
+			newHostedCluster := &hypershiftlogforwarder.HostedCluster{
 				Cluster:      hsCluster,
 				HCPNamespace: hcpNamespace,
 				ClusterName:  hostedCluster.Name,
+				UID:          hostedCluster.UID,
 				Context:      ctx,
 				CancelFunc:   cancelFunc,
+				Done:         make(chan struct{}),
+				Version:      hostedcluster.GuestVersion(hostedCluster.Status.Version),
+				Resync:       make(chan event.GenericEvent),
 			}
-			hostedClusters[req.NamespacedName.Name] = newHostedCluster
 			rhc := hypershiftlogforwarder.HyperShiftLogForwarderReconciler{
-				Client:       hsCluster.GetClient(),
-				Scheme:       clusterScheme,
-				MCClient:     r.Client,
-				HCPNamespace: hcpNamespace,
+				Client:               hsCluster.GetClient(),
+				Scheme:               clusterScheme,
+				MCClient:             r.Client,
+				HCPNamespace:         hcpNamespace,
+				CommonMetadata:       r.CommonMetadata,
+				FinalizerGracePeriod: r.FinalizerGracePeriod,
+				ReadySince:           hostedcluster.ReadySince(hostedCluster),
+				Paused:               r.Paused,
+				HostedClusterKey:     req.NamespacedName,
+				Teardown:             cancelFunc,
+				ResyncInterval:       r.ForwarderResyncInterval,
+				RequeueJitter:        r.RequeueJitter,
+				LoggingVersion:       r.LoggingVersion,
 			}
 
 			rHostedClusterServiceAccount := hypershiftsa.ServiceAccountReconciler{
-				Client:       hsCluster.GetClient(),
-				ClientSet:    clientset,
-				Scheme:       clusterScheme,
-				MCClient:     r.Client,
-				HCPNamespace: hcpNamespace,
+				Client:         hsCluster.GetClient(),
+				ClientSet:      clientset,
+				Scheme:         clusterScheme,
+				MCClient:       r.Client,
+				HCPNamespace:   hcpNamespace,
+				CommonMetadata: r.CommonMetadata,
+				RequeueJitter:  r.RequeueJitter,
+			}
+
+			// The event routers read the guest cluster events with a service account granted to read them only
+			rEventRouterAccess := hypershiftsa.EventRouterAccessReconciler{
+				Client:         hsCluster.GetClient(),
+				Reader:         hsCluster.GetAPIReader(),
+				ClientSet:      clientset,
+				MCClient:       r.Client,
+				HCPNamespace:   hcpNamespace,
+				Server:         restConfig.Host,
+				CAData:         restConfig.CAData,
+				CommonMetadata: r.CommonMetadata,
+				RequeueJitter:  r.RequeueJitter,
 			}
 
 			leaderElectionID := fmt.Sprintf("%s.logging.managed.openshift.io", hostedCluster.Name)
@@ -143,9 +400,11 @@ func (r *HostedClusterReconciler) Reconcile(
 				MetricsBindAddress:     "0",
 				LeaderElectionID:       leaderElectionID,
 				Namespace:              constants.HLFWatchedNamespace,
+				Controller:             r.guestControllerConfig(),
 			})
 
 			if err != nil {
+				cancelFunc()
 				log.Error(err, "creating new sub manager")
 				return ctrl.Result{}, err
 			}
@@ -153,14 +412,51 @@ func (r *HostedClusterReconciler) Reconcile(
 			//Adding hosted cluster to sub manger
 			err = mgrHostedCluster.Add(hsCluster)
 			if err != nil {
+				cancelFunc()
 				log.Error(err, "Adding hosted cluster runnable to sub manager")
 				return ctrl.Result{}, err
 			}
 
-			go func() {
-				err = ctrl.NewControllerManagedBy(mgrHostedCluster).
-					Named(hostedCluster.Name).
+			// The CSVs of the cluster-logging operator are read from the cache of the sub manager, scoped to
+			// the HLF namespace the operator is installed in. They are not watched in the guest clusters without OLM
+			olmInstalled, err := hostedcluster.ServesClusterServiceVersions(mgrHostedCluster.GetRESTMapper())
+			if err != nil {
+				cancelFunc()
+				log.Error(err, "discovering the CSVs of the guest cluster")
+				return ctrl.Result{}, err
+			}
+			if olmInstalled {
+				rhc.LoggingVersionReader = mgrHostedCluster.GetClient()
+			}
+			rLoggingVersion := hypershiftlogforwarder.LoggingVersionReconciler{
+				Client:              mgrHostedCluster.GetClient(),
+				MCClient:            r.Client,
+				HostedClusterReader: r.reader(),
+				HostedClusterKey:    req.NamespacedName,
+			}
+
+			hostedClusters.Add(req.NamespacedName, newHostedCluster)
+
+			newHostedCluster.Go(func(ctx context.Context) {
+				hlfController := ctrl.NewControllerManagedBy(mgrHostedCluster).
+					Named(metrics.GuestControllerName(metrics.HyperShiftLogForwarderController, hostedCluster.Name)).
 					For(&v1alpha1.HyperShiftLogForwarder{}).
+					Watches(&source.Channel{Source: newHostedCluster.Resync}, &handler.EnqueueRequestForObject{})
+				if olmInstalled {
+					// The CLFs are re-rendered once the cluster-logging operator is upgraded
+					hlfController = hlfController.Watches(&source.Kind{Type: hostedcluster.NewClusterServiceVersion()},
+						handler.EnqueueRequestsFromMapFunc(rhc.ForwardersForLoggingOperator),
+						builder.WithPredicates(hostedcluster.LoggingOperatorCSVPredicate()))
+				}
+				err := hlfController.
+					// The CLFs are generated on the management cluster, their deletions are watched from its cache
+					Watches(source.NewKindWithCache(&loggingv1.ClusterLogForwarder{}, r.Mgr.GetCache()),
+						handler.EnqueueRequestsFromMapFunc(rhc.ForwarderForClusterLogForwarder),
+						builder.WithPredicates(clusterlogforwarder.DeletedPredicate(constants.HyperShiftLogForwarderLabel))).
+					// The next HLF takes over once the applied one is deleted
+					Watches(&source.Kind{Type: &v1alpha1.HyperShiftLogForwarder{}},
+						handler.EnqueueRequestsFromMapFunc(rhc.ConflictingForwarders),
+						builder.WithPredicates(hypershiftlogforwarder.DeletedForwarderPredicate())).
 					WithEventFilter(eventPredicates()).
 					Complete(&rhc)
 
@@ -169,9 +465,8 @@ func (r *HostedClusterReconciler) Reconcile(
 				}
 
 				// Add hosted cluster service account minter to sub manager
-				controllerName := fmt.Sprintf("service_account_%s", hostedCluster.Name)
 				err = ctrl.NewControllerManagedBy(mgrHostedCluster).
-					Named(controllerName).
+					Named(metrics.GuestControllerName(metrics.ServiceAccountController, hostedCluster.Name)).
 					For(&corev1.ServiceAccount{}).
 					Complete(&rHostedClusterServiceAccount)
 
@@ -179,35 +474,247 @@ func (r *HostedClusterReconciler) Reconcile(
 					r.log.Error(err, "problem adding secret controller to sub manager", "Name", hostedCluster.Name)
 				}
 
-				r.log.Info("starting HostedCluster manager", "Name", hostedCluster.Name)
-				if err := mgrHostedCluster.Start(ctx); err != nil {
-					r.log.Error(err, "problem running HostedCluster manager", "Name", hostedCluster.Name)
+				// The access of the event routers is refreshed periodically, the service account events are
+				// mapped to a single request
+				err = ctrl.NewControllerManagedBy(mgrHostedCluster).
+					Named(metrics.GuestControllerName(metrics.EventRouterAccessController, hostedCluster.Name)).
+					Watches(&source.Kind{Type: &corev1.ServiceAccount{}}, handler.EnqueueRequestsFromMapFunc(
+						func(client.Object) []reconcile.Request {
+							return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: constants.EventRouterServiceAccountName}}}
+						})).
+					Complete(&rEventRouterAccess)
+
+				if err != nil {
+					r.log.Error(err, "problem adding event router access controller to sub manager", "Name", hostedCluster.Name)
+				}
+
+				// The cluster-logging version detected in the guest cluster is recorded on the HostedCluster,
+				// the templates are rendered for it
+				if olmInstalled {
+					err = ctrl.NewControllerManagedBy(mgrHostedCluster).
+						Named(metrics.GuestControllerName(metrics.LoggingVersionController, hostedCluster.Name)).
+						For(hostedcluster.NewClusterServiceVersion(), builder.WithPredicates(hostedcluster.LoggingOperatorCSVPredicate())).
+						Complete(&rLoggingVersion)
+
+					if err != nil {
+						r.log.Error(err, "problem adding logging version controller to sub manager", "Name", hostedCluster.Name)
+					}
 				}
 
-			}()
+				r.log.Info("starting HostedCluster manager", "Name", hostedCluster.Name)
+				r.runGuestManager(ctx, req.NamespacedName, newHostedCluster, mgrHostedCluster.Start)
+			})
 
 			return ctrl.Result{}, nil
 		}
 
 	} else {
-		//Stop the controller when cluster is not ready or deleted
+		//Stop the controller when cluster is not ready
 
-		r.log.V(1).Info("Stop existing managers", "ready cluster", isReadyCluster, "found", found)
-		validKubeConfig, _ := hostedcluster.ValidateKubeConfig(r.Client, hcpNamespace)
+		r.log.V(1).Info("Stop existing managers", "ready cluster", isReadyCluster)
+		validKubeConfig, _ := hostedcluster.ValidateKubeConfig(r.Client, kubeConfigSecret)
 
-		if !isReadyCluster || !found || !validKubeConfig {
-			cancelFunc := hostedClusters[req.NamespacedName.Name].CancelFunc
-			cancelFunc()
-			r.log.V(1).Info("stop the manager", "controller name", hostedClusters[req.NamespacedName.Name])
+		if !isReadyCluster || !validKubeConfig {
+			registered.CancelFunc()
+			r.log.V(1).Info("stop the manager", "controller name", registered.ClusterName)
 
-			//delete hosted cluster from the map since it may create / active again
-			delete(hostedClusters, req.NamespacedName.Name)
+			// Keep the hosted cluster in the registry until its manager has fully stopped,
+			// it is removed on the next reconcile so that it may be created / active again
+			return ctrl.Result{RequeueAfter: managerStopRequeueInterval}, nil
+		}
+
+		// Re-apply the forwarders once the hosted cluster is upgraded, for the cluster-logging version
+		// running after the upgrade
+		if version := hostedcluster.GuestVersion(hostedCluster.Status.Version); version != "" && version != registered.Version {
+			r.log.Info("hosted cluster upgraded, resync the forwarders", "Name", req.NamespacedName,
+				"From", registered.Version, "To", version)
+			registered.Version = version
+			if err := resyncForwarders(ctx, registered); err != nil {
+				return ctrl.Result{}, err
+			}
 		}
 	}
 
 	return ctrl.Result{}, nil
 }
 
+// teardown stops the manager of the hosted cluster and removes it from the registry once fully stopped,
+// the reconcile is requeued until then. The metrics of the hosted cluster are forgotten once torn down, those
+// of the HCP namespace given when it has no manager
+func (r *HostedClusterReconciler) teardown(key types.NamespacedName, hcpNamespace string) ctrl.Result {
+	registered, exist := hostedClusters.Get(key)
+	if !exist {
+		metrics.ForgetCluster(hcpNamespace)
+		return ctrl.Result{}
+	}
+
+	registered.CancelFunc()
+	if !registered.Stopped() {
+		return ctrl.Result{RequeueAfter: managerStopRequeueInterval}
+	}
+	hostedClusters.Delete(key)
+	metrics.ForgetCluster(registered.HCPNamespace)
+	return ctrl.Result{}
+}
+
+// hcpNamespaceOf returns the HCP namespace of the hosted cluster, the one of its manager once the hosted
+// cluster is gone
+func hcpNamespaceOf(key types.NamespacedName, hostedCluster *hyperv1beta1.HostedCluster) string {
+	if hostedCluster != nil {
+		return hostedcluster.HCPNamespace(hostedCluster)
+	}
+	if registered, exist := hostedClusters.Get(key); exist && registered.HCPNamespace != "" {
+		return registered.HCPNamespace
+	}
+	return fmt.Sprintf("%s-%s", key.Namespace, key.Name)
+}
+
+// deleteForwarders deletes the CLFs generated from the HLFs in the HCP namespace, the unmanaged CLFs are left intact
+func (r *HostedClusterReconciler) deleteForwarders(ctx context.Context, hcpNamespace string) error {
+	clfList := &loggingv1.ClusterLogForwarderList{}
+	if err := r.List(ctx, clfList, client.InNamespace(hcpNamespace),
+		client.MatchingLabels{constants.ManagedByLabel: constants.ManagedByLabelValue},
+		client.HasLabels{constants.HyperShiftLogForwarderLabel}); err != nil {
+		return fmt.Errorf("failed to list the CLFs in %s: %w", hcpNamespace, err)
+	}
+	for i := range clfList.Items {
+		clf := &clfList.Items[i]
+		if clusterlogforwarder.IsUnmanaged(clf) {
+			continue
+		}
+		if err := client.IgnoreNotFound(r.Delete(ctx, clf)); err != nil {
+			return fmt.Errorf("failed to delete the CLF %s/%s: %w", clf.Namespace, clf.Name, err)
+		}
+		r.log.Info("deleted the CLF of the hosted cluster excluded from logging", "Name", clf.Name, "Namespace", clf.Namespace)
+	}
+	return nil
+}
+
+// resyncForwarders triggers the reconcile of all the HLFs of the hosted cluster,
+// the events are delivered in the background not to block on a sub manager which is not started yet
+func resyncForwarders(ctx context.Context, hc *hypershiftlogforwarder.HostedCluster) error {
+	hlfList := &v1alpha1.HyperShiftLogForwarderList{}
+	if err := hc.Cluster.GetClient().List(ctx, hlfList, client.InNamespace(constants.HLFWatchedNamespace)); err != nil {
+		return err
+	}
+
+	hc.Go(func(ctx context.Context) {
+		for i := range hlfList.Items {
+			select {
+			case hc.Resync <- event.GenericEvent{Object: &hlfList.Items[i]}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+
+	return nil
+}
+
+// checkPermissions verifies the operator is allowed to onboard the hosted cluster and
+// records the result as a condition on the HostedCluster
+func (r *HostedClusterReconciler) checkPermissions(
+	ctx context.Context,
+	hostedCluster *hyperv1beta1.HostedCluster,
+	hcpNamespace string,
+	kubeConfigSecret types.NamespacedName,
+) error {
+	denied, err := hostedcluster.CheckPermissions(r.Client, ctx, hcpNamespace, kubeConfigSecret)
+	if err != nil {
+		return err
+	}
+
+	condition := metav1.Condition{
+		Type:    constants.PermissionsCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  constants.PermissionsGrantedReason,
+		Message: "all the required permissions are granted",
+	}
+	var deniedErr error
+	if len(denied) > 0 {
+		verbs := make([]string, 0, len(denied))
+		for _, p := range denied {
+			verbs = append(verbs, p.String())
+		}
+		deniedErr = hloerrors.Wrap(hloerrors.ErrPermissionDenied,
+			fmt.Errorf("permission denied in namespace %s: %s", hcpNamespace, strings.Join(verbs, ", ")))
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = constants.PermissionsDeniedReason
+		condition.Message = deniedErr.Error()
+	}
+
+	// Only report the granted permissions when recovering from a previous denial
+	existing := meta.FindStatusCondition(hostedCluster.Status.Conditions, condition.Type)
+	if (existing == nil && deniedErr == nil) ||
+		(existing != nil && existing.Status == condition.Status && existing.Message == condition.Message) {
+		return deniedErr
+	}
+
+	r.updateCondition(ctx, hostedCluster, condition)
+
+	return deniedErr
+}
+
+// setSuspendedCondition records the suspension of the hosted cluster on its status
+func (r *HostedClusterReconciler) setSuspendedCondition(
+	ctx context.Context,
+	key types.NamespacedName,
+	condition metav1.Condition,
+) {
+	hostedCluster := &hyperv1beta1.HostedCluster{}
+	if err := r.reader().Get(ctx, key, hostedCluster); err != nil {
+		if !errors.IsNotFound(err) {
+			ctrllog.FromContext(ctx).Error(err, "getting hosted cluster", "Name", key)
+		}
+		return
+	}
+	r.updateCondition(ctx, hostedCluster, condition)
+}
+
+// recordHCPNamespace stamps the HostedCluster with the HCP namespace resolved for it by the operator
+func (r *HostedClusterReconciler) recordHCPNamespace(
+	ctx context.Context,
+	hostedCluster *hyperv1beta1.HostedCluster,
+	hcpNamespace string,
+) {
+	if hostedCluster.Annotations[constants.HCPNamespaceAnnotation] == hcpNamespace {
+		return
+	}
+	// The HostedCluster is owned by HyperShift, the annotation is patched only
+	patch := client.MergeFrom(hostedCluster.DeepCopy())
+	if hostedCluster.Annotations == nil {
+		hostedCluster.Annotations = map[string]string{}
+	}
+	hostedCluster.Annotations[constants.HCPNamespaceAnnotation] = hcpNamespace
+	if err := r.Patch(ctx, hostedCluster, patch); err != nil {
+		ctrllog.FromContext(ctx).Error(err, "recording the HCP namespace", "Name", hostedCluster.Name, "Namespace", hcpNamespace)
+	}
+}
+
+// updateCondition sets the condition on the HostedCluster status
+func (r *HostedClusterReconciler) updateCondition(
+	ctx context.Context,
+	hostedCluster *hyperv1beta1.HostedCluster,
+	condition metav1.Condition,
+) {
+	meta.SetStatusCondition(&hostedCluster.Status.Conditions, condition)
+	if err := r.Status().Update(ctx, hostedCluster); err != nil {
+		ctrllog.FromContext(ctx).Error(err, "updating condition", "Name", hostedCluster.Name, "Condition", condition.Type)
+	}
+}
+
+// newGuestCluster returns the cluster of the guest API server, an ErrGuestUnreachable error if it cannot be
+// reached to discover its resources
+func newGuestCluster(restConfig *rest.Config, scheme *runtime.Scheme) (cluster.Cluster, error) {
+	hsCluster, err := cluster.New(restConfig, func(o *cluster.Options) {
+		o.Scheme = scheme
+	})
+	if err != nil {
+		return nil, hloerrors.Wrap(hloerrors.ErrGuestUnreachable, err)
+	}
+	return hsCluster, nil
+}
+
 func eventPredicates() predicate.Predicate {
 	return predicate.Funcs{
 		DeleteFunc: func(e event.DeleteEvent) bool {
@@ -216,10 +723,112 @@ func eventPredicates() predicate.Predicate {
 	}
 }
 
+// inWatchedNamespace returns true if the namespace is in the scope of the reconciler
+func (r *HostedClusterReconciler) inWatchedNamespace(namespace string) bool {
+	if len(r.WatchNamespaces) == 0 {
+		return true
+	}
+	for _, ns := range r.WatchNamespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// inHCPNamespaces returns true if the HCP namespace is in the scope of the reconciler
+func (r *HostedClusterReconciler) inHCPNamespaces(namespace string) bool {
+	if len(r.HCPNamespaces) == 0 {
+		return true
+	}
+	for _, ns := range r.HCPNamespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// reader returns the reader used to get the HostedClusters
+func (r *HostedClusterReconciler) reader() client.Reader {
+	if r.hostedClusterReader != nil {
+		return r.hostedClusterReader
+	}
+	return r.Client
+}
+
+// guestControllerConfig returns the configuration of the controllers of the guest managers
+func (r *HostedClusterReconciler) guestControllerConfig() ctrlconfig.ControllerConfigurationSpec {
+	if r.CacheSyncTimeout == 0 {
+		return ctrlconfig.ControllerConfigurationSpec{}
+	}
+	timeout := r.CacheSyncTimeout
+	return ctrlconfig.ControllerConfigurationSpec{CacheSyncTimeout: &timeout}
+}
+
+// leaderContext returns the context the guest managers are started with, false if the operator is not the leader
+func (r *HostedClusterReconciler) leaderContext() (context.Context, bool) {
+	if r.leader == nil {
+		return context.Background(), true
+	}
+	return r.leader.Context()
+}
+
+// NewHostedClusterCache returns the cache the HostedClusters are read and watched from, the cache of the manager
+// unless the watched namespaces are set. Only the HostedCluster informer is restricted to the watched namespaces,
+// the other resources live in the HCP namespaces. The cache is shared by all the controllers watching the
+// HostedClusters, so that a single informer is started
+func NewHostedClusterCache(mgr ctrl.Manager, watchNamespaces []string) (cache.Cache, error) {
+	if len(watchNamespaces) == 0 {
+		return mgr.GetCache(), nil
+	}
+	hcCache, err := cache.MultiNamespacedCacheBuilder(watchNamespaces)(mgr.GetConfig(), cache.Options{
+		Scheme: mgr.GetScheme(),
+		Mapper: mgr.GetRESTMapper(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := mgr.Add(hcCache); err != nil {
+		return nil, err
+	}
+	return hcCache, nil
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *HostedClusterReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.retries = make(chan event.GenericEvent)
+	r.leader = &leaderGate{}
+	if err := mgr.Add(r.leader); err != nil {
+		return err
+	}
+	if err := mgr.Add(&startupRecovery{r: r}); err != nil {
+		return err
+	}
+
+	hcCache := r.HostedClusterCache
+	if hcCache == nil {
+		var err error
+		if hcCache, err = NewHostedClusterCache(mgr, r.WatchNamespaces); err != nil {
+			return err
+		}
+	}
+
+	if len(r.WatchNamespaces) == 0 {
+		return ctrl.NewControllerManagedBy(mgr).
+			For(&hyperv1beta1.HostedCluster{}, builder.WithPredicates(hostedClusterChangedPredicate(r.RequiredConditions))).
+			Watches(&source.Channel{Source: r.retries}, &handler.EnqueueRequestForObject{}).
+			WithEventFilter(eventPredicates()).
+			Complete(r)
+	}
+
+	r.hostedClusterReader = hcCache
+
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&hyperv1beta1.HostedCluster{}).
+		Named("hostedcluster").
+		Watches(source.NewKindWithCache(&hyperv1beta1.HostedCluster{}, hcCache), &handler.EnqueueRequestForObject{},
+			builder.WithPredicates(hostedClusterChangedPredicate(r.RequiredConditions))).
+		Watches(&source.Channel{Source: r.retries}, &handler.EnqueueRequestForObject{}).
 		WithEventFilter(eventPredicates()).
 		Complete(r)
 }
@@ -0,0 +1,1386 @@
+package hostedcluster
+
+import (
+	"context"
+	goerrors "errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	configv1 "github.com/openshift/api/config/v1"
+	loggingv1 "github.com/openshift/cluster-logging-operator/apis/logging/v1"
+	hyperv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/goleak"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/openshift/hypershift-logging-operator/api/v1alpha1"
+	"github.com/openshift/hypershift-logging-operator/controllers/hypershiftlogforwarder"
+	"github.com/openshift/hypershift-logging-operator/pkg/constants"
+	hloerrors "github.com/openshift/hypershift-logging-operator/pkg/errors"
+	"github.com/openshift/hypershift-logging-operator/pkg/hostedcluster"
+	"github.com/openshift/hypershift-logging-operator/pkg/metrics"
+)
+
+// accessReviewClient answers the SelfSubjectAccessReviews, denying the given resources
+type accessReviewClient struct {
+	client.Client
+	deniedResources map[string]bool
+}
+
+func (c *accessReviewClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	review, ok := obj.(*authorizationv1.SelfSubjectAccessReview)
+	if !ok {
+		return c.Client.Create(ctx, obj, opts...)
+	}
+	review.Status.Allowed = !c.deniedResources[review.Spec.ResourceAttributes.Resource]
+	return nil
+}
+
+func TestReconcileRecreatedHostedCluster(t *testing.T) {
+	hostedClusters = newClusterRegistry()
+	key := types.NamespacedName{Name: "test", Namespace: "clusters"}
+
+	// The manager of the deleted cluster is still shutting down
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	old := &hypershiftlogforwarder.HostedCluster{
+		ClusterName: key.Name,
+		UID:         "old-uid",
+		Context:     ctx,
+		CancelFunc:  cancelFunc,
+		Done:        make(chan struct{}),
+	}
+	hostedClusters.Add(key, old)
+
+	// The cluster is recreated with the same name and is not ready yet
+	hc := &hyperv1beta1.HostedCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      key.Name,
+			Namespace: key.Namespace,
+			UID:       "new-uid",
+		},
+	}
+	r := &HostedClusterReconciler{Client: newTestClient(t, hc)}
+
+	result, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: key})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if result.RequeueAfter != managerStopRequeueInterval {
+		t.Errorf("mismatched requeue, expected %v, got %v", managerStopRequeueInterval, result.RequeueAfter)
+	}
+	if !old.Stopping() {
+		t.Error("expected the old manager to be stopped")
+	}
+	if registered, _ := hostedClusters.Get(key); registered != old {
+		t.Error("expected the old cluster to stay registered until its manager stopped")
+	}
+
+	// Once the old manager has fully stopped it is removed from the registry
+	close(old.Done)
+	if _, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if _, exist := hostedClusters.Get(key); exist {
+		t.Error("expected the old cluster to be removed from the registry")
+	}
+}
+
+func TestReconcileHostedClusterBeingDeleted(t *testing.T) {
+	hostedClusters = newClusterRegistry()
+	key := types.NamespacedName{Name: "test", Namespace: "clusters"}
+
+	// The hosted cluster is ready but being deleted, the finalizers of HyperShift keep it around
+	now := metav1.Now()
+	hc := &hyperv1beta1.HostedCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              key.Name,
+			Namespace:         key.Namespace,
+			DeletionTimestamp: &now,
+			Finalizers:        []string{"hypershift.openshift.io/finalizer"},
+		},
+		Status: hyperv1beta1.HostedClusterStatus{
+			Conditions: []metav1.Condition{{
+				Type:   string(hyperv1beta1.HostedClusterAvailable),
+				Status: metav1.ConditionTrue,
+			}},
+		},
+	}
+	r := &HostedClusterReconciler{Client: newTestClient(t, hc)}
+
+	result, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: key})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if !result.IsZero() {
+		t.Errorf("mismatched result, expected %v, got %v", ctrl.Result{}, result)
+	}
+	if _, exist := hostedClusters.Get(key); exist {
+		t.Error("expected no manager to be created for the hosted cluster being deleted")
+	}
+
+	// The manager started before the deletion is stopped and removed once fully stopped
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	registered := &hypershiftlogforwarder.HostedCluster{
+		ClusterName: key.Name,
+		Context:     ctx,
+		CancelFunc:  cancelFunc,
+		Done:        make(chan struct{}),
+	}
+	hostedClusters.Add(key, registered)
+
+	result, err = r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: key})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if !registered.Stopping() {
+		t.Error("expected the manager to be stopped")
+	}
+	if result.RequeueAfter != managerStopRequeueInterval {
+		t.Errorf("mismatched requeue, expected %v, got %v", managerStopRequeueInterval, result.RequeueAfter)
+	}
+
+	close(registered.Done)
+	if _, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if _, exist := hostedClusters.Get(key); exist {
+		t.Error("expected the stopped cluster to be removed from the registry")
+	}
+}
+
+func TestReconcileForgetsClusterMetrics(t *testing.T) {
+	tests := []struct {
+		name         string
+		hostedRemove bool
+		annotation   string
+		hcpNamespace string
+	}{
+		{
+			name:         "hosted cluster gone",
+			hostedRemove: true,
+			hcpNamespace: "clusters-test",
+		},
+		{
+			name:         "hosted cluster being deleted",
+			hcpNamespace: "clusters-test",
+		},
+		{
+			name:         "hosted cluster being deleted with a recorded HCP namespace",
+			annotation:   "hcp-test",
+			hcpNamespace: "hcp-test",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hostedClusters = newClusterRegistry()
+			key := types.NamespacedName{Name: "test", Namespace: "clusters"}
+			now := metav1.Now()
+			hc := &hyperv1beta1.HostedCluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              key.Name,
+					Namespace:         key.Namespace,
+					DeletionTimestamp: &now,
+					Finalizers:        []string{"hypershift.openshift.io/finalizer"},
+				},
+			}
+			if tt.annotation != "" {
+				hc.Annotations = map[string]string{constants.HCPNamespaceAnnotation: tt.annotation}
+			}
+			var objs []client.Object
+			if !tt.hostedRemove {
+				objs = append(objs, hc)
+			}
+			r := &HostedClusterReconciler{Client: newTestClient(t, objs...)}
+
+			// The forwarders of the HCP namespace were reconciled, e.g. by a template, without a manager
+			metrics.ObserveClusterReconcile(tt.hcpNamespace, nil)
+			if clusterSeries(t, tt.hcpNamespace) == 0 {
+				t.Fatalf("expected the series of %s to be recorded", tt.hcpNamespace)
+			}
+			if _, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: key}); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if got := clusterSeries(t, tt.hcpNamespace); got != 0 {
+				t.Errorf("mismatched series of %s, expected 0, got %d", tt.hcpNamespace, got)
+			}
+		})
+	}
+}
+
+// clusterSeries returns the number of series of the hosted cluster metrics labeled with the cluster
+func clusterSeries(t *testing.T, cluster string) int {
+	families, err := ctrlmetrics.Registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	series := 0
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "cluster" && label.GetValue() == cluster {
+					series++
+				}
+			}
+		}
+	}
+	return series
+}
+
+func TestReconcileWatchNamespaces(t *testing.T) {
+	tests := []struct {
+		name            string
+		namespace       string
+		expectedRequeue time.Duration
+	}{
+		{
+			// The ready cluster is onboarded and waits for the missing kubeconfig secret
+			name:            "in scope cluster is reconciled",
+			namespace:       "watched",
+			expectedRequeue: kubeConfigRequeueInterval,
+		},
+		{
+			name:      "out of scope cluster is ignored",
+			namespace: "not-watched",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hostedClusters = newClusterRegistry()
+			hc := &hyperv1beta1.HostedCluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: test.namespace,
+				},
+				Status: hyperv1beta1.HostedClusterStatus{
+					Conditions: []metav1.Condition{
+						{Type: "Available", Status: metav1.ConditionTrue},
+					},
+				},
+			}
+			r := &HostedClusterReconciler{
+				Client:          &accessReviewClient{Client: newTestClient(t, hc)},
+				WatchNamespaces: []string{"watched"},
+			}
+
+			result, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(hc)})
+			if err != nil {
+				t.Fatalf("expected no err, got %v", err)
+			}
+			if result.RequeueAfter != test.expectedRequeue {
+				t.Errorf("mismatched requeue, expected %v, got %v", test.expectedRequeue, result.RequeueAfter)
+			}
+		})
+	}
+}
+
+func TestReconcileHCPNamespaces(t *testing.T) {
+	tests := []struct {
+		name            string
+		clusterName     string
+		hcpNamespace    string
+		expectedRequeue time.Duration
+	}{
+		{
+			// The ready cluster is onboarded and waits for the missing kubeconfig secret
+			name:            "cluster of a granted HCP namespace is reconciled",
+			clusterName:     "example",
+			expectedRequeue: kubeConfigRequeueInterval,
+		},
+		{
+			name:        "cluster of another HCP namespace is ignored",
+			clusterName: "other",
+		},
+		{
+			name:            "cluster of a recorded granted HCP namespace is reconciled",
+			clusterName:     "other",
+			hcpNamespace:    "clusters-example",
+			expectedRequeue: kubeConfigRequeueInterval,
+		},
+		{
+			name:         "cluster of a recorded other HCP namespace is ignored",
+			clusterName:  "example",
+			hcpNamespace: "clusters-other",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hostedClusters = newClusterRegistry()
+			hc := &hyperv1beta1.HostedCluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      test.clusterName,
+					Namespace: "clusters",
+				},
+				Status: hyperv1beta1.HostedClusterStatus{
+					Conditions: []metav1.Condition{
+						{Type: "Available", Status: metav1.ConditionTrue},
+					},
+				},
+			}
+			if test.hcpNamespace != "" {
+				hc.Annotations = map[string]string{constants.HCPNamespaceAnnotation: test.hcpNamespace}
+			}
+			r := &HostedClusterReconciler{
+				Client:          &accessReviewClient{Client: newTestClient(t, hc)},
+				WatchNamespaces: []string{"clusters"},
+				HCPNamespaces:   []string{"clusters-example"},
+			}
+
+			result, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(hc)})
+			if err != nil {
+				t.Fatalf("expected no err, got %v", err)
+			}
+			if result.RequeueAfter != test.expectedRequeue {
+				t.Errorf("mismatched requeue, expected %v, got %v", test.expectedRequeue, result.RequeueAfter)
+			}
+		})
+	}
+}
+
+func TestReconcileKubeConfigSecret(t *testing.T) {
+	tests := []struct {
+		name       string
+		kubeConfig *corev1.LocalObjectReference
+		secret     types.NamespacedName
+	}{
+		{
+			name:       "secret from the hosted cluster status",
+			kubeConfig: &corev1.LocalObjectReference{Name: "test-admin-kubeconfig"},
+			secret:     types.NamespacedName{Name: "test-admin-kubeconfig", Namespace: "clusters"},
+		},
+		{
+			name:   "conventional secret in the HCP namespace",
+			secret: types.NamespacedName{Name: hostedcluster.KubeConfigSecret, Namespace: "clusters-test"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hostedClusters = newClusterRegistry()
+			hc := &hyperv1beta1.HostedCluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "clusters",
+				},
+				Status: hyperv1beta1.HostedClusterStatus{
+					KubeConfig: test.kubeConfig,
+					Conditions: []metav1.Condition{
+						{Type: "Available", Status: metav1.ConditionTrue},
+					},
+				},
+			}
+			c := &accessReviewClient{Client: newTestClient(t, hc)}
+			r := &HostedClusterReconciler{Client: c}
+			req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(hc)}
+
+			result, err := r.Reconcile(context.TODO(), req)
+			if err != nil {
+				t.Fatalf("expected no err, got %v", err)
+			}
+			if result.RequeueAfter != kubeConfigRequeueInterval {
+				t.Errorf("mismatched requeue, expected %v, got %v", kubeConfigRequeueInterval, result.RequeueAfter)
+			}
+
+			// Once published, the secret is read from the expected location
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: test.secret.Name, Namespace: test.secret.Namespace},
+				Data:       map[string][]byte{"kubeconfig": []byte("invalid")},
+			}
+			if err := c.Create(context.TODO(), secret); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := r.Reconcile(context.TODO(), req); err == nil {
+				t.Error("expected err on the invalid kubeconfig, got nil")
+			}
+		})
+	}
+}
+
+func TestNewGuestClusterUnreachable(t *testing.T) {
+	scheme, err := newGuestScheme()
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	// Nothing listens on the port, the discovery of the guest resources fails
+	restConfig := &rest.Config{Host: "https://127.0.0.1:1", Timeout: time.Second}
+
+	if _, err := newGuestCluster(restConfig, scheme); !goerrors.Is(err, hloerrors.ErrGuestUnreachable) {
+		t.Errorf("expected the %v error, got %v", hloerrors.ErrGuestUnreachable, err)
+	}
+}
+
+func TestReconcileDeniedPermissions(t *testing.T) {
+	hostedClusters = newClusterRegistry()
+	hc := &hyperv1beta1.HostedCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: "clusters",
+		},
+		Status: hyperv1beta1.HostedClusterStatus{
+			Conditions: []metav1.Condition{
+				{Type: "Available", Status: metav1.ConditionTrue},
+			},
+		},
+	}
+	c := &accessReviewClient{
+		Client:          newTestClient(t, hc),
+		deniedResources: map[string]bool{"secrets": true},
+	}
+	r := &HostedClusterReconciler{Client: c}
+	key := client.ObjectKeyFromObject(hc)
+
+	if _, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: key}); !goerrors.Is(err, hloerrors.ErrPermissionDenied) {
+		t.Fatalf("expected the %v error, got %v", hloerrors.ErrPermissionDenied, err)
+	}
+	if _, exist := hostedClusters.Get(key); exist {
+		t.Error("expected no manager to be started without permissions")
+	}
+
+	updated := &hyperv1beta1.HostedCluster{}
+	if err := c.Get(context.TODO(), key, updated); err != nil {
+		t.Fatal(err)
+	}
+	condition := meta.FindStatusCondition(updated.Status.Conditions, constants.PermissionsCondition)
+	if condition == nil {
+		t.Fatal("expected the permissions condition to be set")
+	}
+	if condition.Status != metav1.ConditionFalse || condition.Reason != constants.PermissionsDeniedReason {
+		t.Errorf("mismatched condition, expected %v/%v, got %v/%v",
+			metav1.ConditionFalse, constants.PermissionsDeniedReason, condition.Status, condition.Reason)
+	}
+	expected := "permission denied in namespace clusters-test: get secrets/" + hostedcluster.KubeConfigSecret
+	if condition.Message != expected {
+		t.Errorf("mismatched message, expected %v, got %v", expected, condition.Message)
+	}
+
+	// Once the permission is granted the condition recovers
+	c.deniedResources = nil
+	if _, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := c.Get(context.TODO(), key, updated); err != nil {
+		t.Fatal(err)
+	}
+	if !meta.IsStatusConditionTrue(updated.Status.Conditions, constants.PermissionsCondition) {
+		t.Error("expected the permissions condition to be true")
+	}
+}
+
+func TestReconcileGuestSchemeFailure(t *testing.T) {
+	hostedClusters = newClusterRegistry()
+	builder := guestSchemeBuilder
+	defer func() { guestSchemeBuilder = builder }()
+	guestSchemeBuilder = runtime.NewSchemeBuilder(func(*runtime.Scheme) error {
+		return fmt.Errorf("conflicting registration")
+	})
+
+	hc := &hyperv1beta1.HostedCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: "clusters",
+		},
+		Status: hyperv1beta1.HostedClusterStatus{
+			Conditions: []metav1.Condition{
+				{Type: "Available", Status: metav1.ConditionTrue},
+			},
+		},
+	}
+	kubeConfig := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: hostedcluster.KubeConfigSecret, Namespace: "clusters-test"},
+		Data: map[string][]byte{"kubeconfig": []byte(`apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: https://kube-apiserver:6443
+contexts:
+- name: test
+  context:
+    cluster: test
+current-context: test
+`)},
+	}
+	r := &HostedClusterReconciler{Client: &accessReviewClient{Client: newTestClient(t, hc, kubeConfig)}}
+	key := client.ObjectKeyFromObject(hc)
+
+	// The failure is returned for the hosted cluster to be requeued instead of crashing the operator
+	_, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: key})
+	if err == nil || !strings.Contains(err.Error(), "conflicting registration") {
+		t.Fatalf("expected the registration err, got %v", err)
+	}
+	if _, exist := hostedClusters.Get(key); exist {
+		t.Error("expected no manager to be started without the guest scheme")
+	}
+}
+
+func TestGuestScheme(t *testing.T) {
+	s, err := newGuestScheme()
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	// The guest client is built from the scheme shared with the guest manager and reconcilers
+	guestClient := fake.NewClientBuilder().WithScheme(s).Build()
+
+	for _, obj := range []client.Object{
+		&v1alpha1.HyperShiftLogForwarder{
+			ObjectMeta: metav1.ObjectMeta{Name: "instance", Namespace: constants.HLFWatchedNamespace},
+		},
+		&corev1.ServiceAccount{
+			ObjectMeta: metav1.ObjectMeta{Name: "collector", Namespace: constants.HLFWatchedNamespace},
+		},
+	} {
+		if err := guestClient.Create(context.TODO(), obj); err != nil {
+			t.Fatalf("unexpected err creating %T: %v", obj, err)
+		}
+		if err := guestClient.Get(context.TODO(), client.ObjectKeyFromObject(obj), obj); err != nil {
+			t.Fatalf("unexpected err reading %T: %v", obj, err)
+		}
+	}
+}
+
+func TestReconcileMinClusterAge(t *testing.T) {
+	hostedClusters = newClusterRegistry()
+	hc := &hyperv1beta1.HostedCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: "clusters",
+		},
+		Status: hyperv1beta1.HostedClusterStatus{
+			Conditions: []metav1.Condition{
+				{Type: "Available", Status: metav1.ConditionTrue, LastTransitionTime: metav1.Now()},
+			},
+		},
+	}
+	r := &HostedClusterReconciler{
+		Client:        &accessReviewClient{Client: newTestClient(t, hc)},
+		MinClusterAge: 10 * time.Minute,
+	}
+	key := client.ObjectKeyFromObject(hc)
+
+	result, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: key})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	// Requeued once the cluster is old enough
+	if result.RequeueAfter < r.MinClusterAge-time.Minute || result.RequeueAfter > r.MinClusterAge {
+		t.Errorf("mismatched requeue, expected about %v, got %v", r.MinClusterAge, result.RequeueAfter)
+	}
+	if _, exist := hostedClusters.Get(key); exist {
+		t.Error("expected the onboarding of the freshly ready cluster to be deferred")
+	}
+}
+
+func TestReconcileRequiredConditions(t *testing.T) {
+	hostedClusters = newClusterRegistry()
+	hc := &hyperv1beta1.HostedCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: "clusters",
+		},
+		Status: hyperv1beta1.HostedClusterStatus{
+			Conditions: []metav1.Condition{
+				{Type: "Available", Status: metav1.ConditionTrue, LastTransitionTime: metav1.Now()},
+				{Type: "ClusterVersionSucceeding", Status: metav1.ConditionFalse, LastTransitionTime: metav1.Now()},
+			},
+		},
+	}
+	// The other cluster is completely provisioned but ready after the partially provisioned one
+	other := &hyperv1beta1.HostedCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "clusters"},
+		Status: hyperv1beta1.HostedClusterStatus{
+			Conditions: []metav1.Condition{
+				{Type: "Available", Status: metav1.ConditionTrue, LastTransitionTime: metav1.NewTime(time.Now().Add(time.Minute))},
+				{Type: "ClusterVersionSucceeding", Status: metav1.ConditionTrue, LastTransitionTime: metav1.Now()},
+			},
+		},
+	}
+	r := &HostedClusterReconciler{
+		Client:             &accessReviewClient{Client: newTestClient(t, hc, other)},
+		RequiredConditions: []string{"ClusterVersionSucceeding"},
+		MaxManagedClusters: 1,
+	}
+	key := client.ObjectKeyFromObject(hc)
+
+	// The partially provisioned cluster is not onboarded until its required condition is true
+	if _, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if _, exist := hostedClusters.Get(key); exist {
+		t.Error("expected the cluster without its required condition not to be onboarded")
+	}
+	// and it is not queued for a slot either
+	admitted, err := r.admitted(context.TODO(), other)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if !admitted {
+		t.Error("expected the cluster without its required condition to take no slot")
+	}
+
+	// The update of the required condition is reconciled
+	updated := hc.DeepCopy()
+	updated.Status.Conditions[1].Status = metav1.ConditionTrue
+	if !hostedClusterChangedPredicate(r.RequiredConditions).Update(event.UpdateEvent{ObjectOld: hc, ObjectNew: updated}) {
+		t.Error("expected the update of the required condition to pass")
+	}
+	if hostedClusterChangedPredicate(nil).Update(event.UpdateEvent{ObjectOld: hc, ObjectNew: updated}) {
+		t.Error("expected the update of a condition not required to be skipped")
+	}
+}
+
+func TestReconcileDisabledHostedCluster(t *testing.T) {
+	hostedClusters = newClusterRegistry()
+	key := types.NamespacedName{Name: "test", Namespace: "clusters"}
+	const hcpNamespace = "clusters-test"
+	hc := &hyperv1beta1.HostedCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      key.Name,
+			Namespace: key.Namespace,
+			Labels:    map[string]string{constants.DisabledLabel: "true"},
+		},
+		Status: hyperv1beta1.HostedClusterStatus{
+			Conditions: []metav1.Condition{{
+				Type:               string(hyperv1beta1.HostedClusterAvailable),
+				Status:             metav1.ConditionTrue,
+				LastTransitionTime: metav1.Now(),
+			}},
+		},
+	}
+	// The other cluster is not disabled but ready after the disabled one
+	other := &hyperv1beta1.HostedCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: key.Namespace},
+		Status: hyperv1beta1.HostedClusterStatus{
+			Conditions: []metav1.Condition{{
+				Type:               string(hyperv1beta1.HostedClusterAvailable),
+				Status:             metav1.ConditionTrue,
+				LastTransitionTime: metav1.NewTime(time.Now().Add(time.Minute)),
+			}},
+		},
+	}
+	generated := func(name string, sourceLabel string) *loggingv1.ClusterLogForwarder {
+		return &loggingv1.ClusterLogForwarder{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: hcpNamespace,
+				Labels:    map[string]string{constants.ManagedByLabel: constants.ManagedByLabelValue, sourceLabel: name},
+			},
+		}
+	}
+	hlfCLF := generated("hlf", constants.HyperShiftLogForwarderLabel)
+	unmanagedCLF := generated("unmanaged", constants.HyperShiftLogForwarderLabel)
+	unmanagedCLF.Annotations = map[string]string{constants.UnmanagedAnnotation: "true"}
+	// The CLFs of the templates are deleted by the template controller
+	templateCLF := generated("template", constants.TemplateLabel)
+	c := newTestClient(t, hc, other, hlfCLF, unmanagedCLF, templateCLF)
+	r := &HostedClusterReconciler{Client: c, DisabledLabel: constants.DisabledLabel, MaxManagedClusters: 1}
+
+	// The manager of the already managed cluster is stopped, its forwarding is left until fully stopped
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	registered := &hypershiftlogforwarder.HostedCluster{
+		ClusterName:  key.Name,
+		HCPNamespace: hcpNamespace,
+		Context:      ctx,
+		CancelFunc:   cancelFunc,
+		Done:         make(chan struct{}),
+	}
+	hostedClusters.Add(key, registered)
+
+	result, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: key})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if !registered.Stopping() {
+		t.Error("expected the manager of the disabled cluster to be stopped")
+	}
+	if result.RequeueAfter != managerStopRequeueInterval {
+		t.Errorf("mismatched requeue, expected %v, got %v", managerStopRequeueInterval, result.RequeueAfter)
+	}
+	if err := c.Get(context.TODO(), client.ObjectKeyFromObject(hlfCLF), &loggingv1.ClusterLogForwarder{}); err != nil {
+		t.Errorf("expected the CLF to be kept until the manager is stopped, got %v", err)
+	}
+
+	// Once stopped, the cluster is removed from the registry and the CLFs generated from its HLFs are deleted
+	close(registered.Done)
+	result, err = r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: key})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if !result.IsZero() {
+		t.Errorf("mismatched result, expected %v, got %v", ctrl.Result{}, result)
+	}
+	if _, exist := hostedClusters.Get(key); exist {
+		t.Error("expected the disabled cluster to be removed from the registry")
+	}
+	if err := c.Get(context.TODO(), client.ObjectKeyFromObject(hlfCLF), &loggingv1.ClusterLogForwarder{}); !errors.IsNotFound(err) {
+		t.Errorf("expected the CLF generated from the HLF to be deleted, got %v", err)
+	}
+	for _, kept := range []*loggingv1.ClusterLogForwarder{unmanagedCLF, templateCLF} {
+		if err := c.Get(context.TODO(), client.ObjectKeyFromObject(kept), &loggingv1.ClusterLogForwarder{}); err != nil {
+			t.Errorf("expected the CLF %s to be kept, got %v", kept.Name, err)
+		}
+	}
+
+	// The disabled cluster is not onboarded again and takes no slot
+	if _, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if _, exist := hostedClusters.Get(key); exist {
+		t.Error("expected the disabled cluster not to be onboarded")
+	}
+	admitted, err := r.admitted(context.TODO(), other)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if !admitted {
+		t.Error("expected the disabled cluster to take no slot")
+	}
+
+	// The label set on the cluster is reconciled
+	updated := hc.DeepCopy()
+	updated.Labels = nil
+	if !hostedClusterChangedPredicate(nil).Update(event.UpdateEvent{ObjectOld: updated, ObjectNew: hc}) {
+		t.Error("expected the update of the disabled label to pass")
+	}
+}
+
+func TestReconcileMaxManagedClusters(t *testing.T) {
+	hostedClusters = newClusterRegistry()
+	readyCluster := func(name string, readySince time.Time) *hyperv1beta1.HostedCluster {
+		return &hyperv1beta1.HostedCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "clusters"},
+			Status: hyperv1beta1.HostedClusterStatus{
+				Conditions: []metav1.Condition{
+					{Type: "Available", Status: metav1.ConditionTrue, LastTransitionTime: metav1.NewTime(readySince)},
+				},
+			},
+		}
+	}
+	now := time.Now().Truncate(time.Second)
+	// The clusters ready at the same time are admitted by name
+	oldest, older, newest := readyCluster("oldest", now.Add(-time.Hour)), readyCluster("b", now), readyCluster("c", now)
+	hostedClusters.Add(types.NamespacedName{Name: "managed", Namespace: "clusters"}, &hypershiftlogforwarder.HostedCluster{})
+
+	recorder := record.NewFakeRecorder(10)
+	c := &accessReviewClient{
+		Client:          newTestClient(t, oldest, older, newest),
+		deniedResources: map[string]bool{"secrets": true},
+	}
+	r := &HostedClusterReconciler{Client: c, MaxManagedClusters: 2, Recorder: recorder}
+
+	// A single slot is left, only the oldest ready cluster is onboarded and fails on the denied permissions
+	for _, hc := range []*hyperv1beta1.HostedCluster{newest, older} {
+		result, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(hc)})
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if result.RequeueAfter != admissionRequeueInterval {
+			t.Errorf("mismatched requeue of %s, expected %v, got %v", hc.Name, admissionRequeueInterval, result.RequeueAfter)
+		}
+		select {
+		case event := <-recorder.Events:
+			if !strings.HasPrefix(event, corev1.EventTypeWarning+" "+ManagedClustersLimitReason) {
+				t.Errorf("mismatched event, expected a %s warning, got %v", ManagedClustersLimitReason, event)
+			}
+		default:
+			t.Errorf("expected a warning event for the queued cluster %s", hc.Name)
+		}
+	}
+	expected := `
+# HELP hlo_queued_clusters Number of ready hosted clusters queued beyond the maximum of managed hosted clusters.
+# TYPE hlo_queued_clusters gauge
+hlo_queued_clusters 2
+`
+	if err := testutil.GatherAndCompare(ctrlmetrics.Registry, strings.NewReader(expected), "hlo_queued_clusters"); err != nil {
+		t.Errorf("mismatched queued clusters, %v", err)
+	}
+	if _, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(oldest)}); !goerrors.Is(err, hloerrors.ErrPermissionDenied) {
+		t.Errorf("expected the oldest cluster to be admitted, got %v", err)
+	}
+
+	// The released slot goes to the next cluster by name
+	hostedClusters.Delete(types.NamespacedName{Name: "managed", Namespace: "clusters"})
+	hostedClusters.Add(client.ObjectKeyFromObject(oldest), &hypershiftlogforwarder.HostedCluster{})
+	result, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(newest)})
+	if err != nil || result.RequeueAfter != admissionRequeueInterval {
+		t.Errorf("expected %s to stay queued, got %v, %v", newest.Name, result, err)
+	}
+	if _, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(older)}); !goerrors.Is(err, hloerrors.ErrPermissionDenied) {
+		t.Errorf("expected %s to be admitted, got %v", older.Name, err)
+	}
+}
+
+func TestRecoverGuestManagers(t *testing.T) {
+	hostedClusters = newClusterRegistry()
+	readyCluster := func(name string, readySince time.Time) *hyperv1beta1.HostedCluster {
+		return &hyperv1beta1.HostedCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "clusters"},
+			Status: hyperv1beta1.HostedClusterStatus{
+				Conditions: []metav1.Condition{
+					{Type: "Available", Status: metav1.ConditionTrue, LastTransitionTime: metav1.NewTime(readySince)},
+				},
+			},
+		}
+	}
+	generatedCLF := func(namespace string) *loggingv1.ClusterLogForwarder {
+		return &loggingv1.ClusterLogForwarder{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "instance",
+				Namespace: namespace,
+				Labels: map[string]string{
+					constants.ManagedByLabel:              constants.ManagedByLabelValue,
+					constants.HyperShiftLogForwarderLabel: "instance",
+				},
+			},
+		}
+	}
+	now := time.Now().Truncate(time.Second)
+	// The operator restarts with the CLFs generated by the guest managers of the previous process: the managed
+	// cluster is the newest one, its HCP namespace is resolved from its annotation
+	managed, unmanaged := readyCluster("managed", now), readyCluster("unmanaged", now.Add(-time.Hour))
+	managed.Annotations = map[string]string{constants.HCPNamespaceAnnotation: "hcp-managed"}
+	templateCLF := generatedCLF("clusters-unmanaged")
+	templateCLF.Labels = map[string]string{constants.ManagedByLabel: constants.ManagedByLabelValue, constants.TemplateLabel: "template"}
+
+	c := &accessReviewClient{
+		Client:          newTestClient(t, managed, unmanaged, generatedCLF("hcp-managed"), generatedCLF("clusters-deleted"), templateCLF),
+		deniedResources: map[string]bool{"secrets": true},
+	}
+	r := &HostedClusterReconciler{Client: c, MaxManagedClusters: 1, retries: make(chan event.GenericEvent, 10)}
+
+	recovered, err := r.recoverGuestManagers(context.TODO())
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	managedKey := client.ObjectKeyFromObject(managed)
+	if len(recovered) != 1 || recovered[0] != managedKey {
+		t.Errorf("mismatched recovered clusters, expected [%v], got %v", managedKey, recovered)
+	}
+	select {
+	case e := <-r.retries:
+		if e.Object.GetName() != managed.Name || e.Object.GetNamespace() != managed.Namespace {
+			t.Errorf("mismatched requeue, expected %v, got %s/%s", managedKey, e.Object.GetNamespace(), e.Object.GetName())
+		}
+	default:
+		t.Error("expected the recovered cluster to be reconciled again")
+	}
+	if len(r.retries) != 0 {
+		t.Errorf("expected only the recovered cluster to be reconciled again, got %d more", len(r.retries))
+	}
+	if hostedClusters.IsRecovered(client.ObjectKeyFromObject(unmanaged)) {
+		t.Error("expected the cluster without generated CLFs not to be recovered")
+	}
+
+	// The recovered cluster takes the single slot over the older cluster it was managed before
+	result, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(unmanaged)})
+	if err != nil || result.RequeueAfter != admissionRequeueInterval {
+		t.Errorf("expected %s to be queued, got %v, %v", unmanaged.Name, result, err)
+	}
+	if _, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: managedKey}); !goerrors.Is(err, hloerrors.ErrPermissionDenied) {
+		t.Errorf("expected the recovered cluster to be admitted, got %v", err)
+	}
+
+	// The recovery ends once the guest manager is started again
+	hostedClusters.Add(managedKey, &hypershiftlogforwarder.HostedCluster{})
+	if hostedClusters.IsRecovered(managedKey) {
+		t.Error("expected the registered cluster not to be recovered anymore")
+	}
+}
+
+func TestReconcileHCPNamespaceAnnotation(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		expected    string
+	}{
+		{name: "not recorded", expected: "clusters-test"},
+		// The recorded HCP namespace is the one the operator works in, it is kept
+		{name: "recorded", annotations: map[string]string{constants.HCPNamespaceAnnotation: "hcp-test"}, expected: "hcp-test"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hostedClusters = newClusterRegistry()
+			hc := &hyperv1beta1.HostedCluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "test",
+					Namespace:   "clusters",
+					Annotations: test.annotations,
+				},
+			}
+			c := newTestClient(t, hc)
+			r := &HostedClusterReconciler{Client: c}
+			key := client.ObjectKeyFromObject(hc)
+
+			if _, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: key}); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			got := &hyperv1beta1.HostedCluster{}
+			if err := c.Get(context.TODO(), key, got); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if got.Annotations[constants.HCPNamespaceAnnotation] != test.expected {
+				t.Errorf("mismatched HCP namespace, expected %v, got %v", test.expected, got.Annotations[constants.HCPNamespaceAnnotation])
+			}
+		})
+	}
+}
+
+func TestReconcileCircuitBreaker(t *testing.T) {
+	hostedClusters = newClusterRegistry()
+	clusterBreaker = newCircuitBreaker()
+	hc := &hyperv1beta1.HostedCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: "clusters",
+		},
+		Status: hyperv1beta1.HostedClusterStatus{
+			Conditions: []metav1.Condition{
+				{Type: "Available", Status: metav1.ConditionTrue},
+			},
+		},
+	}
+	// The invalid kubeconfig fails every reconcile
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: hostedcluster.KubeConfigSecret, Namespace: "clusters-test"},
+		Data:       map[string][]byte{"kubeconfig": []byte("invalid")},
+	}
+	c := &accessReviewClient{Client: newTestClient(t, hc, secret)}
+	r := &HostedClusterReconciler{
+		Client:           c,
+		FailureThreshold: 2,
+		SuspendInterval:  time.Hour,
+	}
+	key := client.ObjectKeyFromObject(hc)
+	req := ctrl.Request{NamespacedName: key}
+
+	suspended := func() *metav1.Condition {
+		updated := &hyperv1beta1.HostedCluster{}
+		if err := c.Get(context.TODO(), key, updated); err != nil {
+			t.Fatal(err)
+		}
+		return meta.FindStatusCondition(updated.Status.Conditions, constants.SuspendedCondition)
+	}
+
+	// The failures below the threshold are retried as usual
+	if _, err := r.Reconcile(context.TODO(), req); err == nil {
+		t.Fatal("expected err, got nil")
+	}
+	if suspended() != nil {
+		t.Error("expected the hosted cluster not to be suspended")
+	}
+
+	// The breaker trips on the threshold
+	result, err := r.Reconcile(context.TODO(), req)
+	if err != nil {
+		t.Fatalf("expected no err, got %v", err)
+	}
+	if result.RequeueAfter != r.SuspendInterval {
+		t.Errorf("mismatched requeue, expected %v, got %v", r.SuspendInterval, result.RequeueAfter)
+	}
+	if condition := suspended(); condition == nil || condition.Status != metav1.ConditionTrue {
+		t.Errorf("expected the hosted cluster to be suspended, got %v", condition)
+	}
+
+	// The suspended hosted cluster is not retried before the interval
+	if err := c.Delete(context.TODO(), secret); err != nil {
+		t.Fatal(err)
+	}
+	result, err = r.Reconcile(context.TODO(), req)
+	if err != nil {
+		t.Fatalf("expected no err, got %v", err)
+	}
+	if result.RequeueAfter <= 0 || result.RequeueAfter > r.SuspendInterval {
+		t.Errorf("mismatched requeue, expected up to %v, got %v", r.SuspendInterval, result.RequeueAfter)
+	}
+	if failures, _ := clusterBreaker.Failures(key); failures != 2 {
+		t.Errorf("mismatched failures, expected %v, got %v", 2, failures)
+	}
+
+	// Once the interval elapsed a success resets the breaker
+	r.SuspendInterval = 0
+	if _, err := r.Reconcile(context.TODO(), req); err != nil {
+		t.Fatalf("expected no err, got %v", err)
+	}
+	if failures, _ := clusterBreaker.Failures(key); failures != 0 {
+		t.Errorf("mismatched failures, expected %v, got %v", 0, failures)
+	}
+	if condition := suspended(); condition == nil || condition.Status != metav1.ConditionFalse {
+		t.Errorf("expected the hosted cluster to be resumed, got %v", condition)
+	}
+}
+
+// guestCluster serves the client of the guest cluster
+type guestCluster struct {
+	cluster.Cluster
+	client client.Client
+}
+
+func (c *guestCluster) GetClient() client.Client {
+	return c.client
+}
+
+func TestReconcileDeletedHostedClusterStopsBackgroundWork(t *testing.T) {
+	hostedClusters = newClusterRegistry()
+	key := types.NamespacedName{Name: "test", Namespace: "clusters"}
+	// The goroutines of the hosted cluster are gone once it is torn down
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	registered := &hypershiftlogforwarder.HostedCluster{
+		Cluster: &guestCluster{client: newTestClient(t, &v1alpha1.HyperShiftLogForwarder{
+			ObjectMeta: metav1.ObjectMeta{Name: "instance", Namespace: constants.HLFWatchedNamespace},
+		})},
+		ClusterName: key.Name,
+		Context:     ctx,
+		CancelFunc:  cancelFunc,
+		Done:        make(chan struct{}),
+		Resync:      make(chan event.GenericEvent),
+	}
+	hostedClusters.Add(key, registered)
+
+	// The sub manager runs until the context is cancelled and nobody receives the resync events
+	registered.Go(func(ctx context.Context) {
+		<-ctx.Done()
+	})
+	if err := resyncForwarders(context.TODO(), registered); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	// The hosted cluster is deleted
+	r := &HostedClusterReconciler{Client: newTestClient(t)}
+	if _, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	select {
+	case <-registered.Done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the background work to stop")
+	}
+	if _, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if _, exist := hostedClusters.Get(key); exist {
+		t.Error("expected the cluster to be removed from the registry")
+	}
+
+	// No background work is started once the hosted cluster is stopping
+	registered.Go(func(ctx context.Context) {
+		t.Error("unexpected background work")
+	})
+}
+
+func TestRunGuestManagerCacheSyncTimeout(t *testing.T) {
+	hostedClusters = newClusterRegistry()
+	guestStartBackoff = workqueue.NewItemExponentialFailureRateLimiter(10*time.Millisecond, time.Second)
+	key := types.NamespacedName{Name: "test", Namespace: "clusters"}
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	registered := &hypershiftlogforwarder.HostedCluster{
+		ClusterName: key.Name,
+		Context:     ctx,
+		CancelFunc:  cancelFunc,
+		Done:        make(chan struct{}),
+	}
+	hostedClusters.Add(key, registered)
+
+	// The caches of the slow guest cluster never sync, the manager gives up after the timeout
+	synced := make(chan struct{})
+	start := func(ctx context.Context) error {
+		select {
+		case <-synced:
+			<-ctx.Done()
+			return nil
+		case <-time.After(50 * time.Millisecond):
+			return fmt.Errorf("failed to wait for caches to sync: timed out waiting for cache to be synced")
+		}
+	}
+
+	r := &HostedClusterReconciler{Client: newTestClient(t), retries: make(chan event.GenericEvent)}
+	registered.Go(func(ctx context.Context) {
+		r.runGuestManager(ctx, key, registered, start)
+	})
+
+	select {
+	case <-registered.Done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the hosted cluster to stop on the cache sync timeout")
+	}
+	if !registered.Stopping() {
+		t.Error("expected the hosted cluster to be stopping")
+	}
+
+	select {
+	case e := <-r.retries:
+		if got := client.ObjectKeyFromObject(e.Object); got != key {
+			t.Errorf("mismatched retry, expected %v, got %v", key, got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the hosted cluster to be retried")
+	}
+	if got := guestStartBackoff.NumRequeues(key); got != 1 {
+		t.Errorf("mismatched failed starts, expected %v, got %v", 1, got)
+	}
+
+	// The retry removes the stopped hosted cluster, a fresh manager is started on the next reconcile
+	if _, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if _, exist := hostedClusters.Get(key); exist {
+		t.Error("expected the stopped cluster to be removed from the registry")
+	}
+}
+
+func TestRetryAfterLeadershipLoss(t *testing.T) {
+	// The pending retry gives up once the leadership is lost, no controller receives it anymore
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	key := types.NamespacedName{Name: "test", Namespace: "clusters"}
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	r := &HostedClusterReconciler{retries: make(chan event.GenericEvent), leader: &leaderGate{ctx: ctx}}
+
+	r.retryAfter(key, time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	cancelFunc()
+
+	// No retry is scheduled once the operator is not the leader
+	r.retryAfter(key, time.Millisecond)
+}
+
+func TestLeadershipLossStopsGuestManagers(t *testing.T) {
+	hostedClusters = newClusterRegistry()
+	hc := &hyperv1beta1.HostedCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "clusters"},
+		Status: hyperv1beta1.HostedClusterStatus{
+			Conditions: []metav1.Condition{
+				{Type: "Available", Status: metav1.ConditionTrue},
+			},
+		},
+	}
+	gate := &leaderGate{}
+	r := &HostedClusterReconciler{Client: &accessReviewClient{Client: newTestClient(t, hc)}, leader: gate}
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(hc)}
+
+	// No guest manager is started before the operator is elected
+	result, err := r.Reconcile(context.TODO(), req)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if result.RequeueAfter != leaderRequeueInterval {
+		t.Errorf("mismatched requeue, expected %v, got %v", leaderRequeueInterval, result.RequeueAfter)
+	}
+
+	leaderCtx, loseLeadership := context.WithCancel(context.Background())
+	stopped := make(chan error)
+	go func() { stopped <- gate.Start(leaderCtx) }()
+	for i := 0; i < 100; i++ {
+		if _, ok := gate.Context(); ok {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The leader goes on with the onboarding, waiting for the kubeconfig of the hosted cluster
+	result, err = r.Reconcile(context.TODO(), req)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if result.RequeueAfter != kubeConfigRequeueInterval {
+		t.Errorf("mismatched requeue, expected %v, got %v", kubeConfigRequeueInterval, result.RequeueAfter)
+	}
+
+	// Guest managers of the leader, running until their context is cancelled
+	ctx, _ := r.leaderContext()
+	var managers []*hypershiftlogforwarder.HostedCluster
+	for _, name := range []string{"a", "b"} {
+		ctx, cancelFunc := context.WithCancel(ctx)
+		registered := &hypershiftlogforwarder.HostedCluster{
+			ClusterName: name,
+			Context:     ctx,
+			CancelFunc:  cancelFunc,
+			Done:        make(chan struct{}),
+		}
+		registered.Go(func(ctx context.Context) { <-ctx.Done() })
+		hostedClusters.Add(types.NamespacedName{Name: name, Namespace: "clusters"}, registered)
+		managers = append(managers, registered)
+	}
+
+	loseLeadership()
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Errorf("unexpected err: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the gate to stop on the leadership loss")
+	}
+	for _, registered := range managers {
+		if !registered.Stopped() {
+			t.Errorf("expected the manager of %s to be stopped", registered.ClusterName)
+		}
+	}
+	if _, ok := gate.Context(); ok {
+		t.Error("expected the operator not to be the leader anymore")
+	}
+}
+
+func newTestClient(t *testing.T, objs ...client.Object) client.Client {
+	s := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{
+		corev1.AddToScheme,
+		hyperv1beta1.AddToScheme,
+		loggingv1.AddToScheme,
+		v1alpha1.AddToScheme,
+	} {
+		if err := add(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return fake.NewClientBuilder().WithScheme(s).WithObjects(objs...).Build()
+}
+
+func TestHostedClusterChangedPredicate(t *testing.T) {
+	readySince := metav1.NewTime(time.Now().Add(-time.Hour).Truncate(time.Second))
+	base := &hyperv1beta1.HostedCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "test",
+			Namespace:  "clusters",
+			Generation: 1,
+			Labels:     map[string]string{"env": "prod"},
+		},
+		Status: hyperv1beta1.HostedClusterStatus{
+			Conditions: []metav1.Condition{
+				{Type: hostedcluster.HostedClusterAvailableCondition, Status: metav1.ConditionTrue, LastTransitionTime: readySince},
+				{Type: "Degraded", Status: metav1.ConditionFalse, LastTransitionTime: readySince},
+			},
+			Version: &hyperv1beta1.ClusterVersionStatus{
+				History: []configv1.UpdateHistory{{State: hostedcluster.HostedClusterVersionCompletedStatus, Version: "4.14.1"}},
+			},
+			KubeConfig: &corev1.LocalObjectReference{Name: "test-admin-kubeconfig"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		update   func(hc *hyperv1beta1.HostedCluster)
+		expected bool
+	}{
+		{
+			name:     "resync without change",
+			update:   func(hc *hyperv1beta1.HostedCluster) {},
+			expected: false,
+		},
+		{
+			name: "other condition",
+			update: func(hc *hyperv1beta1.HostedCluster) {
+				hc.Status.Conditions[1].Status = metav1.ConditionTrue
+				hc.Status.Conditions[1].Message = "degraded"
+			},
+			expected: false,
+		},
+		{
+			name: "new condition",
+			update: func(hc *hyperv1beta1.HostedCluster) {
+				hc.Status.Conditions = append(hc.Status.Conditions, metav1.Condition{Type: "Progressing", Status: metav1.ConditionTrue})
+			},
+			expected: false,
+		},
+		{
+			name:     "version in progress",
+			update:   func(hc *hyperv1beta1.HostedCluster) { hc.Status.Version.Desired.Version = "4.14.2" },
+			expected: false,
+		},
+		{
+			name:     "resource version",
+			update:   func(hc *hyperv1beta1.HostedCluster) { hc.ResourceVersion = "2" },
+			expected: false,
+		},
+		{
+			name:     "not available",
+			update:   func(hc *hyperv1beta1.HostedCluster) { hc.Status.Conditions[0].Status = metav1.ConditionFalse },
+			expected: true,
+		},
+		{
+			name: "available again",
+			update: func(hc *hyperv1beta1.HostedCluster) {
+				hc.Status.Conditions[0].LastTransitionTime = metav1.NewTime(readySince.Add(time.Minute))
+			},
+			expected: true,
+		},
+		{
+			name: "version rolled out",
+			update: func(hc *hyperv1beta1.HostedCluster) {
+				hc.Status.Version.History = append([]configv1.UpdateHistory{
+					{State: hostedcluster.HostedClusterVersionCompletedStatus, Version: "4.14.2"},
+				}, hc.Status.Version.History...)
+			},
+			expected: true,
+		},
+		{
+			name:     "kubeconfig",
+			update:   func(hc *hyperv1beta1.HostedCluster) { hc.Status.KubeConfig.Name = "other-kubeconfig" },
+			expected: true,
+		},
+		{
+			name:     "label",
+			update:   func(hc *hyperv1beta1.HostedCluster) { hc.Labels["env"] = "stage" },
+			expected: true,
+		},
+		{
+			name: "annotation",
+			update: func(hc *hyperv1beta1.HostedCluster) {
+				hc.Annotations = map[string]string{constants.HCPNamespaceAnnotation: "clusters-test"}
+			},
+			expected: true,
+		},
+		{
+			name:     "spec",
+			update:   func(hc *hyperv1beta1.HostedCluster) { hc.Generation = 2 },
+			expected: true,
+		},
+		{
+			name: "deletion",
+			update: func(hc *hyperv1beta1.HostedCluster) {
+				now := metav1.Now()
+				hc.DeletionTimestamp = &now
+			},
+			expected: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updated := base.DeepCopy()
+			tt.update(updated)
+			passed := hostedClusterChangedPredicate(nil).Update(event.UpdateEvent{ObjectOld: base, ObjectNew: updated})
+			if passed != tt.expected {
+				t.Errorf("mismatched predicate, expected %v, got %v", tt.expected, passed)
+			}
+		})
+	}
+
+	// The other events pass, the deletions stop the guest managers
+	if !hostedClusterChangedPredicate(nil).Create(event.CreateEvent{Object: base}) {
+		t.Errorf("expected the creation to pass")
+	}
+	if !hostedClusterChangedPredicate(nil).Delete(event.DeleteEvent{Object: base}) {
+		t.Errorf("expected the deletion to pass")
+	}
+}
@@ -0,0 +1,46 @@
+package hostedcluster
+
+import (
+	"context"
+	"sync"
+)
+
+// leaderGate is a runnable of the top-level manager tracking the leadership of the operator,
+// it is only started once the operator is elected. The guest managers are only started by the
+// leader and they are all stopped when the leadership is lost
+type leaderGate struct {
+	mu sync.RWMutex
+	// ctx is the context of the current leadership, nil if the operator is not the leader
+	ctx context.Context
+}
+
+// NeedLeaderElection makes the manager start the gate on the elected leader only
+func (g *leaderGate) NeedLeaderElection() bool {
+	return true
+}
+
+// Start records the leadership until the context is cancelled, then stops all the guest managers
+func (g *leaderGate) Start(ctx context.Context) error {
+	g.mu.Lock()
+	g.ctx = ctx
+	g.mu.Unlock()
+
+	<-ctx.Done()
+
+	g.mu.Lock()
+	g.ctx = nil
+	g.mu.Unlock()
+	hostedClusters.StopAll()
+	return nil
+}
+
+// Context returns the context of the current leadership, false if the operator is not the leader
+func (g *leaderGate) Context() (context.Context, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	if g.ctx == nil || g.ctx.Err() != nil {
+		return nil, false
+	}
+	return g.ctx, true
+}
@@ -0,0 +1,53 @@
+package hostedcluster
+
+import (
+	"reflect"
+
+	hyperv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"github.com/openshift/hypershift-logging-operator/pkg/hostedcluster"
+)
+
+// hostedClusterChangedPredicate skips the updates of a HostedCluster changing nothing the reconcile reads,
+// e.g. the conditions other than the availability and the required conditions updated by HyperShift on busy
+// management clusters
+func hostedClusterChangedPredicate(required []string) predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldHC, ok := e.ObjectOld.(*hyperv1beta1.HostedCluster)
+			if !ok {
+				return true
+			}
+			newHC, ok := e.ObjectNew.(*hyperv1beta1.HostedCluster)
+			if !ok {
+				return true
+			}
+			return hostedClusterChanged(oldHC, newHC, required)
+		},
+	}
+}
+
+// hostedClusterChanged returns true if the update changes the spec, the deletion, the labels or the annotations
+// of the HostedCluster, its availability, its required conditions, its rolled out version or its kubeconfig secret
+func hostedClusterChanged(oldHC, newHC *hyperv1beta1.HostedCluster, required []string) bool {
+	if oldHC.Generation != newHC.Generation || oldHC.UID != newHC.UID ||
+		oldHC.DeletionTimestamp.IsZero() != newHC.DeletionTimestamp.IsZero() {
+		return true
+	}
+	if !reflect.DeepEqual(oldHC.Labels, newHC.Labels) || !reflect.DeepEqual(oldHC.Annotations, newHC.Annotations) {
+		return true
+	}
+	// The time the hosted cluster became available is zero while it is not available
+	if !hostedcluster.ReadySince(oldHC).Equal(hostedcluster.ReadySince(newHC)) {
+		return true
+	}
+	if hostedcluster.HasTrueConditions(oldHC, required) != hostedcluster.HasTrueConditions(newHC, required) {
+		return true
+	}
+	if hostedcluster.GuestVersion(oldHC.Status.Version) != hostedcluster.GuestVersion(newHC.Status.Version) {
+		return true
+	}
+	return !reflect.DeepEqual(oldHC.Status.KubeConfig, newHC.Status.KubeConfig)
+}
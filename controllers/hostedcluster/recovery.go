@@ -0,0 +1,113 @@
+package hostedcluster
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	loggingv1 "github.com/openshift/cluster-logging-operator/apis/logging/v1"
+	hyperv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/openshift/hypershift-logging-operator/pkg/constants"
+	"github.com/openshift/hypershift-logging-operator/pkg/hostedcluster"
+)
+
+// startupRecovery is a runnable of the top-level manager rebuilding the registry of the guest managers from the
+// cluster state once the operator is elected, e.g. after it crashed and restarted with the CLFs generated by the
+// lost guest managers left in the HCP namespaces
+type startupRecovery struct {
+	r *HostedClusterReconciler
+}
+
+// NeedLeaderElection makes the manager run the recovery on the elected leader only, the guest managers
+// are only started by the leader
+func (s *startupRecovery) NeedLeaderElection() bool {
+	return true
+}
+
+// Start recovers the guest managers, a failure is logged as the HostedClusters are reconciled regardless
+func (s *startupRecovery) Start(ctx context.Context) error {
+	if _, err := s.r.recoverGuestManagers(ctx); err != nil {
+		ctrllog.FromContext(ctx).WithName("hostedcluster-recovery").Error(err, "failed to recover the guest managers")
+	}
+	return nil
+}
+
+// recoverGuestManagers records in the registry the hosted clusters whose HCP namespace holds CLFs generated from
+// their HLFs, and reconciles them again so that their guest managers are restarted. The recovered hosted clusters
+// are admitted first within MaxManagedClusters. The generated CLFs of no HostedCluster are left to the garbage
+// collection of their HCP and reported. The recovered hosted clusters are returned
+func (r *HostedClusterReconciler) recoverGuestManagers(ctx context.Context) ([]types.NamespacedName, error) {
+	log := ctrllog.FromContext(ctx).WithName("hostedcluster-recovery")
+
+	clfList := &loggingv1.ClusterLogForwarderList{}
+	if err := r.List(ctx, clfList,
+		client.MatchingLabels{constants.ManagedByLabel: constants.ManagedByLabelValue},
+		client.HasLabels{constants.HyperShiftLogForwarderLabel},
+	); err != nil {
+		return nil, fmt.Errorf("failed to list the generated ClusterLogForwarders: %w", err)
+	}
+	generated := map[string]bool{}
+	for _, clf := range clfList.Items {
+		generated[clf.Namespace] = true
+	}
+	if len(generated) == 0 {
+		return nil, nil
+	}
+
+	hcList := &hyperv1beta1.HostedClusterList{}
+	if err := r.reader().List(ctx, hcList); err != nil {
+		return nil, fmt.Errorf("failed to list the hosted clusters: %w", err)
+	}
+	var recovered []types.NamespacedName
+	for _, hc := range hcList.Items {
+		if !r.inWatchedNamespace(hc.Namespace) || !hc.DeletionTimestamp.IsZero() {
+			continue
+		}
+		hcpNamespace := hostedcluster.HCPNamespace(&hc)
+		if !generated[hcpNamespace] || !r.inHCPNamespaces(hcpNamespace) {
+			continue
+		}
+		delete(generated, hcpNamespace)
+		key := client.ObjectKeyFromObject(&hc)
+		if _, registered := hostedClusters.Get(key); registered {
+			continue
+		}
+		hostedClusters.Recover(key)
+		recovered = append(recovered, key)
+	}
+	sort.Slice(recovered, func(i, j int) bool { return recovered[i].String() < recovered[j].String() })
+
+	for namespace := range generated {
+		log.Info("generated ClusterLogForwarders of no hosted cluster, left to the garbage collection of their HCP",
+			"Namespace", namespace)
+	}
+	log.Info("recovered the guest managers", "HostedClusters", len(recovered))
+
+	for _, key := range recovered {
+		if err := r.requeue(ctx, key); err != nil {
+			return recovered, err
+		}
+	}
+	return recovered, nil
+}
+
+// requeue reconciles the HostedCluster again, blocking until the controller receives it or the context is cancelled
+func (r *HostedClusterReconciler) requeue(ctx context.Context, key types.NamespacedName) error {
+	if r.retries == nil {
+		return nil
+	}
+	select {
+	case r.retries <- event.GenericEvent{Object: &hyperv1beta1.HostedCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+	}}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,97 @@
+package hostedcluster
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/openshift/hypershift-logging-operator/controllers/hypershiftlogforwarder"
+)
+
+// clusterRegistry keeps the hosted clusters which have a running sub manager,
+// keyed by the namespace/name of the HostedCluster
+type clusterRegistry struct {
+	mu       sync.Mutex
+	clusters map[types.NamespacedName]*hypershiftlogforwarder.HostedCluster
+	// recovered are the hosted clusters found with generated resources on startup, whose sub manager
+	// was lost with the previous operator process and is not started again yet
+	recovered map[types.NamespacedName]bool
+}
+
+func newClusterRegistry() *clusterRegistry {
+	return &clusterRegistry{
+		clusters:  map[types.NamespacedName]*hypershiftlogforwarder.HostedCluster{},
+		recovered: map[types.NamespacedName]bool{},
+	}
+}
+
+// Get returns the registered hosted cluster for the key
+func (r *clusterRegistry) Get(key types.NamespacedName) (*hypershiftlogforwarder.HostedCluster, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	hc, ok := r.clusters[key]
+	return hc, ok
+}
+
+// Add registers the hosted cluster for the key
+func (r *clusterRegistry) Add(key types.NamespacedName, hc *hypershiftlogforwarder.HostedCluster) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.clusters[key] = hc
+	delete(r.recovered, key)
+}
+
+// Recover records the hosted cluster of the key had a sub manager before the operator restarted
+func (r *clusterRegistry) Recover(key types.NamespacedName) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.clusters[key]; !ok {
+		r.recovered[key] = true
+	}
+}
+
+// IsRecovered returns true if the sub manager of the hosted cluster of the key is to be started again
+// after the operator restarted
+func (r *clusterRegistry) IsRecovered(key types.NamespacedName) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.recovered[key]
+}
+
+// Len returns the number of registered hosted clusters, including the ones whose manager is stopping
+func (r *clusterRegistry) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.clusters)
+}
+
+// Delete removes the hosted cluster of the key from the registry
+func (r *clusterRegistry) Delete(key types.NamespacedName) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.clusters, key)
+}
+
+// StopAll asks the sub managers of all the registered hosted clusters to stop and waits until they
+// have fully stopped
+func (r *clusterRegistry) StopAll() {
+	r.mu.Lock()
+	clusters := make([]*hypershiftlogforwarder.HostedCluster, 0, len(r.clusters))
+	for _, hc := range r.clusters {
+		clusters = append(clusters, hc)
+	}
+	r.mu.Unlock()
+
+	for _, hc := range clusters {
+		hc.CancelFunc()
+	}
+	for _, hc := range clusters {
+		<-hc.Done
+	}
+}
@@ -0,0 +1,65 @@
+package hypershiftlogforwarder
+
+import (
+	"context"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/openshift/hypershift-logging-operator/api/v1alpha1"
+)
+
+const (
+	// collectorComponentLabel and collectorInstanceLabel select the collector pods of a CLF
+	collectorComponentLabel = "app.kubernetes.io/component"
+	collectorComponentValue = "collector"
+	collectorInstanceLabel  = "app.kubernetes.io/instance"
+)
+
+// collectorStatus reads the collector of the CLF in the HCP namespace, which runs either as
+// a Deployment or a DaemonSet named after the CLF. It returns nil if there is no collector yet
+func (r *HyperShiftLogForwarderReconciler) collectorStatus(ctx context.Context, name string) (*v1alpha1.CollectorStatus, error) {
+	key := types.NamespacedName{Name: name, Namespace: r.HCPNamespace}
+	status := &v1alpha1.CollectorStatus{}
+
+	deployment := &appsv1.Deployment{}
+	err := r.MCClient.Get(ctx, key, deployment)
+	if err == nil {
+		if deployment.Spec.Replicas != nil {
+			status.Desired = *deployment.Spec.Replicas
+		}
+		status.Ready = deployment.Status.ReadyReplicas
+	} else if errors.IsNotFound(err) {
+		daemonSet := &appsv1.DaemonSet{}
+		if err := r.MCClient.Get(ctx, key, daemonSet); err != nil {
+			return nil, client.IgnoreNotFound(err)
+		}
+		status.Desired = daemonSet.Status.DesiredNumberScheduled
+		status.Ready = daemonSet.Status.NumberReady
+	} else {
+		return nil, err
+	}
+
+	pods := &corev1.PodList{}
+	if err := r.MCClient.List(ctx, pods,
+		client.InNamespace(r.HCPNamespace),
+		client.MatchingLabels{collectorComponentLabel: collectorComponentValue, collectorInstanceLabel: name},
+	); err != nil {
+		return nil, err
+	}
+	for _, pod := range pods.Items {
+		restarts := int32(0)
+		for _, cs := range pod.Status.ContainerStatuses {
+			restarts += cs.RestartCount
+		}
+		if restarts > 0 {
+			status.Restarting++
+			status.Restarts += restarts
+		}
+	}
+
+	return status, nil
+}
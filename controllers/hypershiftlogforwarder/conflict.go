@@ -0,0 +1,93 @@
+package hypershiftlogforwarder
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	loggingv1 "github.com/openshift/cluster-logging-operator/apis/logging/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/openshift/hypershift-logging-operator/api/v1alpha1"
+)
+
+// ConflictCondition reports the HLF is not applied because another HLF of the guest cluster forwards its logs
+const ConflictCondition loggingv1.ConditionType = "Conflict"
+
+// MultipleForwardersReason is the reason of the ConflictCondition
+const MultipleForwardersReason loggingv1.ConditionReason = "MultipleForwarders"
+
+// forwarderOwner returns the name of the HLF applied for the guest cluster among the HLFs of the namespace
+// of the instance. The oldest HLF not being deleted is applied, by name if created at the same time,
+// so that every reconcile picks the same one
+func (r *HyperShiftLogForwarderReconciler) forwarderOwner(
+	ctx context.Context,
+	instance *v1alpha1.HyperShiftLogForwarder,
+) (string, error) {
+	hlfList := &v1alpha1.HyperShiftLogForwarderList{}
+	if err := r.List(ctx, hlfList, client.InNamespace(instance.Namespace)); err != nil {
+		return "", fmt.Errorf("failed to list the HyperShiftLogForwarders: %w", err)
+	}
+
+	var candidates []v1alpha1.HyperShiftLogForwarder
+	for _, hlf := range hlfList.Items {
+		if hlf.DeletionTimestamp.IsZero() {
+			candidates = append(candidates, hlf)
+		}
+	}
+	if len(candidates) == 0 {
+		return instance.Name, nil
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if !candidates[i].CreationTimestamp.Equal(&candidates[j].CreationTimestamp) {
+			return candidates[i].CreationTimestamp.Before(&candidates[j].CreationTimestamp)
+		}
+		return candidates[i].Name < candidates[j].Name
+	})
+	return candidates[0].Name, nil
+}
+
+// conflictCondition returns the ConflictCondition of the HLF left out in favor of the owner
+func conflictCondition(owner string) loggingv1.Condition {
+	return loggingv1.Condition{
+		Type:   ConflictCondition,
+		Status: corev1.ConditionTrue,
+		Reason: MultipleForwardersReason,
+		Message: fmt.Sprintf("The HyperShiftLogForwarder %s already forwards the logs of the hosted cluster, "+
+			"only one HyperShiftLogForwarder is applied", owner),
+	}
+}
+
+// ConflictingForwarders maps a deleted HLF to the other HLFs of its namespace, the one applied next
+// takes over the forwarding
+func (r *HyperShiftLogForwarderReconciler) ConflictingForwarders(obj client.Object) []reconcile.Request {
+	hlfList := &v1alpha1.HyperShiftLogForwarderList{}
+	if err := r.List(context.TODO(), hlfList, client.InNamespace(obj.GetNamespace())); err != nil {
+		ctrllog.Log.WithName(controllerName).Error(err, "failed to list the HyperShiftLogForwarders", "Namespace", obj.GetNamespace())
+		return nil
+	}
+	var reqs []reconcile.Request
+	for _, hlf := range hlfList.Items {
+		if hlf.Name != obj.GetName() {
+			reqs = append(reqs, reconcile.Request{NamespacedName: types.NamespacedName{Name: hlf.Name, Namespace: hlf.Namespace}})
+		}
+	}
+	return reqs
+}
+
+// DeletedForwarderPredicate passes only the deletions of the HLFs, the HLFs in conflict with the deleted one
+// are reconciled again
+func DeletedForwarderPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc:  func(event.CreateEvent) bool { return false },
+		UpdateFunc:  func(event.UpdateEvent) bool { return false },
+		GenericFunc: func(event.GenericEvent) bool { return false },
+		DeleteFunc:  func(event.DeleteEvent) bool { return true },
+	}
+}
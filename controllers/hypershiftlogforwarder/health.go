@@ -0,0 +1,51 @@
+package hypershiftlogforwarder
+
+import (
+	"context"
+
+	loggingv1 "github.com/openshift/cluster-logging-operator/apis/logging/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/openshift/hypershift-logging-operator/api/v1alpha1"
+)
+
+// healthConditions are the conditions summarized by the health, along with the status failing the forwarding
+var healthConditions = []struct {
+	Type    loggingv1.ConditionType
+	Failing corev1.ConditionStatus
+}{
+	{Type: degradedCondition, Failing: corev1.ConditionTrue},
+	{Type: ConflictCondition, Failing: corev1.ConditionTrue},
+	{Type: SecretsPropagatedCondition, Failing: corev1.ConditionFalse},
+}
+
+// forwarderHealth rolls the conditions of the HLF up into a health state, by precedence:
+//   - Degraded if the HLF fails validation, is in conflict with another HLF or misses the secrets of its outputs
+//   - Unknown if any of these conditions is of unknown status, or the CLF is unmanaged and its forwarding
+//     is out of the hands of the operator
+//   - Healthy otherwise
+func forwarderHealth(conditions loggingv1.Conditions) v1alpha1.HealthState {
+	unknown := conditions.IsTrueFor(unmanagedCondition.Type)
+	for _, hc := range healthConditions {
+		cond := conditions.GetCondition(hc.Type)
+		if cond == nil {
+			continue
+		}
+		switch cond.Status {
+		case hc.Failing:
+			return v1alpha1.DegradedState
+		case corev1.ConditionUnknown:
+			unknown = true
+		}
+	}
+	if unknown {
+		return v1alpha1.UnknownState
+	}
+	return v1alpha1.HealthyState
+}
+
+// updateStatus updates the status of the HLF with the health summarizing its conditions
+func (r *HyperShiftLogForwarderReconciler) updateStatus(ctx context.Context, hlf *v1alpha1.HyperShiftLogForwarder) error {
+	hlf.Status.Health = forwarderHealth(hlf.Status.Conditions)
+	return r.Status().Update(ctx, hlf)
+}
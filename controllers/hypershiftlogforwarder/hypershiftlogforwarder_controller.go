@@ -20,6 +20,8 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"sync"
+	"time"
 
 	"github.com/go-logr/logr"
 	loggingv1 "github.com/openshift/cluster-logging-operator/apis/logging/v1"
@@ -30,32 +32,57 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/cluster"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	"github.com/openshift/hypershift-logging-operator/api/v1alpha1"
 	"github.com/openshift/hypershift-logging-operator/pkg/clusterlogforwarder"
 	"github.com/openshift/hypershift-logging-operator/pkg/constants"
+	hloerrors "github.com/openshift/hypershift-logging-operator/pkg/errors"
+	"github.com/openshift/hypershift-logging-operator/pkg/hostedcluster"
+	"github.com/openshift/hypershift-logging-operator/pkg/metrics"
+)
+
+const (
+	controllerName = "hypershiftlogforwarder-controller"
+	// defaultRateLimitDelay is the requeue delay when the API server rate limits without suggesting a delay
+	defaultRateLimitDelay = 10 * time.Second
+	// degradedCondition is the condition type of the HLF failing validation
+	degradedCondition loggingv1.ConditionType = "Degraded"
 )
 
 var (
 	nonSupportInputTypeCondition = loggingv1.Condition{
-		Type:    "Degraded",
+		Type:    degradedCondition,
 		Status:  "True",
 		Reason:  "NonSupportedInputType",
 		Message: "The input supports only the audit type",
 	}
 	nonSupportedInputRefCondition = loggingv1.Condition{
-		Type:    "Degraded",
+		Type:    degradedCondition,
 		Status:  "True",
 		Reason:  "NonSupportedInputRef",
 		Message: fmt.Sprintf("The input ref can be %s only for the current release", clusterlogforwarder.InputHTTPServerName),
 	}
 	nonSupportFilterTypeCondition = loggingv1.Condition{
-		Type:    "Degraded",
+		Type:    degradedCondition,
 		Status:  "True",
 		Reason:  "NonSupportedFilterType",
 		Message: "The filter supports only the kubeAPIAudit type",
 	}
+	noPipelineCondition = loggingv1.Condition{
+		Type:    degradedCondition,
+		Status:  "True",
+		Reason:  "NoPipeline",
+		Message: "The HyperShiftLogForwarder has no pipeline, no log is forwarded",
+	}
+	unmanagedCondition = loggingv1.Condition{
+		Type:    "Unmanaged",
+		Status:  "True",
+		Reason:  "UnmanagedAnnotation",
+		Message: fmt.Sprintf("The ClusterLogForwarder is annotated with %s and left intact", constants.UnmanagedAnnotation),
+	}
 	hostedClusters = map[string]HostedCluster{}
 )
 
@@ -65,8 +92,62 @@ type HostedCluster struct {
 	ClusterId    string
 	ClusterName  string
 	HCPNamespace string
+	UID          types.UID
 	Context      context.Context
 	CancelFunc   context.CancelFunc
+	// Done is closed once the sub manager of the hosted cluster has fully stopped
+	Done chan struct{}
+	// Version is the last known version of the hosted cluster
+	Version string
+	// Resync triggers the reconcile of the HLFs of the hosted cluster, e.g. after it is upgraded
+	Resync chan event.GenericEvent
+
+	// mu guards the start of the background work against the cancellation of the context
+	mu       sync.Mutex
+	workers  sync.WaitGroup
+	doneOnce sync.Once
+}
+
+// Go runs f in the background with the context of the hosted cluster, f must return once the context
+// is cancelled. Done is closed after the context is cancelled and all the background work has returned,
+// no work is started once the hosted cluster is stopping
+func (hc *HostedCluster) Go(f func(ctx context.Context)) {
+	hc.doneOnce.Do(func() {
+		go func() {
+			<-hc.Context.Done()
+			// No work is added once the context is cancelled
+			hc.mu.Lock()
+			hc.mu.Unlock()
+			hc.workers.Wait()
+			close(hc.Done)
+		}()
+	})
+
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	if hc.Stopping() {
+		return
+	}
+	hc.workers.Add(1)
+	go func() {
+		defer hc.workers.Done()
+		f(hc.Context)
+	}()
+}
+
+// Stopping returns true if the sub manager of the hosted cluster has been asked to stop
+func (hc *HostedCluster) Stopping() bool {
+	return hc.Context.Err() != nil
+}
+
+// Stopped returns true if the sub manager of the hosted cluster has fully stopped
+func (hc *HostedCluster) Stopped() bool {
+	select {
+	case <-hc.Done:
+		return true
+	default:
+		return false
+	}
 }
 
 // HyperShiftLogForwarderReconciler reconciles a HyperShiftLogForwarder object
@@ -75,7 +156,37 @@ type HyperShiftLogForwarderReconciler struct {
 	Scheme       *runtime.Scheme
 	MCClient     client.Client
 	HCPNamespace string
-	log          logr.Logger
+	// CommonMetadata is stamped on all the generated CLFs
+	CommonMetadata clusterlogforwarder.CommonMetadata
+	// FinalizerGracePeriod is how long the cleanup of a deleted HLF is retried before its finalizer
+	// is removed anyway, the cleanup is retried until it succeeds if 0
+	FinalizerGracePeriod time.Duration
+	// ReadySince is when the hosted cluster became ready, the onboarding latency is measured from it
+	ReadySince time.Time
+	// Paused pauses the reconciliation of all the HLFs, the generated resources are left untouched.
+	// The reconciliation is also paused by the PauseConfigMapName ConfigMap of the operator namespace
+	Paused bool
+	// HostedClusterKey is the HostedCluster of the guest cluster on the management cluster, it is checked
+	// when the guest API server cannot be reached
+	HostedClusterKey types.NamespacedName
+	// Teardown stops the manager of the guest cluster once its HostedCluster is gone
+	Teardown func()
+	// ResyncInterval is how often an applied HLF is reconciled again, so that its CLF changed out-of-band,
+	// which is only watched for deletions, is restored. Not resynced if 0
+	ResyncInterval time.Duration
+	// RequeueJitter is the fraction of ResyncInterval added at random to each resync, so that the HLFs
+	// of the hosted clusters are not resynced at the same time
+	RequeueJitter float64
+	// LoggingVersion is the version of the cluster-logging operator assumed when it is not detected in the guest
+	// cluster. The latest version is assumed if empty
+	LoggingVersion string
+	// LoggingVersionReader reads the CSVs of the cluster-logging operator in the guest cluster, the CLFs applied
+	// for another version are re-rendered. The version is not detected if nil
+	LoggingVersionReader client.Reader
+	log                  logr.Logger
+
+	// onboarded records the onboarding latency once the first forwarder is applied
+	onboarded sync.Once
 }
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
@@ -84,6 +195,70 @@ func (r *HyperShiftLogForwarderReconciler) Reconcile(ctx context.Context, req ct
 
 	r.log = ctrllog.FromContext(ctx).WithName("hyperShiftLogForwarder-controller")
 	r.log.V(1).Info("start reconcile", "Name", req.NamespacedName)
+
+	// The pause state failing to be read does not block the reconciliation, it is read again by the next one
+	if paused, err := hostedcluster.IsPaused(ctx, r.MCClient, r.Paused); err != nil {
+		r.log.Error(err, "failed to read the pause state", "Name", req.NamespacedName)
+	} else if paused {
+		r.log.V(1).Info("reconciliation paused", "Name", req.NamespacedName)
+		return ctrl.Result{RequeueAfter: constants.PausedRequeueInterval}, nil
+	}
+
+	// The CLFs of the hosted cluster are not written concurrently by the template controller
+	if r.HCPNamespace != "" {
+		defer hostedcluster.LockCluster(r.HCPNamespace)()
+	}
+
+	result, err := r.reconcile(ctx, req)
+	if err != nil && errors.IsTooManyRequests(err) {
+		// Honor the delay suggested by the rate limiting API server instead of retrying immediately
+		delay := defaultRateLimitDelay
+		if seconds, ok := errors.SuggestsClientDelay(err); ok && seconds > 0 {
+			delay = time.Duration(seconds) * time.Second
+		}
+		r.log.V(1).Info("rate limited by the API server", "Name", req.NamespacedName, "RequeueAfter", delay)
+		return ctrl.Result{RequeueAfter: delay}, nil
+	}
+	if hloerrors.IsUnreachable(err) {
+		return r.guestUnreachable(ctx, req, err), nil
+	}
+
+	return result, err
+}
+
+// finalize deletes the CLF generated from the HLF, unless it is unmanaged, then removes the finalizer.
+// The cleanup is best-effort: once FinalizerGracePeriod has passed since the deletion of the HLF,
+// the finalizer is removed even if the cleanup keeps failing so that the deletion is not blocked forever
+func (r *HyperShiftLogForwarderReconciler) finalize(ctx context.Context, instance *v1alpha1.HyperShiftLogForwarder) error {
+	if !controllerutil.ContainsFinalizer(instance, constants.ManagedLoggingFinalizer) {
+		return nil
+	}
+
+	if err := r.cleanup(ctx, instance); err != nil {
+		if r.FinalizerGracePeriod <= 0 || time.Since(instance.DeletionTimestamp.Time) < r.FinalizerGracePeriod {
+			return err
+		}
+		r.log.Error(err, "giving up the cleanup after the grace period, removing the finalizer",
+			"Name", instance.Name, "GracePeriod", r.FinalizerGracePeriod)
+	}
+
+	controllerutil.RemoveFinalizer(instance, constants.ManagedLoggingFinalizer)
+	return r.Update(ctx, instance)
+}
+
+// cleanup deletes the CLF generated from the HLF in the HCP namespace, the unmanaged CLF is left intact
+func (r *HyperShiftLogForwarderReconciler) cleanup(ctx context.Context, instance *v1alpha1.HyperShiftLogForwarder) error {
+	clf := &loggingv1.ClusterLogForwarder{}
+	if err := r.MCClient.Get(ctx, types.NamespacedName{Name: instance.Name, Namespace: r.HCPNamespace}, clf); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if clusterlogforwarder.IsUnmanaged(clf) {
+		return nil
+	}
+	return client.IgnoreNotFound(r.MCClient.Delete(ctx, clf))
+}
+
+func (r *HyperShiftLogForwarderReconciler) reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	instance := &v1alpha1.HyperShiftLogForwarder{}
 
 	if r.HCPNamespace == "" {
@@ -97,6 +272,16 @@ func (r *HyperShiftLogForwarderReconciler) Reconcile(ctx context.Context, req ct
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
+	if !instance.ObjectMeta.DeletionTimestamp.IsZero() {
+		// The object is being deleted
+		if err := r.finalize(ctx, instance); err != nil {
+			return ctrl.Result{}, err
+		}
+		r.log.V(1).Info("HLF deleted", "UID", instance.UID, "Name", instance.Name)
+		// Stop reconciliation as the item is being deleted
+		return ctrl.Result{}, nil
+	}
+
 	// Getting the clf
 	clf := &loggingv1.ClusterLogForwarder{}
 
@@ -110,26 +295,6 @@ func (r *HyperShiftLogForwarderReconciler) Reconcile(ctx context.Context, req ct
 		return ctrl.Result{}, err
 	}
 
-	if !instance.ObjectMeta.DeletionTimestamp.IsZero() {
-		// The object is being deleted
-		if controllerutil.ContainsFinalizer(instance, constants.ManagedLoggingFinalizer) {
-			// remove our finalizer from the list and update it.
-			controllerutil.RemoveFinalizer(instance, constants.ManagedLoggingFinalizer)
-			if err := r.Update(ctx, instance); err != nil {
-				return ctrl.Result{}, err
-			}
-			// delete the CLF which created by the HLF
-			if clfFound {
-				if err = r.MCClient.Delete(ctx, clf); err != nil {
-					return ctrl.Result{}, err
-				}
-			}
-		}
-		r.log.V(1).Info("HLF deleted", "UID", instance.UID, "Name", instance.Name)
-		// Stop reconciliation as the item is being deleted
-		return ctrl.Result{}, nil
-	}
-
 	// The object is not being deleted, so if it does not have our finalizer,
 	// then lets add the finalizer and update the object. This is equivalent
 	// registering our finalizer.
@@ -141,6 +306,21 @@ func (r *HyperShiftLogForwarderReconciler) Reconcile(ctx context.Context, req ct
 	}
 	r.log.V(3).Info("Found new or update HLF", "UID", instance.UID, "Name", instance.Name)
 
+	// A single HLF is applied for the guest cluster, the others are reported in conflict and their CLFs removed
+	owner, err := r.forwarderOwner(ctx, instance)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if owner != instance.Name {
+		r.log.Info("HLF in conflict, skip it", "Name", instance.Name, "Owner", owner)
+		instance.Status.Conditions.SetCondition(conflictCondition(owner))
+		if err := r.updateStatus(ctx, instance); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, r.cleanup(ctx, instance)
+	}
+	instance.Status.Conditions.RemoveCondition(ConflictCondition)
+
 	// Do not need to validate the inputs from HLF since we build it as fixed format for now
 	//if err = r.ValidateInputs(instance); err != nil {
 	//	return ctrl.Result{}, err
@@ -157,14 +337,54 @@ func (r *HyperShiftLogForwarderReconciler) Reconcile(ctx context.Context, req ct
 	instance.Status.Conditions.RemoveCondition(nonSupportInputTypeCondition.Type)
 	instance.Status.Conditions.RemoveCondition(nonSupportFilterTypeCondition.Type)
 	instance.Status.Conditions.RemoveCondition(nonSupportedInputRefCondition.Type)
-	if err = r.Status().Update(ctx, instance); err != nil {
+	collector, err := r.collectorStatus(ctx, instance.Name)
+	if err != nil {
+		r.log.Error(err, "failed to read the collector status", "Name", instance.Name)
+	} else {
+		instance.Status.Collector = collector
+	}
+	secrets, err := r.secretsCondition(ctx, instance)
+	if err != nil {
+		r.log.Error(err, "failed to check the secrets", "Name", instance.Name)
+	} else if secrets != nil {
+		instance.Status.Conditions.SetCondition(*secrets)
+	} else {
+		instance.Status.Conditions.RemoveCondition(SecretsPropagatedCondition)
+	}
+
+	unmanaged := clfFound && clusterlogforwarder.IsUnmanaged(clf)
+	if unmanaged {
+		instance.Status.Conditions.SetCondition(unmanagedCondition)
+	} else {
+		instance.Status.Conditions.RemoveCondition(unmanagedCondition.Type)
+	}
+	if err = r.updateStatus(ctx, instance); err != nil {
 		return ctrl.Result{}, err
 	}
 
-	if err := r.refreshCLF(clf, instance, ctx, clfFound); err != nil {
+	if unmanaged {
+		r.log.V(1).Info("skip unmanaged CLF", "Name", clf.Name, "Namespace", clf.Namespace)
+		return r.resync(), nil
+	}
+
+	err = r.refreshCLF(clf, instance, ctx, clfFound)
+	metrics.ObserveClusterReconcile(r.HCPNamespace, err)
+	if err != nil {
 		return ctrl.Result{}, err
 	}
-	return ctrl.Result{}, nil
+	r.onboarded.Do(func() {
+		metrics.ObserveClusterOnboard(r.ReadySince)
+	})
+	return r.resync(), nil
+}
+
+// resync returns the result of a successful reconcile, requeued after ResyncInterval jittered by RequeueJitter
+// to detect the drift of the CLF
+func (r *HyperShiftLogForwarderReconciler) resync() ctrl.Result {
+	if r.ResyncInterval <= 0 {
+		return ctrl.Result{}
+	}
+	return ctrl.Result{RequeueAfter: hostedcluster.JitterInterval(r.ResyncInterval, r.RequeueJitter)}
 }
 
 func (r *HyperShiftLogForwarderReconciler) buildClusterLogForwarder(instance *v1alpha1.HyperShiftLogForwarder,
@@ -174,6 +394,13 @@ func (r *HyperShiftLogForwarderReconciler) buildClusterLogForwarder(instance *v1
 
 	clf.Name = instance.Name
 	clf.Namespace = r.HCPNamespace
+	clf.Labels = clusterlogforwarder.ManagedLabels(constants.HyperShiftLogForwarderLabel, instance.Name)
+	clusterlogforwarder.SetAuditAnnotations(clf,
+		fmt.Sprintf("HyperShiftLogForwarder/%s/%s", instance.Namespace, instance.Name),
+		instance.Generation,
+		controllerName,
+	)
+	r.CommonMetadata.Apply(clf)
 
 	clfBuilder := clusterlogforwarder.ClusterLogForwarderBuilder{
 		Clf: clf,
@@ -201,9 +428,38 @@ func (r *HyperShiftLogForwarderReconciler) refreshCLF(
 
 	newClf := r.buildClusterLogForwarder(instance)
 
+	// The HLF lives in the guest cluster and cannot own the CLF, tie the CLF to the HCP instead
+	// so it is garbage-collected along with the hosted cluster
+	hcp, err := hostedcluster.GetHostedControlPlane(r.MCClient, ctx, r.HCPNamespace)
+	if err != nil {
+		return err
+	}
+	if err := controllerutil.SetOwnerReference(hcp, newClf, r.MCClient.Scheme()); err != nil {
+		return err
+	}
+
+	// Record the cluster-logging version of the guest cluster, the CLF is re-rendered once cluster-logging
+	// is upgraded so that it is processed with the defaults of the new version
+	loggingVersion, err := r.loggingVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if loggingVersion != "" {
+		newClf.Annotations[constants.LoggingVersionAnnotation] = loggingVersion
+	}
+
 	if clfFound {
-		if reflect.DeepEqual(newClf.Spec, oldClf.Spec) {
+		if clusterlogforwarder.IsUpToDate(oldClf, newClf) {
 			return nil
+		} else if reflect.DeepEqual(oldClf.Spec, newClf.Spec) {
+			// Only the metadata changed, e.g. the cluster-logging version, update it in place
+			if applied := oldClf.Annotations[constants.LoggingVersionAnnotation]; applied != loggingVersion {
+				r.log.Info("cluster-logging version changed, re-render the CLF", "Name", oldClf.Name,
+					"From", applied, "To", loggingVersion)
+			}
+			clusterlogforwarder.MergeMetadata(oldClf, newClf)
+			clusterlogforwarder.StampLastAppliedTime(oldClf)
+			return r.MCClient.Update(ctx, oldClf)
 		} else {
 			err := r.MCClient.Delete(ctx, oldClf)
 			if err != nil {
@@ -212,7 +468,8 @@ func (r *HyperShiftLogForwarderReconciler) refreshCLF(
 		}
 	}
 
-	err := r.MCClient.Create(ctx, newClf)
+	clusterlogforwarder.StampLastAppliedTime(newClf)
+	err = r.MCClient.Create(ctx, newClf)
 	if err != nil {
 		return err
 	}
@@ -225,7 +482,7 @@ func (r *HyperShiftLogForwarderReconciler) ValidateInputs(hlf *v1alpha1.HyperShi
 		if input.Infrastructure != nil || input.Application != nil {
 			r.log.V(3).Info("support only audit log for HyperShiftLogForwarder")
 			hlf.Status.Conditions.SetCondition(nonSupportInputTypeCondition)
-			if err := r.Status().Update(context.TODO(), hlf); err != nil {
+			if err := r.updateStatus(context.TODO(), hlf); err != nil {
 				return err
 			}
 			return fmt.Errorf("support only audit log for HyperShiftLogForwarder")
@@ -236,12 +493,20 @@ func (r *HyperShiftLogForwarderReconciler) ValidateInputs(hlf *v1alpha1.HyperShi
 
 // ValidatePipelines validates the HLF pipelines
 func (r *HyperShiftLogForwarderReconciler) ValidatePipelines(hlf *v1alpha1.HyperShiftLogForwarder) error {
+	if len(hlf.Spec.Pipelines) == 0 {
+		r.log.V(3).Info("the HyperShiftLogForwarder has no pipeline")
+		hlf.Status.Conditions.SetCondition(noPipelineCondition)
+		if err := r.updateStatus(context.TODO(), hlf); err != nil {
+			return err
+		}
+		return fmt.Errorf("HyperShiftLogForwarder %s has no pipeline", hlf.Name)
+	}
 	for _, ppl := range hlf.Spec.Pipelines {
 		for _, ir := range ppl.InputRefs {
 			if ir != clusterlogforwarder.InputHTTPServerName {
 				r.log.V(3).Info(fmt.Sprintf("the input can be '%s' only for the current release", clusterlogforwarder.InputHTTPServerName))
 				hlf.Status.Conditions.SetCondition(nonSupportedInputRefCondition)
-				if err := r.Status().Update(context.TODO(), hlf); err != nil {
+				if err := r.updateStatus(context.TODO(), hlf); err != nil {
 					return err
 				}
 				return fmt.Errorf(fmt.Sprintf("support only %s as input ref for current release", clusterlogforwarder.InputHTTPServerName))
@@ -249,7 +514,7 @@ func (r *HyperShiftLogForwarderReconciler) ValidatePipelines(hlf *v1alpha1.Hyper
 			if ir == "application" || ir == "infrastructure" {
 				r.log.V(3).Info("support only audit log for HyperShiftLogForwarder")
 				hlf.Status.Conditions.SetCondition(nonSupportInputTypeCondition)
-				if err := r.Status().Update(context.TODO(), hlf); err != nil {
+				if err := r.updateStatus(context.TODO(), hlf); err != nil {
 					return err
 				}
 				return fmt.Errorf("support only audit log for HyperShiftLogForwarder")
@@ -265,7 +530,7 @@ func (r *HyperShiftLogForwarderReconciler) ValidateFilters(hlf *v1alpha1.HyperSh
 		if f.Type != "kubeAPIAudit" {
 			r.log.V(3).Info(fmt.Sprintf("support only kubeAPIAudit type of filter for HyperShiftLogForwarder"))
 			hlf.Status.Conditions.SetCondition(nonSupportFilterTypeCondition)
-			if err := r.Status().Update(context.TODO(), hlf); err != nil {
+			if err := r.updateStatus(context.TODO(), hlf); err != nil {
 				return err
 			}
 			return fmt.Errorf("support only kubeAPIAudit filter for HyperShiftLogForwarder")
@@ -273,3 +538,13 @@ func (r *HyperShiftLogForwarderReconciler) ValidateFilters(hlf *v1alpha1.HyperSh
 	}
 	return nil
 }
+
+// ForwarderForClusterLogForwarder maps a CLF generated in the HCP namespace to its HLF, the CLF deleted by hand
+// is created again
+func (r *HyperShiftLogForwarderReconciler) ForwarderForClusterLogForwarder(obj client.Object) []reconcile.Request {
+	name, ok := clusterlogforwarder.SourceName(obj, constants.HyperShiftLogForwarderLabel)
+	if !ok || obj.GetNamespace() != r.HCPNamespace {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: name, Namespace: constants.HLFWatchedNamespace}}}
+}
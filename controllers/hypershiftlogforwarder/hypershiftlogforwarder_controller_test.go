@@ -0,0 +1,1097 @@
+package hypershiftlogforwarder
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	loggingv1 "github.com/openshift/cluster-logging-operator/apis/logging/v1"
+	hyperv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/openshift/hypershift-logging-operator/api/v1alpha1"
+	"github.com/openshift/hypershift-logging-operator/pkg/clusterlogforwarder"
+	"github.com/openshift/hypershift-logging-operator/pkg/constants"
+	"github.com/openshift/hypershift-logging-operator/pkg/hostedcluster"
+)
+
+// rateLimitedClient rejects every read with a 429 response
+type rateLimitedClient struct {
+	client.Client
+	retryAfterSeconds int
+}
+
+func (c *rateLimitedClient) Get(_ context.Context, _ client.ObjectKey, _ client.Object) error {
+	return apierrors.NewTooManyRequests("too many requests", c.retryAfterSeconds)
+}
+
+func TestReconcileRateLimited(t *testing.T) {
+	tests := []struct {
+		name              string
+		retryAfterSeconds int
+		expectedRequeue   time.Duration
+	}{
+		{
+			name:              "requeue after the suggested delay",
+			retryAfterSeconds: 30,
+			expectedRequeue:   30 * time.Second,
+		},
+		{
+			name:              "requeue after the default delay",
+			retryAfterSeconds: 0,
+			expectedRequeue:   defaultRateLimitDelay,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := &HyperShiftLogForwarderReconciler{
+				Client:       &rateLimitedClient{Client: newTestClient(t), retryAfterSeconds: test.retryAfterSeconds},
+				MCClient:     newTestClient(t),
+				HCPNamespace: "clusters-test",
+			}
+
+			result, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "instance", Namespace: "openshift-logging"}})
+			if err != nil {
+				t.Fatalf("expected no err, got %v", err)
+			}
+			if result.RequeueAfter != test.expectedRequeue {
+				t.Errorf("mismatched requeue, expected %v, got %v", test.expectedRequeue, result.RequeueAfter)
+			}
+		})
+	}
+}
+
+func TestReconcileUnmanagedCLF(t *testing.T) {
+	const hcpNamespace = "clusters-test"
+
+	hlf := &v1alpha1.HyperShiftLogForwarder{
+		ObjectMeta: metav1.ObjectMeta{Name: "instance", Namespace: constants.HLFWatchedNamespace},
+		Spec: v1alpha1.HyperShiftLogForwarderSpec{
+			ClusterLogForwarderSpec: loggingv1.ClusterLogForwarderSpec{
+				Pipelines: testPipelines,
+				Outputs:   []loggingv1.OutputSpec{{Name: "cloudwatch", Type: "cloudwatch"}},
+			},
+		},
+	}
+	clf := &loggingv1.ClusterLogForwarder{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        hlf.Name,
+			Namespace:   hcpNamespace,
+			Annotations: map[string]string{constants.UnmanagedAnnotation: "true"},
+		},
+		Spec: loggingv1.ClusterLogForwarderSpec{
+			Outputs: []loggingv1.OutputSpec{{Name: "by-hand", Type: "loki"}},
+		},
+	}
+	guestClient := newTestClient(t, hlf)
+	mcClient := newTestClient(t, clf, &hyperv1beta1.HostedControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: hcpNamespace},
+	})
+	r := &HyperShiftLogForwarderReconciler{
+		Client:       guestClient,
+		MCClient:     mcClient,
+		HCPNamespace: hcpNamespace,
+	}
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(hlf)}
+	clfKey := client.ObjectKeyFromObject(clf)
+
+	if _, err := r.Reconcile(context.TODO(), req); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	current := &loggingv1.ClusterLogForwarder{}
+	if err := mcClient.Get(context.TODO(), clfKey, current); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(current.Spec.Outputs) != 1 || current.Spec.Outputs[0].Name != "by-hand" {
+		t.Errorf("expected the unmanaged CLF to be left intact, got outputs %v", current.Spec.Outputs)
+	}
+	if err := guestClient.Get(context.TODO(), req.NamespacedName, hlf); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if !hlf.Status.Conditions.IsTrueFor(unmanagedCondition.Type) {
+		t.Errorf("expected the unmanaged condition, got %v", hlf.Status.Conditions)
+	}
+	if hlf.Status.Health != v1alpha1.UnknownState {
+		t.Errorf("mismatched health, expected %s, got %s", v1alpha1.UnknownState, hlf.Status.Health)
+	}
+
+	// Removing the annotation hands the CLF back to the operator
+	delete(current.Annotations, constants.UnmanagedAnnotation)
+	if err := mcClient.Update(context.TODO(), current); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if _, err := r.Reconcile(context.TODO(), req); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := mcClient.Get(context.TODO(), clfKey, current); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(current.Spec.Outputs) != 1 || current.Spec.Outputs[0].Name != "cloudwatch" {
+		t.Errorf("expected the CLF to be applied, got outputs %v", current.Spec.Outputs)
+	}
+	if err := guestClient.Get(context.TODO(), req.NamespacedName, hlf); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if hlf.Status.Conditions.GetCondition(unmanagedCondition.Type) != nil {
+		t.Errorf("expected no unmanaged condition, got %v", hlf.Status.Conditions)
+	}
+	if hlf.Status.Health != v1alpha1.HealthyState {
+		t.Errorf("mismatched health, expected %s, got %s", v1alpha1.HealthyState, hlf.Status.Health)
+	}
+}
+
+func TestReconcileResync(t *testing.T) {
+	const hcpNamespace = "clusters-test"
+
+	tests := []struct {
+		name           string
+		resyncInterval time.Duration
+		jitter         float64
+	}{
+		{name: "not resynced"},
+		{name: "resynced", resyncInterval: 10 * time.Minute},
+		{name: "resynced with jitter", resyncInterval: 10 * time.Minute, jitter: 0.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hlf := &v1alpha1.HyperShiftLogForwarder{
+				ObjectMeta: metav1.ObjectMeta{Name: "instance", Namespace: constants.HLFWatchedNamespace},
+				Spec: v1alpha1.HyperShiftLogForwarderSpec{
+					ClusterLogForwarderSpec: loggingv1.ClusterLogForwarderSpec{
+						Pipelines: testPipelines,
+						Outputs:   []loggingv1.OutputSpec{{Name: "cloudwatch", Type: "cloudwatch"}},
+					},
+				},
+			}
+			guestClient := newTestClient(t, hlf)
+			mcClient := newTestClient(t, &hyperv1beta1.HostedControlPlane{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: hcpNamespace},
+			})
+			r := &HyperShiftLogForwarderReconciler{
+				Client:         guestClient,
+				MCClient:       mcClient,
+				HCPNamespace:   hcpNamespace,
+				ResyncInterval: tt.resyncInterval,
+				RequeueJitter:  tt.jitter,
+			}
+			req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(hlf)}
+
+			result, err := r.Reconcile(context.TODO(), req)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			maxInterval := time.Duration(float64(tt.resyncInterval) * (1 + tt.jitter))
+			if result.RequeueAfter < tt.resyncInterval || result.RequeueAfter > maxInterval {
+				t.Errorf("mismatched requeue, expected %v-%v, got %v", tt.resyncInterval, maxInterval, result.RequeueAfter)
+			}
+
+			// The CLF changed out-of-band is restored by the resync
+			clf := &loggingv1.ClusterLogForwarder{}
+			clfKey := types.NamespacedName{Name: hlf.Name, Namespace: hcpNamespace}
+			if err := mcClient.Get(context.TODO(), clfKey, clf); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			clf.Spec.Outputs = []loggingv1.OutputSpec{{Name: "by-hand", Type: "loki"}}
+			if err := mcClient.Update(context.TODO(), clf); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if _, err := r.Reconcile(context.TODO(), req); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if err := mcClient.Get(context.TODO(), clfKey, clf); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if len(clf.Spec.Outputs) != 1 || clf.Spec.Outputs[0].Name != "cloudwatch" {
+				t.Errorf("expected the CLF to be restored, got outputs %v", clf.Spec.Outputs)
+			}
+		})
+	}
+}
+
+func TestReconcileNoPipeline(t *testing.T) {
+	const hcpNamespace = "clusters-test"
+
+	hlf := &v1alpha1.HyperShiftLogForwarder{
+		ObjectMeta: metav1.ObjectMeta{Name: "instance", Namespace: constants.HLFWatchedNamespace},
+		Spec: v1alpha1.HyperShiftLogForwarderSpec{
+			ClusterLogForwarderSpec: loggingv1.ClusterLogForwarderSpec{
+				Outputs: []loggingv1.OutputSpec{{Name: "cloudwatch", Type: "cloudwatch"}},
+			},
+		},
+	}
+	guestClient := newTestClient(t, hlf)
+	mcClient := newTestClient(t, &hyperv1beta1.HostedControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: hcpNamespace},
+	})
+	r := &HyperShiftLogForwarderReconciler{
+		Client:       guestClient,
+		MCClient:     mcClient,
+		HCPNamespace: hcpNamespace,
+	}
+
+	if _, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(hlf)}); err == nil {
+		t.Fatal("expected the HLF without pipeline to be rejected")
+	}
+
+	// The HLF forwarding no logs is reported degraded and no CLF is applied
+	key := types.NamespacedName{Name: hlf.Name, Namespace: hcpNamespace}
+	if err := mcClient.Get(context.TODO(), key, &loggingv1.ClusterLogForwarder{}); !apierrors.IsNotFound(err) {
+		t.Errorf("expected no CLF applied for the HLF without pipeline, got %v", err)
+	}
+	if err := guestClient.Get(context.TODO(), client.ObjectKeyFromObject(hlf), hlf); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	condition := hlf.Status.Conditions.GetCondition(noPipelineCondition.Type)
+	if condition == nil || condition.Reason != noPipelineCondition.Reason {
+		t.Errorf("mismatched condition, expected %v, got %v", noPipelineCondition.Reason, condition)
+	}
+	if hlf.Status.Health != v1alpha1.DegradedState {
+		t.Errorf("mismatched health, expected %s, got %s", v1alpha1.DegradedState, hlf.Status.Health)
+	}
+}
+
+func TestForwarderHealth(t *testing.T) {
+	secretsPresent := loggingv1.Condition{Type: SecretsPropagatedCondition, Status: corev1.ConditionTrue, Reason: SecretsPresentReason}
+	secretsMissing := loggingv1.Condition{Type: SecretsPropagatedCondition, Status: corev1.ConditionFalse, Reason: SecretsMissingReason}
+	secretsUnknown := loggingv1.Condition{Type: SecretsPropagatedCondition, Status: corev1.ConditionUnknown}
+
+	tests := []struct {
+		name       string
+		conditions loggingv1.Conditions
+		expected   v1alpha1.HealthState
+	}{
+		{
+			name:     "no condition",
+			expected: v1alpha1.HealthyState,
+		},
+		{
+			name:       "secrets present",
+			conditions: loggingv1.Conditions{secretsPresent},
+			expected:   v1alpha1.HealthyState,
+		},
+		{
+			name:       "secrets missing",
+			conditions: loggingv1.Conditions{secretsMissing},
+			expected:   v1alpha1.DegradedState,
+		},
+		{
+			name:       "failing validation",
+			conditions: loggingv1.Conditions{noPipelineCondition},
+			expected:   v1alpha1.DegradedState,
+		},
+		{
+			name:       "in conflict",
+			conditions: loggingv1.Conditions{conflictCondition("other")},
+			expected:   v1alpha1.DegradedState,
+		},
+		{
+			name:       "secrets unknown",
+			conditions: loggingv1.Conditions{secretsUnknown},
+			expected:   v1alpha1.UnknownState,
+		},
+		{
+			name:       "unmanaged",
+			conditions: loggingv1.Conditions{unmanagedCondition, secretsPresent},
+			expected:   v1alpha1.UnknownState,
+		},
+		{
+			name:       "unmanaged with the secrets missing",
+			conditions: loggingv1.Conditions{unmanagedCondition, secretsMissing},
+			expected:   v1alpha1.DegradedState,
+		},
+		{
+			name:       "not degraded",
+			conditions: loggingv1.Conditions{{Type: degradedCondition, Status: corev1.ConditionFalse}, secretsPresent},
+			expected:   v1alpha1.HealthyState,
+		},
+		{
+			name:       "degraded with the secrets unknown",
+			conditions: loggingv1.Conditions{secretsUnknown, nonSupportFilterTypeCondition},
+			expected:   v1alpha1.DegradedState,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if health := forwarderHealth(tt.conditions); health != tt.expected {
+				t.Errorf("mismatched health, expected %s, got %s", tt.expected, health)
+			}
+		})
+	}
+}
+
+func TestReconcileCollectorStatus(t *testing.T) {
+	const hcpNamespace = "clusters-test"
+
+	hlf := &v1alpha1.HyperShiftLogForwarder{
+		ObjectMeta: metav1.ObjectMeta{Name: "instance", Namespace: constants.HLFWatchedNamespace},
+		Spec: v1alpha1.HyperShiftLogForwarderSpec{
+			ClusterLogForwarderSpec: loggingv1.ClusterLogForwarderSpec{
+				Pipelines: testPipelines,
+				Outputs:   []loggingv1.OutputSpec{{Name: "cloudwatch", Type: "cloudwatch"}},
+			},
+		},
+	}
+	replicas := int32(2)
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: hlf.Name, Namespace: hcpNamespace},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+		Status:     appsv1.DeploymentStatus{ReadyReplicas: 1},
+	}
+	collectorPod := func(name string, restarts int32) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: hcpNamespace,
+				Labels: map[string]string{
+					collectorComponentLabel: collectorComponentValue,
+					collectorInstanceLabel:  hlf.Name,
+				},
+			},
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{{Name: "collector", RestartCount: restarts}},
+			},
+		}
+	}
+	guestClient := newTestClient(t, hlf)
+	mcClient := newTestClient(t, deployment, collectorPod("collector-a", 3), collectorPod("collector-b", 0),
+		&hyperv1beta1.HostedControlPlane{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: hcpNamespace},
+		})
+	r := &HyperShiftLogForwarderReconciler{
+		Client:       guestClient,
+		MCClient:     mcClient,
+		HCPNamespace: hcpNamespace,
+	}
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(hlf)}
+
+	if _, err := r.Reconcile(context.TODO(), req); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := guestClient.Get(context.TODO(), req.NamespacedName, hlf); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	expected := v1alpha1.CollectorStatus{Desired: 2, Ready: 1, Restarts: 3, Restarting: 1}
+	if hlf.Status.Collector == nil || *hlf.Status.Collector != expected {
+		t.Errorf("mismatched collector status, expected %v, got %v", expected, hlf.Status.Collector)
+	}
+}
+
+func TestReconcileSecretsPropagated(t *testing.T) {
+	const hcpNamespace = "clusters-test"
+
+	hlf := &v1alpha1.HyperShiftLogForwarder{
+		ObjectMeta: metav1.ObjectMeta{Name: "instance", Namespace: constants.HLFWatchedNamespace},
+		Spec: v1alpha1.HyperShiftLogForwarderSpec{
+			ClusterLogForwarderSpec: loggingv1.ClusterLogForwarderSpec{
+				Pipelines: testPipelines,
+				Outputs: []loggingv1.OutputSpec{
+					{Name: "cloudwatch", Type: "cloudwatch", Secret: &loggingv1.OutputSecretSpec{Name: "cloudwatch-credentials"}},
+					{Name: "loki", Type: "loki", Secret: &loggingv1.OutputSecretSpec{Name: "loki-credentials"}},
+				},
+			},
+		},
+	}
+	guestClient := newTestClient(t, hlf)
+	mcClient := newTestClient(t,
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "loki-credentials", Namespace: hcpNamespace},
+			Data:       map[string][]byte{"token": []byte("secret")},
+		},
+		&hyperv1beta1.HostedControlPlane{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: hcpNamespace},
+		})
+	r := &HyperShiftLogForwarderReconciler{
+		Client:       guestClient,
+		MCClient:     mcClient,
+		HCPNamespace: hcpNamespace,
+	}
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(hlf)}
+
+	if _, err := r.Reconcile(context.TODO(), req); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := guestClient.Get(context.TODO(), req.NamespacedName, hlf); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	condition := hlf.Status.Conditions.GetCondition(SecretsPropagatedCondition)
+	if condition == nil {
+		t.Fatalf("expected the %s condition, got %v", SecretsPropagatedCondition, hlf.Status.Conditions)
+	}
+	if condition.Status != corev1.ConditionFalse || condition.Reason != SecretsMissingReason {
+		t.Errorf("mismatched condition, expected %v/%v, got %v/%v",
+			corev1.ConditionFalse, SecretsMissingReason, condition.Status, condition.Reason)
+	}
+	expected := "missing in clusters-test: cloudwatch-credentials (output cloudwatch); present: loki-credentials (output loki)"
+	if condition.Message != expected {
+		t.Errorf("mismatched message, expected %q, got %q", expected, condition.Message)
+	}
+}
+
+func TestReconcileDeletedClusterLogForwarder(t *testing.T) {
+	const hcpNamespace = "clusters-test"
+
+	hlf := &v1alpha1.HyperShiftLogForwarder{
+		ObjectMeta: metav1.ObjectMeta{Name: "instance", Namespace: constants.HLFWatchedNamespace},
+		Spec: v1alpha1.HyperShiftLogForwarderSpec{
+			ClusterLogForwarderSpec: loggingv1.ClusterLogForwarderSpec{
+				Pipelines: testPipelines,
+				Outputs:   []loggingv1.OutputSpec{{Name: "cloudwatch", Type: "cloudwatch"}},
+			},
+		},
+	}
+	guestClient := newTestClient(t, hlf)
+	mcClient := newTestClient(t, &hyperv1beta1.HostedControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: hcpNamespace},
+	})
+	r := &HyperShiftLogForwarderReconciler{
+		Client:       guestClient,
+		MCClient:     mcClient,
+		HCPNamespace: hcpNamespace,
+	}
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(hlf)}
+	key := types.NamespacedName{Name: hlf.Name, Namespace: hcpNamespace}
+
+	if _, err := r.Reconcile(context.TODO(), req); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	clf := &loggingv1.ClusterLogForwarder{}
+	if err := mcClient.Get(context.TODO(), key, clf); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := mcClient.Delete(context.TODO(), clf); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	other := clf.DeepCopy()
+	other.Namespace = "clusters-other"
+	if reqs := r.ForwarderForClusterLogForwarder(other); len(reqs) != 0 {
+		t.Errorf("expected no request for the CLF of another hosted cluster, got %v", reqs)
+	}
+	reqs := r.ForwarderForClusterLogForwarder(clf)
+	if len(reqs) != 1 || reqs[0] != req {
+		t.Fatalf("mismatched requests, expected %v, got %v", []ctrl.Request{req}, reqs)
+	}
+	if _, err := r.Reconcile(context.TODO(), reqs[0]); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := mcClient.Get(context.TODO(), key, &loggingv1.ClusterLogForwarder{}); err != nil {
+		t.Errorf("expected the deleted CLF to be created again, got %v", err)
+	}
+}
+
+func TestReconcileConflictingForwarders(t *testing.T) {
+	const hcpNamespace = "clusters-test"
+
+	hlf := func(name string, created time.Time) *v1alpha1.HyperShiftLogForwarder {
+		return &v1alpha1.HyperShiftLogForwarder{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         constants.HLFWatchedNamespace,
+				CreationTimestamp: metav1.NewTime(created),
+			},
+			Spec: v1alpha1.HyperShiftLogForwarderSpec{
+				ClusterLogForwarderSpec: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: testPipelines,
+					Outputs:   []loggingv1.OutputSpec{{Name: "cloudwatch", Type: "cloudwatch"}},
+				},
+			},
+		}
+	}
+	now := time.Now().Truncate(time.Second)
+	// The oldest HLF is applied, not the older one by name
+	older, newer := hlf("forwarder-b", now.Add(-time.Hour)), hlf("forwarder-a", now)
+	guestClient := newTestClient(t, older, newer)
+	mcClient := newTestClient(t, &hyperv1beta1.HostedControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: hcpNamespace},
+	})
+	r := &HyperShiftLogForwarderReconciler{
+		Client:       guestClient,
+		MCClient:     mcClient,
+		HCPNamespace: hcpNamespace,
+	}
+
+	// The applied HLF does not depend on the order of the reconciles
+	for _, instance := range []*v1alpha1.HyperShiftLogForwarder{newer, older} {
+		if _, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(instance)}); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+	for name, expected := range map[string]bool{older.Name: true, newer.Name: false} {
+		err := mcClient.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: hcpNamespace}, &loggingv1.ClusterLogForwarder{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if found := err == nil; found != expected {
+			t.Errorf("mismatched CLF of %s, expected %v, got %v", name, expected, found)
+		}
+	}
+	if err := guestClient.Get(context.TODO(), client.ObjectKeyFromObject(newer), newer); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	condition := newer.Status.Conditions.GetCondition(ConflictCondition)
+	if condition == nil || condition.Reason != MultipleForwardersReason || !strings.Contains(condition.Message, older.Name) {
+		t.Errorf("mismatched condition, expected %v naming %s, got %v", MultipleForwardersReason, older.Name, condition)
+	}
+	if err := guestClient.Get(context.TODO(), client.ObjectKeyFromObject(older), older); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if older.Status.Conditions.GetCondition(ConflictCondition) != nil {
+		t.Errorf("expected no conflict of the applied HLF, got %v", older.Status.Conditions)
+	}
+
+	// The other HLF takes over once the applied one is deleted
+	if err := guestClient.Delete(context.TODO(), older); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if _, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(older)}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	reqs := r.ConflictingForwarders(older)
+	if len(reqs) != 1 || reqs[0].Name != newer.Name {
+		t.Fatalf("mismatched requests, expected %v, got %v", newer.Name, reqs)
+	}
+	if _, err := r.Reconcile(context.TODO(), reqs[0]); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := mcClient.Get(context.TODO(), types.NamespacedName{Name: newer.Name, Namespace: hcpNamespace}, &loggingv1.ClusterLogForwarder{}); err != nil {
+		t.Errorf("expected the CLF of %s, got %v", newer.Name, err)
+	}
+	if err := guestClient.Get(context.TODO(), client.ObjectKeyFromObject(newer), newer); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if newer.Status.Conditions.GetCondition(ConflictCondition) != nil {
+		t.Errorf("expected the conflict to be resolved, got %v", newer.Status.Conditions)
+	}
+}
+
+// writeCountingClient counts the updated and the deleted objects
+type writeCountingClient struct {
+	client.Client
+	updates int
+	deletes int
+}
+
+func (c *writeCountingClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	c.updates++
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+func (c *writeCountingClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	c.deletes++
+	return c.Client.Delete(ctx, obj, opts...)
+}
+
+func TestReconcileLoggingUpgrade(t *testing.T) {
+	const hcpNamespace = "clusters-test"
+
+	tests := []struct {
+		name            string
+		appliedVersion  string
+		guestVersion    string
+		loggingVersion  string
+		expectedUpdates int
+		expectedVersion string
+	}{
+		{
+			name:            "cluster-logging upgraded",
+			appliedVersion:  "5.7.3",
+			guestVersion:    "5.8.0",
+			expectedUpdates: 1,
+			expectedVersion: "5.8.0",
+		},
+		{
+			name:            "cluster-logging not upgraded",
+			appliedVersion:  "5.7.3",
+			guestVersion:    "5.7.3",
+			expectedUpdates: 0,
+			expectedVersion: "5.7.3",
+		},
+		{
+			name:            "version recorded for the first time",
+			guestVersion:    "5.7.3",
+			expectedUpdates: 1,
+			expectedVersion: "5.7.3",
+		},
+		{
+			name:            "detected version preferred",
+			appliedVersion:  "5.6",
+			guestVersion:    "5.8.0",
+			loggingVersion:  "5.6",
+			expectedUpdates: 1,
+			expectedVersion: "5.8.0",
+		},
+		{
+			name:            "version not detected",
+			appliedVersion:  "5.7",
+			loggingVersion:  "5.7",
+			expectedUpdates: 0,
+			expectedVersion: "5.7",
+		},
+		{
+			name:            "latest version assumed",
+			appliedVersion:  "5.7",
+			expectedUpdates: 1,
+			expectedVersion: "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hlf := &v1alpha1.HyperShiftLogForwarder{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       "instance",
+					Namespace:  constants.HLFWatchedNamespace,
+					Finalizers: []string{constants.ManagedLoggingFinalizer},
+				},
+				Spec: v1alpha1.HyperShiftLogForwarderSpec{
+					ClusterLogForwarderSpec: loggingv1.ClusterLogForwarderSpec{
+						Pipelines: testPipelines,
+						Outputs:   []loggingv1.OutputSpec{{Name: "cloudwatch", Type: "cloudwatch"}},
+					},
+				},
+			}
+			hcp := &hyperv1beta1.HostedControlPlane{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: hcpNamespace},
+			}
+			r := &HyperShiftLogForwarderReconciler{HCPNamespace: hcpNamespace, LoggingVersion: test.loggingVersion}
+			clf := r.buildClusterLogForwarder(hlf)
+			if err := controllerutil.SetOwnerReference(hcp, clf, newTestClient(t).Scheme()); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if test.appliedVersion != "" {
+				clf.Annotations[constants.LoggingVersionAnnotation] = test.appliedVersion
+			}
+
+			guestClient := newTestClient(t, hlf)
+			mcClient := &writeCountingClient{Client: newTestClient(t, clf, hcp)}
+			r.Client = guestClient
+			r.MCClient = mcClient
+			var csvs []client.Object
+			if test.guestVersion != "" {
+				csvs = append(csvs, newLoggingOperatorCSV(test.guestVersion))
+			}
+			r.LoggingVersionReader = newTestClient(t, csvs...)
+			req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(hlf)}
+
+			if _, err := r.Reconcile(context.TODO(), req); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			// The CLF is re-rendered in place, it is never deleted
+			if mcClient.deletes != 0 {
+				t.Errorf("mismatched deletes, expected %v, got %v", 0, mcClient.deletes)
+			}
+			if mcClient.updates != test.expectedUpdates {
+				t.Errorf("mismatched updates, expected %v, got %v", test.expectedUpdates, mcClient.updates)
+			}
+			current := &loggingv1.ClusterLogForwarder{}
+			if err := mcClient.Get(context.TODO(), client.ObjectKeyFromObject(clf), current); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if current.Annotations[constants.LoggingVersionAnnotation] != test.expectedVersion {
+				t.Errorf("mismatched logging version, expected %v, got %v",
+					test.expectedVersion, current.Annotations[constants.LoggingVersionAnnotation])
+			}
+		})
+	}
+}
+
+// newLoggingOperatorCSV returns the succeeded CSV of the cluster-logging operator at the version
+func newLoggingOperatorCSV(version string) *unstructured.Unstructured {
+	csv := hostedcluster.NewClusterServiceVersion()
+	csv.SetNamespace(constants.HLFWatchedNamespace)
+	csv.SetName(constants.LoggingOperatorCSVPrefix + "v" + version)
+	csv.Object["spec"] = map[string]interface{}{"version": version}
+	csv.Object["status"] = map[string]interface{}{"phase": "Succeeded"}
+	return csv
+}
+
+func TestLoggingVersionReconciler(t *testing.T) {
+	key := types.NamespacedName{Name: "test", Namespace: "clusters"}
+
+	tests := []struct {
+		name            string
+		recordedVersion string
+		guestVersion    string
+		expectedVersion string
+	}{
+		{
+			name:            "recorded for the first time",
+			guestVersion:    "5.7.3",
+			expectedVersion: "5.7.3",
+		},
+		{
+			name:            "cluster-logging upgraded",
+			recordedVersion: "5.7.3",
+			guestVersion:    "5.8.0",
+			expectedVersion: "5.8.0",
+		},
+		{
+			name:            "cluster-logging uninstalled",
+			recordedVersion: "5.8.0",
+			expectedVersion: "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hc := &hyperv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}}
+			if test.recordedVersion != "" {
+				hc.Annotations = map[string]string{constants.LoggingVersionAnnotation: test.recordedVersion}
+			}
+			var csvs []client.Object
+			if test.guestVersion != "" {
+				csvs = append(csvs, newLoggingOperatorCSV(test.guestVersion))
+			}
+			mcClient := newTestClient(t, hc)
+			r := &LoggingVersionReconciler{
+				Client:              newTestClient(t, csvs...),
+				MCClient:            mcClient,
+				HostedClusterReader: mcClient,
+				HostedClusterKey:    key,
+			}
+
+			if _, err := r.Reconcile(context.TODO(), ctrl.Request{}); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			current := &hyperv1beta1.HostedCluster{}
+			if err := mcClient.Get(context.TODO(), key, current); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if current.Annotations[constants.LoggingVersionAnnotation] != test.expectedVersion {
+				t.Errorf("mismatched logging version, expected %v, got %v",
+					test.expectedVersion, current.Annotations[constants.LoggingVersionAnnotation])
+			}
+		})
+	}
+}
+
+// unreachableClient fails every call as if the cluster could not be reached
+type unreachableClient struct {
+	client.Client
+}
+
+func (c *unreachableClient) Get(_ context.Context, _ client.ObjectKey, _ client.Object) error {
+	return errors.New("dial tcp 10.0.0.1:6443: connect: connection refused")
+}
+
+func (c *unreachableClient) Delete(_ context.Context, _ client.Object, _ ...client.DeleteOption) error {
+	return errors.New("dial tcp 10.0.0.1:6443: connect: connection refused")
+}
+
+// guestUnreachableClient fails the reads of the guest cluster as if its API server was gone
+type guestUnreachableClient struct {
+	client.Client
+}
+
+func (c *guestUnreachableClient) Get(_ context.Context, _ client.ObjectKey, _ client.Object) error {
+	return &url.Error{
+		Op:  "Get",
+		URL: "https://api.guest:6443/apis/logging.managed.openshift.io/v1alpha1",
+		Err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED},
+	}
+}
+
+func TestReconcileGuestUnreachable(t *testing.T) {
+	const hcpNamespace = "clusters-test"
+	key := types.NamespacedName{Name: "test", Namespace: "clusters"}
+	deleted := metav1.Now()
+
+	tests := []struct {
+		name           string
+		hostedCluster  *hyperv1beta1.HostedCluster
+		expectTeardown bool
+	}{
+		{
+			name:          "transient",
+			hostedCluster: &hyperv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}},
+		},
+		{
+			name:           "hosted cluster deleted",
+			expectTeardown: true,
+		},
+		{
+			name: "hosted cluster being deleted",
+			hostedCluster: &hyperv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{
+				Name:              key.Name,
+				Namespace:         key.Namespace,
+				DeletionTimestamp: &deleted,
+				Finalizers:        []string{"hypershift.openshift.io/finalizer"},
+			}},
+			expectTeardown: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var objs []client.Object
+			if test.hostedCluster != nil {
+				objs = append(objs, test.hostedCluster)
+			}
+			tornDown := false
+			r := &HyperShiftLogForwarderReconciler{
+				Client:           &guestUnreachableClient{Client: newTestClient(t)},
+				MCClient:         newTestClient(t, objs...),
+				HCPNamespace:     hcpNamespace,
+				HostedClusterKey: key,
+				Teardown:         func() { tornDown = true },
+			}
+
+			result, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "instance", Namespace: constants.HLFWatchedNamespace}})
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if tornDown != test.expectTeardown {
+				t.Errorf("mismatched teardown, expected %v, got %v", test.expectTeardown, tornDown)
+			}
+			// The unreachable guest cluster is retried later rather than with the backoff of the failures
+			expectedRequeue := unreachableRequeueInterval
+			if test.expectTeardown {
+				expectedRequeue = 0
+			}
+			if result.RequeueAfter != expectedRequeue {
+				t.Errorf("mismatched requeue, expected %v, got %v", expectedRequeue, result.RequeueAfter)
+			}
+		})
+	}
+}
+
+func TestReconcileFinalizerGracePeriod(t *testing.T) {
+	tests := []struct {
+		name            string
+		deletedAgo      time.Duration
+		gracePeriod     time.Duration
+		expectErr       bool
+		expectFinalizer bool
+	}{
+		{
+			name:        "finalizer removed after the grace period",
+			deletedAgo:  time.Hour,
+			gracePeriod: 10 * time.Minute,
+		},
+		{
+			name:            "cleanup retried within the grace period",
+			deletedAgo:      time.Minute,
+			gracePeriod:     10 * time.Minute,
+			expectErr:       true,
+			expectFinalizer: true,
+		},
+		{
+			name:            "cleanup retried without grace period",
+			deletedAgo:      time.Hour,
+			expectErr:       true,
+			expectFinalizer: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			deleted := metav1.NewTime(time.Now().Add(-test.deletedAgo))
+			hlf := &v1alpha1.HyperShiftLogForwarder{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "instance",
+					Namespace:         constants.HLFWatchedNamespace,
+					DeletionTimestamp: &deleted,
+					Finalizers:        []string{constants.ManagedLoggingFinalizer},
+				},
+			}
+			guestClient := newTestClient(t, hlf)
+			r := &HyperShiftLogForwarderReconciler{
+				Client:               guestClient,
+				MCClient:             &unreachableClient{Client: newTestClient(t)},
+				HCPNamespace:         "clusters-test",
+				FinalizerGracePeriod: test.gracePeriod,
+			}
+
+			_, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(hlf)})
+			if test.expectErr != (err != nil) {
+				t.Errorf("mismatched err, expected err %v, got %v", test.expectErr, err)
+			}
+
+			current := &v1alpha1.HyperShiftLogForwarder{}
+			err = guestClient.Get(context.TODO(), client.ObjectKeyFromObject(hlf), current)
+			if err != nil && !apierrors.IsNotFound(err) {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			hasFinalizer := err == nil && controllerutil.ContainsFinalizer(current, constants.ManagedLoggingFinalizer)
+			if hasFinalizer != test.expectFinalizer {
+				t.Errorf("mismatched finalizer, expected %v, got %v", test.expectFinalizer, hasFinalizer)
+			}
+		})
+	}
+}
+
+// onboardObservations returns the number of onboarding latencies recorded
+func onboardObservations(t *testing.T) uint64 {
+	families, err := metrics.Registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() == "hlo_cluster_onboard_seconds" {
+			return family.GetMetric()[0].GetHistogram().GetSampleCount()
+		}
+	}
+	return 0
+}
+
+func TestReconcileOnboardLatency(t *testing.T) {
+	const hcpNamespace = "clusters-test"
+
+	hlf := &v1alpha1.HyperShiftLogForwarder{
+		ObjectMeta: metav1.ObjectMeta{Name: "instance", Namespace: constants.HLFWatchedNamespace},
+		Spec: v1alpha1.HyperShiftLogForwarderSpec{
+			ClusterLogForwarderSpec: loggingv1.ClusterLogForwarderSpec{
+				Pipelines: testPipelines,
+				Outputs:   []loggingv1.OutputSpec{{Name: "cloudwatch", Type: "cloudwatch"}},
+			},
+		},
+	}
+	r := &HyperShiftLogForwarderReconciler{
+		Client: newTestClient(t, hlf),
+		MCClient: newTestClient(t, &hyperv1beta1.HostedControlPlane{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: hcpNamespace},
+		}),
+		HCPNamespace: hcpNamespace,
+		ReadySince:   time.Now(),
+	}
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(hlf)}
+	before := onboardObservations(t)
+
+	if _, err := r.Reconcile(context.TODO(), req); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if got := onboardObservations(t) - before; got != 1 {
+		t.Errorf("mismatched onboard observations, expected %v, got %v", 1, got)
+	}
+
+	// The hosted cluster is onboarded once
+	if _, err := r.Reconcile(context.TODO(), req); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if got := onboardObservations(t) - before; got != 1 {
+		t.Errorf("mismatched onboard observations, expected %v, got %v", 1, got)
+	}
+}
+
+func TestReconcilePaused(t *testing.T) {
+	const hcpNamespace = "clusters-test"
+
+	tests := []struct {
+		name   string
+		paused bool
+		cm     *corev1.ConfigMap
+	}{
+		{
+			name:   "paused by the flag",
+			paused: true,
+		},
+		{
+			name: "paused by the ConfigMap",
+			cm: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: constants.PauseConfigMapName, Namespace: constants.OperatorNamespace},
+				Data:       map[string]string{constants.PausedKey: "true"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hlf := &v1alpha1.HyperShiftLogForwarder{
+				ObjectMeta: metav1.ObjectMeta{Name: "instance", Namespace: constants.HLFWatchedNamespace},
+				Spec: v1alpha1.HyperShiftLogForwarderSpec{
+					ClusterLogForwarderSpec: loggingv1.ClusterLogForwarderSpec{
+						Pipelines: testPipelines,
+						Outputs:   []loggingv1.OutputSpec{{Name: "cloudwatch", Type: "cloudwatch"}},
+					},
+				},
+			}
+			objs := []client.Object{&hyperv1beta1.HostedControlPlane{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: hcpNamespace},
+			}}
+			if test.cm != nil {
+				objs = append(objs, test.cm)
+			}
+			guestClient := newTestClient(t, hlf)
+			mcClient := newTestClient(t, objs...)
+			r := &HyperShiftLogForwarderReconciler{
+				Client:       guestClient,
+				MCClient:     mcClient,
+				HCPNamespace: hcpNamespace,
+				Paused:       test.paused,
+			}
+			req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(hlf)}
+			clfKey := types.NamespacedName{Name: hlf.Name, Namespace: hcpNamespace}
+
+			result, err := r.Reconcile(context.TODO(), req)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if result.RequeueAfter != constants.PausedRequeueInterval {
+				t.Errorf("mismatched requeue, expected %v, got %v", constants.PausedRequeueInterval, result.RequeueAfter)
+			}
+			if err := mcClient.Get(context.TODO(), clfKey, &loggingv1.ClusterLogForwarder{}); !apierrors.IsNotFound(err) {
+				t.Errorf("expected no CLF applied while paused, got %v", err)
+			}
+			if err := guestClient.Get(context.TODO(), req.NamespacedName, hlf); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if controllerutil.ContainsFinalizer(hlf, constants.ManagedLoggingFinalizer) {
+				t.Errorf("expected the HLF untouched while paused, got finalizers %v", hlf.Finalizers)
+			}
+
+			// The reconciliation resumes once unpaused
+			r.Paused = false
+			if test.cm != nil {
+				if err := mcClient.Delete(context.TODO(), test.cm); err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+			}
+			if _, err := r.Reconcile(context.TODO(), req); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if err := mcClient.Get(context.TODO(), clfKey, &loggingv1.ClusterLogForwarder{}); err != nil {
+				t.Errorf("expected the CLF applied once resumed, got %v", err)
+			}
+		})
+	}
+}
+
+// testPipelines forward the audit logs of the hosted control plane, a valid HLF has at least one pipeline
+var testPipelines = []loggingv1.PipelineSpec{{
+	Name:       "audit",
+	InputRefs:  []string{clusterlogforwarder.InputHTTPServerName},
+	OutputRefs: []string{"cloudwatch"},
+}}
+
+func newTestClient(t *testing.T, objs ...client.Object) client.Client {
+	s := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{
+		appsv1.AddToScheme,
+		corev1.AddToScheme,
+		hyperv1beta1.AddToScheme,
+		loggingv1.AddToScheme,
+		v1alpha1.AddToScheme,
+	} {
+		if err := add(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return fake.NewClientBuilder().WithScheme(s).WithObjects(objs...).Build()
+}
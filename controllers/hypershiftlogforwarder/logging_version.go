@@ -0,0 +1,94 @@
+package hypershiftlogforwarder
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	hyperv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/openshift/hypershift-logging-operator/api/v1alpha1"
+	"github.com/openshift/hypershift-logging-operator/pkg/constants"
+	"github.com/openshift/hypershift-logging-operator/pkg/hostedcluster"
+)
+
+// loggingVersion returns the version of cluster-logging running in the guest cluster, LoggingVersion if it is not
+// detected
+func (r *HyperShiftLogForwarderReconciler) loggingVersion(ctx context.Context) (string, error) {
+	if r.LoggingVersionReader != nil {
+		version, err := hostedcluster.LoggingVersion(ctx, r.LoggingVersionReader)
+		if version != "" || err != nil {
+			return version, err
+		}
+	}
+	return r.LoggingVersion, nil
+}
+
+// ForwardersForLoggingOperator maps a CSV of the cluster-logging operator to all the HLFs of the guest cluster,
+// their CLFs are rendered again for the cluster-logging version once it is upgraded
+func (r *HyperShiftLogForwarderReconciler) ForwardersForLoggingOperator(obj client.Object) []reconcile.Request {
+	hlfList := &v1alpha1.HyperShiftLogForwarderList{}
+	if err := r.List(context.TODO(), hlfList, client.InNamespace(constants.HLFWatchedNamespace)); err != nil {
+		return nil
+	}
+
+	var reqs []reconcile.Request
+	for _, hlf := range hlfList.Items {
+		reqs = append(reqs, reconcile.Request{NamespacedName: types.NamespacedName{Name: hlf.Name, Namespace: hlf.Namespace}})
+	}
+	return reqs
+}
+
+// LoggingVersionReconciler records on the HostedCluster the version of cluster-logging detected in the guest
+// cluster, the templates are rendered for the version of each hosted cluster
+type LoggingVersionReconciler struct {
+	// Client reads the CSVs of the cluster-logging operator in the guest cluster
+	Client client.Client
+	// MCClient patches the HostedCluster on the management cluster
+	MCClient client.Client
+	// HostedClusterReader reads the HostedCluster from the cache of the HostedCluster controller
+	HostedClusterReader client.Reader
+	// HostedClusterKey is the HostedCluster of the guest cluster on the management cluster
+	HostedClusterKey types.NamespacedName
+	log              logr.Logger
+}
+
+// Reconcile records the version of cluster-logging once a CSV of the operator changes
+func (r *LoggingVersionReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	r.log = ctrllog.FromContext(ctx).WithName("logging-version")
+
+	version, err := hostedcluster.LoggingVersion(ctx, r.Client)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	hostedCluster := &hyperv1beta1.HostedCluster{}
+	err = r.HostedClusterReader.Get(ctx, r.HostedClusterKey, hostedCluster)
+	if errors.IsNotFound(err) {
+		return ctrl.Result{}, nil
+	} else if err != nil {
+		return ctrl.Result{}, err
+	}
+	if hostedCluster.Annotations[constants.LoggingVersionAnnotation] == version {
+		return ctrl.Result{}, nil
+	}
+
+	r.log.Info("cluster-logging version changed", "Name", r.HostedClusterKey,
+		"From", hostedCluster.Annotations[constants.LoggingVersionAnnotation], "To", version)
+	// The HostedCluster is owned by HyperShift, the annotation is patched only
+	patch := client.MergeFrom(hostedCluster.DeepCopy())
+	if version == "" {
+		delete(hostedCluster.Annotations, constants.LoggingVersionAnnotation)
+	} else {
+		if hostedCluster.Annotations == nil {
+			hostedCluster.Annotations = map[string]string{}
+		}
+		hostedCluster.Annotations[constants.LoggingVersionAnnotation] = version
+	}
+	return ctrl.Result{}, r.MCClient.Patch(ctx, hostedCluster, patch)
+}
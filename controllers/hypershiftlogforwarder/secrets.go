@@ -0,0 +1,83 @@
+package hypershiftlogforwarder
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	loggingv1 "github.com/openshift/cluster-logging-operator/apis/logging/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/openshift/hypershift-logging-operator/api/v1alpha1"
+)
+
+// SecretsPropagatedCondition reports whether the secrets referenced by the outputs of the HLF are present
+// in the HCP namespace, where the collector reads them
+const SecretsPropagatedCondition loggingv1.ConditionType = "SecretsPropagated"
+
+// Reasons of the SecretsPropagatedCondition
+const (
+	SecretsPresentReason loggingv1.ConditionReason = "SecretsPresent"
+	SecretsMissingReason loggingv1.ConditionReason = "SecretsMissing"
+)
+
+// secretsCondition checks each secret referenced by the outputs of the HLF in the HCP namespace,
+// a secret without data is reported along with the missing ones. It returns nil if no output has a secret
+func (r *HyperShiftLogForwarderReconciler) secretsCondition(
+	ctx context.Context,
+	instance *v1alpha1.HyperShiftLogForwarder,
+) (*loggingv1.Condition, error) {
+	var present, missing, empty []string
+	checked := map[string]bool{}
+	for _, output := range instance.Spec.Outputs {
+		if output.Secret == nil || output.Secret.Name == "" || checked[output.Secret.Name] {
+			continue
+		}
+		checked[output.Secret.Name] = true
+		name := fmt.Sprintf("%s (output %s)", output.Secret.Name, output.Name)
+
+		secret := &corev1.Secret{}
+		err := r.MCClient.Get(ctx, types.NamespacedName{Name: output.Secret.Name, Namespace: r.HCPNamespace}, secret)
+		switch {
+		case errors.IsNotFound(err):
+			missing = append(missing, name)
+		case err != nil:
+			return nil, fmt.Errorf("failed to get the secret %s: %w", output.Secret.Name, err)
+		case len(secret.Data) == 0:
+			empty = append(empty, name)
+		default:
+			present = append(present, name)
+		}
+	}
+	if len(checked) == 0 {
+		return nil, nil
+	}
+
+	if len(missing) == 0 && len(empty) == 0 {
+		return &loggingv1.Condition{
+			Type:    SecretsPropagatedCondition,
+			Status:  corev1.ConditionTrue,
+			Reason:  SecretsPresentReason,
+			Message: fmt.Sprintf("present in %s: %s", r.HCPNamespace, strings.Join(present, ", ")),
+		}, nil
+	}
+
+	var details []string
+	if len(missing) > 0 {
+		details = append(details, fmt.Sprintf("missing in %s: %s", r.HCPNamespace, strings.Join(missing, ", ")))
+	}
+	if len(empty) > 0 {
+		details = append(details, fmt.Sprintf("without data: %s", strings.Join(empty, ", ")))
+	}
+	if len(present) > 0 {
+		details = append(details, fmt.Sprintf("present: %s", strings.Join(present, ", ")))
+	}
+	return &loggingv1.Condition{
+		Type:    SecretsPropagatedCondition,
+		Status:  corev1.ConditionFalse,
+		Reason:  SecretsMissingReason,
+		Message: strings.Join(details, "; "),
+	}, nil
+}
@@ -0,0 +1,52 @@
+package hypershiftlogforwarder
+
+import (
+	"context"
+	"time"
+
+	hyperv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// unreachableRequeueInterval is the requeue delay of an HLF whose guest cluster cannot be reached,
+// the unreachable guest cluster is not retried with the fast backoff of the failed reconciles
+const unreachableRequeueInterval = time.Minute
+
+// guestUnreachable handles a reconcile interrupted by an unreachable API server. The unreachability is permanent
+// once the hosted cluster is gone or being deleted, the guest manager is then torn down instead of retrying.
+// It is transient otherwise, e.g. during an upgrade of the guest API server, and the HLF is retried later
+func (r *HyperShiftLogForwarderReconciler) guestUnreachable(ctx context.Context, req ctrl.Request, err error) ctrl.Result {
+	gone, getErr := r.hostedClusterGone(ctx)
+	if getErr != nil {
+		r.log.Error(getErr, "failed to get the hosted cluster", "Name", r.HostedClusterKey)
+	}
+	if gone {
+		r.log.Error(err, "guest cluster unreachable and the hosted cluster is gone, stop its manager",
+			"Name", req.NamespacedName, "HostedCluster", r.HostedClusterKey)
+		if r.Teardown != nil {
+			r.Teardown()
+		}
+		return ctrl.Result{}
+	}
+
+	r.log.Error(err, "guest cluster unreachable, retry later", "Name", req.NamespacedName,
+		"RequeueAfter", unreachableRequeueInterval)
+	return ctrl.Result{RequeueAfter: unreachableRequeueInterval}
+}
+
+// hostedClusterGone returns true if the HostedCluster of the guest cluster is deleted or being deleted
+// from the management cluster
+func (r *HyperShiftLogForwarderReconciler) hostedClusterGone(ctx context.Context) (bool, error) {
+	if r.HostedClusterKey.Name == "" {
+		return false, nil
+	}
+	hostedCluster := &hyperv1beta1.HostedCluster{}
+	err := r.MCClient.Get(ctx, r.HostedClusterKey, hostedCluster)
+	if errors.IsNotFound(err) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	return !hostedCluster.DeletionTimestamp.IsZero(), nil
+}
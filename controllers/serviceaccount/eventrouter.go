@@ -0,0 +1,242 @@
+package serviceaccount
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/go-logr/logr"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/utils/pointer"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/openshift/hypershift-logging-operator/pkg/clusterlogforwarder"
+	"github.com/openshift/hypershift-logging-operator/pkg/constants"
+	"github.com/openshift/hypershift-logging-operator/pkg/hostedcluster"
+)
+
+const (
+	// eventRouterTokenExpiration is the lifetime of the tokens of the event routers, refreshed every TokenRefreshDuration
+	eventRouterTokenExpiration = time.Hour
+	eventRouterKubeConfigKey   = "kubeconfig"
+	eventRouterTokenKey        = "token"
+)
+
+// EventRouterAccessReconciler grants the event routers of the hosted cluster the read of the guest cluster events
+// only. It creates the guest service account of the event routers bound to a role reading the events, and publishes
+// a kubeconfig with a token of the service account in the HCP namespace, where the event routers mount it
+type EventRouterAccessReconciler struct {
+	// Client writes the service account and the RBAC of the guest cluster
+	Client client.Client
+	// Reader reads the guest service account and RBAC from the API server, they are not cached
+	Reader client.Reader
+	// ClientSet mints the tokens of the guest service account
+	ClientSet    kubernetes.Interface
+	MCClient     client.Client
+	HCPNamespace string
+	// Server and CAData are the guest API server the event routers connect to, as reached from the HCP namespace
+	Server string
+	CAData []byte
+	// CommonMetadata is stamped on the guest service account and RBAC and the published secret
+	CommonMetadata clusterlogforwarder.CommonMetadata
+	// RequeueJitter is the fraction of the refresh interval added at random to each requeue
+	RequeueJitter float64
+	log           logr.Logger
+}
+
+func (r *EventRouterAccessReconciler) Reconcile(ctx context.Context, _ ctrl.Request) (ctrl.Result, error) {
+	r.log = ctrllog.FromContext(ctx).WithName("hostedcluster-eventrouter-access-controller")
+	if r.HCPNamespace == "" {
+		return ctrl.Result{}, nil
+	}
+
+	if err := r.applyServiceAccount(ctx); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.applyRBAC(ctx); err != nil {
+		return ctrl.Result{}, err
+	}
+	token, err := r.mintToken(ctx)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.applyKubeConfigSecret(ctx, token); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: hostedcluster.JitterInterval(constants.TokenRefreshDuration, r.RequeueJitter)}, nil
+}
+
+// applyServiceAccount creates the guest service account of the event routers
+func (r *EventRouterAccessReconciler) applyServiceAccount(ctx context.Context) error {
+	sa := &corev1.ServiceAccount{}
+	key := types.NamespacedName{Name: constants.EventRouterServiceAccountName, Namespace: constants.MintServiceAccountNamespace}
+	err := r.Reader.Get(ctx, key, sa)
+	if err == nil {
+		return nil
+	} else if !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to get the event router service account: %w", err)
+	}
+	sa = &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}}
+	r.setManagedMetadata(sa)
+	if err := r.Client.Create(ctx, sa); err != nil && !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create the event router service account: %w", err)
+	}
+	return nil
+}
+
+// applyRBAC grants the guest service account of the event routers the read of the events, the rules and the
+// binding changed out-of-band are restored
+func (r *EventRouterAccessReconciler) applyRBAC(ctx context.Context) error {
+	role := &rbacv1.ClusterRole{
+		ObjectMeta: metav1.ObjectMeta{Name: constants.EventRouterServiceAccountName},
+		Rules: []rbacv1.PolicyRule{{
+			APIGroups: []string{"", "events.k8s.io"},
+			Resources: []string{"events"},
+			Verbs:     []string{"get", "list", "watch"},
+		}},
+	}
+	existingRole := &rbacv1.ClusterRole{}
+	err := r.Reader.Get(ctx, client.ObjectKeyFromObject(role), existingRole)
+	if errors.IsNotFound(err) {
+		r.setManagedMetadata(role)
+		if err := r.Client.Create(ctx, role); err != nil {
+			return fmt.Errorf("failed to create the event router role: %w", err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("failed to get the event router role: %w", err)
+	} else if !reflect.DeepEqual(existingRole.Rules, role.Rules) {
+		existingRole.Rules = role.Rules
+		if err := r.Client.Update(ctx, existingRole); err != nil {
+			return fmt.Errorf("failed to update the event router role: %w", err)
+		}
+	}
+
+	binding := &rbacv1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: constants.EventRouterServiceAccountName},
+		RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: role.Name},
+		Subjects: []rbacv1.Subject{{
+			Kind:      rbacv1.ServiceAccountKind,
+			Name:      constants.EventRouterServiceAccountName,
+			Namespace: constants.MintServiceAccountNamespace,
+		}},
+	}
+	existingBinding := &rbacv1.ClusterRoleBinding{}
+	err = r.Reader.Get(ctx, client.ObjectKeyFromObject(binding), existingBinding)
+	if errors.IsNotFound(err) {
+		r.setManagedMetadata(binding)
+		if err := r.Client.Create(ctx, binding); err != nil {
+			return fmt.Errorf("failed to create the event router role binding: %w", err)
+		}
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to get the event router role binding: %w", err)
+	}
+	if reflect.DeepEqual(existingBinding.Subjects, binding.Subjects) && existingBinding.RoleRef == binding.RoleRef {
+		return nil
+	}
+	// The role of a binding cannot be changed, the binding is created again
+	if existingBinding.RoleRef != binding.RoleRef {
+		if err := r.Client.Delete(ctx, existingBinding); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete the event router role binding: %w", err)
+		}
+		r.setManagedMetadata(binding)
+		if err := r.Client.Create(ctx, binding); err != nil {
+			return fmt.Errorf("failed to create the event router role binding: %w", err)
+		}
+		return nil
+	}
+	existingBinding.Subjects = binding.Subjects
+	if err := r.Client.Update(ctx, existingBinding); err != nil {
+		return fmt.Errorf("failed to update the event router role binding: %w", err)
+	}
+	return nil
+}
+
+// mintToken mints a token of the guest service account of the event routers
+func (r *EventRouterAccessReconciler) mintToken(ctx context.Context) (string, error) {
+	treq := &authenticationv1.TokenRequest{
+		Spec: authenticationv1.TokenRequestSpec{
+			ExpirationSeconds: pointer.Int64(int64(eventRouterTokenExpiration.Seconds())),
+		},
+	}
+	apiContext, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	token, err := r.ClientSet.CoreV1().ServiceAccounts(constants.MintServiceAccountNamespace).
+		CreateToken(apiContext, constants.EventRouterServiceAccountName, treq, metav1.CreateOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to create the event router token: %w", err)
+	}
+	return token.Status.Token, nil
+}
+
+// applyKubeConfigSecret publishes the kubeconfig and the token of the event routers in the HCP namespace. The
+// kubeconfig reads the token from its file, so that the refreshed token is picked up without restarting the
+// event routers
+func (r *EventRouterAccessReconciler) applyKubeConfigSecret(ctx context.Context, token string) error {
+	kubeConfig, err := clientcmd.Write(clientcmdapi.Config{
+		Clusters: map[string]*clientcmdapi.Cluster{
+			"guest": {Server: r.Server, CertificateAuthorityData: r.CAData},
+		},
+		AuthInfos: map[string]*clientcmdapi.AuthInfo{
+			"eventrouter": {TokenFile: fmt.Sprintf("%s/%s", constants.EventRouterKubeConfigPath, eventRouterTokenKey)},
+		},
+		Contexts: map[string]*clientcmdapi.Context{
+			"eventrouter": {Cluster: "guest", AuthInfo: "eventrouter"},
+		},
+		CurrentContext: "eventrouter",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to serialize the event router kubeconfig: %w", err)
+	}
+	data := map[string][]byte{eventRouterKubeConfigKey: kubeConfig, eventRouterTokenKey: []byte(token)}
+
+	hcp, err := hostedcluster.GetHostedControlPlane(r.MCClient, ctx, r.HCPNamespace)
+	if err != nil {
+		return err
+	}
+	secret := &corev1.Secret{}
+	err = r.MCClient.Get(ctx, types.NamespacedName{Name: constants.EventRouterKubeConfigSecretName, Namespace: r.HCPNamespace}, secret)
+	if errors.IsNotFound(err) {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: constants.EventRouterKubeConfigSecretName, Namespace: r.HCPNamespace},
+			Type:       corev1.SecretTypeOpaque,
+			Data:       data,
+		}
+		r.setManagedMetadata(secret)
+		if err := controllerutil.SetOwnerReference(hcp, secret, r.MCClient.Scheme()); err != nil {
+			return err
+		}
+		return r.MCClient.Create(ctx, secret)
+	} else if err != nil {
+		return err
+	}
+	secret.Data = data
+	r.setManagedMetadata(secret)
+	if err := controllerutil.SetOwnerReference(hcp, secret, r.MCClient.Scheme()); err != nil {
+		return err
+	}
+	return r.MCClient.Update(ctx, secret)
+}
+
+// setManagedMetadata labels the object as generated by the operator and stamps the common metadata
+func (r *EventRouterAccessReconciler) setManagedMetadata(obj client.Object) {
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[constants.ManagedByLabel] = constants.ManagedByLabelValue
+	obj.SetLabels(labels)
+	r.CommonMetadata.Apply(obj)
+}
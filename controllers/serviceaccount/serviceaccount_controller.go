@@ -26,9 +26,12 @@ import (
 	"k8s.io/client-go/kubernetes"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
 
+	"github.com/openshift/hypershift-logging-operator/pkg/clusterlogforwarder"
 	"github.com/openshift/hypershift-logging-operator/pkg/constants"
+	"github.com/openshift/hypershift-logging-operator/pkg/hostedcluster"
 
 	authenticationv1 "k8s.io/api/authentication/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -42,7 +45,12 @@ type ServiceAccountReconciler struct {
 	Scheme       *runtime.Scheme
 	MCClient     client.Client
 	HCPNamespace string
-	log          logr.Logger
+	// CommonMetadata is stamped on the minted service account and the propagated secret
+	CommonMetadata clusterlogforwarder.CommonMetadata
+	// RequeueJitter is the fraction of the refresh interval added at random to each requeue, so that the tokens
+	// of the hosted clusters are not refreshed at the same time
+	RequeueJitter float64
+	log           logr.Logger
 }
 
 func (r *ServiceAccountReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -57,7 +65,7 @@ func (r *ServiceAccountReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 
 	// If the audit log is not enabled, we skip the reconcile and retry in 10 minutes
 	if !enabled {
-		return ctrl.Result{RequeueAfter: 10 * time.Minute}, nil
+		return r.requeueAfter(10 * time.Minute), nil
 	}
 
 	serviceAccount := &corev1.ServiceAccount{}
@@ -81,7 +89,7 @@ func (r *ServiceAccountReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 	} else if err == nil {
 		serviceAccountExists = true
 	} else {
-		return ctrl.Result{RequeueAfter: constants.TokenRefreshDuration}, nil
+		return r.requeueAfter(constants.TokenRefreshDuration), nil
 	}
 
 	if serviceAccountExists {
@@ -93,6 +101,7 @@ func (r *ServiceAccountReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 				Namespace: constants.MintServiceAccountNamespace,
 			},
 		}
+		r.CommonMetadata.Apply(serviceAccount)
 
 		// Create the service account
 		apiContext, cancel := context.WithTimeout(ctx, 10*time.Second)
@@ -117,7 +126,12 @@ func (r *ServiceAccountReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 		return ctrl.Result{}, err
 	}
 
-	return ctrl.Result{RequeueAfter: constants.TokenRefreshDuration}, nil
+	return r.requeueAfter(constants.TokenRefreshDuration), nil
+}
+
+// requeueAfter returns the result requeuing the reconcile after the interval, jittered by RequeueJitter
+func (r *ServiceAccountReconciler) requeueAfter(interval time.Duration) ctrl.Result {
+	return ctrl.Result{RequeueAfter: hostedcluster.JitterInterval(interval, r.RequeueJitter)}
 }
 
 func (r *ServiceAccountReconciler) mintServiceAccountToken(
@@ -194,9 +208,19 @@ func (r *ServiceAccountReconciler) updateOrCreateCloudWatchSecret(
 		return err
 	}
 
+	hcp, err := hostedcluster.GetHostedControlPlane(r.MCClient, ctx, r.HCPNamespace)
+	if err != nil {
+		r.log.Error(err, "failed to get hosted control plane")
+		return err
+	}
+
 	if cloSecretExists {
 		cloCloudwatchSecret.Data["credentials"] = ocmCloudwatchSecret.Data["credentials"]
 		cloCloudwatchSecret.Data["token"] = []byte(token)
+		r.setManagedMetadata(cloCloudwatchSecret)
+		if err := controllerutil.SetOwnerReference(hcp, cloCloudwatchSecret, r.MCClient.Scheme()); err != nil {
+			return err
+		}
 		if err := r.MCClient.Update(ctx, cloCloudwatchSecret); err != nil {
 			r.log.Error(err, "failed to update secret")
 			return err
@@ -213,6 +237,10 @@ func (r *ServiceAccountReconciler) updateOrCreateCloudWatchSecret(
 				"token":       []byte(token),
 			},
 		}
+		r.setManagedMetadata(cloCloudwatchSecret)
+		if err := controllerutil.SetOwnerReference(hcp, cloCloudwatchSecret, r.MCClient.Scheme()); err != nil {
+			return err
+		}
 
 		if err := r.MCClient.Create(ctx, cloCloudwatchSecret); err != nil {
 			r.log.Error(err, "failed to create secret")
@@ -222,3 +250,12 @@ func (r *ServiceAccountReconciler) updateOrCreateCloudWatchSecret(
 
 	return nil
 }
+
+// setManagedMetadata labels the propagated secret as generated by the operator and stamps the common metadata
+func (r *ServiceAccountReconciler) setManagedMetadata(secret *corev1.Secret) {
+	if secret.Labels == nil {
+		secret.Labels = map[string]string{}
+	}
+	secret.Labels[constants.ManagedByLabel] = constants.ManagedByLabelValue
+	r.CommonMetadata.Apply(secret)
+}
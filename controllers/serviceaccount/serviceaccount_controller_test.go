@@ -0,0 +1,246 @@
+package serviceaccount
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	hyperv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	fakeclientset "k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/clientcmd"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/openshift/hypershift-logging-operator/pkg/clusterlogforwarder"
+	"github.com/openshift/hypershift-logging-operator/pkg/constants"
+)
+
+func TestReconcileRequeueJitter(t *testing.T) {
+	const hcpNamespace = "clusters-test"
+
+	tests := []struct {
+		name     string
+		jitter   float64
+		expected time.Duration
+	}{
+		{name: "no jitter", jitter: 0, expected: 10 * time.Minute},
+		{name: "jitter", jitter: 0.2, expected: 12 * time.Minute},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Without the CloudWatch credentials the audit is not enabled and the reconcile is retried later
+			c := newTestClient(t)
+			r := &ServiceAccountReconciler{
+				Client:        c,
+				MCClient:      c,
+				HCPNamespace:  hcpNamespace,
+				RequeueJitter: test.jitter,
+			}
+
+			for i := 0; i < 100; i++ {
+				result, err := r.Reconcile(context.TODO(), ctrl.Request{})
+				if err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+				if result.RequeueAfter < 10*time.Minute || result.RequeueAfter > test.expected {
+					t.Fatalf("mismatched requeue, expected within [%v, %v], got %v", 10*time.Minute, test.expected, result.RequeueAfter)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateOrCreateCloudWatchSecretCommonMetadata(t *testing.T) {
+	const hcpNamespace = "clusters-test"
+
+	tests := []struct {
+		name     string
+		existing []client.Object
+	}{
+		{
+			name: "new secret",
+		},
+		{
+			name: "existing secret",
+			existing: []client.Object{&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: constants.CollectorCloudWatchSecretName, Namespace: hcpNamespace},
+				Data:       map[string][]byte{"token": []byte("old-token")},
+			}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objs := append([]client.Object{
+				&hyperv1beta1.HostedControlPlane{
+					ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: hcpNamespace},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: constants.CloudWatchSecretName, Namespace: hcpNamespace},
+					Data:       map[string][]byte{"credentials": []byte("role_arn = arn:aws:iam::123456789012:role/test")},
+				},
+			}, test.existing...)
+			c := newTestClient(t, objs...)
+			r := &ServiceAccountReconciler{
+				MCClient:     c,
+				HCPNamespace: hcpNamespace,
+				CommonMetadata: clusterlogforwarder.CommonMetadata{
+					Labels:      map[string]string{"team": "logging"},
+					Annotations: map[string]string{"cost-center": "1234"},
+				},
+			}
+
+			if err := r.updateOrCreateCloudWatchSecret(context.TODO(), "token"); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			secret := &corev1.Secret{}
+			key := types.NamespacedName{Name: constants.CollectorCloudWatchSecretName, Namespace: hcpNamespace}
+			if err := c.Get(context.TODO(), key, secret); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if secret.Labels["team"] != "logging" {
+				t.Errorf("mismatched label, expected %v, got %v", "logging", secret.Labels["team"])
+			}
+			if secret.Labels[constants.ManagedByLabel] != constants.ManagedByLabelValue {
+				t.Errorf("mismatched label, expected %v, got %v", constants.ManagedByLabelValue, secret.Labels[constants.ManagedByLabel])
+			}
+			if secret.Annotations["cost-center"] != "1234" {
+				t.Errorf("mismatched annotation, expected %v, got %v", "1234", secret.Annotations["cost-center"])
+			}
+		})
+	}
+}
+
+func TestReconcileEventRouterAccess(t *testing.T) {
+	const hcpNamespace = "clusters-test"
+
+	mc := newTestClient(t, &hyperv1beta1.HostedControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: hcpNamespace},
+	})
+	// The role granted more than the events out-of-band is restored
+	guest := newTestClient(t, &rbacv1.ClusterRole{
+		ObjectMeta: metav1.ObjectMeta{Name: constants.EventRouterServiceAccountName},
+		Rules:      []rbacv1.PolicyRule{{APIGroups: []string{"*"}, Resources: []string{"*"}, Verbs: []string{"*"}}},
+	})
+	clientset := fakeclientset.NewSimpleClientset()
+	var minted []string
+	clientset.PrependReactor("create", "serviceaccounts", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "token" {
+			return false, nil, nil
+		}
+		minted = append(minted, action.GetNamespace())
+		return true, &authenticationv1.TokenRequest{Status: authenticationv1.TokenRequestStatus{Token: "token"}}, nil
+	})
+	r := &EventRouterAccessReconciler{
+		Client:       guest,
+		Reader:       guest,
+		ClientSet:    clientset,
+		MCClient:     mc,
+		HCPNamespace: hcpNamespace,
+		Server:       "https://kube-apiserver.clusters-test.svc:6443",
+		CAData:       []byte("ca"),
+	}
+
+	result, err := r.Reconcile(context.TODO(), ctrl.Request{})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if result.RequeueAfter != constants.TokenRefreshDuration {
+		t.Errorf("mismatched requeue, expected %v, got %v", constants.TokenRefreshDuration, result.RequeueAfter)
+	}
+	if !reflect.DeepEqual(minted, []string{constants.MintServiceAccountNamespace}) {
+		t.Errorf("mismatched minted tokens, expected %v, got %v", []string{constants.MintServiceAccountNamespace}, minted)
+	}
+
+	sa := &corev1.ServiceAccount{}
+	key := types.NamespacedName{Name: constants.EventRouterServiceAccountName, Namespace: constants.MintServiceAccountNamespace}
+	if err := guest.Get(context.TODO(), key, sa); err != nil {
+		t.Fatalf("expected the event router service account, got %v", err)
+	}
+	role := &rbacv1.ClusterRole{}
+	if err := guest.Get(context.TODO(), types.NamespacedName{Name: constants.EventRouterServiceAccountName}, role); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	expectedRules := []rbacv1.PolicyRule{{
+		APIGroups: []string{"", "events.k8s.io"},
+		Resources: []string{"events"},
+		Verbs:     []string{"get", "list", "watch"},
+	}}
+	if !reflect.DeepEqual(role.Rules, expectedRules) {
+		t.Errorf("mismatched rules, expected %v, got %v", expectedRules, role.Rules)
+	}
+	binding := &rbacv1.ClusterRoleBinding{}
+	if err := guest.Get(context.TODO(), types.NamespacedName{Name: constants.EventRouterServiceAccountName}, binding); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(binding.Subjects) != 1 || binding.Subjects[0].Name != sa.Name || binding.Subjects[0].Namespace != sa.Namespace ||
+		binding.RoleRef.Name != role.Name {
+		t.Errorf("expected the role to be bound to the event router service account, got %v", binding)
+	}
+
+	secret := &corev1.Secret{}
+	if err := mc.Get(context.TODO(), types.NamespacedName{Name: constants.EventRouterKubeConfigSecretName, Namespace: hcpNamespace}, secret); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if string(secret.Data["token"]) != "token" {
+		t.Errorf("mismatched token, expected token, got %s", secret.Data["token"])
+	}
+	kubeConfig, err := clientcmd.Load(secret.Data["kubeconfig"])
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	authInfo := kubeConfig.AuthInfos[kubeConfig.Contexts[kubeConfig.CurrentContext].AuthInfo]
+	if authInfo.TokenFile != constants.EventRouterKubeConfigPath+"/token" || authInfo.Token != "" {
+		t.Errorf("expected the kubeconfig to read the mounted token, got %v", authInfo)
+	}
+	cluster := kubeConfig.Clusters[kubeConfig.Contexts[kubeConfig.CurrentContext].Cluster]
+	if cluster.Server != r.Server || string(cluster.CertificateAuthorityData) != "ca" {
+		t.Errorf("mismatched cluster, expected %s, got %v", r.Server, cluster)
+	}
+	if len(secret.OwnerReferences) != 1 || secret.OwnerReferences[0].Name != "test" {
+		t.Errorf("mismatched owner, expected test, got %v", secret.OwnerReferences)
+	}
+
+	// The token is refreshed on the next reconcile
+	clientset.PrependReactor("create", "serviceaccounts", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "token" {
+			return false, nil, nil
+		}
+		return true, &authenticationv1.TokenRequest{Status: authenticationv1.TokenRequestStatus{Token: "refreshed"}}, nil
+	})
+	if _, err := r.Reconcile(context.TODO(), ctrl.Request{}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := mc.Get(context.TODO(), client.ObjectKeyFromObject(secret), secret); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if string(secret.Data["token"]) != "refreshed" {
+		t.Errorf("mismatched token, expected refreshed, got %s", secret.Data["token"])
+	}
+}
+
+func newTestClient(t *testing.T, objs ...client.Object) client.Client {
+	s := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{
+		corev1.AddToScheme,
+		rbacv1.AddToScheme,
+		hyperv1beta1.AddToScheme,
+	} {
+		if err := add(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return fake.NewClientBuilder().WithScheme(s).WithObjects(objs...).Build()
+}
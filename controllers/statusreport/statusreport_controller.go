@@ -0,0 +1,117 @@
+/*
+Copyright 2023.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package statusreport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	loggingv1 "github.com/openshift/cluster-logging-operator/apis/logging/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"github.com/openshift/hypershift-logging-operator/pkg/clusterlogforwarder"
+	"github.com/openshift/hypershift-logging-operator/pkg/constants"
+)
+
+// statusReportKey is the single request of the controller, every change rebuilds the whole report
+var statusReportKey = types.NamespacedName{Name: clusterlogforwarder.StatusReportName, Namespace: constants.OperatorNamespace}
+
+// StatusReportReconciler maintains the status report of the ClusterLogForwarders generated for the hosted clusters
+type StatusReportReconciler struct {
+	client.Client
+	// CommonMetadata is stamped on the status report
+	CommonMetadata clusterlogforwarder.CommonMetadata
+	log            logr.Logger
+}
+
+//+kubebuilder:rbac:groups=logging.openshift.io,resources=clusterlogforwarders,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update
+
+// Reconcile rebuilds the status report from the ClusterLogForwarders managed by the operator in every namespace
+func (r *StatusReportReconciler) Reconcile(ctx context.Context, _ ctrl.Request) (ctrl.Result, error) {
+	r.log = ctrllog.FromContext(ctx).WithName("statusreport-controller")
+
+	clfList := &loggingv1.ClusterLogForwarderList{}
+	if err := r.List(ctx, clfList, client.MatchingLabels{constants.ManagedByLabel: constants.ManagedByLabelValue}); err != nil {
+		return ctrl.Result{}, err
+	}
+	data, err := json.MarshalIndent(clusterlogforwarder.BuildStatusReport(clfList.Items), "", "  ")
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	cm := &corev1.ConfigMap{}
+	err = r.Get(ctx, statusReportKey, cm)
+	if errors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      statusReportKey.Name,
+				Namespace: statusReportKey.Namespace,
+				Labels:    map[string]string{constants.ManagedByLabel: constants.ManagedByLabelValue},
+			},
+			Data: map[string]string{clusterlogforwarder.StatusReportKey: string(data)},
+		}
+		r.CommonMetadata.Apply(cm)
+		if err := r.Create(ctx, cm); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to create the status report: %w", err)
+		}
+		return ctrl.Result{}, nil
+	} else if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if cm.Data[clusterlogforwarder.StatusReportKey] == string(data) {
+		return ctrl.Result{}, nil
+	}
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[clusterlogforwarder.StatusReportKey] = string(data)
+	if err := r.Update(ctx, cm); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to update the status report: %w", err)
+	}
+	r.log.V(1).Info("status report updated", "Forwarders", len(clfList.Items))
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager, the report is rebuilt on every change of
+// a managed ClusterLogForwarder and whenever the report itself is modified or deleted
+func (r *StatusReportReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	toReport := handler.EnqueueRequestsFromMapFunc(func(client.Object) []reconcile.Request {
+		return []reconcile.Request{{NamespacedName: statusReportKey}}
+	})
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("statusreport").
+		For(&corev1.ConfigMap{}, builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			return obj.GetName() == statusReportKey.Name && obj.GetNamespace() == statusReportKey.Namespace
+		}))).
+		Watches(&source.Kind{Type: &loggingv1.ClusterLogForwarder{}}, toReport,
+			builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+				return obj.GetLabels()[constants.ManagedByLabel] == constants.ManagedByLabelValue
+			}))).
+		Complete(r)
+}
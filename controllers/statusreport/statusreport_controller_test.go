@@ -0,0 +1,109 @@
+package statusreport
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	loggingv1 "github.com/openshift/cluster-logging-operator/apis/logging/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/openshift/hypershift-logging-operator/pkg/clusterlogforwarder"
+	"github.com/openshift/hypershift-logging-operator/pkg/constants"
+)
+
+func TestReconcileStatusReport(t *testing.T) {
+	managed := func(name string, namespace string, annotations map[string]string, conditions loggingv1.Conditions) *loggingv1.ClusterLogForwarder {
+		return &loggingv1.ClusterLogForwarder{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   namespace,
+				Labels:      clusterlogforwarder.ManagedLabels(constants.TemplateLabel, name),
+				Annotations: annotations,
+			},
+			Status: loggingv1.ClusterLogForwarderStatus{Conditions: conditions},
+		}
+	}
+	ready := loggingv1.Conditions{{Type: "Ready", Status: corev1.ConditionTrue}}
+	templateCLF := managed("template", "clusters-b", map[string]string{
+		constants.SourceAnnotation:          "ClusterLogForwarderTemplate/openshift-logging/template",
+		constants.LastAppliedTimeAnnotation: "2023-05-01T10:00:00Z",
+	}, ready)
+	c := newTestClient(t,
+		templateCLF,
+		managed("instance", "clusters-a", map[string]string{constants.UnmanagedAnnotation: "true"}, nil),
+		managed("another", "clusters-b", nil, nil),
+		// Not generated by the operator
+		&loggingv1.ClusterLogForwarder{ObjectMeta: metav1.ObjectMeta{Name: "instance", Namespace: "openshift-logging"}},
+	)
+	r := &StatusReportReconciler{Client: c}
+
+	if _, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: statusReportKey}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	expected := clusterlogforwarder.StatusReport{Clusters: []clusterlogforwarder.ClusterStatus{
+		{
+			Namespace:  "clusters-a",
+			Forwarders: []clusterlogforwarder.ForwarderStatus{{Name: "instance", Unmanaged: true}},
+		},
+		{
+			Namespace: "clusters-b",
+			Forwarders: []clusterlogforwarder.ForwarderStatus{
+				{Name: "another"},
+				{
+					Name:            "template",
+					Source:          "ClusterLogForwarderTemplate/openshift-logging/template",
+					LastAppliedTime: "2023-05-01T10:00:00Z",
+					Conditions:      ready,
+				},
+			},
+		},
+	}}
+	if report := readReport(t, c); !reflect.DeepEqual(report, expected) {
+		t.Errorf("mismatched report, expected %v, got %v", expected, report)
+	}
+
+	// The report follows the removal of the CLFs
+	if err := c.Delete(context.TODO(), templateCLF); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if _, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: statusReportKey}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	expected.Clusters[1].Forwarders = expected.Clusters[1].Forwarders[:1]
+	if report := readReport(t, c); !reflect.DeepEqual(report, expected) {
+		t.Errorf("mismatched report, expected %v, got %v", expected, report)
+	}
+}
+
+func readReport(t *testing.T, c client.Client) clusterlogforwarder.StatusReport {
+	cm := &corev1.ConfigMap{}
+	if err := c.Get(context.TODO(), statusReportKey, cm); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	report := clusterlogforwarder.StatusReport{}
+	if err := json.Unmarshal([]byte(cm.Data[clusterlogforwarder.StatusReportKey]), &report); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	return report
+}
+
+func newTestClient(t *testing.T, objs ...client.Object) client.Client {
+	s := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{
+		corev1.AddToScheme,
+		loggingv1.AddToScheme,
+	} {
+		if err := add(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return fake.NewClientBuilder().WithScheme(s).WithObjects(objs...).Build()
+}
@@ -18,7 +18,10 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -27,20 +30,31 @@ import (
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
+	"github.com/blang/semver/v4"
 	loggingv1 "github.com/openshift/cluster-logging-operator/apis/logging/v1"
 	hyperv1beta1 "github.com/openshift/hypershift/api/v1beta1"
 
 	"github.com/openshift/hypershift-logging-operator/api/v1alpha1"
 	"github.com/openshift/hypershift-logging-operator/controllers/clusterlogforwardertemplate"
 	"github.com/openshift/hypershift-logging-operator/controllers/hostedcluster"
+	"github.com/openshift/hypershift-logging-operator/controllers/statusreport"
+	"github.com/openshift/hypershift-logging-operator/pkg/clusterlogforwarder"
+	"github.com/openshift/hypershift-logging-operator/pkg/collector"
+	"github.com/openshift/hypershift-logging-operator/pkg/constants"
+	"github.com/openshift/hypershift-logging-operator/pkg/metrics"
+	"github.com/openshift/hypershift-logging-operator/pkg/selftest"
 )
 
 var (
 	scheme   = runtime.NewScheme()
 	setupLog = ctrl.Log.WithName("setup")
+	// version and commit identify the operator build, set at build time with -ldflags "-X main.version=..."
+	version = "dev"
+	commit  = "unknown"
 )
 
 func init() {
@@ -56,11 +70,116 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var watchNamespaces string
+	var secretNamespaces string
+	var hcpNamespaces string
+	var commonLabels string
+	var commonAnnotations string
+	var failureThreshold int
+	var suspendInterval time.Duration
+	var userAgent string
+	var cacheSyncTimeout time.Duration
+	var finalizerGracePeriod time.Duration
+	var minClusterAge time.Duration
+	var requiredConditions string
+	var disabledLabel string
+	var limits clusterlogforwarder.Limits
+	var rejectOrphanedOutputs bool
+	var strict bool
+	var enableWebhooks bool
+	var eventRouterImage string
+	var templateValues string
+	var loggingVersion string
+	var clusterLabelLimit int
+	var paused bool
+	var requeueJitter float64
+	var propagationWorkers int
+	var maxManagedClusters int
+	var selfTestCAFile string
+	var readDeliveryErrors bool
+	var templateResyncInterval time.Duration
+	var forwarderResyncInterval time.Duration
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&watchNamespaces, "watch-namespaces", "",
+		"Comma separated list of namespaces to watch for HostedClusters. All namespaces are watched if empty.")
+	flag.StringVar(&secretNamespaces, "secret-namespaces", "",
+		"Comma separated list of namespaces the output secrets of the templates are copied from besides the operator namespace.")
+	flag.StringVar(&hcpNamespaces, "hcp-namespaces", "",
+		"Comma separated list of the HCP namespaces the operator is restricted to, running with namespace-scoped RBAC. "+
+			"The operator is cluster-scoped if empty, --watch-namespaces is required otherwise.")
+	flag.StringVar(&commonLabels, "common-labels", "",
+		"Comma separated list of key=value labels stamped on all the generated resources.")
+	flag.StringVar(&commonAnnotations, "common-annotations", "",
+		"Comma separated list of key=value annotations stamped on all the generated resources.")
+	flag.IntVar(&failureThreshold, "failure-threshold", 5,
+		"Number of consecutive failures after which a hosted cluster is suspended. Hosted clusters are never suspended if 0.")
+	flag.DurationVar(&suspendInterval, "suspend-interval", 30*time.Minute,
+		"How long a suspended hosted cluster waits before it is retried.")
+	flag.StringVar(&userAgent, "user-agent", "hypershift-logging-operator/"+version,
+		"The user agent set on all the API calls to the guest clusters.")
+	flag.DurationVar(&cacheSyncTimeout, "guest-cache-sync-timeout", 2*time.Minute,
+		"How long the guest controllers wait for their caches to sync before the guest manager is restarted.")
+	flag.DurationVar(&finalizerGracePeriod, "finalizer-grace-period", 10*time.Minute,
+		"How long the cleanup of a deleted HyperShiftLogForwarder is retried before its finalizer is removed anyway. Retried until it succeeds if 0.")
+	flag.DurationVar(&minClusterAge, "min-cluster-age", 0,
+		"How long a hosted cluster has to be ready before its logs are forwarded. Forwarded once ready if 0.")
+	flag.StringVar(&requiredConditions, "required-conditions", "",
+		"Comma separated list of the HostedCluster conditions to be true, besides Available, before its logs are forwarded, "+
+			"e.g. ClusterVersionSucceeding to skip the partially provisioned hosted clusters.")
+	flag.StringVar(&disabledLabel, "disabled-label", constants.DisabledLabel,
+		"The label set to \"true\" on a HostedCluster to exclude it from all logging: its forwarding is torn down and it is not onboarded. "+
+			"Not checked if empty.")
+	flag.IntVar(&propagationWorkers, "propagation-workers", 1,
+		"Number of hosted clusters the secrets and the ClusterLogForwarder of a template are propagated to concurrently.")
+	flag.IntVar(&limits.MaxOutputs, "max-clf-outputs", 50,
+		"Maximum number of outputs of a ClusterLogForwarder rendered from a template. Not enforced if 0.")
+	flag.IntVar(&limits.MaxPipelines, "max-clf-pipelines", 50,
+		"Maximum number of pipelines of a ClusterLogForwarder rendered from a template. Not enforced if 0.")
+	flag.IntVar(&limits.MaxSize, "max-clf-size", 1024*1024,
+		"Maximum size in bytes of a ClusterLogForwarder rendered from a template. Not enforced if 0.")
+	flag.BoolVar(&rejectOrphanedOutputs, "reject-orphaned-outputs", false,
+		"Reject the templates with outputs referenced by no pipeline instead of only reporting them on the template status.")
+	flag.BoolVar(&strict, "strict", false,
+		"Fail the apply of a template to a hosted cluster instead of applying it best-effort, e.g. with template tokens "+
+			"without value, options not supported by the cluster-logging version or output secrets missing in the operator "+
+			"namespace and not used by reference. Implies --reject-orphaned-outputs.")
+	flag.StringVar(&templateValues, "template-values", "",
+		"Comma separated list of key=value substituted into the ${key} tokens of the templates for all the hosted clusters.")
+	flag.StringVar(&eventRouterImage, "eventrouter-image", clusterlogforwardertemplate.DefaultEventRouterImage,
+		"The image of the event router forwarding the guest cluster Kubernetes events.")
+	flag.StringVar(&loggingVersion, "cluster-logging-version", "",
+		"The version of the cluster-logging operator collecting the hosted control plane logs, e.g. 5.6, "+
+			"unless the version is detected in the guest cluster. The template options it does not support are not "+
+			"rendered, the forwarders applied for another version are re-rendered. The latest version is assumed if empty.")
+	flag.IntVar(&clusterLabelLimit, "metrics-cluster-limit", metrics.DefaultClusterLabelLimit,
+		"Maximum number of hosted clusters labeled by name in the per-cluster metrics, the others are aggregated under the \"other\" label.")
+	flag.BoolVar(&paused, "paused", false,
+		"Pause the reconciliation of all the templates and HyperShiftLogForwarders, the generated resources are left untouched. "+
+			"The reconciliation is also paused while the "+constants.PauseConfigMapName+" ConfigMap of the operator namespace has paused set to \"true\".")
+	flag.Float64Var(&requeueJitter, "requeue-jitter", 0.1,
+		"Fraction of the interval, between 0 and 1, added at random to the periodic requeues of each hosted cluster "+
+			"so that the hosted clusters are not resynced at the same time. The requeues are not jittered if 0.")
+	flag.IntVar(&maxManagedClusters, "max-managed-clusters", 0,
+		"Maximum number of hosted clusters managed at the same time, the others are queued by the time they became ready "+
+			"until a hosted cluster is released. Not capped if 0.")
+	flag.DurationVar(&templateResyncInterval, "template-resync-interval", 10*time.Minute,
+		"How often the templates are reconciled again, so that the propagated secrets deleted out-of-band are recreated. "+
+			"Not resynced if 0.")
+	flag.DurationVar(&forwarderResyncInterval, "forwarder-resync-interval", 10*time.Minute,
+		"How often the applied HyperShiftLogForwarders are reconciled again, so that their ClusterLogForwarders changed "+
+			"out-of-band are restored. Jittered by --requeue-jitter, not resynced if 0.")
+	flag.StringVar(&selfTestCAFile, "self-test-ca-file", "/var/run/secrets/kubernetes.io/serviceaccount/service-ca.crt",
+		"CA bundle trusted by the self-tests of the log delivery, along with the system roots, to inject the marker logs "+
+			"into the collectors. The service CA of the cluster by default, skipped if the file does not exist.")
+	flag.BoolVar(&readDeliveryErrors, "read-delivery-errors", false,
+		"Read the delivery errors of the outputs, e.g. the records rejected by the backends, from the metrics of the collectors "+
+			"of the hosted clusters and report them on the template status. The collectors are trusted with --self-test-ca-file.")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", false,
+		"Enable the validating webhook blocking the deletion of the templates still applied to hosted clusters.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -68,8 +187,67 @@ func main() {
 	flag.Parse()
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+	metrics.SetBuildInfo(version, commit)
+	metrics.SetClusterLabelLimit(clusterLabelLimit)
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	commonMetadata, err := parseCommonMetadata(commonLabels, commonAnnotations)
+	if err != nil {
+		setupLog.Error(err, "invalid common metadata")
+		os.Exit(1)
+	}
+	values, err := parseKeyValues(templateValues)
+	if err != nil {
+		setupLog.Error(err, "invalid template values")
+		os.Exit(1)
+	}
+	if hcpNamespaces != "" && watchNamespaces == "" {
+		setupLog.Error(fmt.Errorf("--watch-namespaces is required along with --hcp-namespaces"), "invalid namespace scope")
+		os.Exit(1)
+	}
+	if requeueJitter < 0 || requeueJitter > 1 {
+		setupLog.Error(fmt.Errorf("%v is out of the range 0-1", requeueJitter), "invalid requeue jitter")
+		os.Exit(1)
+	}
+	if maxManagedClusters < 0 {
+		setupLog.Error(fmt.Errorf("%d is negative", maxManagedClusters), "invalid max managed clusters")
+		os.Exit(1)
+	}
+	if templateResyncInterval < 0 {
+		setupLog.Error(fmt.Errorf("%s is negative", templateResyncInterval), "invalid template resync interval")
+		os.Exit(1)
+	}
+	if forwarderResyncInterval < 0 {
+		setupLog.Error(fmt.Errorf("%s is negative", forwarderResyncInterval), "invalid forwarder resync interval")
+		os.Exit(1)
+	}
+	if propagationWorkers < 1 {
+		setupLog.Error(fmt.Errorf("%d is lower than 1", propagationWorkers), "invalid propagation workers")
+		os.Exit(1)
+	}
+	if loggingVersion != "" {
+		if _, err := semver.ParseTolerant(loggingVersion); err != nil {
+			setupLog.Error(err, "invalid cluster-logging version")
+			os.Exit(1)
+		}
+	}
+
+	selfTestCABundle, err := os.ReadFile(selfTestCAFile)
+	if err != nil && !os.IsNotExist(err) {
+		setupLog.Error(err, "unable to read the self-test CA bundle")
+		os.Exit(1)
+	}
+	selfTester, err := selftest.NewHTTPTester(selfTestCABundle)
+	if err != nil {
+		setupLog.Error(err, "invalid self-test CA bundle")
+		os.Exit(1)
+	}
+
+	var deliveryErrors collector.ErrorReader
+	if readDeliveryErrors {
+		deliveryErrors = &collector.MetricsReader{RootCAs: selfTester.RootCAs}
+	}
+
+	options := ctrl.Options{
 		Scheme:                 scheme,
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
@@ -85,7 +263,14 @@ func main() {
 		// if you are doing or is intended to do any operation such as perform cleanups
 		// after the manager stops then its usage might be unsafe.
 		// LeaderElectionReleaseOnCancel: true,
-	})
+	}
+	// The namespace-scoped operator only caches the namespaces it is granted, the lists across all the namespaces,
+	// e.g. of the HostedControlPlanes, are merged from the lists of each namespace
+	if scope := splitList(hcpNamespaces); len(scope) > 0 {
+		options.NewCache = cache.MultiNamespacedCacheBuilder(scopedNamespaces(
+			[]string{constants.OperatorNamespace}, splitList(watchNamespaces), splitList(secretNamespaces), scope))
+	}
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), options)
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
@@ -93,25 +278,94 @@ func main() {
 
 	setupLog.Info("Registering Components.")
 
+	// The HostedClusters are watched from a single cache shared by the controllers
+	hostedClusterCache, err := hostedcluster.NewHostedClusterCache(mgr, splitList(watchNamespaces))
+	if err != nil {
+		setupLog.Error(err, "unable to create the HostedCluster cache")
+		os.Exit(1)
+	}
+
 	//Adding ClusterLogForwarderTemplate controller
 	if err = (&clusterlogforwardertemplate.ClusterLogForwarderTemplateReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:                mgr.GetClient(),
+		Scheme:                mgr.GetScheme(),
+		CommonMetadata:        commonMetadata,
+		Limits:                limits,
+		RejectOrphanedOutputs: rejectOrphanedOutputs,
+		Strict:                strict,
+		Values:                values,
+		EventRouterImage:      eventRouterImage,
+		LoggingVersion:        loggingVersion,
+		Paused:                paused,
+		PropagationWorkers:    propagationWorkers,
+		SelfTester:            selfTester,
+		DeliveryErrors:        deliveryErrors,
+		ResyncInterval:        templateResyncInterval,
+		DisabledLabel:         disabledLabel,
+		SecretNamespaces:      splitList(secretNamespaces),
+		HostedClusterCache:    hostedClusterCache,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ClusterLogForwarderTemplate")
 		os.Exit(1)
 	}
+	if enableWebhooks {
+		if err = (&clusterlogforwardertemplate.TemplateValidator{
+			Client: mgr.GetClient(),
+		}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ClusterLogForwarderTemplate")
+			os.Exit(1)
+		}
+	}
 
 	//Adding HostedCluster controller
 	if err = (&hostedcluster.HostedClusterReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-		Mgr:    mgr,
+		Client:                  mgr.GetClient(),
+		Scheme:                  mgr.GetScheme(),
+		Mgr:                     mgr,
+		WatchNamespaces:         splitList(watchNamespaces),
+		HostedClusterCache:      hostedClusterCache,
+		HCPNamespaces:           splitList(hcpNamespaces),
+		FailureThreshold:        failureThreshold,
+		SuspendInterval:         suspendInterval,
+		CommonMetadata:          commonMetadata,
+		UserAgent:               userAgent,
+		CacheSyncTimeout:        cacheSyncTimeout,
+		FinalizerGracePeriod:    finalizerGracePeriod,
+		MinClusterAge:           minClusterAge,
+		RequiredConditions:      splitList(requiredConditions),
+		DisabledLabel:           disabledLabel,
+		Paused:                  paused,
+		RequeueJitter:           requeueJitter,
+		ForwarderResyncInterval: forwarderResyncInterval,
+		LoggingVersion:          loggingVersion,
+		MaxManagedClusters:      maxManagedClusters,
+		Recorder:                mgr.GetEventRecorderFor("hostedcluster-controller"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "HostedCluster")
 		os.Exit(1)
 	}
 
+	if err = (&statusreport.StatusReportReconciler{
+		Client:         mgr.GetClient(),
+		CommonMetadata: commonMetadata,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "StatusReport")
+		os.Exit(1)
+	}
+
+	if err := mgr.Add(&metrics.WorkqueueDepthRecorder{Interval: metrics.DefaultWorkqueueDepthInterval}); err != nil {
+		setupLog.Error(err, "unable to set up the workqueue depth metric")
+		os.Exit(1)
+	}
+
+	// The effective config is read from the API server, the managed ClusterLogForwarders are not cached. The
+	// metrics port is not authenticated, the handler reviews the token and the access of every request
+	if err := mgr.AddMetricsExtraHandler(clusterlogforwarder.EffectiveConfigPath,
+		clusterlogforwarder.EffectiveConfigHandler(mgr.GetAPIReader(), mgr.GetClient())); err != nil {
+		setupLog.Error(err, "unable to set up the effective config endpoint")
+		os.Exit(1)
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -128,3 +382,55 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// splitList splits a comma separated flag value, ignoring empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// scopedNamespaces returns the namespaces of the namespace-scoped operator without duplicates, in order
+func scopedNamespaces(lists ...[]string) []string {
+	seen := map[string]bool{}
+	var namespaces []string
+	for _, list := range lists {
+		for _, namespace := range list {
+			if !seen[namespace] {
+				seen[namespace] = true
+				namespaces = append(namespaces, namespace)
+			}
+		}
+	}
+	return namespaces
+}
+
+// parseCommonMetadata parses the common labels and annotations flags
+func parseCommonMetadata(labels string, annotations string) (clusterlogforwarder.CommonMetadata, error) {
+	var err error
+	metadata := clusterlogforwarder.CommonMetadata{}
+	if metadata.Labels, err = parseKeyValues(labels); err != nil {
+		return metadata, err
+	}
+	if metadata.Annotations, err = parseKeyValues(annotations); err != nil {
+		return metadata, err
+	}
+	return metadata, metadata.Validate()
+}
+
+// parseKeyValues parses a comma separated list of key=value pairs
+func parseKeyValues(value string) (map[string]string, error) {
+	pairs := map[string]string{}
+	for _, item := range splitList(value) {
+		k, v, ok := strings.Cut(item, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			return nil, fmt.Errorf("invalid key=value pair %q", item)
+		}
+		pairs[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return pairs, nil
+}
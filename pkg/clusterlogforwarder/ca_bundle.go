@@ -0,0 +1,56 @@
+package clusterlogforwarder
+
+import (
+	"fmt"
+
+	loggingv1 "github.com/openshift/cluster-logging-operator/apis/logging/v1"
+
+	"github.com/openshift/hypershift-logging-operator/api/v1alpha1"
+)
+
+const (
+	// CABundleKey is the key of an output secret holding the CA bundle trusted by the collector
+	CABundleKey = "ca-bundle.crt"
+	// caBundleSuffix is the suffix of the secret propagating the CA bundle of a template into the HCP namespace
+	caBundleSuffix = "-ca-bundle"
+)
+
+// CABundleSecretName returns the name of the secret holding the CA bundle of the template in the HCP namespace
+func CABundleSecretName(template *v1alpha1.ClusterLogForwarderTemplate) string {
+	return template.Name + caBundleSuffix
+}
+
+// IsTLSOutput returns true if the output connects to its URL with TLS, the outputs without URL,
+// e.g. cloudwatch, are left to the default trust of the collector
+func IsTLSOutput(output loggingv1.OutputSpec) bool {
+	return output.URL != "" && !IsInsecureURL(output.URL)
+}
+
+// BuildCABundleFromTemplate references the CA bundle secret of the template from the TLS outputs without secret,
+// the secrets of the other TLS outputs are completed with the CA bundle when they are propagated
+func BuildCABundleFromTemplate(template *v1alpha1.ClusterLogForwarderTemplate,
+	clf *loggingv1.ClusterLogForwarder) *loggingv1.ClusterLogForwarder {
+
+	if template.Spec.CABundle == nil {
+		return clf
+	}
+	for i := range clf.Spec.Outputs {
+		output := &clf.Spec.Outputs[i]
+		if IsTLSOutput(*output) && output.Secret == nil {
+			output.Secret = &loggingv1.OutputSecretSpec{Name: CABundleSecretName(template)}
+		}
+	}
+	return clf
+}
+
+// ValidateCABundle validates the CA bundle of the template references either a secret or a ConfigMap
+func ValidateCABundle(template *v1alpha1.ClusterLogForwarderTemplate) error {
+	ref := template.Spec.CABundle
+	if ref == nil {
+		return nil
+	}
+	if (ref.SecretName == "") == (ref.ConfigMapName == "") {
+		return fmt.Errorf("CA bundle must reference either a secret or a ConfigMap")
+	}
+	return nil
+}
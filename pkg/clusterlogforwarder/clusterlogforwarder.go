@@ -1,7 +1,12 @@
 package clusterlogforwarder
 
 import (
+	"fmt"
+	"regexp"
+
+	"github.com/blang/semver/v4"
 	loggingv1 "github.com/openshift/cluster-logging-operator/apis/logging/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/openshift/hypershift-logging-operator/api/v1alpha1"
 )
@@ -32,7 +37,8 @@ type ClusterLogForwarderBuilder struct {
 func BuildInputsFromTemplate(template *v1alpha1.ClusterLogForwarderTemplate,
 	clf *loggingv1.ClusterLogForwarder) *loggingv1.ClusterLogForwarder {
 
-	if len(clf.Spec.Inputs) < 1 {
+	// The audit logs of the hosted control plane are collected only once enabled
+	if template.Spec.IsHCPAuditEnabled() && len(clf.Spec.Inputs) < 1 {
 		clf.Spec.Inputs = append(clf.Spec.Inputs, InputHTTPServerSpec)
 	}
 
@@ -42,28 +48,174 @@ func BuildInputsFromTemplate(template *v1alpha1.ClusterLogForwarderTemplate,
 	//	}
 	//}
 
+	for _, source := range template.Spec.CollectionSources {
+		clf.Spec.Inputs = append(clf.Spec.Inputs, buildCollectionSourceInput(source))
+	}
+	for _, limit := range template.Spec.NamespaceRateLimits {
+		clf.Spec.Inputs = append(clf.Spec.Inputs, buildNamespaceRateLimitInput(limit))
+	}
+	for _, selector := range template.Spec.PodSelectors {
+		clf.Spec.Inputs = append(clf.Spec.Inputs, buildPodSelectorInput(selector))
+	}
+
 	return clf
 }
 
+// buildCollectionSourceInput maps the extra collection source of the template to a collector input
+func buildCollectionSourceInput(source v1alpha1.CollectionSource) loggingv1.InputSpec {
+	input := loggingv1.InputSpec{Name: source.Name}
+	sources := append([]string{}, source.Sources...)
+	switch source.Type {
+	case loggingv1.InputNameInfrastructure:
+		input.Infrastructure = &loggingv1.Infrastructure{Sources: sources}
+	case loggingv1.InputNameAudit:
+		input.Audit = &loggingv1.Audit{Sources: sources}
+	}
+	return input
+}
+
+// buildNamespaceRateLimitInput maps the namespace rate limit of the template to an application input of the
+// namespace, the limit of the group caps the records of all its containers together
+func buildNamespaceRateLimitInput(limit v1alpha1.NamespaceRateLimit) loggingv1.InputSpec {
+	return loggingv1.InputSpec{
+		Name: limit.Name,
+		Application: &loggingv1.Application{
+			Namespaces: []string{limit.Namespace},
+			GroupLimit: &loggingv1.LimitSpec{MaxRecordsPerSecond: limit.MaxRecordsPerSecond},
+		},
+	}
+}
+
+// buildPodSelectorInput maps the pod selector of the template to an application input of the pods matching
+// its labels in its namespaces
+func buildPodSelectorInput(selector v1alpha1.PodSelector) loggingv1.InputSpec {
+	matchLabels := make(map[string]string, len(selector.MatchLabels))
+	for k, v := range selector.MatchLabels {
+		matchLabels[k] = v
+	}
+	return loggingv1.InputSpec{
+		Name: selector.Name,
+		Application: &loggingv1.Application{
+			Namespaces: append([]string{}, selector.Namespaces...),
+			Selector:   &metav1.LabelSelector{MatchLabels: matchLabels},
+		},
+	}
+}
+
 // BuildOutputsFromTemplate builds the output array from the template
 func BuildOutputsFromTemplate(template *v1alpha1.ClusterLogForwarderTemplate,
 	clf *loggingv1.ClusterLogForwarder) *loggingv1.ClusterLogForwarder {
 
 	if len(template.Spec.Template.Outputs) > 0 {
 		for _, output := range template.Spec.Template.Outputs {
-			clf.Spec.Outputs = append(clf.Spec.Outputs, output)
+			clf.Spec.Outputs = append(clf.Spec.Outputs, buildTemplateOutput(template, output))
 		}
 	}
 
 	return clf
 }
 
+// BuildPlatformOutputsFromTemplate builds the outputs selected by the platform of the hosted cluster
+func BuildPlatformOutputsFromTemplate(template *v1alpha1.ClusterLogForwarderTemplate,
+	clf *loggingv1.ClusterLogForwarder, platform string) (*loggingv1.ClusterLogForwarder, error) {
+
+	if len(template.Spec.PlatformOutputs) < 1 {
+		return clf, nil
+	}
+
+	outputs, ok := template.Spec.GetPlatformOutputs(platform)
+	if !ok {
+		return clf, fmt.Errorf("no outputs defined for the platform %s and no %s platform outputs", platform, v1alpha1.DefaultPlatform)
+	}
+	for _, output := range outputs {
+		clf.Spec.Outputs = append(clf.Spec.Outputs, buildTemplateOutput(template, output))
+	}
+
+	return clf, nil
+}
+
+// buildTemplateOutput merges the template defaults and options into the output
+func buildTemplateOutput(template *v1alpha1.ClusterLogForwarderTemplate, output loggingv1.OutputSpec) loggingv1.OutputSpec {
+	merged := MergeOutputDefaults(output, template.Spec.OutputDefaults)
+	return ApplyOutputOptions(merged, template.Spec.GetOutputOptions(output.Name))
+}
+
+// ApplyOutputOptions returns a copy of the output with the operator output options rendered into it
+func ApplyOutputOptions(output loggingv1.OutputSpec, options *v1alpha1.OutputOptions) loggingv1.OutputSpec {
+	if options == nil {
+		return output
+	}
+
+	if options.Compression != "" || options.MinRetryDuration != nil || options.MaxRetryDuration != nil || options.MaxWrite != nil {
+		tuning := &loggingv1.OutputTuningSpec{}
+		if output.Tuning != nil {
+			tuning = output.Tuning.DeepCopy()
+		}
+		if options.Compression != "" {
+			tuning.Compression = options.Compression
+		}
+		if options.MinRetryDuration != nil {
+			d := options.MinRetryDuration.Duration
+			tuning.MinRetryDuration = &d
+		}
+		if options.MaxRetryDuration != nil {
+			d := options.MaxRetryDuration.Duration
+			tuning.MaxRetryDuration = &d
+		}
+		if options.MaxWrite != nil {
+			q := options.MaxWrite.DeepCopy()
+			tuning.MaxWrite = &q
+		}
+		output.Tuning = tuning
+	}
+
+	// The timeout of the http outputs is in seconds
+	if options.Timeout != nil && output.Type == loggingv1.OutputTypeHttp {
+		http := &loggingv1.Http{}
+		if output.Http != nil {
+			*http = *output.Http
+		}
+		http.Timeout = int(options.Timeout.Seconds())
+		output.Http = http
+	}
+
+	return output
+}
+
+// MergeOutputDefaults returns a copy of the output with the unset settings taken from the defaults
+func MergeOutputDefaults(output loggingv1.OutputSpec, defaults *v1alpha1.OutputDefaults) loggingv1.OutputSpec {
+	merged := *output.DeepCopy()
+	if defaults == nil {
+		return merged
+	}
+
+	if merged.TLS == nil && defaults.TLS != nil && !IsInsecureURL(merged.URL) {
+		merged.TLS = defaults.TLS.DeepCopy()
+	}
+	if merged.Secret == nil && defaults.Secret != nil {
+		merged.Secret = defaults.Secret.DeepCopy()
+	}
+	if merged.Limit == nil && defaults.Limit != nil {
+		merged.Limit = defaults.Limit.DeepCopy()
+	}
+
+	return merged
+}
+
 // BuildPipelinesFromTemplate builds the pipeline array from the template
 func BuildPipelinesFromTemplate(template *v1alpha1.ClusterLogForwarderTemplate,
 	clf *loggingv1.ClusterLogForwarder) *loggingv1.ClusterLogForwarder {
 
 	if len(template.Spec.Template.Pipelines) > 0 {
 		for _, ppl := range template.Spec.Template.Pipelines {
+			// Disabled pipelines are kept in the template but not rendered
+			opts := template.Spec.GetPipelineOptions(ppl.Name)
+			if !opts.IsEnabled() {
+				continue
+			}
+			if opts != nil && len(opts.Labels) > 0 {
+				ppl.Labels = mergeLabels(ppl.Labels, opts.Labels)
+			}
 			clf.Spec.Pipelines = append(clf.Spec.Pipelines, ppl)
 		}
 	}
@@ -71,6 +223,127 @@ func BuildPipelinesFromTemplate(template *v1alpha1.ClusterLogForwarderTemplate,
 	return clf
 }
 
+// BuildFallbackOutputsFromTemplate adds the fallback of each output to the pipelines forwarding to the output,
+// the pipelines fan out to both outputs. The fallbacks not rendered, e.g. the outputs of another platform, are skipped
+func BuildFallbackOutputsFromTemplate(template *v1alpha1.ClusterLogForwarderTemplate,
+	clf *loggingv1.ClusterLogForwarder) *loggingv1.ClusterLogForwarder {
+
+	rendered := map[string]bool{}
+	for _, output := range clf.Spec.Outputs {
+		rendered[output.Name] = true
+	}
+
+	for i := range clf.Spec.Pipelines {
+		ppl := &clf.Spec.Pipelines[i]
+		refs := append([]string{}, ppl.OutputRefs...)
+		for _, ref := range ppl.OutputRefs {
+			opts := template.Spec.GetOutputOptions(ref)
+			if opts == nil || opts.Fallback == "" || !rendered[opts.Fallback] || contains(refs, opts.Fallback) {
+				continue
+			}
+			refs = append(refs, opts.Fallback)
+		}
+		ppl.OutputRefs = refs
+	}
+
+	return clf
+}
+
+// mergeLabels returns a copy of the labels overridden by the given ones
+func mergeLabels(labels map[string]string, overrides map[string]string) map[string]string {
+	merged := make(map[string]string, len(labels)+len(overrides))
+	for k, v := range labels {
+		merged[k] = v
+	}
+	for k, v := range overrides {
+		merged[k] = v
+	}
+	return merged
+}
+
+// MinMultilineVersion is the first cluster-logging version supporting detectMultilineErrors on the pipelines
+var MinMultilineVersion = semver.MustParse("5.7.0")
+
+// SupportsMultiline returns true if the cluster-logging version supports the multiline error detection.
+// An empty version is assumed to be recent enough, an invalid one is not supported
+func SupportsMultiline(loggingVersion string) bool {
+	return supportsVersion(loggingVersion, MinMultilineVersion)
+}
+
+func supportsVersion(loggingVersion string, minVersion semver.Version) bool {
+	if loggingVersion == "" {
+		return true
+	}
+	version, err := semver.ParseTolerant(loggingVersion)
+	if err != nil {
+		return false
+	}
+	// The pre-releases of the minimum version, e.g. 5.7.0-rc.1, have the option too
+	version.Pre = nil
+	return version.GTE(minVersion)
+}
+
+// BuildMultilineFromTemplate enables the multiline error detection on the application pipelines
+// selected by the multiline options of the template
+func BuildMultilineFromTemplate(template *v1alpha1.ClusterLogForwarderTemplate,
+	clf *loggingv1.ClusterLogForwarder) (*loggingv1.ClusterLogForwarder, error) {
+
+	multiline := template.Spec.Multiline
+	if multiline == nil || !multiline.Enabled {
+		return clf, nil
+	}
+
+	patterns := make([]*regexp.Regexp, 0, len(multiline.PipelinePatterns))
+	for _, pattern := range multiline.PipelinePatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return clf, fmt.Errorf("invalid multiline pipeline pattern %q: %w", pattern, err)
+		}
+		patterns = append(patterns, re)
+	}
+
+	for i := range clf.Spec.Pipelines {
+		ppl := &clf.Spec.Pipelines[i]
+		if isApplicationPipeline(*ppl, clf.Spec.Inputs) && matchesAny(ppl.Name, patterns) {
+			ppl.DetectMultilineErrors = true
+		}
+	}
+
+	return clf, nil
+}
+
+// isApplicationPipeline returns true if the pipeline forwards application logs
+func isApplicationPipeline(ppl loggingv1.PipelineSpec, inputs []loggingv1.InputSpec) bool {
+	for _, ref := range ppl.InputRefs {
+		if ref == loggingv1.InputNameApplication {
+			return true
+		}
+		for _, input := range inputs {
+			if input.Name == ref && input.Application != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchesAny returns true if the name matches one of the patterns, or if there is no pattern
+func matchesAny(name string, patterns []*regexp.Regexp) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, re := range patterns {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// GeneratedFilterPrefix prefixes the names of the filters added by the operator, the template filters
+// cannot use it so that the names never collide
+const GeneratedFilterPrefix = "hlo-"
+
 // BuildFiltersFromTemplate builds the filter array from the template
 func BuildFiltersFromTemplate(template *v1alpha1.ClusterLogForwarderTemplate,
 	clf *loggingv1.ClusterLogForwarder) *loggingv1.ClusterLogForwarder {
@@ -84,6 +357,37 @@ func BuildFiltersFromTemplate(template *v1alpha1.ClusterLogForwarderTemplate,
 	return clf
 }
 
+// BuildFilterOrderFromTemplate orders the filter refs of the pipelines by the filter order of their options,
+// it is applied once all the filters are added. The ordered filters come first, the others keep their order after them
+func BuildFilterOrderFromTemplate(template *v1alpha1.ClusterLogForwarderTemplate,
+	clf *loggingv1.ClusterLogForwarder) (*loggingv1.ClusterLogForwarder, error) {
+
+	for i := range clf.Spec.Pipelines {
+		ppl := &clf.Spec.Pipelines[i]
+		opts := template.Spec.GetPipelineOptions(ppl.Name)
+		if opts == nil || len(opts.FilterOrder) == 0 {
+			continue
+		}
+
+		// The filter refs may be shared with the template pipeline
+		refs := make([]string, 0, len(ppl.FilterRefs))
+		for _, name := range opts.FilterOrder {
+			if !contains(ppl.FilterRefs, name) {
+				return clf, fmt.Errorf("pipeline %s: the filter order refers to the filter %s not applied by the pipeline", ppl.Name, name)
+			}
+			refs = append(refs, name)
+		}
+		for _, ref := range ppl.FilterRefs {
+			if !contains(opts.FilterOrder, ref) {
+				refs = append(refs, ref)
+			}
+		}
+		ppl.FilterRefs = refs
+	}
+
+	return clf, nil
+}
+
 // BuildInputsFromHLF builds the CLF inputs from the HLF
 func (b *ClusterLogForwarderBuilder) BuildInputsFromHLF() *ClusterLogForwarderBuilder {
 
@@ -0,0 +1,3115 @@
+package clusterlogforwarder
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	loggingv1 "github.com/openshift/cluster-logging-operator/apis/logging/v1"
+	hyperv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/openshift/hypershift-logging-operator/api/v1alpha1"
+	"github.com/openshift/hypershift-logging-operator/pkg/constants"
+)
+
+func TestBuildOutputsFromTemplate(t *testing.T) {
+	defaults := &v1alpha1.OutputDefaults{
+		TLS:    &loggingv1.OutputTLSSpec{InsecureSkipVerify: true},
+		Secret: &loggingv1.OutputSecretSpec{Name: "shared-ca"},
+	}
+
+	tests := []struct {
+		name           string
+		outputs        []loggingv1.OutputSpec
+		defaults       *v1alpha1.OutputDefaults
+		expectedOutput []loggingv1.OutputSpec
+	}{
+		{
+			name:           "no defaults",
+			outputs:        []loggingv1.OutputSpec{{Name: "es", Type: "elasticsearch", URL: "https://es:9200"}},
+			expectedOutput: []loggingv1.OutputSpec{{Name: "es", Type: "elasticsearch", URL: "https://es:9200"}},
+		},
+		{
+			name:     "defaults apply to unset settings",
+			outputs:  []loggingv1.OutputSpec{{Name: "es", Type: "elasticsearch", URL: "https://es:9200"}},
+			defaults: defaults,
+			expectedOutput: []loggingv1.OutputSpec{{
+				Name:   "es",
+				Type:   "elasticsearch",
+				URL:    "https://es:9200",
+				TLS:    &loggingv1.OutputTLSSpec{InsecureSkipVerify: true},
+				Secret: &loggingv1.OutputSecretSpec{Name: "shared-ca"},
+			}},
+		},
+		{
+			name: "output settings override defaults",
+			outputs: []loggingv1.OutputSpec{{
+				Name:   "es",
+				Type:   "elasticsearch",
+				URL:    "https://es:9200",
+				Secret: &loggingv1.OutputSecretSpec{Name: "es-secret"},
+			}},
+			defaults: defaults,
+			expectedOutput: []loggingv1.OutputSpec{{
+				Name:   "es",
+				Type:   "elasticsearch",
+				URL:    "https://es:9200",
+				TLS:    &loggingv1.OutputTLSSpec{InsecureSkipVerify: true},
+				Secret: &loggingv1.OutputSecretSpec{Name: "es-secret"},
+			}},
+		},
+		{
+			name:     "default TLS is not applied to insecure URL",
+			outputs:  []loggingv1.OutputSpec{{Name: "fluentd", Type: "fluentdForward", URL: "tcp://fluentd:24224"}},
+			defaults: defaults,
+			expectedOutput: []loggingv1.OutputSpec{{
+				Name:   "fluentd",
+				Type:   "fluentdForward",
+				URL:    "tcp://fluentd:24224",
+				Secret: &loggingv1.OutputSecretSpec{Name: "shared-ca"},
+			}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			template := &v1alpha1.ClusterLogForwarderTemplate{
+				Spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+					Template:       loggingv1.ClusterLogForwarderSpec{Outputs: test.outputs},
+					OutputDefaults: test.defaults,
+				},
+			}
+
+			clf := BuildOutputsFromTemplate(template, &loggingv1.ClusterLogForwarder{})
+
+			if !reflect.DeepEqual(clf.Spec.Outputs, test.expectedOutput) {
+				t.Errorf("mismatched outputs, expected %v, got %v", test.expectedOutput, clf.Spec.Outputs)
+			}
+		})
+	}
+}
+
+func TestBuildOutputsFromTemplateCompression(t *testing.T) {
+	template := &v1alpha1.ClusterLogForwarderTemplate{
+		Spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+			Template: loggingv1.ClusterLogForwarderSpec{
+				Outputs: []loggingv1.OutputSpec{
+					{Name: "loki", Type: loggingv1.OutputTypeLoki, URL: "https://loki:3100"},
+					{Name: "kafka", Type: loggingv1.OutputTypeKafka, URL: "tls://kafka:9093",
+						Tuning: &loggingv1.OutputTuningSpec{Delivery: "AtLeastOnce"}},
+					{Name: "es", Type: loggingv1.OutputTypeElasticsearch, URL: "https://es:9200"},
+				},
+			},
+			OutputOptions: []v1alpha1.OutputOptions{
+				{Name: "loki", Compression: "snappy"},
+				{Name: "kafka", Compression: "zstd"},
+			},
+		},
+	}
+
+	clf := BuildOutputsFromTemplate(template, &loggingv1.ClusterLogForwarder{})
+
+	expected := map[string]*loggingv1.OutputTuningSpec{
+		"loki":  {Compression: "snappy"},
+		"kafka": {Delivery: "AtLeastOnce", Compression: "zstd"},
+		"es":    nil,
+	}
+	for _, output := range clf.Spec.Outputs {
+		if !reflect.DeepEqual(output.Tuning, expected[output.Name]) {
+			t.Errorf("mismatched tuning of %s, expected %v, got %v", output.Name, expected[output.Name], output.Tuning)
+		}
+	}
+	if template.Spec.Template.Outputs[1].Tuning.Compression != "" {
+		t.Error("expected the template output to be unchanged")
+	}
+}
+
+func TestBuildOutputsFromTemplateTimeouts(t *testing.T) {
+	template := &v1alpha1.ClusterLogForwarderTemplate{
+		Spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+			Template: loggingv1.ClusterLogForwarderSpec{
+				Outputs: []loggingv1.OutputSpec{
+					{Name: "http", Type: loggingv1.OutputTypeHttp, URL: "https://collector:8443",
+						OutputTypeSpec: loggingv1.OutputTypeSpec{Http: &loggingv1.Http{Method: "POST"}}},
+					{Name: "kafka", Type: loggingv1.OutputTypeKafka, URL: "tls://kafka:9093",
+						Tuning: &loggingv1.OutputTuningSpec{Delivery: "AtLeastOnce"}},
+				},
+			},
+			OutputOptions: []v1alpha1.OutputOptions{
+				{Name: "http", Timeout: &metav1.Duration{Duration: 30 * time.Second}},
+				{
+					Name:             "kafka",
+					MinRetryDuration: &metav1.Duration{Duration: 5 * time.Second},
+					MaxRetryDuration: &metav1.Duration{Duration: 5 * time.Minute},
+				},
+			},
+		},
+	}
+
+	clf := BuildOutputsFromTemplate(template, &loggingv1.ClusterLogForwarder{})
+
+	httpOutput, kafkaOutput := clf.Spec.Outputs[0], clf.Spec.Outputs[1]
+	expectedHttp := &loggingv1.Http{Method: "POST", Timeout: 30}
+	if !reflect.DeepEqual(httpOutput.Http, expectedHttp) {
+		t.Errorf("mismatched http settings, expected %v, got %v", expectedHttp, httpOutput.Http)
+	}
+	if httpOutput.Tuning != nil {
+		t.Errorf("mismatched http tuning, expected %v, got %v", nil, httpOutput.Tuning)
+	}
+
+	minRetry, maxRetry := 5*time.Second, 5*time.Minute
+	expectedTuning := &loggingv1.OutputTuningSpec{Delivery: "AtLeastOnce", MinRetryDuration: &minRetry, MaxRetryDuration: &maxRetry}
+	if !reflect.DeepEqual(kafkaOutput.Tuning, expectedTuning) {
+		t.Errorf("mismatched kafka tuning, expected %v, got %v", expectedTuning, kafkaOutput.Tuning)
+	}
+
+	if template.Spec.Template.Outputs[0].Http.Timeout != 0 || template.Spec.Template.Outputs[1].Tuning.MinRetryDuration != nil {
+		t.Error("expected the template outputs to be unchanged")
+	}
+}
+
+func TestBuildOutputsFromTemplateMaxWrite(t *testing.T) {
+	maxWrite := resource.MustParse("2Mi")
+	template := &v1alpha1.ClusterLogForwarderTemplate{
+		Spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+			Template: loggingv1.ClusterLogForwarderSpec{
+				Outputs: []loggingv1.OutputSpec{
+					{Name: "kafka", Type: loggingv1.OutputTypeKafka, URL: "tls://kafka:9093",
+						Tuning: &loggingv1.OutputTuningSpec{Delivery: "AtLeastOnce"}},
+					{Name: "loki", Type: loggingv1.OutputTypeLoki, URL: "https://loki:3100"},
+				},
+			},
+			OutputOptions: []v1alpha1.OutputOptions{{Name: "kafka", MaxWrite: &maxWrite}},
+		},
+	}
+
+	clf := BuildOutputsFromTemplate(template, &loggingv1.ClusterLogForwarder{})
+
+	kafkaOutput, lokiOutput := clf.Spec.Outputs[0], clf.Spec.Outputs[1]
+	expectedTuning := &loggingv1.OutputTuningSpec{Delivery: "AtLeastOnce", MaxWrite: &maxWrite}
+	if !reflect.DeepEqual(kafkaOutput.Tuning, expectedTuning) {
+		t.Errorf("mismatched kafka tuning, expected %v, got %v", expectedTuning, kafkaOutput.Tuning)
+	}
+	if kafkaOutput.Tuning.MaxWrite == &maxWrite {
+		t.Error("expected the max write to be copied from the output options")
+	}
+	if lokiOutput.Tuning != nil {
+		t.Errorf("mismatched loki tuning, expected %v, got %v", nil, lokiOutput.Tuning)
+	}
+	if template.Spec.Template.Outputs[0].Tuning.MaxWrite != nil {
+		t.Error("expected the template outputs to be unchanged")
+	}
+}
+
+func TestForEnvironment(t *testing.T) {
+	templateMaxWrite, prodMaxWrite := resource.MustParse("1Mi"), resource.MustParse("8Mi")
+	template := &v1alpha1.ClusterLogForwarderTemplate{
+		Spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+			Template: loggingv1.ClusterLogForwarderSpec{
+				Outputs: []loggingv1.OutputSpec{
+					{Name: "kafka", Type: loggingv1.OutputTypeKafka, URL: "tls://kafka:9093"},
+					{Name: "loki", Type: loggingv1.OutputTypeLoki, URL: "https://loki:3100"},
+				},
+			},
+			OutputDefaults: &v1alpha1.OutputDefaults{Limit: &loggingv1.LimitSpec{MaxRecordsPerSecond: 100}},
+			OutputOptions:  []v1alpha1.OutputOptions{{Name: "kafka", Compression: "gzip", MaxWrite: &templateMaxWrite}},
+			Environments: []v1alpha1.EnvironmentTuning{{
+				Environment:    "prod",
+				OutputDefaults: &v1alpha1.OutputDefaults{Limit: &loggingv1.LimitSpec{MaxRecordsPerSecond: 1000}},
+				OutputOptions: []v1alpha1.OutputOptions{
+					{Name: "kafka", MaxWrite: &prodMaxWrite},
+					{Name: "loki", Compression: "snappy"},
+				},
+			}},
+		},
+	}
+
+	tests := []struct {
+		name               string
+		environment        string
+		expectedLimit      int64
+		expectedMaxWrite   resource.Quantity
+		expectedLokiTuning *loggingv1.OutputTuningSpec
+	}{
+		{
+			name:               "tuned environment",
+			environment:        "prod",
+			expectedLimit:      1000,
+			expectedMaxWrite:   prodMaxWrite,
+			expectedLokiTuning: &loggingv1.OutputTuningSpec{Compression: "snappy"},
+		},
+		{
+			name:             "environment without tuning",
+			environment:      "dev",
+			expectedLimit:    100,
+			expectedMaxWrite: templateMaxWrite,
+		},
+		{
+			name:             "cluster without environment",
+			expectedLimit:    100,
+			expectedMaxWrite: templateMaxWrite,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tuned := ForEnvironment(template, test.environment)
+			clf := BuildOutputsFromTemplate(tuned, &loggingv1.ClusterLogForwarder{})
+
+			kafkaOutput, lokiOutput := clf.Spec.Outputs[0], clf.Spec.Outputs[1]
+			if kafkaOutput.Limit == nil || kafkaOutput.Limit.MaxRecordsPerSecond != test.expectedLimit {
+				t.Errorf("mismatched kafka limit, expected %v, got %v", test.expectedLimit, kafkaOutput.Limit)
+			}
+			// The options of the environment are merged into the ones of the template
+			expectedTuning := &loggingv1.OutputTuningSpec{Compression: "gzip", MaxWrite: &test.expectedMaxWrite}
+			if !reflect.DeepEqual(kafkaOutput.Tuning, expectedTuning) {
+				t.Errorf("mismatched kafka tuning, expected %v, got %v", expectedTuning, kafkaOutput.Tuning)
+			}
+			if !reflect.DeepEqual(lokiOutput.Tuning, test.expectedLokiTuning) {
+				t.Errorf("mismatched loki tuning, expected %v, got %v", test.expectedLokiTuning, lokiOutput.Tuning)
+			}
+		})
+	}
+
+	if template.Spec.OutputOptions[0].MaxWrite.Cmp(templateMaxWrite) != 0 || len(template.Spec.OutputOptions) != 1 {
+		t.Error("expected the template output options to be unchanged")
+	}
+}
+
+func TestBuildPlatformOutputsFromTemplate(t *testing.T) {
+	awsOutputs := v1alpha1.PlatformOutputs{
+		Platform: "AWS",
+		Outputs:  []loggingv1.OutputSpec{{Name: "cloud", Type: "cloudwatch"}},
+	}
+	azureOutputs := v1alpha1.PlatformOutputs{
+		Platform: "Azure",
+		Outputs:  []loggingv1.OutputSpec{{Name: "cloud", Type: "http", URL: "https://azure.example.com"}},
+	}
+	defaultOutputs := v1alpha1.PlatformOutputs{
+		Platform: v1alpha1.DefaultPlatform,
+		Outputs:  []loggingv1.OutputSpec{{Name: "cloud", Type: "loki", URL: "https://loki.example.com"}},
+	}
+
+	tests := []struct {
+		name            string
+		platformOutputs []v1alpha1.PlatformOutputs
+		platform        string
+		expectedType    string
+		expectErr       bool
+	}{
+		{
+			name:            "AWS cluster selects the AWS outputs",
+			platformOutputs: []v1alpha1.PlatformOutputs{awsOutputs, azureOutputs},
+			platform:        "AWS",
+			expectedType:    "cloudwatch",
+		},
+		{
+			name:            "Azure cluster selects the Azure outputs",
+			platformOutputs: []v1alpha1.PlatformOutputs{awsOutputs, azureOutputs},
+			platform:        "Azure",
+			expectedType:    "http",
+		},
+		{
+			name:            "unknown platform falls back to the default outputs",
+			platformOutputs: []v1alpha1.PlatformOutputs{awsOutputs, defaultOutputs},
+			platform:        "KubeVirt",
+			expectedType:    "loki",
+		},
+		{
+			name:            "unknown platform without default outputs",
+			platformOutputs: []v1alpha1.PlatformOutputs{awsOutputs, azureOutputs},
+			platform:        "KubeVirt",
+			expectErr:       true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			template := &v1alpha1.ClusterLogForwarderTemplate{
+				Spec: v1alpha1.ClusterLogForwarderTemplateSpec{PlatformOutputs: test.platformOutputs},
+			}
+
+			clf, err := BuildPlatformOutputsFromTemplate(template, &loggingv1.ClusterLogForwarder{}, test.platform)
+			if test.expectErr {
+				if err == nil {
+					t.Error("expected err, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no err, got %v", err)
+			}
+			if len(clf.Spec.Outputs) != 1 || clf.Spec.Outputs[0].Type != test.expectedType {
+				t.Errorf("mismatched outputs, expected one output of type %v, got %v", test.expectedType, clf.Spec.Outputs)
+			}
+		})
+	}
+}
+
+func TestBuildPipelinesFromTemplate(t *testing.T) {
+	disabled := false
+	enabled := true
+	pipelines := []loggingv1.PipelineSpec{
+		{Name: "audit", InputRefs: []string{"audit"}, OutputRefs: []string{"default"}},
+		{Name: "app", InputRefs: []string{"application"}, OutputRefs: []string{"default"}},
+	}
+
+	tests := []struct {
+		name              string
+		options           []v1alpha1.PipelineOptions
+		expectedPipelines []string
+	}{
+		{
+			name:              "pipelines are enabled by default",
+			expectedPipelines: []string{"audit", "app"},
+		},
+		{
+			name:              "explicitly enabled pipeline",
+			options:           []v1alpha1.PipelineOptions{{Name: "audit", Enabled: &enabled}},
+			expectedPipelines: []string{"audit", "app"},
+		},
+		{
+			name:              "disabled pipeline is omitted",
+			options:           []v1alpha1.PipelineOptions{{Name: "audit", Enabled: &disabled}},
+			expectedPipelines: []string{"app"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			template := &v1alpha1.ClusterLogForwarderTemplate{
+				Spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+					Template:        loggingv1.ClusterLogForwarderSpec{Pipelines: pipelines},
+					PipelineOptions: test.options,
+				},
+			}
+
+			clf := BuildPipelinesFromTemplate(template, &loggingv1.ClusterLogForwarder{})
+
+			var names []string
+			for _, ppl := range clf.Spec.Pipelines {
+				names = append(names, ppl.Name)
+			}
+			if !reflect.DeepEqual(names, test.expectedPipelines) {
+				t.Errorf("mismatched pipelines, expected %v, got %v", test.expectedPipelines, names)
+			}
+		})
+	}
+}
+
+func TestBuildPipelineLabelsFromTemplate(t *testing.T) {
+	template := &v1alpha1.ClusterLogForwarderTemplate{
+		Spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+			Template: loggingv1.ClusterLogForwarderSpec{
+				Pipelines: []loggingv1.PipelineSpec{
+					{Name: "audit", InputRefs: []string{"audit"}, OutputRefs: []string{"default"}, Labels: map[string]string{"team": "sre", "data_classification": "internal"}},
+					{Name: "app", InputRefs: []string{"application"}, OutputRefs: []string{"default"}},
+				},
+			},
+			PipelineOptions: []v1alpha1.PipelineOptions{
+				{Name: "audit", Labels: map[string]string{"data_classification": "restricted"}},
+			},
+		},
+	}
+
+	clf := BuildPipelinesFromTemplate(template, &loggingv1.ClusterLogForwarder{})
+
+	expected := map[string]map[string]string{
+		"audit": {"team": "sre", "data_classification": "restricted"},
+		"app":   nil,
+	}
+	for _, ppl := range clf.Spec.Pipelines {
+		if !reflect.DeepEqual(ppl.Labels, expected[ppl.Name]) {
+			t.Errorf("mismatched labels of %s, expected %v, got %v", ppl.Name, expected[ppl.Name], ppl.Labels)
+		}
+	}
+	// The template itself is left intact
+	if got := template.Spec.Template.Pipelines[0].Labels["data_classification"]; got != "internal" {
+		t.Errorf("mismatched template label, expected %v, got %v", "internal", got)
+	}
+}
+
+func TestBuildFallbackOutputsFromTemplate(t *testing.T) {
+	template := &v1alpha1.ClusterLogForwarderTemplate{
+		Spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+			Template: loggingv1.ClusterLogForwarderSpec{
+				Outputs: []loggingv1.OutputSpec{
+					{Name: "loki", Type: "loki", URL: "https://loki:3100"},
+					{Name: "s3-archive", Type: "http", URL: "https://archive:8443"},
+					{Name: "es", Type: "elasticsearch", URL: "https://es:9200"},
+				},
+				Pipelines: []loggingv1.PipelineSpec{
+					{Name: "audit", InputRefs: []string{"audit"}, OutputRefs: []string{"loki"}},
+					{Name: "app", InputRefs: []string{"application"}, OutputRefs: []string{"es"}},
+					{Name: "infra", InputRefs: []string{"infrastructure"}, OutputRefs: []string{"loki", "s3-archive"}},
+				},
+			},
+			OutputOptions: []v1alpha1.OutputOptions{
+				{Name: "loki", Fallback: "s3-archive"},
+				// The fallback of another platform is not rendered
+				{Name: "es", Fallback: "cloudwatch"},
+			},
+		},
+	}
+
+	clf := BuildOutputsFromTemplate(template, &loggingv1.ClusterLogForwarder{})
+	clf = BuildPipelinesFromTemplate(template, clf)
+	clf = BuildFallbackOutputsFromTemplate(template, clf)
+
+	expected := map[string][]string{
+		"audit": {"loki", "s3-archive"},
+		"app":   {"es"},
+		"infra": {"loki", "s3-archive"},
+	}
+	for _, ppl := range clf.Spec.Pipelines {
+		if !reflect.DeepEqual(ppl.OutputRefs, expected[ppl.Name]) {
+			t.Errorf("mismatched output refs of %s, expected %v, got %v", ppl.Name, expected[ppl.Name], ppl.OutputRefs)
+		}
+	}
+	if got := template.Spec.Template.Pipelines[0].OutputRefs; !reflect.DeepEqual(got, []string{"loki"}) {
+		t.Errorf("mismatched template output refs, expected %v, got %v", []string{"loki"}, got)
+	}
+}
+
+func TestBuildCABundleFromTemplate(t *testing.T) {
+	template := &v1alpha1.ClusterLogForwarderTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "instance"},
+		Spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+			Template: loggingv1.ClusterLogForwarderSpec{
+				Outputs: []loggingv1.OutputSpec{
+					{Name: "loki", Type: "loki", URL: "https://loki:3100"},
+					{Name: "es", Type: "elasticsearch", URL: "https://es:9200", Secret: &loggingv1.OutputSecretSpec{Name: "es-tls"}},
+					{Name: "http", Type: "http", URL: "http://receiver:8080"},
+					{Name: "cloudwatch", Type: "cloudwatch"},
+				},
+			},
+			CABundle: &v1alpha1.CABundleReference{ConfigMapName: "ca"},
+		},
+	}
+
+	clf := BuildOutputsFromTemplate(template, &loggingv1.ClusterLogForwarder{})
+	clf = BuildCABundleFromTemplate(template, clf)
+
+	// Only the TLS output without secret references the CA bundle, the secret of the other is completed on propagation
+	expected := map[string]string{"loki": "instance-ca-bundle", "es": "es-tls"}
+	for _, output := range clf.Spec.Outputs {
+		var secret string
+		if output.Secret != nil {
+			secret = output.Secret.Name
+		}
+		if secret != expected[output.Name] {
+			t.Errorf("mismatched secret of %s, expected %q, got %q", output.Name, expected[output.Name], secret)
+		}
+	}
+	if template.Spec.Template.Outputs[0].Secret != nil {
+		t.Error("expected the template outputs to be left unchanged")
+	}
+}
+
+func TestBuildPerLogTypeRouting(t *testing.T) {
+	template := &v1alpha1.ClusterLogForwarderTemplate{
+		Spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+			Template: loggingv1.ClusterLogForwarderSpec{
+				Outputs: []loggingv1.OutputSpec{
+					{Name: "loki", Type: loggingv1.OutputTypeLoki, URL: "https://loki:3100"},
+					{Name: "kafka", Type: loggingv1.OutputTypeKafka, URL: "tls://kafka:9093"},
+					{Name: "cloudwatch", Type: loggingv1.OutputTypeCloudwatch},
+				},
+				Pipelines: []loggingv1.PipelineSpec{
+					{Name: "app", InputRefs: []string{loggingv1.InputNameApplication}, OutputRefs: []string{"loki"}},
+					{Name: "audit", InputRefs: []string{loggingv1.InputNameAudit}, OutputRefs: []string{"kafka"}},
+					{Name: "infra", InputRefs: []string{loggingv1.InputNameInfrastructure}, OutputRefs: []string{"cloudwatch"}},
+				},
+			},
+		},
+	}
+	if err := ValidateTemplate(template); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	clf := BuildOutputsFromTemplate(template, &loggingv1.ClusterLogForwarder{})
+	clf = BuildPipelinesFromTemplate(template, clf)
+
+	outputTypes := map[string]string{}
+	for _, output := range clf.Spec.Outputs {
+		outputTypes[output.Name] = output.Type
+	}
+	routes := map[string][]string{}
+	for _, ppl := range clf.Spec.Pipelines {
+		for _, input := range ppl.InputRefs {
+			for _, ref := range ppl.OutputRefs {
+				routes[input] = append(routes[input], outputTypes[ref])
+			}
+		}
+	}
+
+	expected := map[string][]string{
+		loggingv1.InputNameApplication:    {loggingv1.OutputTypeLoki},
+		loggingv1.InputNameAudit:          {loggingv1.OutputTypeKafka},
+		loggingv1.InputNameInfrastructure: {loggingv1.OutputTypeCloudwatch},
+	}
+	if !reflect.DeepEqual(routes, expected) {
+		t.Errorf("mismatched routes, expected %v, got %v", expected, routes)
+	}
+}
+
+func TestBuildMultilineFromTemplate(t *testing.T) {
+	pipelines := []loggingv1.PipelineSpec{
+		{Name: "app-java", InputRefs: []string{loggingv1.InputNameApplication}, OutputRefs: []string{"default"}},
+		{Name: "app-go", InputRefs: []string{loggingv1.InputNameApplication}, OutputRefs: []string{"default"}},
+		{Name: "audit", InputRefs: []string{loggingv1.InputNameAudit}, OutputRefs: []string{"default"}},
+	}
+
+	tests := []struct {
+		name      string
+		multiline *v1alpha1.MultilineOptions
+		expected  map[string]bool
+		expectErr bool
+	}{
+		{
+			name:     "multiline not configured",
+			expected: map[string]bool{"app-java": false, "app-go": false, "audit": false},
+		},
+		{
+			name:      "multiline disabled",
+			multiline: &v1alpha1.MultilineOptions{Enabled: false},
+			expected:  map[string]bool{"app-java": false, "app-go": false, "audit": false},
+		},
+		{
+			name:      "all application pipelines",
+			multiline: &v1alpha1.MultilineOptions{Enabled: true},
+			expected:  map[string]bool{"app-java": true, "app-go": true, "audit": false},
+		},
+		{
+			name:      "application pipelines matching the patterns",
+			multiline: &v1alpha1.MultilineOptions{Enabled: true, PipelinePatterns: []string{"java$", "^audit$"}},
+			expected:  map[string]bool{"app-java": true, "app-go": false, "audit": false},
+		},
+		{
+			name:      "invalid pattern",
+			multiline: &v1alpha1.MultilineOptions{Enabled: true, PipelinePatterns: []string{"[a-"}},
+			expectErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			template := &v1alpha1.ClusterLogForwarderTemplate{
+				Spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+					Template:  loggingv1.ClusterLogForwarderSpec{Pipelines: pipelines},
+					Multiline: test.multiline,
+				},
+			}
+
+			clf := BuildPipelinesFromTemplate(template, &loggingv1.ClusterLogForwarder{})
+			clf, err := BuildMultilineFromTemplate(template, clf)
+			if test.expectErr {
+				if err == nil {
+					t.Error("expected err, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no err, got %v", err)
+			}
+			for _, ppl := range clf.Spec.Pipelines {
+				if ppl.DetectMultilineErrors != test.expected[ppl.Name] {
+					t.Errorf("mismatched multiline detection of %s, expected %v, got %v", ppl.Name, test.expected[ppl.Name], ppl.DetectMultilineErrors)
+				}
+			}
+			for _, ppl := range template.Spec.Template.Pipelines {
+				if ppl.DetectMultilineErrors {
+					t.Errorf("expected the template pipeline %s to be unchanged", ppl.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildSeverityFiltersFromTemplate(t *testing.T) {
+	tests := []struct {
+		name               string
+		minSeverity        string
+		expectedMatches    string
+		expectedFilterRefs []string
+		expectErr          bool
+	}{
+		{
+			name:               "textual severity",
+			minSeverity:        "warn",
+			expectedMatches:    "(?i)^(notice|5|info|informational|6|debug|7|trace)$",
+			expectedFilterRefs: []string{"audit", "hlo-app-min-severity"},
+		},
+		{
+			name:               "numeric severity",
+			minSeverity:        "6",
+			expectedMatches:    "(?i)^(debug|7|trace)$",
+			expectedFilterRefs: []string{"audit", "hlo-app-min-severity"},
+		},
+		{
+			name:               "case insensitive severity",
+			minSeverity:        "Error",
+			expectedMatches:    "(?i)^(warning|warn|4|notice|5|info|informational|6|debug|7|trace)$",
+			expectedFilterRefs: []string{"audit", "hlo-app-min-severity"},
+		},
+		{
+			name:               "no minimum severity",
+			expectedFilterRefs: []string{"audit"},
+		},
+		{
+			name:        "unknown severity",
+			minSeverity: "loud",
+			expectErr:   true,
+		},
+		{
+			name:        "out of range numeric severity",
+			minSeverity: "9",
+			expectErr:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			template := &v1alpha1.ClusterLogForwarderTemplate{
+				Spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+					Template: loggingv1.ClusterLogForwarderSpec{
+						Pipelines: []loggingv1.PipelineSpec{{
+							Name:       "app",
+							InputRefs:  []string{"application"},
+							OutputRefs: []string{"default"},
+							FilterRefs: []string{"audit"},
+						}},
+					},
+					PipelineOptions: []v1alpha1.PipelineOptions{{Name: "app", MinSeverity: test.minSeverity}},
+				},
+			}
+
+			clf := BuildPipelinesFromTemplate(template, &loggingv1.ClusterLogForwarder{})
+			clf, err := BuildSeverityFiltersFromTemplate(template, clf)
+			if test.expectErr {
+				if err == nil {
+					t.Error("expected err, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if !reflect.DeepEqual(clf.Spec.Pipelines[0].FilterRefs, test.expectedFilterRefs) {
+				t.Errorf("mismatched filter refs, expected %v, got %v", test.expectedFilterRefs, clf.Spec.Pipelines[0].FilterRefs)
+			}
+			if test.expectedMatches == "" {
+				if len(clf.Spec.Filters) != 0 {
+					t.Errorf("expected no filter, got %v", clf.Spec.Filters)
+				}
+				return
+			}
+			expected := []loggingv1.FilterSpec{{
+				Name: "hlo-app-min-severity",
+				Type: loggingv1.FilterDrop,
+				FilterTypeSpec: loggingv1.FilterTypeSpec{
+					DropTestsSpec: &[]loggingv1.DropTest{{
+						DropConditions: []loggingv1.DropCondition{{Field: ".level", Matches: test.expectedMatches}},
+					}},
+				},
+			}}
+			if !reflect.DeepEqual(clf.Spec.Filters, expected) {
+				t.Errorf("mismatched filters, expected %v, got %v", expected, clf.Spec.Filters)
+			}
+			if len(template.Spec.Template.Pipelines[0].FilterRefs) != 1 {
+				t.Error("expected the template pipeline to be unchanged")
+			}
+		})
+	}
+}
+
+func TestBuildFilterOrderFromTemplate(t *testing.T) {
+	tests := []struct {
+		name               string
+		filterOrder        []string
+		expectedFilterRefs []string
+		expectErr          bool
+	}{
+		{
+			name:               "rendered order without a filter order",
+			expectedFilterRefs: []string{"redact", "parse", "hlo-app-min-severity"},
+		},
+		{
+			name:               "ordered filters",
+			filterOrder:        []string{"parse", "hlo-app-min-severity", "redact"},
+			expectedFilterRefs: []string{"parse", "hlo-app-min-severity", "redact"},
+		},
+		{
+			name:               "unlisted filters applied after the ordered ones",
+			filterOrder:        []string{"hlo-app-min-severity"},
+			expectedFilterRefs: []string{"hlo-app-min-severity", "redact", "parse"},
+		},
+		{
+			name:        "filter not applied by the pipeline",
+			filterOrder: []string{"parse", "unknown"},
+			expectErr:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			template := &v1alpha1.ClusterLogForwarderTemplate{
+				Spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+					Template: loggingv1.ClusterLogForwarderSpec{
+						Pipelines: []loggingv1.PipelineSpec{{
+							Name:       "app",
+							InputRefs:  []string{"application"},
+							OutputRefs: []string{"default"},
+							FilterRefs: []string{"redact", "parse"},
+						}},
+					},
+					PipelineOptions: []v1alpha1.PipelineOptions{{Name: "app", MinSeverity: "warn", FilterOrder: test.filterOrder}},
+				},
+			}
+
+			// The order is the same however many times the CLF is rendered
+			for i := 0; i < 10; i++ {
+				clf := BuildPipelinesFromTemplate(template, &loggingv1.ClusterLogForwarder{})
+				clf, err := BuildSeverityFiltersFromTemplate(template, clf)
+				if err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+				clf, err = BuildFilterOrderFromTemplate(template, clf)
+				if test.expectErr {
+					if err == nil {
+						t.Error("expected err, got nil")
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+				if !reflect.DeepEqual(clf.Spec.Pipelines[0].FilterRefs, test.expectedFilterRefs) {
+					t.Fatalf("mismatched filter refs, expected %v, got %v", test.expectedFilterRefs, clf.Spec.Pipelines[0].FilterRefs)
+				}
+			}
+			if !reflect.DeepEqual(template.Spec.Template.Pipelines[0].FilterRefs, []string{"redact", "parse"}) {
+				t.Error("expected the template pipeline to be unchanged")
+			}
+		})
+	}
+}
+
+func TestBuildSystemNamespacesFilterFromTemplate(t *testing.T) {
+	tests := []struct {
+		name               string
+		opts               *v1alpha1.SystemNamespacesOptions
+		inputRefs          []string
+		expectedConditions []loggingv1.DropCondition
+	}{
+		{
+			name:      "system namespaces are excluded by default",
+			inputRefs: []string{loggingv1.InputNameApplication},
+			expectedConditions: []loggingv1.DropCondition{
+				{Field: ".kubernetes.namespace_name", Matches: "^(kube-.*|openshift-.*)$"},
+			},
+		},
+		{
+			name:      "opted out",
+			opts:      &v1alpha1.SystemNamespacesOptions{Disabled: true},
+			inputRefs: []string{loggingv1.InputNameApplication},
+		},
+		{
+			name:      "added namespace",
+			opts:      &v1alpha1.SystemNamespacesOptions{Add: []string{"istio-system"}},
+			inputRefs: []string{loggingv1.InputNameApplication},
+			expectedConditions: []loggingv1.DropCondition{
+				{Field: ".kubernetes.namespace_name", Matches: "^(kube-.*|openshift-.*|istio-system)$"},
+			},
+		},
+		{
+			name:      "removed default pattern",
+			opts:      &v1alpha1.SystemNamespacesOptions{Remove: []string{"kube-*"}},
+			inputRefs: []string{loggingv1.InputNameApplication},
+			expectedConditions: []loggingv1.DropCondition{
+				{Field: ".kubernetes.namespace_name", Matches: "^(openshift-.*)$"},
+			},
+		},
+		{
+			name:      "namespace kept within a default pattern",
+			opts:      &v1alpha1.SystemNamespacesOptions{Remove: []string{"openshift-monitoring"}},
+			inputRefs: []string{loggingv1.InputNameApplication},
+			expectedConditions: []loggingv1.DropCondition{
+				{Field: ".kubernetes.namespace_name", Matches: "^(kube-.*|openshift-.*)$"},
+				{Field: ".kubernetes.namespace_name", NotMatches: "^(openshift-monitoring)$"},
+			},
+		},
+		{
+			name:      "pipeline without application logs",
+			inputRefs: []string{loggingv1.InputNameAudit},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			template := &v1alpha1.ClusterLogForwarderTemplate{
+				Spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+					Template: loggingv1.ClusterLogForwarderSpec{
+						Pipelines: []loggingv1.PipelineSpec{{Name: "logs", InputRefs: test.inputRefs, OutputRefs: []string{"default"}}},
+					},
+					SystemNamespaces: test.opts,
+				},
+			}
+			clf := BuildPipelinesFromTemplate(template, &loggingv1.ClusterLogForwarder{})
+			clf = BuildSystemNamespacesFilterFromTemplate(template, clf)
+
+			if test.expectedConditions == nil {
+				if len(clf.Spec.Filters) != 0 || len(clf.Spec.Pipelines[0].FilterRefs) != 0 {
+					t.Errorf("expected no filter, got %v", clf.Spec.Filters)
+				}
+				return
+			}
+			if len(clf.Spec.Filters) != 1 {
+				t.Fatalf("mismatched filters, expected %v, got %v", 1, len(clf.Spec.Filters))
+			}
+			filter := clf.Spec.Filters[0]
+			if filter.Name != SystemNamespacesFilterName || filter.Type != loggingv1.FilterDrop {
+				t.Errorf("mismatched filter, expected a %s filter named %s, got %v", loggingv1.FilterDrop, SystemNamespacesFilterName, filter)
+			}
+			if got := (*filter.DropTestsSpec)[0].DropConditions; !reflect.DeepEqual(got, test.expectedConditions) {
+				t.Errorf("mismatched conditions, expected %v, got %v", test.expectedConditions, got)
+			}
+			if got := clf.Spec.Pipelines[0].FilterRefs; !reflect.DeepEqual(got, []string{SystemNamespacesFilterName}) {
+				t.Errorf("mismatched filter refs, expected %v, got %v", []string{SystemNamespacesFilterName}, got)
+			}
+		})
+	}
+}
+
+func TestBuildTransformsFromTemplate(t *testing.T) {
+	template := &v1alpha1.ClusterLogForwarderTemplate{
+		Spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+			Template: loggingv1.ClusterLogForwarderSpec{
+				Pipelines: []loggingv1.PipelineSpec{
+					{Name: "app", InputRefs: []string{"application"}, OutputRefs: []string{"default"}},
+					{
+						Name:       "audit",
+						InputRefs:  []string{"audit"},
+						OutputRefs: []string{"default"},
+						Labels:     map[string]string{"datacenter": "audit-dc"},
+					},
+				},
+			},
+			Transforms: &v1alpha1.TransformOptions{
+				AddFields:    map[string]string{"datacenter": "eu-west-1a", "cluster_id": "1234"},
+				RemoveFields: []string{".kubernetes.annotations"},
+			},
+		},
+	}
+
+	clf := BuildPipelinesFromTemplate(template, &loggingv1.ClusterLogForwarder{})
+	clf = BuildTransformsFromTemplate(template, clf)
+
+	// The labels of the pipeline take precedence over the added fields
+	expectedLabels := []map[string]string{
+		{"datacenter": "eu-west-1a", "cluster_id": "1234"},
+		{"datacenter": "audit-dc", "cluster_id": "1234"},
+	}
+	for i, ppl := range clf.Spec.Pipelines {
+		if !reflect.DeepEqual(ppl.Labels, expectedLabels[i]) {
+			t.Errorf("mismatched labels of %s, expected %v, got %v", ppl.Name, expectedLabels[i], ppl.Labels)
+		}
+		if !reflect.DeepEqual(ppl.FilterRefs, []string{RemoveFieldsFilterName}) {
+			t.Errorf("mismatched filter refs of %s, expected %v, got %v", ppl.Name, []string{RemoveFieldsFilterName}, ppl.FilterRefs)
+		}
+	}
+	expectedFilters := []loggingv1.FilterSpec{{
+		Name: RemoveFieldsFilterName,
+		Type: loggingv1.FilterPrune,
+		FilterTypeSpec: loggingv1.FilterTypeSpec{
+			PruneFilterSpec: &loggingv1.PruneFilterSpec{In: []string{".kubernetes.annotations"}},
+		},
+	}}
+	if !reflect.DeepEqual(clf.Spec.Filters, expectedFilters) {
+		t.Errorf("mismatched filters, expected %v, got %v", expectedFilters, clf.Spec.Filters)
+	}
+	if template.Spec.Template.Pipelines[1].Labels["cluster_id"] != "" {
+		t.Error("expected the template pipeline to be left intact")
+	}
+}
+
+func TestBuildEventsInput(t *testing.T) {
+	tests := []struct {
+		name           string
+		inputRefs      []string
+		expectedInputs []string
+	}{
+		{
+			name:           "pipeline forwarding the events",
+			inputRefs:      []string{InputEventsName},
+			expectedInputs: []string{InputHTTPServerName, InputEventsName},
+		},
+		{
+			name:           "pipeline without the events",
+			inputRefs:      []string{InputHTTPServerName},
+			expectedInputs: []string{InputHTTPServerName},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			template := &v1alpha1.ClusterLogForwarderTemplate{
+				Spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+					Template: loggingv1.ClusterLogForwarderSpec{
+						Pipelines: []loggingv1.PipelineSpec{
+							{Name: "events", InputRefs: test.inputRefs, OutputRefs: []string{"default"}},
+							{Name: "more-events", InputRefs: test.inputRefs, OutputRefs: []string{"default"}},
+						},
+					},
+					HCPAudit: &v1alpha1.HCPAuditOptions{Enabled: true},
+				},
+			}
+			clf := &loggingv1.ClusterLogForwarder{}
+			clf.Namespace = "clusters-test"
+			clf = BuildInputsFromTemplate(template, clf)
+			clf = BuildPipelinesFromTemplate(template, clf)
+			clf = BuildEventsInput(clf, "instance")
+
+			var names []string
+			for _, input := range clf.Spec.Inputs {
+				names = append(names, input.Name)
+			}
+			if !reflect.DeepEqual(names, test.expectedInputs) {
+				t.Fatalf("mismatched inputs, expected %v, got %v", test.expectedInputs, names)
+			}
+			if len(names) < 2 {
+				return
+			}
+
+			app := clf.Spec.Inputs[1].Application
+			if app == nil {
+				t.Fatal("expected the events to be collected as application logs")
+			}
+			if !reflect.DeepEqual(app.Namespaces, []string{"clusters-test"}) {
+				t.Errorf("mismatched namespaces, expected %v, got %v", []string{"clusters-test"}, app.Namespaces)
+			}
+			expectedLabels := map[string]string{
+				"app.kubernetes.io/component": EventRouterComponent,
+				"app.kubernetes.io/instance":  "instance",
+			}
+			if app.Selector == nil || !reflect.DeepEqual(app.Selector.MatchLabels, expectedLabels) {
+				t.Errorf("mismatched selector, expected %v, got %v", expectedLabels, app.Selector)
+			}
+		})
+	}
+}
+
+func TestBuildNetworkLogsInput(t *testing.T) {
+	tests := []struct {
+		name           string
+		pipelines      []loggingv1.PipelineSpec
+		expectedInputs []string
+	}{
+		{
+			name: "pipeline forwarding the network logs",
+			pipelines: []loggingv1.PipelineSpec{
+				{Name: "app", InputRefs: []string{"application"}, OutputRefs: []string{"default"}},
+				{Name: "network", InputRefs: []string{InputNetworkLogsName}, OutputRefs: []string{"network-store"}},
+				{Name: "more-network", InputRefs: []string{InputNetworkLogsName}, OutputRefs: []string{"default"}},
+			},
+			expectedInputs: []string{InputNetworkLogsName},
+		},
+		{
+			name: "pipelines without the network logs",
+			pipelines: []loggingv1.PipelineSpec{
+				{Name: "app", InputRefs: []string{"application"}, OutputRefs: []string{"default"}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			template := &v1alpha1.ClusterLogForwarderTemplate{
+				Spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+					Template: loggingv1.ClusterLogForwarderSpec{Pipelines: test.pipelines},
+				},
+			}
+			clf := BuildInputsFromTemplate(template, &loggingv1.ClusterLogForwarder{})
+			clf = BuildPipelinesFromTemplate(template, clf)
+			clf = BuildNetworkLogsInput(clf)
+
+			var names []string
+			for _, input := range clf.Spec.Inputs {
+				names = append(names, input.Name)
+			}
+			if !reflect.DeepEqual(names, test.expectedInputs) {
+				t.Fatalf("mismatched inputs, expected %v, got %v", test.expectedInputs, names)
+			}
+			if len(names) == 0 {
+				return
+			}
+			// The network logs are the ovn audit source only
+			audit := clf.Spec.Inputs[0].Audit
+			if audit == nil || !reflect.DeepEqual(audit.Sources, []string{"ovn"}) {
+				t.Errorf("mismatched network logs input, expected the ovn audit source, got %v", audit)
+			}
+		})
+	}
+}
+
+func TestValidateNetworkLogs(t *testing.T) {
+	tests := []struct {
+		name           string
+		inputRefs      []string
+		loggingVersion string
+		expectErr      bool
+	}{
+		{
+			name:           "own pipeline",
+			inputRefs:      []string{InputNetworkLogsName},
+			loggingVersion: "5.8.1",
+		},
+		{
+			name:           "unknown version",
+			inputRefs:      []string{InputNetworkLogsName},
+			loggingVersion: "",
+		},
+		{
+			name:           "version without the ovn source",
+			inputRefs:      []string{InputNetworkLogsName},
+			loggingVersion: "5.7.6",
+			expectErr:      true,
+		},
+		{
+			name:           "pipeline mixing the network logs with the audit logs",
+			inputRefs:      []string{InputNetworkLogsName, "audit"},
+			loggingVersion: "5.8.1",
+			expectErr:      true,
+		},
+		{
+			name:           "version without the ovn source and no network logs",
+			inputRefs:      []string{"audit"},
+			loggingVersion: "5.7.6",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			template := &v1alpha1.ClusterLogForwarderTemplate{
+				Spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+					Template: loggingv1.ClusterLogForwarderSpec{
+						Pipelines: []loggingv1.PipelineSpec{{Name: "network", InputRefs: test.inputRefs, OutputRefs: []string{"default"}}},
+					},
+				},
+			}
+			err := ValidateNetworkLogs(template, test.loggingVersion)
+			if test.expectErr && err == nil {
+				t.Error("expected err, got nil")
+			}
+			if !test.expectErr && err != nil {
+				t.Errorf("expected no err, got %v", err)
+			}
+		})
+	}
+}
+
+func TestBuildHCPAuditInput(t *testing.T) {
+	tests := []struct {
+		name           string
+		hcpAudit       *v1alpha1.HCPAuditOptions
+		expectedInputs []string
+	}{
+		{
+			name:           "HCP audit omitted by default",
+			expectedInputs: []string{"journal", "noisy-app"},
+		},
+		{
+			name:           "HCP audit disabled",
+			hcpAudit:       &v1alpha1.HCPAuditOptions{Enabled: false},
+			expectedInputs: []string{"journal", "noisy-app"},
+		},
+		{
+			name:           "HCP audit enabled",
+			hcpAudit:       &v1alpha1.HCPAuditOptions{Enabled: true},
+			expectedInputs: []string{InputHTTPServerName, "journal", "noisy-app"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			template := &v1alpha1.ClusterLogForwarderTemplate{
+				Spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+					HCPAudit:            test.hcpAudit,
+					CollectionSources:   []v1alpha1.CollectionSource{{Name: "journal", Type: "infrastructure", Sources: []string{"node"}}},
+					NamespaceRateLimits: []v1alpha1.NamespaceRateLimit{{Name: "noisy-app", Namespace: "noisy", MaxRecordsPerSecond: 100}},
+				},
+			}
+			clf := BuildInputsFromTemplate(template, &loggingv1.ClusterLogForwarder{})
+
+			var names []string
+			for _, input := range clf.Spec.Inputs {
+				names = append(names, input.Name)
+			}
+			if !reflect.DeepEqual(names, test.expectedInputs) {
+				t.Errorf("mismatched inputs, expected %v, got %v", test.expectedInputs, names)
+			}
+		})
+	}
+}
+
+func TestBuildCollectionSources(t *testing.T) {
+	template := &v1alpha1.ClusterLogForwarderTemplate{
+		Spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+			CollectionSources: []v1alpha1.CollectionSource{
+				{Name: "journal", Type: "infrastructure", Sources: []string{"node"}},
+				{Name: "ovn-audit", Type: "audit", Sources: []string{"ovn"}},
+			},
+		},
+	}
+	clf := BuildInputsFromTemplate(template, &loggingv1.ClusterLogForwarder{})
+
+	expected := []loggingv1.InputSpec{
+		{Name: "journal", Infrastructure: &loggingv1.Infrastructure{Sources: []string{"node"}}},
+		{Name: "ovn-audit", Audit: &loggingv1.Audit{Sources: []string{"ovn"}}},
+	}
+	if !reflect.DeepEqual(clf.Spec.Inputs, expected) {
+		t.Errorf("mismatched inputs, expected %v, got %v", expected, clf.Spec.Inputs)
+	}
+}
+
+func TestBuildNamespaceRateLimits(t *testing.T) {
+	template := &v1alpha1.ClusterLogForwarderTemplate{
+		Spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+			NamespaceRateLimits: []v1alpha1.NamespaceRateLimit{
+				{Name: "noisy-app", Namespace: "noisy", MaxRecordsPerSecond: 100},
+				{Name: "quiet-app", Namespace: "quiet", MaxRecordsPerSecond: 1000},
+			},
+		},
+	}
+	clf := BuildInputsFromTemplate(template, &loggingv1.ClusterLogForwarder{})
+
+	expected := []loggingv1.InputSpec{
+		{Name: "noisy-app", Application: &loggingv1.Application{
+			Namespaces: []string{"noisy"},
+			GroupLimit: &loggingv1.LimitSpec{MaxRecordsPerSecond: 100},
+		}},
+		{Name: "quiet-app", Application: &loggingv1.Application{
+			Namespaces: []string{"quiet"},
+			GroupLimit: &loggingv1.LimitSpec{MaxRecordsPerSecond: 1000},
+		}},
+	}
+	if !reflect.DeepEqual(clf.Spec.Inputs, expected) {
+		t.Errorf("mismatched inputs, expected %v, got %v", expected, clf.Spec.Inputs)
+	}
+}
+
+func TestBuildPodSelectors(t *testing.T) {
+	template := &v1alpha1.ClusterLogForwarderTemplate{
+		Spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+			PodSelectors: []v1alpha1.PodSelector{
+				{Name: "tenant-a", MatchLabels: map[string]string{"tenant": "a"}},
+				{Name: "tenant-b-web", MatchLabels: map[string]string{"tenant": "b", "tier": "web"}, Namespaces: []string{"web"}},
+			},
+		},
+	}
+	clf := BuildInputsFromTemplate(template, &loggingv1.ClusterLogForwarder{})
+
+	expected := []loggingv1.InputSpec{
+		{Name: "tenant-a", Application: &loggingv1.Application{
+			Namespaces: []string{},
+			Selector:   &metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "a"}},
+		}},
+		{Name: "tenant-b-web", Application: &loggingv1.Application{
+			Namespaces: []string{"web"},
+			Selector:   &metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "b", "tier": "web"}},
+		}},
+	}
+	if !reflect.DeepEqual(clf.Spec.Inputs, expected) {
+		t.Errorf("mismatched inputs, expected %v, got %v", expected, clf.Spec.Inputs)
+	}
+
+	// The rendered selector must not share the labels of the template
+	clf.Spec.Inputs[0].Application.Selector.MatchLabels["tenant"] = "c"
+	if template.Spec.PodSelectors[0].MatchLabels["tenant"] != "a" {
+		t.Errorf("mismatched template labels, expected a, got %s", template.Spec.PodSelectors[0].MatchLabels["tenant"])
+	}
+}
+
+func TestBuildCollectorTypeFromTemplate(t *testing.T) {
+	tests := []struct {
+		name             string
+		collectorType    string
+		loggingVersion   string
+		expectErr        bool
+		expectDeployment bool
+	}{
+		{
+			name: "default collector type",
+		},
+		{
+			name:          "collector as a DaemonSet",
+			collectorType: CollectorTypeDaemonSet,
+		},
+		{
+			name:             "collector as a Deployment",
+			collectorType:    CollectorTypeDeployment,
+			loggingVersion:   "5.8.1",
+			expectDeployment: true,
+		},
+		{
+			name:           "collector as a Deployment on an older cluster-logging",
+			collectorType:  CollectorTypeDeployment,
+			loggingVersion: "5.7.4",
+			expectErr:      true,
+		},
+		{
+			name:          "unsupported collector type",
+			collectorType: "StatefulSet",
+			expectErr:     true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			template := &v1alpha1.ClusterLogForwarderTemplate{
+				Spec: v1alpha1.ClusterLogForwarderTemplateSpec{CollectorType: test.collectorType},
+			}
+			err := ValidateCollectorType(template, test.loggingVersion)
+			if (err != nil) != test.expectErr {
+				t.Fatalf("mismatched err, expected %v, got %v", test.expectErr, err)
+			}
+			if err != nil {
+				return
+			}
+			clf := BuildCollectorTypeFromTemplate(template, &loggingv1.ClusterLogForwarder{})
+			if IsCollectorDeployment(clf) != test.expectDeployment {
+				t.Errorf("mismatched collector deployment, expected %v, got %v", test.expectDeployment, IsCollectorDeployment(clf))
+			}
+		})
+	}
+}
+
+func TestMergeMetadataCollectorType(t *testing.T) {
+	existing := &loggingv1.ClusterLogForwarder{
+		ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{CollectorAsDeploymentAnnotation: ""}},
+	}
+	desired := &loggingv1.ClusterLogForwarder{}
+
+	// Switching back to a DaemonSet removes the annotation
+	if HasDesiredMetadata(existing, desired) {
+		t.Error("expected the change of collector type to be detected")
+	}
+	MergeMetadata(existing, desired)
+	if IsCollectorDeployment(existing) {
+		t.Error("expected the collector deployment annotation to be removed")
+	}
+	if !HasDesiredMetadata(existing, desired) {
+		t.Error("expected the merged metadata to be up to date")
+	}
+}
+
+func TestBuildCollectorLogLevelFromTemplate(t *testing.T) {
+	tests := []struct {
+		name      string
+		logLevel  string
+		expectErr bool
+		expected  string
+	}{
+		{
+			name: "default log level",
+		},
+		{
+			name:     "debug log level",
+			logLevel: "debug",
+			expected: "debug",
+		},
+		{
+			name:     "collector logs turned off",
+			logLevel: "off",
+			expected: "off",
+		},
+		{
+			name:      "unsupported log level",
+			logLevel:  "verbose",
+			expectErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			template := &v1alpha1.ClusterLogForwarderTemplate{
+				Spec: v1alpha1.ClusterLogForwarderTemplateSpec{CollectorLogLevel: test.logLevel},
+			}
+			err := ValidateCollectorLogLevel(template)
+			if (err != nil) != test.expectErr {
+				t.Fatalf("mismatched err, expected %v, got %v", test.expectErr, err)
+			}
+			if err != nil {
+				return
+			}
+			clf := BuildCollectorLogLevelFromTemplate(template, &loggingv1.ClusterLogForwarder{})
+			level, ok := clf.Annotations[CollectorLogLevelAnnotation]
+			if level != test.expected || ok != (test.expected != "") {
+				t.Errorf("mismatched log level, expected %q, got %q", test.expected, level)
+			}
+		})
+	}
+}
+
+func TestMergeMetadataCollectorLogLevel(t *testing.T) {
+	existing := &loggingv1.ClusterLogForwarder{
+		ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{CollectorLogLevelAnnotation: "debug"}},
+	}
+	desired := &loggingv1.ClusterLogForwarder{}
+
+	// Switching back to the default level removes the annotation
+	if HasDesiredMetadata(existing, desired) {
+		t.Error("expected the change of log level to be detected")
+	}
+	MergeMetadata(existing, desired)
+	if _, ok := existing.Annotations[CollectorLogLevelAnnotation]; ok {
+		t.Error("expected the collector log level annotation to be removed")
+	}
+	if !HasDesiredMetadata(existing, desired) {
+		t.Error("expected the merged metadata to be up to date")
+	}
+}
+
+// testPipelines forward the application logs to the default log store, a valid template renders at least one pipeline
+var testPipelines = []loggingv1.PipelineSpec{{
+	Name:       "app",
+	InputRefs:  []string{loggingv1.InputNameApplication},
+	OutputRefs: []string{"default"},
+}}
+
+func TestValidateTemplate(t *testing.T) {
+	disabled := false
+	environmentSpec := loggingv1.ClusterLogForwarderSpec{
+		Outputs:   []loggingv1.OutputSpec{{Name: "kafka", Type: loggingv1.OutputTypeKafka, URL: "tls://kafka:9093"}},
+		Pipelines: []loggingv1.PipelineSpec{{Name: "app", InputRefs: []string{"application"}, OutputRefs: []string{"kafka"}}},
+	}
+	selfTestSpec := loggingv1.ClusterLogForwarderSpec{
+		Outputs: []loggingv1.OutputSpec{
+			{Name: "loki", Type: loggingv1.OutputTypeLoki, URL: "https://loki:3100"},
+			{Name: "kafka", Type: loggingv1.OutputTypeKafka, URL: "tls://kafka:9093"},
+		},
+		Pipelines: []loggingv1.PipelineSpec{
+			{Name: "audit", InputRefs: []string{InputHTTPServerName}, OutputRefs: []string{"loki", "kafka"}},
+			{Name: "app", InputRefs: []string{"application"}, OutputRefs: []string{"loki"}},
+		},
+	}
+	appOnlySpec := *selfTestSpec.DeepCopy()
+	appOnlySpec.Pipelines = appOnlySpec.Pipelines[1:]
+	tests := []struct {
+		name      string
+		spec      v1alpha1.ClusterLogForwarderTemplateSpec
+		expectErr bool
+	}{
+		{
+			name: "ClusterLogForwarder name with tokens",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				ClusterLogForwarderName: "${tenant}-audit",
+				Template:                environmentSpec,
+			},
+		},
+		{
+			name: "invalid ClusterLogForwarder name",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				ClusterLogForwarderName: "Audit_Forwarder",
+				Template:                environmentSpec,
+			},
+			expectErr: true,
+		},
+		{
+			name: "no pipeline",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Outputs: []loggingv1.OutputSpec{{Name: "es", Type: "elasticsearch", URL: "https://es:9200"}},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "valid merged outputs",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: testPipelines,
+					Outputs:   []loggingv1.OutputSpec{{Name: "es", Type: "elasticsearch", URL: "https://es:9200"}},
+				},
+				OutputDefaults: &v1alpha1.OutputDefaults{Limit: &loggingv1.LimitSpec{MaxRecordsPerSecond: 100}},
+			},
+			expectErr: false,
+		},
+		{
+			name: "invalid default limit",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: testPipelines,
+					Outputs:   []loggingv1.OutputSpec{{Name: "es", Type: "elasticsearch", URL: "https://es:9200"}},
+				},
+				OutputDefaults: &v1alpha1.OutputDefaults{Limit: &loggingv1.LimitSpec{MaxRecordsPerSecond: -1}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "pipeline options of unknown pipeline",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: []loggingv1.PipelineSpec{{Name: "audit", InputRefs: []string{"audit"}, OutputRefs: []string{"default"}}},
+				},
+				PipelineOptions: []v1alpha1.PipelineOptions{{Name: "unknown"}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "HCP audit input not enabled",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: []loggingv1.PipelineSpec{{Name: "audit", InputRefs: []string{InputHTTPServerName}, OutputRefs: []string{"default"}}},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "HCP audit input enabled",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: []loggingv1.PipelineSpec{{Name: "audit", InputRefs: []string{InputHTTPServerName}, OutputRefs: []string{"default"}}},
+				},
+				HCPAudit: &v1alpha1.HCPAuditOptions{Enabled: true},
+			},
+			expectErr: false,
+		},
+		{
+			name: "filter ordered twice",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: []loggingv1.PipelineSpec{{Name: "app", InputRefs: []string{"application"}, OutputRefs: []string{"default"}}},
+				},
+				PipelineOptions: []v1alpha1.PipelineOptions{{Name: "app", FilterOrder: []string{"parse", "drop", "parse"}}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "URL with value tokens",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: testPipelines,
+					Outputs:   []loggingv1.OutputSpec{{Name: "loki", Type: "loki", URL: "https://${tenant}.loki.example.com:3100"}},
+				},
+			},
+			expectErr: false,
+		},
+		{
+			name: "duplicate output names",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: testPipelines,
+					Outputs: []loggingv1.OutputSpec{
+						{Name: "loki", Type: "loki", URL: "https://loki-a:3100"},
+						{Name: "loki", Type: "loki", URL: "https://loki-b:3100"},
+					},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "duplicate platform output names",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{Pipelines: testPipelines},
+				PlatformOutputs: []v1alpha1.PlatformOutputs{{
+					Platform: "AWS",
+					Outputs: []loggingv1.OutputSpec{
+						{Name: "cloud", Type: "cloudwatch"},
+						{Name: "cloud", Type: "cloudwatch"},
+					},
+				}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "same output name in different platforms",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{Pipelines: testPipelines},
+				PlatformOutputs: []v1alpha1.PlatformOutputs{
+					{Platform: "AWS", Outputs: []loggingv1.OutputSpec{{Name: "cloud", Type: "cloudwatch"}}},
+					{Platform: "Azure", Outputs: []loggingv1.OutputSpec{{Name: "cloud", Type: "loki", URL: "https://loki:3100"}}},
+				},
+			},
+			expectErr: false,
+		},
+		{
+			name: "duplicate pipeline names",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: []loggingv1.PipelineSpec{
+						{Name: "app", InputRefs: []string{"application"}, OutputRefs: []string{"default"}},
+						{Name: "app", InputRefs: []string{"infrastructure"}, OutputRefs: []string{"default"}},
+					},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "unnamed pipelines",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: []loggingv1.PipelineSpec{
+						{InputRefs: []string{"application"}, OutputRefs: []string{"default"}},
+						{InputRefs: []string{"infrastructure"}, OutputRefs: []string{"default"}},
+					},
+				},
+			},
+			expectErr: false,
+		},
+		{
+			name: "unknown pipeline minimum severity",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: []loggingv1.PipelineSpec{{Name: "app", InputRefs: []string{"application"}, OutputRefs: []string{"default"}}},
+				},
+				PipelineOptions: []v1alpha1.PipelineOptions{{Name: "app", MinSeverity: "loud"}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "supported compression",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: testPipelines,
+					Outputs:   []loggingv1.OutputSpec{{Name: "kafka", Type: "kafka", URL: "tls://kafka:9093"}},
+				},
+				OutputOptions: []v1alpha1.OutputOptions{{Name: "kafka", Compression: "lz4"}},
+			},
+			expectErr: false,
+		},
+		{
+			name: "compression not supported by the output type",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: testPipelines,
+					Outputs:   []loggingv1.OutputSpec{{Name: "loki", Type: "loki", URL: "https://loki:3100"}},
+				},
+				OutputOptions: []v1alpha1.OutputOptions{{Name: "loki", Compression: "zstd"}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "compression of an output type without compression",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: testPipelines,
+					Outputs:   []loggingv1.OutputSpec{{Name: "syslog", Type: "syslog", URL: "tls://syslog:6514"}},
+				},
+				OutputOptions: []v1alpha1.OutputOptions{{Name: "syslog", Compression: "gzip"}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "no compression of an output type without compression",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: testPipelines,
+					Outputs:   []loggingv1.OutputSpec{{Name: "syslog", Type: "syslog", URL: "tls://syslog:6514"}},
+				},
+				OutputOptions: []v1alpha1.OutputOptions{{Name: "syslog", Compression: "none"}},
+			},
+			expectErr: false,
+		},
+		{
+			name: "unsupported compression of a platform output",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{Pipelines: testPipelines},
+				PlatformOutputs: []v1alpha1.PlatformOutputs{{
+					Platform: "AWS",
+					Outputs:  []loggingv1.OutputSpec{{Name: "cloud", Type: "cloudwatch"}},
+				}},
+				OutputOptions: []v1alpha1.OutputOptions{{Name: "cloud", Compression: "gzip"}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "pipeline without output",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: []loggingv1.PipelineSpec{{Name: "audit", InputRefs: []string{loggingv1.InputNameAudit}}},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "pipeline without input",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: []loggingv1.PipelineSpec{{Name: "audit", OutputRefs: []string{"default"}}},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "disabled pipeline without output",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: append([]loggingv1.PipelineSpec{{Name: "audit", InputRefs: []string{loggingv1.InputNameAudit}}},
+						testPipelines...),
+				},
+				PipelineOptions: []v1alpha1.PipelineOptions{{Name: "audit", Enabled: &disabled}},
+			},
+			expectErr: false,
+		},
+		{
+			name: "filter with the prefix of the generated filters",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Filters:   []loggingv1.FilterSpec{{Name: RemoveFieldsFilterName, Type: loggingv1.FilterPrune}},
+					Pipelines: testPipelines,
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "filter named like the generated filters without their prefix",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Filters:   []loggingv1.FilterSpec{{Name: "app-min-severity", Type: loggingv1.FilterDrop}},
+					Pipelines: testPipelines,
+				},
+				PipelineOptions: []v1alpha1.PipelineOptions{{Name: "app", MinSeverity: "warn"}},
+			},
+		},
+		{
+			name: "filter defined more than once",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Filters: []loggingv1.FilterSpec{
+						{Name: "redact", Type: loggingv1.FilterPrune},
+						{Name: "redact", Type: loggingv1.FilterDrop},
+					},
+					Pipelines: testPipelines,
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "input forwarded by no pipeline",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Inputs: []loggingv1.InputSpec{{
+						Name:        "payments",
+						Application: &loggingv1.Application{Namespaces: []string{"payments"}},
+					}},
+					Pipelines: testPipelines,
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "input forwarded by a disabled pipeline only",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Inputs: []loggingv1.InputSpec{{
+						Name:        "payments",
+						Application: &loggingv1.Application{Namespaces: []string{"payments"}},
+					}},
+					Pipelines: append([]loggingv1.PipelineSpec{
+						{Name: "payments", InputRefs: []string{"payments"}, OutputRefs: []string{"default"}},
+					}, testPipelines...),
+				},
+				PipelineOptions: []v1alpha1.PipelineOptions{{Name: "payments", Enabled: &disabled}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "input forwarded by an enabled pipeline",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Inputs: []loggingv1.InputSpec{{
+						Name:        "payments",
+						Application: &loggingv1.Application{Namespaces: []string{"payments"}},
+					}},
+					Pipelines: []loggingv1.PipelineSpec{
+						{Name: "payments", InputRefs: []string{"payments"}, OutputRefs: []string{"default"}},
+					},
+				},
+			},
+		},
+		{
+			name: "all pipelines disabled",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: []loggingv1.PipelineSpec{
+						{Name: "audit", InputRefs: []string{loggingv1.InputNameAudit}, OutputRefs: []string{"default"}},
+					},
+				},
+				PipelineOptions: []v1alpha1.PipelineOptions{{Name: "audit", Enabled: &disabled}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "output options of unknown output",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template:      loggingv1.ClusterLogForwarderSpec{Pipelines: testPipelines},
+				OutputOptions: []v1alpha1.OutputOptions{{Name: "unknown", Compression: "gzip"}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "output timeout and retry durations in range",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: testPipelines,
+					Outputs:   []loggingv1.OutputSpec{{Name: "http", Type: loggingv1.OutputTypeHttp, URL: "https://collector:8443"}},
+				},
+				OutputOptions: []v1alpha1.OutputOptions{{
+					Name:             "http",
+					Timeout:          &metav1.Duration{Duration: time.Minute},
+					MinRetryDuration: &metav1.Duration{Duration: time.Second},
+					MaxRetryDuration: &metav1.Duration{Duration: time.Hour},
+				}},
+			},
+			expectErr: false,
+		},
+		{
+			name: "output timeout out of range",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: testPipelines,
+					Outputs:   []loggingv1.OutputSpec{{Name: "http", Type: loggingv1.OutputTypeHttp, URL: "https://collector:8443"}},
+				},
+				OutputOptions: []v1alpha1.OutputOptions{{Name: "http", Timeout: &metav1.Duration{Duration: time.Hour}}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "output timeout on an output without timeout",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: testPipelines,
+					Outputs:   []loggingv1.OutputSpec{{Name: "loki", Type: loggingv1.OutputTypeLoki, URL: "https://loki:3100"}},
+				},
+				OutputOptions: []v1alpha1.OutputOptions{{Name: "loki", Timeout: &metav1.Duration{Duration: time.Minute}}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "output retry duration out of range",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: testPipelines,
+					Outputs:   []loggingv1.OutputSpec{{Name: "loki", Type: loggingv1.OutputTypeLoki, URL: "https://loki:3100"}},
+				},
+				OutputOptions: []v1alpha1.OutputOptions{{Name: "loki", MinRetryDuration: &metav1.Duration{Duration: time.Millisecond}}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "output min retry duration longer than the max",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: testPipelines,
+					Outputs:   []loggingv1.OutputSpec{{Name: "loki", Type: loggingv1.OutputTypeLoki, URL: "https://loki:3100"}},
+				},
+				OutputOptions: []v1alpha1.OutputOptions{{
+					Name:             "loki",
+					MinRetryDuration: &metav1.Duration{Duration: time.Minute},
+					MaxRetryDuration: &metav1.Duration{Duration: time.Second},
+				}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "output max write in range",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: testPipelines,
+					Outputs:   []loggingv1.OutputSpec{{Name: "loki", Type: loggingv1.OutputTypeLoki, URL: "https://loki:3100"}},
+				},
+				OutputOptions: []v1alpha1.OutputOptions{{Name: "loki", MaxWrite: resource.NewQuantity(10*1024*1024, resource.BinarySI)}},
+			},
+			expectErr: false,
+		},
+		{
+			name: "output max write below the range",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: testPipelines,
+					Outputs:   []loggingv1.OutputSpec{{Name: "loki", Type: loggingv1.OutputTypeLoki, URL: "https://loki:3100"}},
+				},
+				OutputOptions: []v1alpha1.OutputOptions{{Name: "loki", MaxWrite: resource.NewQuantity(512, resource.BinarySI)}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "output max write above the range",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: testPipelines,
+					Outputs:   []loggingv1.OutputSpec{{Name: "loki", Type: loggingv1.OutputTypeLoki, URL: "https://loki:3100"}},
+				},
+				OutputOptions: []v1alpha1.OutputOptions{{Name: "loki", MaxWrite: resource.NewQuantity(64*1024*1024, resource.BinarySI)}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "invalid multiline pipeline pattern",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template:  loggingv1.ClusterLogForwarderSpec{Pipelines: testPipelines},
+				Multiline: &v1alpha1.MultilineOptions{Enabled: true, PipelinePatterns: []string{"app-("}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "valid multiline pipeline pattern",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template:  loggingv1.ClusterLogForwarderSpec{Pipelines: testPipelines},
+				Multiline: &v1alpha1.MultilineOptions{Enabled: true, PipelinePatterns: []string{"^app-.*$"}},
+			},
+			expectErr: false,
+		},
+		{
+			name: "platform output already defined in the template",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: testPipelines,
+					Outputs:   []loggingv1.OutputSpec{{Name: "cloud", Type: "loki", URL: "https://loki:3100"}},
+				},
+				PlatformOutputs: []v1alpha1.PlatformOutputs{{
+					Platform: "AWS",
+					Outputs:  []loggingv1.OutputSpec{{Name: "cloud", Type: "cloudwatch"}},
+				}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "valid azure monitor output",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: testPipelines,
+					Outputs:   []loggingv1.OutputSpec{azureMonitorOutput("workspace", "hypershift", "azure-secret")},
+				},
+			},
+			expectErr: false,
+		},
+		{
+			name: "azure monitor output without workspace ID",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: testPipelines,
+					Outputs:   []loggingv1.OutputSpec{azureMonitorOutput("", "hypershift", "azure-secret")},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "azure monitor output without log type",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: testPipelines,
+					Outputs:   []loggingv1.OutputSpec{azureMonitorOutput("workspace", "", "azure-secret")},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "azure monitor output without shared key secret",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: testPipelines,
+					Outputs:   []loggingv1.OutputSpec{azureMonitorOutput("workspace", "hypershift", "")},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "azure monitor output with the default secret",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: testPipelines,
+					Outputs:   []loggingv1.OutputSpec{azureMonitorOutput("workspace", "hypershift", "")},
+				},
+				OutputDefaults: &v1alpha1.OutputDefaults{Secret: &loggingv1.OutputSecretSpec{Name: "azure-secret"}},
+			},
+			expectErr: false,
+		},
+		{
+			name: "TLS on insecure URL",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: testPipelines,
+					Outputs: []loggingv1.OutputSpec{{
+						Name: "es",
+						Type: "elasticsearch",
+						URL:  "http://es:9200",
+						TLS:  &loggingv1.OutputTLSSpec{InsecureSkipVerify: true},
+					}},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "fallback output",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: testPipelines,
+					Outputs: []loggingv1.OutputSpec{
+						{Name: "loki", Type: "loki", URL: "https://loki:3100"},
+						{Name: "archive", Type: "http", URL: "https://archive:8443"},
+					},
+				},
+				OutputOptions: []v1alpha1.OutputOptions{{Name: "loki", Fallback: "archive"}},
+			},
+			expectErr: false,
+		},
+		{
+			name: "unknown fallback output",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: testPipelines,
+					Outputs:   []loggingv1.OutputSpec{{Name: "loki", Type: "loki", URL: "https://loki:3100"}},
+				},
+				OutputOptions: []v1alpha1.OutputOptions{{Name: "loki", Fallback: "archive"}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "chained fallback outputs",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: testPipelines,
+					Outputs: []loggingv1.OutputSpec{
+						{Name: "loki", Type: "loki", URL: "https://loki:3100"},
+						{Name: "archive", Type: "http", URL: "https://archive:8443"},
+						{Name: "es", Type: "elasticsearch", URL: "https://es:9200"},
+					},
+				},
+				OutputOptions: []v1alpha1.OutputOptions{
+					{Name: "loki", Fallback: "archive"},
+					{Name: "archive", Fallback: "es"},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "pipeline labels",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: []loggingv1.PipelineSpec{{Name: "audit", InputRefs: []string{"audit"}, OutputRefs: []string{"default"}}},
+				},
+				PipelineOptions: []v1alpha1.PipelineOptions{{Name: "audit", Labels: map[string]string{"data_classification": "restricted"}}},
+			},
+			expectErr: false,
+		},
+		{
+			name: "pipeline label with an invalid key",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: []loggingv1.PipelineSpec{{Name: "audit", InputRefs: []string{"audit"}, OutputRefs: []string{"default"}}},
+				},
+				PipelineOptions: []v1alpha1.PipelineOptions{{Name: "audit", Labels: map[string]string{"data classification": "restricted"}}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "pipeline label with an invalid value",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: []loggingv1.PipelineSpec{{Name: "audit", InputRefs: []string{"audit"}, OutputRefs: []string{"default"}}},
+				},
+				PipelineOptions: []v1alpha1.PipelineOptions{{Name: "audit", Labels: map[string]string{"data_classification": "restricted/pii"}}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "transforms",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{Pipelines: testPipelines},
+				Transforms: &v1alpha1.TransformOptions{
+					AddFields:    map[string]string{"datacenter": "eu-west-1a"},
+					RemoveFields: []string{".kubernetes.annotations", `.kubernetes.labels."app.kubernetes.io/secret"`},
+				},
+			},
+			expectErr: false,
+		},
+		{
+			name: "transforms adding an invalid field",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template:   loggingv1.ClusterLogForwarderSpec{Pipelines: testPipelines},
+				Transforms: &v1alpha1.TransformOptions{AddFields: map[string]string{"data center": "eu"}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "transforms removing an invalid field path",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template:   loggingv1.ClusterLogForwarderSpec{Pipelines: testPipelines},
+				Transforms: &v1alpha1.TransformOptions{RemoveFields: []string{"kubernetes.annotations"}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "transforms removing a required field",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template:   loggingv1.ClusterLogForwarderSpec{Pipelines: testPipelines},
+				Transforms: &v1alpha1.TransformOptions{RemoveFields: []string{".message"}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "invalid system namespace pattern",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template:         loggingv1.ClusterLogForwarderSpec{Pipelines: testPipelines},
+				SystemNamespaces: &v1alpha1.SystemNamespacesOptions{Add: []string{"*-system"}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "namespace rate limit",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template:            loggingv1.ClusterLogForwarderSpec{Pipelines: testPipelines},
+				NamespaceRateLimits: []v1alpha1.NamespaceRateLimit{{Name: "noisy-app", Namespace: "noisy", MaxRecordsPerSecond: 100}},
+			},
+			expectErr: false,
+		},
+		{
+			name: "namespace rate limit without rate",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template:            loggingv1.ClusterLogForwarderSpec{Pipelines: testPipelines},
+				NamespaceRateLimits: []v1alpha1.NamespaceRateLimit{{Name: "noisy-app", Namespace: "noisy", MaxRecordsPerSecond: 0}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "namespace rate limit of an invalid namespace",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template:            loggingv1.ClusterLogForwarderSpec{Pipelines: testPipelines},
+				NamespaceRateLimits: []v1alpha1.NamespaceRateLimit{{Name: "noisy-app", Namespace: "Noisy_NS", MaxRecordsPerSecond: 100}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "namespace rate limited twice",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{Pipelines: testPipelines},
+				NamespaceRateLimits: []v1alpha1.NamespaceRateLimit{
+					{Name: "noisy-app", Namespace: "noisy", MaxRecordsPerSecond: 100},
+					{Name: "noisy-app-2", Namespace: "noisy", MaxRecordsPerSecond: 200},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "namespace rate limit named as a collection source",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template:            loggingv1.ClusterLogForwarderSpec{Pipelines: testPipelines},
+				CollectionSources:   []v1alpha1.CollectionSource{{Name: "journal", Type: "infrastructure", Sources: []string{"node"}}},
+				NamespaceRateLimits: []v1alpha1.NamespaceRateLimit{{Name: "journal", Namespace: "noisy", MaxRecordsPerSecond: 100}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "pod selector",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template:     loggingv1.ClusterLogForwarderSpec{Pipelines: testPipelines},
+				PodSelectors: []v1alpha1.PodSelector{{Name: "tenant-a", MatchLabels: map[string]string{"tenant": "a"}, Namespaces: []string{"web"}}},
+			},
+			expectErr: false,
+		},
+		{
+			name: "pod selector without labels",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template:     loggingv1.ClusterLogForwarderSpec{Pipelines: testPipelines},
+				PodSelectors: []v1alpha1.PodSelector{{Name: "tenant-a"}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "pod selector of an invalid label",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template:     loggingv1.ClusterLogForwarderSpec{Pipelines: testPipelines},
+				PodSelectors: []v1alpha1.PodSelector{{Name: "tenant-a", MatchLabels: map[string]string{"tenant/a/b": "a"}}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "pod selector of an invalid label value",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template:     loggingv1.ClusterLogForwarderSpec{Pipelines: testPipelines},
+				PodSelectors: []v1alpha1.PodSelector{{Name: "tenant-a", MatchLabels: map[string]string{"tenant": "a b"}}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "pod selector of an invalid namespace",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template:     loggingv1.ClusterLogForwarderSpec{Pipelines: testPipelines},
+				PodSelectors: []v1alpha1.PodSelector{{Name: "tenant-a", MatchLabels: map[string]string{"tenant": "a"}, Namespaces: []string{"Web_NS"}}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "pod selector named as a namespace rate limit",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template:            loggingv1.ClusterLogForwarderSpec{Pipelines: testPipelines},
+				NamespaceRateLimits: []v1alpha1.NamespaceRateLimit{{Name: "noisy-app", Namespace: "noisy", MaxRecordsPerSecond: 100}},
+				PodSelectors:        []v1alpha1.PodSelector{{Name: "noisy-app", MatchLabels: map[string]string{"tenant": "a"}}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "pod selector of a reserved name",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template:     loggingv1.ClusterLogForwarderSpec{Pipelines: testPipelines},
+				PodSelectors: []v1alpha1.PodSelector{{Name: loggingv1.InputNameApplication, MatchLabels: map[string]string{"tenant": "a"}}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "output secret by reference",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: testPipelines,
+					Outputs: []loggingv1.OutputSpec{{
+						Name:   "cloudwatch",
+						Type:   loggingv1.OutputTypeCloudwatch,
+						Secret: &loggingv1.OutputSecretSpec{Name: "cloudwatch-credentials"},
+					}},
+				},
+				OutputOptions: []v1alpha1.OutputOptions{{Name: "cloudwatch", SecretByReference: true}},
+			},
+			expectErr: false,
+		},
+		{
+			name: "output secret by reference from the defaults",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: testPipelines,
+					Outputs:   []loggingv1.OutputSpec{{Name: "cloudwatch", Type: loggingv1.OutputTypeCloudwatch}},
+				},
+				OutputDefaults: &v1alpha1.OutputDefaults{Secret: &loggingv1.OutputSecretSpec{Name: "cloudwatch-credentials"}},
+				OutputOptions:  []v1alpha1.OutputOptions{{Name: "cloudwatch", SecretByReference: true}},
+			},
+			expectErr: false,
+		},
+		{
+			name: "output secret by reference without secret",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: testPipelines,
+					Outputs:   []loggingv1.OutputSpec{{Name: "cloudwatch", Type: loggingv1.OutputTypeCloudwatch}},
+				},
+				OutputOptions: []v1alpha1.OutputOptions{{Name: "cloudwatch", SecretByReference: true}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "output secret by reference copied from a namespace",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Pipelines: testPipelines,
+					Outputs: []loggingv1.OutputSpec{{
+						Name:   "cloudwatch",
+						Type:   loggingv1.OutputTypeCloudwatch,
+						Secret: &loggingv1.OutputSecretSpec{Name: "cloudwatch-credentials"},
+					}},
+				},
+				OutputOptions: []v1alpha1.OutputOptions{{Name: "cloudwatch", SecretByReference: true, SecretNamespace: "team-a"}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "journald collection source",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template:          loggingv1.ClusterLogForwarderSpec{Pipelines: testPipelines},
+				CollectionSources: []v1alpha1.CollectionSource{{Name: "journal", Type: "infrastructure", Sources: []string{"node"}}},
+			},
+			expectErr: false,
+		},
+		{
+			name: "collection source of a host path",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template:          loggingv1.ClusterLogForwarderSpec{Pipelines: testPipelines},
+				CollectionSources: []v1alpha1.CollectionSource{{Name: "secure", Type: "infrastructure", Sources: []string{"/var/log/secure"}}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "collection source of another type",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template:          loggingv1.ClusterLogForwarderSpec{Pipelines: testPipelines},
+				CollectionSources: []v1alpha1.CollectionSource{{Name: "journal", Type: "audit", Sources: []string{"node"}}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "collection source with a reserved name",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template:          loggingv1.ClusterLogForwarderSpec{Pipelines: testPipelines},
+				CollectionSources: []v1alpha1.CollectionSource{{Name: InputHTTPServerName, Type: "audit", Sources: []string{"kubeAPI"}}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "collection source with the name of the network logs",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template:          loggingv1.ClusterLogForwarderSpec{Pipelines: testPipelines},
+				CollectionSources: []v1alpha1.CollectionSource{{Name: InputNetworkLogsName, Type: "audit", Sources: []string{"ovn"}}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "CA bundle from a secret",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{Pipelines: testPipelines},
+				CABundle: &v1alpha1.CABundleReference{SecretName: "ca"},
+			},
+			expectErr: false,
+		},
+		{
+			name: "CA bundle from both a secret and a ConfigMap",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{Pipelines: testPipelines},
+				CABundle: &v1alpha1.CABundleReference{SecretName: "ca", ConfigMapName: "ca"},
+			},
+			expectErr: true,
+		},
+		{
+			name: "CA bundle without reference",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{Pipelines: testPipelines},
+				CABundle: &v1alpha1.CABundleReference{Key: "ca.crt"},
+			},
+			expectErr: true,
+		},
+		{
+			name: "environments tuning the outputs",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: environmentSpec,
+				Environments: []v1alpha1.EnvironmentTuning{
+					{Environment: "prod", OutputOptions: []v1alpha1.OutputOptions{{Name: "kafka", MaxWrite: resource.NewQuantity(8<<20, resource.BinarySI)}}},
+					{Environment: "dev", OutputDefaults: &v1alpha1.OutputDefaults{Limit: &loggingv1.LimitSpec{MaxRecordsPerSecond: 10}}},
+				},
+			},
+			expectErr: false,
+		},
+		{
+			name: "environment without name",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template:     environmentSpec,
+				Environments: []v1alpha1.EnvironmentTuning{{}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "environment not a label value",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template:     environmentSpec,
+				Environments: []v1alpha1.EnvironmentTuning{{Environment: "prod/eu"}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "environment defined twice",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template:     environmentSpec,
+				Environments: []v1alpha1.EnvironmentTuning{{Environment: "prod"}, {Environment: "prod"}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "environment with an invalid max write",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: environmentSpec,
+				Environments: []v1alpha1.EnvironmentTuning{
+					{Environment: "prod", OutputOptions: []v1alpha1.OutputOptions{{Name: "kafka", MaxWrite: resource.NewQuantity(1, resource.BinarySI)}}},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "environment tuning an unknown output",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: environmentSpec,
+				Environments: []v1alpha1.EnvironmentTuning{
+					{Environment: "prod", OutputOptions: []v1alpha1.OutputOptions{{Name: "unknown", Compression: "gzip"}}},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "self-test of a loki output",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: selfTestSpec,
+				HCPAudit: &v1alpha1.HCPAuditOptions{Enabled: true},
+				SelfTest: &v1alpha1.SelfTestOptions{Enabled: true, Output: "loki", Interval: &metav1.Duration{Duration: time.Hour}},
+			},
+			expectErr: false,
+		},
+		{
+			name: "self-test disabled",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{Pipelines: testPipelines},
+				SelfTest: &v1alpha1.SelfTestOptions{Output: "unknown"},
+			},
+			expectErr: false,
+		},
+		{
+			name: "self-test without the hosted control plane audit",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: appOnlySpec,
+				SelfTest: &v1alpha1.SelfTestOptions{Enabled: true, Output: "loki"},
+			},
+			expectErr: true,
+		},
+		{
+			name: "self-test of an unknown output",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: selfTestSpec,
+				HCPAudit: &v1alpha1.HCPAuditOptions{Enabled: true},
+				SelfTest: &v1alpha1.SelfTestOptions{Enabled: true, Output: "unknown"},
+			},
+			expectErr: true,
+		},
+		{
+			name: "self-test of an output without query API",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: selfTestSpec,
+				HCPAudit: &v1alpha1.HCPAuditOptions{Enabled: true},
+				SelfTest: &v1alpha1.SelfTestOptions{Enabled: true, Output: "kafka"},
+			},
+			expectErr: true,
+		},
+		{
+			name: "self-test of an output not forwarded the audit logs",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: appOnlySpec,
+				HCPAudit: &v1alpha1.HCPAuditOptions{Enabled: true},
+				SelfTest: &v1alpha1.SelfTestOptions{Enabled: true, Output: "loki"},
+			},
+			expectErr: true,
+		},
+		{
+			name: "self-test interval too short",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: selfTestSpec,
+				HCPAudit: &v1alpha1.HCPAuditOptions{Enabled: true},
+				SelfTest: &v1alpha1.SelfTestOptions{Enabled: true, Output: "loki", Interval: &metav1.Duration{Duration: time.Minute}},
+			},
+			expectErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateTemplate(&v1alpha1.ClusterLogForwarderTemplate{Spec: test.spec})
+			if test.expectErr && err == nil {
+				t.Error("expected err, got nil")
+			}
+			if !test.expectErr && err != nil {
+				t.Errorf("expected no err, got %v", err)
+			}
+		})
+	}
+}
+
+func TestOrphanedOutputs(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     v1alpha1.ClusterLogForwarderTemplateSpec
+		expected []string
+	}{
+		{
+			name: "every output referenced",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Outputs:   []loggingv1.OutputSpec{{Name: "loki", Type: "loki"}},
+					Pipelines: []loggingv1.PipelineSpec{{InputRefs: []string{"application"}, OutputRefs: []string{"loki"}}},
+				},
+			},
+		},
+		{
+			name: "orphaned template and platform outputs",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Outputs: []loggingv1.OutputSpec{{Name: "loki", Type: "loki"}, {Name: "unused", Type: "loki"}},
+					Pipelines: []loggingv1.PipelineSpec{
+						{InputRefs: []string{"application"}, OutputRefs: []string{"loki", "cloudwatch"}},
+					},
+				},
+				PlatformOutputs: []v1alpha1.PlatformOutputs{
+					{Platform: "AWS", Outputs: []loggingv1.OutputSpec{{Name: "cloudwatch", Type: "cloudwatch"}}},
+					{Platform: "Azure", Outputs: []loggingv1.OutputSpec{{Name: "azure", Type: "azureMonitor"}}},
+				},
+			},
+			expected: []string{"unused", "azure"},
+		},
+		{
+			name: "output referenced as a fallback",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Outputs:   []loggingv1.OutputSpec{{Name: "loki", Type: "loki"}, {Name: "backup", Type: "loki"}},
+					Pipelines: []loggingv1.PipelineSpec{{InputRefs: []string{"application"}, OutputRefs: []string{"loki"}}},
+				},
+				OutputOptions: []v1alpha1.OutputOptions{{Name: "loki", Fallback: "backup"}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			template := &v1alpha1.ClusterLogForwarderTemplate{Spec: test.spec}
+			if orphaned := OrphanedOutputs(template); !reflect.DeepEqual(orphaned, test.expected) {
+				t.Errorf("mismatched orphaned outputs, expected %v, got %v", test.expected, orphaned)
+			}
+			if err := ValidateOrphanedOutputs(template); (err != nil) != (len(test.expected) > 0) {
+				t.Errorf("mismatched validation of the orphaned outputs %v, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestDisabledOutputs(t *testing.T) {
+	disabled := false
+	tests := []struct {
+		name     string
+		spec     v1alpha1.ClusterLogForwarderTemplateSpec
+		expected map[string]bool
+	}{
+		{
+			name: "every pipeline enabled",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Outputs:   []loggingv1.OutputSpec{{Name: "loki", Type: "loki"}},
+					Pipelines: []loggingv1.PipelineSpec{{Name: "app", InputRefs: []string{"application"}, OutputRefs: []string{"loki"}}},
+				},
+			},
+			expected: map[string]bool{},
+		},
+		{
+			name: "output and fallback of a disabled pipeline",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Outputs: []loggingv1.OutputSpec{{Name: "es", Type: "elasticsearch"}, {Name: "backup", Type: "loki"}},
+					Pipelines: []loggingv1.PipelineSpec{
+						{Name: "audit", InputRefs: []string{"audit"}, OutputRefs: []string{"es"}},
+					},
+				},
+				OutputOptions:   []v1alpha1.OutputOptions{{Name: "es", Fallback: "backup"}},
+				PipelineOptions: []v1alpha1.PipelineOptions{{Name: "audit", Enabled: &disabled}},
+			},
+			expected: map[string]bool{"es": true, "backup": true},
+		},
+		{
+			name: "output also referenced by an enabled pipeline",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Outputs: []loggingv1.OutputSpec{{Name: "loki", Type: "loki"}, {Name: "es", Type: "elasticsearch"}},
+					Pipelines: []loggingv1.PipelineSpec{
+						{Name: "app", InputRefs: []string{"application"}, OutputRefs: []string{"loki"}},
+						{Name: "audit", InputRefs: []string{"audit"}, OutputRefs: []string{"loki", "es"}},
+					},
+				},
+				PipelineOptions: []v1alpha1.PipelineOptions{{Name: "audit", Enabled: &disabled}},
+			},
+			expected: map[string]bool{"es": true},
+		},
+		{
+			name: "orphaned output is not disabled",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{
+					Outputs: []loggingv1.OutputSpec{{Name: "unused", Type: "loki"}},
+				},
+			},
+			expected: map[string]bool{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			template := &v1alpha1.ClusterLogForwarderTemplate{Spec: test.spec}
+			if got := DisabledOutputs(template); !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("mismatched disabled outputs, expected %v, got %v", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestValidateSecretNamespaces(t *testing.T) {
+	tests := []struct {
+		name          string
+		outputOptions []v1alpha1.OutputOptions
+		environments  []v1alpha1.EnvironmentTuning
+		expectErr     bool
+	}{
+		{
+			name:          "template namespace",
+			outputOptions: []v1alpha1.OutputOptions{{Name: "loki", SecretNamespace: constants.OperatorNamespace}},
+		},
+		{
+			name:          "secret namespace of the operator",
+			outputOptions: []v1alpha1.OutputOptions{{Name: "loki", SecretNamespace: "team-a"}},
+		},
+		{
+			name:          "unknown namespace",
+			outputOptions: []v1alpha1.OutputOptions{{Name: "loki", SecretNamespace: "kube-system"}},
+			expectErr:     true,
+		},
+		{
+			name: "unknown namespace of an environment",
+			environments: []v1alpha1.EnvironmentTuning{{
+				Environment:   "prod",
+				OutputOptions: []v1alpha1.OutputOptions{{Name: "loki", SecretNamespace: "kube-system"}},
+			}},
+			expectErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			template := &v1alpha1.ClusterLogForwarderTemplate{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: constants.OperatorNamespace},
+				Spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+					Template: loggingv1.ClusterLogForwarderSpec{
+						Outputs: []loggingv1.OutputSpec{{
+							Name:   "loki",
+							Type:   loggingv1.OutputTypeLoki,
+							Secret: &loggingv1.OutputSecretSpec{Name: "loki-credentials"},
+						}},
+					},
+					OutputOptions: test.outputOptions,
+					Environments:  test.environments,
+				},
+			}
+			err := ValidateSecretNamespaces(template, []string{"team-a", "team-b"})
+			if test.expectErr && err == nil {
+				t.Error("expected err, got nil")
+			}
+			if !test.expectErr && err != nil {
+				t.Errorf("expected no err, got %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateLimits(t *testing.T) {
+	outputs := func(prefix string, n int) []loggingv1.OutputSpec {
+		var outputs []loggingv1.OutputSpec
+		for i := 0; i < n; i++ {
+			outputs = append(outputs, loggingv1.OutputSpec{Name: fmt.Sprintf("%s-%d", prefix, i), Type: "loki", URL: "https://loki:3100"})
+		}
+		return outputs
+	}
+	pipelines := func(n int) []loggingv1.PipelineSpec {
+		var pipelines []loggingv1.PipelineSpec
+		for i := 0; i < n; i++ {
+			pipelines = append(pipelines, loggingv1.PipelineSpec{Name: fmt.Sprintf("app-%d", i), InputRefs: []string{"application"}})
+		}
+		return pipelines
+	}
+	limits := Limits{MaxOutputs: 3, MaxPipelines: 2, MaxSize: 1024}
+	disabled := false
+
+	tests := []struct {
+		name      string
+		spec      v1alpha1.ClusterLogForwarderTemplateSpec
+		limits    Limits
+		expectErr bool
+	}{
+		{
+			name: "within the limits",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{Outputs: outputs("out", 2), Pipelines: pipelines(2)},
+			},
+			limits:    limits,
+			expectErr: false,
+		},
+		{
+			name: "too many outputs",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{Outputs: outputs("out", 4)},
+			},
+			limits:    limits,
+			expectErr: true,
+		},
+		{
+			name: "too many outputs with the platform outputs",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{Outputs: outputs("out", 2)},
+				PlatformOutputs: []v1alpha1.PlatformOutputs{
+					{Platform: "AWS", Outputs: outputs("aws", 1)},
+					{Platform: "Azure", Outputs: outputs("azure", 2)},
+				},
+			},
+			limits:    limits,
+			expectErr: true,
+		},
+		{
+			name: "too many pipelines",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{Pipelines: pipelines(3)},
+			},
+			limits:    limits,
+			expectErr: true,
+		},
+		{
+			name: "disabled pipelines not counted",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template:        loggingv1.ClusterLogForwarderSpec{Pipelines: pipelines(3)},
+				PipelineOptions: []v1alpha1.PipelineOptions{{Name: "app-0", Enabled: &disabled}},
+			},
+			limits:    limits,
+			expectErr: false,
+		},
+		{
+			name: "no limits",
+			spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+				Template: loggingv1.ClusterLogForwarderSpec{Outputs: outputs("out", 100), Pipelines: pipelines(100)},
+			},
+			expectErr: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateLimits(&v1alpha1.ClusterLogForwarderTemplate{Spec: test.spec}, test.limits)
+			if test.expectErr && err == nil {
+				t.Error("expected err, got nil")
+			}
+			if !test.expectErr && err != nil {
+				t.Errorf("expected no err, got %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateSize(t *testing.T) {
+	limits := Limits{MaxSize: 1024}
+	output := func(url string) *loggingv1.ClusterLogForwarder {
+		return &loggingv1.ClusterLogForwarder{Spec: loggingv1.ClusterLogForwarderSpec{
+			Outputs: []loggingv1.OutputSpec{{Name: "http", Type: "http", URL: url}},
+		}}
+	}
+
+	tests := []struct {
+		name      string
+		clf       *loggingv1.ClusterLogForwarder
+		limits    Limits
+		expectErr bool
+	}{
+		{
+			name:   "within the limit",
+			clf:    output("https://http.example.com/"),
+			limits: limits,
+		},
+		{
+			name:      "too large",
+			clf:       output("https://http.example.com/" + strings.Repeat("a", 1024)),
+			limits:    limits,
+			expectErr: true,
+		},
+		{
+			name: "no limit",
+			clf:  output("https://http.example.com/" + strings.Repeat("a", 1024)),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateSize(test.clf, test.limits)
+			if test.expectErr && err == nil {
+				t.Error("expected err, got nil")
+			}
+			if !test.expectErr && err != nil {
+				t.Errorf("expected no err, got %v", err)
+			}
+		})
+	}
+}
+
+func TestBuildOutputsFromTemplateAzureMonitor(t *testing.T) {
+	template := &v1alpha1.ClusterLogForwarderTemplate{
+		Spec: v1alpha1.ClusterLogForwarderTemplateSpec{
+			Template: loggingv1.ClusterLogForwarderSpec{
+				Outputs: []loggingv1.OutputSpec{azureMonitorOutput("workspace", "hypershift", "azure-secret")},
+			},
+		},
+	}
+
+	clf := BuildOutputsFromTemplate(template, &loggingv1.ClusterLogForwarder{})
+
+	expected := []loggingv1.OutputSpec{azureMonitorOutput("workspace", "hypershift", "azure-secret")}
+	if !reflect.DeepEqual(clf.Spec.Outputs, expected) {
+		t.Errorf("mismatched outputs, expected %v, got %v", expected, clf.Spec.Outputs)
+	}
+}
+
+func azureMonitorOutput(customerID string, logType string, secret string) loggingv1.OutputSpec {
+	output := loggingv1.OutputSpec{
+		Name: "azure",
+		Type: loggingv1.OutputTypeAzureMonitor,
+		OutputTypeSpec: loggingv1.OutputTypeSpec{
+			AzureMonitor: &loggingv1.AzureMonitor{CustomerId: customerID, LogType: logType},
+		},
+	}
+	if secret != "" {
+		output.Secret = &loggingv1.OutputSecretSpec{Name: secret}
+	}
+	return output
+}
+
+func TestSubstituteValues(t *testing.T) {
+	tests := []struct {
+		name            string
+		values          map[string]string
+		expectedURL     string
+		expectedTopic   string
+		expectedMissing []string
+	}{
+		{
+			name:          "tokens substituted",
+			values:        map[string]string{"tenant": "acme", "index": "audit-acme"},
+			expectedURL:   "https://acme.loki.example.com:3100",
+			expectedTopic: "audit-acme",
+		},
+		{
+			name:          "values escaped",
+			values:        map[string]string{"tenant": "acme", "index": `audit"\`},
+			expectedURL:   "https://acme.loki.example.com:3100",
+			expectedTopic: `audit"\`,
+		},
+		{
+			name:            "missing keys left intact",
+			values:          map[string]string{"tenant": "acme"},
+			expectedURL:     "https://acme.loki.example.com:3100",
+			expectedTopic:   "${index}",
+			expectedMissing: []string{"index"},
+		},
+		{
+			name:            "no values",
+			expectedURL:     "https://${tenant}.loki.example.com:3100",
+			expectedTopic:   "${index}",
+			expectedMissing: []string{"index", "tenant"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clf := &loggingv1.ClusterLogForwarder{
+				Spec: loggingv1.ClusterLogForwarderSpec{
+					Outputs: []loggingv1.OutputSpec{
+						{Name: "loki", Type: "loki", URL: "https://${tenant}.loki.example.com:3100"},
+						{Name: "kafka", Type: "kafka", OutputTypeSpec: loggingv1.OutputTypeSpec{
+							Kafka: &loggingv1.Kafka{Topic: "${index}"},
+						}},
+					},
+				},
+			}
+
+			clf, missing, err := SubstituteValues(clf, test.values)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if clf.Spec.Outputs[0].URL != test.expectedURL {
+				t.Errorf("mismatched URL, expected %v, got %v", test.expectedURL, clf.Spec.Outputs[0].URL)
+			}
+			if clf.Spec.Outputs[1].Kafka.Topic != test.expectedTopic {
+				t.Errorf("mismatched topic, expected %v, got %v", test.expectedTopic, clf.Spec.Outputs[1].Kafka.Topic)
+			}
+			if len(missing) != len(test.expectedMissing) || (len(missing) > 0 && !reflect.DeepEqual(missing, test.expectedMissing)) {
+				t.Errorf("mismatched missing keys, expected %v, got %v", test.expectedMissing, missing)
+			}
+		})
+	}
+}
+
+func TestRenderName(t *testing.T) {
+	tests := []struct {
+		name      string
+		template  string
+		values    map[string]string
+		expected  string
+		expectErr bool
+	}{
+		{
+			name:     "static name",
+			template: "audit-forwarder",
+			expected: "audit-forwarder",
+		},
+		{
+			name:     "tokens substituted",
+			template: "${tenant}-logs-${region}",
+			values:   map[string]string{"tenant": "acme", "region": "us-east-1"},
+			expected: "acme-logs-us-east-1",
+		},
+		{
+			name:      "missing keys",
+			template:  "${tenant}-logs",
+			expectErr: true,
+		},
+		{
+			name:      "invalid rendered name",
+			template:  "${tenant}-logs",
+			values:    map[string]string{"tenant": "Acme_Corp"},
+			expectErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rendered, err := RenderName(test.template, test.values)
+			if (err != nil) != test.expectErr {
+				t.Fatalf("mismatched err, expected err %v, got %v", test.expectErr, err)
+			}
+			if rendered != test.expected {
+				t.Errorf("mismatched name, expected %v, got %v", test.expected, rendered)
+			}
+		})
+	}
+}
+
+// reviewClient answers the TokenReviews of the tokens of the users and the SubjectAccessReviews of the
+// namespaces allowed to each user
+type reviewClient struct {
+	client.Client
+	tokens  map[string]string
+	allowed map[string]map[string]bool
+}
+
+func (c *reviewClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	switch review := obj.(type) {
+	case *authenticationv1.TokenReview:
+		user, ok := c.tokens[review.Spec.Token]
+		review.Status.Authenticated = ok
+		review.Status.User = authenticationv1.UserInfo{Username: user}
+		return nil
+	case *authorizationv1.SubjectAccessReview:
+		review.Status.Allowed = c.allowed[review.Spec.User][review.Spec.ResourceAttributes.Namespace]
+		return nil
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func TestEffectiveConfigHandler(t *testing.T) {
+	// The HCP namespace recorded on the HostedCluster is not the conventional one
+	const hcpNamespace = "hcp-test"
+	managed := func(name string, sourceLabel string, spec loggingv1.ClusterLogForwarderSpec) *loggingv1.ClusterLogForwarder {
+		return &loggingv1.ClusterLogForwarder{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: hcpNamespace, Labels: ManagedLabels(sourceLabel, name)},
+			Spec:       spec,
+		}
+	}
+	audit := managed("audit", constants.TemplateLabel, loggingv1.ClusterLogForwarderSpec{
+		Inputs:    []loggingv1.InputSpec{InputHTTPServerSpec},
+		Outputs:   []loggingv1.OutputSpec{{Name: "es", Type: "elasticsearch", URL: "https://user:secret@es:9200"}},
+		Pipelines: []loggingv1.PipelineSpec{{Name: "audit", InputRefs: []string{InputHTTPServerName}, OutputRefs: []string{"es"}}},
+	})
+	infra := managed("infra", constants.TemplateLabel, loggingv1.ClusterLogForwarderSpec{
+		Inputs: []loggingv1.InputSpec{InputHTTPServerSpec},
+		Outputs: []loggingv1.OutputSpec{{
+			Name:           "http",
+			Type:           "http",
+			URL:            "https://collector:8443",
+			OutputTypeSpec: loggingv1.OutputTypeSpec{Http: &loggingv1.Http{Headers: map[string]string{"Authorization": "Bearer token"}}},
+		}},
+		Pipelines: []loggingv1.PipelineSpec{{Name: "infra", InputRefs: []string{InputHTTPServerName}, OutputRefs: []string{"http"}}},
+	})
+	instance := managed("instance", constants.HyperShiftLogForwarderLabel, loggingv1.ClusterLogForwarderSpec{
+		Outputs:   []loggingv1.OutputSpec{{Name: "cloudwatch", Type: "cloudwatch"}},
+		Pipelines: []loggingv1.PipelineSpec{{Name: "guest", InputRefs: []string{"audit"}, OutputRefs: []string{"cloudwatch"}}},
+	})
+	unmanaged := &loggingv1.ClusterLogForwarder{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: hcpNamespace}}
+	hostedCluster := &hyperv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{
+		Name:        "test",
+		Namespace:   "clusters",
+		Annotations: map[string]string{constants.HCPNamespaceAnnotation: hcpNamespace},
+	}}
+	unknown := &hyperv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: "unknown", Namespace: "clusters"}}
+
+	scheme := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{loggingv1.AddToScheme, hyperv1beta1.AddToScheme} {
+		if err := add(scheme); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := &reviewClient{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(instance, infra, audit, unmanaged, hostedCluster, unknown).Build(),
+		tokens: map[string]string{"admin-token": "admin", "user-token": "user", "guest-token": "guest"},
+		allowed: map[string]map[string]bool{
+			"admin": {"clusters": true, hcpNamespace: true, "clusters-unknown": true},
+			// The user may read the HostedCluster but not its ClusterLogForwarders
+			"user": {"clusters": true},
+		},
+	}
+	handler := EffectiveConfigHandler(c, c)
+	get := func(cluster string, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, EffectiveConfigPath+"?cluster="+cluster, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	for _, tt := range []struct {
+		name           string
+		token          string
+		expectedStatus int
+	}{
+		{name: "no token", expectedStatus: http.StatusUnauthorized},
+		{name: "unknown token", token: "unknown", expectedStatus: http.StatusUnauthorized},
+		{name: "user not allowed to get the HostedCluster", token: "guest-token", expectedStatus: http.StatusForbidden},
+		{name: "user not allowed to list the ClusterLogForwarders", token: "user-token", expectedStatus: http.StatusForbidden},
+	} {
+		if recorder := get("clusters/test", tt.token); recorder.Code != tt.expectedStatus {
+			t.Errorf("%s: mismatched status, expected %v, got %v", tt.name, tt.expectedStatus, recorder.Code)
+		}
+	}
+
+	recorder := get("clusters/test", "admin-token")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("mismatched status, expected %v, got %v: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+	config := &EffectiveConfig{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), config); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedSources := []string{"audit", "infra", "instance"}
+	if !reflect.DeepEqual(config.Sources, expectedSources) {
+		t.Errorf("mismatched sources, expected %v, got %v", expectedSources, config.Sources)
+	}
+	if len(config.Spec.Inputs) != 1 {
+		t.Errorf("mismatched inputs, expected %v, got %v", 1, len(config.Spec.Inputs))
+	}
+	var pipelines []string
+	for _, ppl := range config.Spec.Pipelines {
+		pipelines = append(pipelines, ppl.Name)
+	}
+	if expected := []string{"audit", "infra", "guest"}; !reflect.DeepEqual(pipelines, expected) {
+		t.Errorf("mismatched pipelines, expected %v, got %v", expected, pipelines)
+	}
+	if len(config.Spec.Outputs) != 3 {
+		t.Fatalf("mismatched outputs, expected %v, got %v", 3, len(config.Spec.Outputs))
+	}
+	if expected := "https://user:" + RedactedValue + "@es:9200"; config.Spec.Outputs[0].URL != expected {
+		t.Errorf("mismatched URL, expected %v, got %v", expected, config.Spec.Outputs[0].URL)
+	}
+	if got := config.Spec.Outputs[1].Http.Headers["Authorization"]; got != RedactedValue {
+		t.Errorf("mismatched header, expected %v, got %v", RedactedValue, got)
+	}
+	if strings.Contains(recorder.Body.String(), "secret") || strings.Contains(recorder.Body.String(), "Bearer") {
+		t.Errorf("expected the credentials to be redacted, got %s", recorder.Body.String())
+	}
+
+	if config.Namespace != hcpNamespace {
+		t.Errorf("mismatched namespace, expected %v, got %v", hcpNamespace, config.Namespace)
+	}
+
+	// The hosted clusters without a forwarder or gone are not found
+	for _, cluster := range []string{"clusters/unknown", "clusters/gone"} {
+		if recorder := get(cluster, "admin-token"); recorder.Code != http.StatusNotFound {
+			t.Errorf("mismatched status of %s, expected %v, got %v", cluster, http.StatusNotFound, recorder.Code)
+		}
+	}
+}
+
+func TestCommonMetadata(t *testing.T) {
+	tests := []struct {
+		name      string
+		metadata  CommonMetadata
+		expectErr bool
+	}{
+		{
+			name: "valid common metadata",
+			metadata: CommonMetadata{
+				Labels:      map[string]string{"team": "logging"},
+				Annotations: map[string]string{"cost-center": "1234"},
+			},
+		},
+		{
+			name:      "label colliding with the managed-by label",
+			metadata:  CommonMetadata{Labels: map[string]string{constants.ManagedByLabel: "someone"}},
+			expectErr: true,
+		},
+		{
+			name:      "annotation under the operator prefix",
+			metadata:  CommonMetadata{Annotations: map[string]string{constants.SourceAnnotation: "somewhere"}},
+			expectErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.metadata.Validate()
+			if test.expectErr && err == nil {
+				t.Error("expected err, got nil")
+			}
+			if !test.expectErr && err != nil {
+				t.Errorf("expected no err, got %v", err)
+			}
+		})
+	}
+
+	// The operator managed keys are kept when applying the common metadata
+	clf := &loggingv1.ClusterLogForwarder{}
+	clf.Labels = ManagedLabels(constants.TemplateLabel, "instance")
+	CommonMetadata{
+		Labels: map[string]string{"team": "logging", constants.TemplateLabel: "other"},
+	}.Apply(clf)
+	expected := map[string]string{
+		constants.ManagedByLabel: constants.ManagedByLabelValue,
+		constants.TemplateLabel:  "instance",
+		"team":                   "logging",
+	}
+	if !reflect.DeepEqual(clf.Labels, expected) {
+		t.Errorf("mismatched labels, expected %v, got %v", expected, clf.Labels)
+	}
+}
+
+func TestSecretReferences(t *testing.T) {
+	tests := []struct {
+		name        string
+		labels      map[string]string
+		annotations map[string]string
+		expected    []string
+	}{
+		{
+			name:     "copy without references recorded",
+			labels:   ManagedLabels(constants.TemplateLabel, "instance"),
+			expected: []string{"instance"},
+		},
+		{
+			name:        "copy shared by templates",
+			labels:      ManagedLabels(constants.TemplateLabel, "b"),
+			annotations: map[string]string{constants.ReferencedByAnnotation: "b,a"},
+			expected:    []string{"a", "b"},
+		},
+		{
+			name: "secret not copied from a template",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			secret := &metav1.ObjectMeta{Labels: test.labels, Annotations: test.annotations}
+			if references := SecretReferences(secret); !reflect.DeepEqual(references, test.expected) {
+				t.Errorf("mismatched references, expected %v, got %v", test.expected, references)
+			}
+		})
+	}
+
+	secret := &metav1.ObjectMeta{}
+	SetSecretReferences(secret, []string{"b", "a"})
+	if annotation := secret.Annotations[constants.ReferencedByAnnotation]; annotation != "a,b" {
+		t.Errorf("mismatched references annotation, expected a,b, got %s", annotation)
+	}
+}
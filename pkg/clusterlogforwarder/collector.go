@@ -0,0 +1,107 @@
+package clusterlogforwarder
+
+import (
+	"fmt"
+
+	"github.com/blang/semver/v4"
+	loggingv1 "github.com/openshift/cluster-logging-operator/apis/logging/v1"
+
+	"github.com/openshift/hypershift-logging-operator/api/v1alpha1"
+)
+
+const (
+	// CollectorTypeDaemonSet runs the collector on every node, the default of cluster-logging
+	CollectorTypeDaemonSet = "DaemonSet"
+	// CollectorTypeDeployment runs the collector as a Deployment, e.g. for the collectors only receiving
+	// the logs of the hosted control plane over HTTP
+	CollectorTypeDeployment = "Deployment"
+
+	// CollectorAsDeploymentAnnotation on a CLF makes cluster-logging deploy its collector as a Deployment
+	CollectorAsDeploymentAnnotation = "logging.openshift.io/dev-preview-enable-collector-as-deployment"
+)
+
+// MinCollectorDeploymentVersion is the first cluster-logging version deploying the collector as a Deployment
+var MinCollectorDeploymentVersion = semver.MustParse("5.8.0")
+
+// SupportsCollectorDeployment returns true if the cluster-logging version deploys the collector as a Deployment.
+// An empty version is assumed to be recent enough, an invalid one is not supported
+func SupportsCollectorDeployment(loggingVersion string) bool {
+	return supportsVersion(loggingVersion, MinCollectorDeploymentVersion)
+}
+
+// ValidateCollectorType validates the collector type of the template is supported by the cluster-logging version
+func ValidateCollectorType(template *v1alpha1.ClusterLogForwarderTemplate, loggingVersion string) error {
+	switch template.Spec.CollectorType {
+	case "", CollectorTypeDaemonSet:
+		return nil
+	case CollectorTypeDeployment:
+		if !SupportsCollectorDeployment(loggingVersion) {
+			return fmt.Errorf("collector type %s requires cluster-logging %s or later, got %s",
+				CollectorTypeDeployment, MinCollectorDeploymentVersion, loggingVersion)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported collector type %s, expected %s or %s",
+			template.Spec.CollectorType, CollectorTypeDaemonSet, CollectorTypeDeployment)
+	}
+}
+
+// BuildCollectorTypeFromTemplate annotates the CLF for its collector to run as a Deployment when the template
+// asks for it, the collector runs as a DaemonSet otherwise
+func BuildCollectorTypeFromTemplate(template *v1alpha1.ClusterLogForwarderTemplate,
+	clf *loggingv1.ClusterLogForwarder) *loggingv1.ClusterLogForwarder {
+
+	if template.Spec.CollectorType != CollectorTypeDeployment {
+		return clf
+	}
+	if clf.Annotations == nil {
+		clf.Annotations = map[string]string{}
+	}
+	clf.Annotations[CollectorAsDeploymentAnnotation] = ""
+	return clf
+}
+
+// IsCollectorDeployment returns true if the collector of the CLF runs as a Deployment
+func IsCollectorDeployment(clf *loggingv1.ClusterLogForwarder) bool {
+	_, ok := clf.Annotations[CollectorAsDeploymentAnnotation]
+	return ok
+}
+
+// CollectorLogLevelAnnotation on a CLF sets the log level of its collector, read by the cluster-logging versions
+// supporting it
+const CollectorLogLevelAnnotation = "observability.openshift.io/log-level"
+
+// CollectorLogLevels are the log levels of the collector, from the most to the least verbose
+var CollectorLogLevels = []string{"trace", "debug", "info", "warn", "error", "off"}
+
+// MinCollectorLogLevelVersion is the first cluster-logging version reading the log level of the collector
+var MinCollectorLogLevelVersion = semver.MustParse("6.0.0")
+
+// SupportsCollectorLogLevel returns true if the cluster-logging version sets the log level of the collector
+func SupportsCollectorLogLevel(loggingVersion string) bool {
+	return supportsVersion(loggingVersion, MinCollectorLogLevelVersion)
+}
+
+// ValidateCollectorLogLevel validates the collector log level of the template is one of CollectorLogLevels
+func ValidateCollectorLogLevel(template *v1alpha1.ClusterLogForwarderTemplate) error {
+	level := template.Spec.CollectorLogLevel
+	if level == "" || contains(CollectorLogLevels, level) {
+		return nil
+	}
+	return fmt.Errorf("unsupported collector log level %s, expected one of %v", level, CollectorLogLevels)
+}
+
+// BuildCollectorLogLevelFromTemplate annotates the CLF with the collector log level of the template, the
+// collector logs at the default level of cluster-logging otherwise
+func BuildCollectorLogLevelFromTemplate(template *v1alpha1.ClusterLogForwarderTemplate,
+	clf *loggingv1.ClusterLogForwarder) *loggingv1.ClusterLogForwarder {
+
+	if template.Spec.CollectorLogLevel == "" {
+		return clf
+	}
+	if clf.Annotations == nil {
+		clf.Annotations = map[string]string{}
+	}
+	clf.Annotations[CollectorLogLevelAnnotation] = template.Spec.CollectorLogLevel
+	return clf
+}
@@ -0,0 +1,220 @@
+package clusterlogforwarder
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+
+	loggingv1 "github.com/openshift/cluster-logging-operator/apis/logging/v1"
+	hyperv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/openshift/hypershift-logging-operator/pkg/constants"
+	"github.com/openshift/hypershift-logging-operator/pkg/hostedcluster"
+)
+
+const (
+	// EffectiveConfigPath is the debug endpoint serving the effective config of a hosted cluster,
+	// e.g. /debug/effective-config?cluster=clusters/test
+	EffectiveConfigPath = "/debug/effective-config"
+
+	// RedactedValue replaces the sensitive values of the effective config
+	RedactedValue = "REDACTED"
+)
+
+// EffectiveConfig is the merged configuration of the ClusterLogForwarders generated for a hosted cluster
+type EffectiveConfig struct {
+	// Namespace is the HCP namespace of the hosted cluster
+	Namespace string `json:"namespace"`
+	// Sources are the names of the ClusterLogForwarders merged into the config
+	Sources []string `json:"sources"`
+	// Spec is the merged spec, the sensitive values are redacted
+	Spec loggingv1.ClusterLogForwarderSpec `json:"spec"`
+}
+
+// BuildEffectiveConfig merges the ClusterLogForwarders of the HCP namespace, sorted by name, into a single
+// redacted config. The entries shared by several ClusterLogForwarders, e.g. the HTTP server input, are merged once
+func BuildEffectiveConfig(namespace string, clfs []loggingv1.ClusterLogForwarder) *EffectiveConfig {
+	sorted := append([]loggingv1.ClusterLogForwarder{}, clfs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	config := &EffectiveConfig{Namespace: namespace, Sources: []string{}}
+	spec := &config.Spec
+	for i := range sorted {
+		clf := sorted[i].DeepCopy()
+		config.Sources = append(config.Sources, clf.Name)
+		for _, input := range clf.Spec.Inputs {
+			if !containsEqual(spec.Inputs, input) {
+				spec.Inputs = append(spec.Inputs, input)
+			}
+		}
+		for _, output := range clf.Spec.Outputs {
+			output = RedactOutput(output)
+			if !containsEqual(spec.Outputs, output) {
+				spec.Outputs = append(spec.Outputs, output)
+			}
+		}
+		for _, filter := range clf.Spec.Filters {
+			if !containsEqual(spec.Filters, filter) {
+				spec.Filters = append(spec.Filters, filter)
+			}
+		}
+		spec.Pipelines = append(spec.Pipelines, clf.Spec.Pipelines...)
+	}
+	return config
+}
+
+// RedactOutput returns a copy of the output without its credentials, i.e. the password of the URL
+// and the values of the HTTP headers
+func RedactOutput(output loggingv1.OutputSpec) loggingv1.OutputSpec {
+	if parsed, err := url.Parse(output.URL); err == nil && parsed.User != nil {
+		if _, ok := parsed.User.Password(); ok {
+			parsed.User = url.UserPassword(parsed.User.Username(), RedactedValue)
+			output.URL = parsed.String()
+		}
+	}
+	if output.Http != nil && len(output.Http.Headers) > 0 {
+		redacted := *output.Http
+		redacted.Headers = map[string]string{}
+		for k := range output.Http.Headers {
+			redacted.Headers[k] = RedactedValue
+		}
+		output.Http = &redacted
+	}
+	return output
+}
+
+// EffectiveConfigHandler serves the effective config of the hosted cluster named by the cluster
+// query parameter as <namespace>/<name>, merged from the ClusterLogForwarders managed by the operator.
+//
+// The requests carry the bearer token of their user, who must be allowed to get the HostedCluster and
+// to list the ClusterLogForwarders of its HCP namespace. The token and the access of the user are reviewed
+// with the writer, the HostedCluster and the ClusterLogForwarders are read with the reader
+func EffectiveConfigHandler(reader client.Reader, writer client.Writer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		namespace, name, ok := strings.Cut(req.URL.Query().Get("cluster"), "/")
+		if !ok || namespace == "" || name == "" {
+			http.Error(w, "the cluster parameter must be <namespace>/<name> of the HostedCluster", http.StatusBadRequest)
+			return
+		}
+
+		user, status, err := authenticate(req, writer)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		if status, err := authorize(req.Context(), writer, user, authorizationv1.ResourceAttributes{
+			Namespace: namespace,
+			Verb:      "get",
+			Group:     hyperv1beta1.GroupVersion.Group,
+			Resource:  "hostedclusters",
+			Name:      name,
+		}); err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		hostedCluster := &hyperv1beta1.HostedCluster{}
+		if err := reader.Get(req.Context(), types.NamespacedName{Namespace: namespace, Name: name}, hostedCluster); errors.IsNotFound(err) {
+			http.Error(w, fmt.Sprintf("the hosted cluster %s/%s is not found", namespace, name), http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, fmt.Sprintf("failed to get the hosted cluster: %v", err), http.StatusInternalServerError)
+			return
+		}
+		hcpNamespace := hostedcluster.HCPNamespace(hostedCluster)
+		if status, err := authorize(req.Context(), writer, user, authorizationv1.ResourceAttributes{
+			Namespace: hcpNamespace,
+			Verb:      "list",
+			Group:     loggingv1.GroupVersion.Group,
+			Resource:  "clusterlogforwarders",
+		}); err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		clfList := &loggingv1.ClusterLogForwarderList{}
+		if err := reader.List(req.Context(), clfList,
+			client.InNamespace(hcpNamespace),
+			client.MatchingLabels{constants.ManagedByLabel: constants.ManagedByLabelValue},
+		); err != nil {
+			http.Error(w, fmt.Sprintf("failed to list the ClusterLogForwarders: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if len(clfList.Items) == 0 {
+			http.Error(w, fmt.Sprintf("no ClusterLogForwarder found for the hosted cluster %s/%s", namespace, name), http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		_ = encoder.Encode(BuildEffectiveConfig(hcpNamespace, clfList.Items))
+	})
+}
+
+// authenticate reviews the bearer token of the request and returns its user, with the HTTP status of the
+// failure if any
+func authenticate(req *http.Request, writer client.Writer) (authenticationv1.UserInfo, int, error) {
+	header := req.Header.Get("Authorization")
+	token := strings.TrimPrefix(header, "Bearer ")
+	if token == header || token == "" {
+		return authenticationv1.UserInfo{}, http.StatusUnauthorized, fmt.Errorf("a bearer token is required")
+	}
+	review := &authenticationv1.TokenReview{Spec: authenticationv1.TokenReviewSpec{Token: token}}
+	if err := writer.Create(req.Context(), review); err != nil {
+		return authenticationv1.UserInfo{}, http.StatusInternalServerError, fmt.Errorf("failed to review the token: %w", err)
+	}
+	if !review.Status.Authenticated {
+		return authenticationv1.UserInfo{}, http.StatusUnauthorized, fmt.Errorf("the bearer token is not authenticated")
+	}
+	return review.Status.User, http.StatusOK, nil
+}
+
+// authorize reviews the access of the user to the resource, with the HTTP status of the denial if any
+func authorize(
+	ctx context.Context,
+	writer client.Writer,
+	user authenticationv1.UserInfo,
+	attributes authorizationv1.ResourceAttributes,
+) (int, error) {
+	extra := map[string]authorizationv1.ExtraValue{}
+	for k, v := range user.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+	review := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			ResourceAttributes: &attributes,
+			User:               user.Username,
+			UID:                user.UID,
+			Groups:             user.Groups,
+			Extra:              extra,
+		},
+	}
+	if err := writer.Create(ctx, review); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("failed to review the access: %w", err)
+	}
+	if !review.Status.Allowed {
+		return http.StatusForbidden, fmt.Errorf("%s is not allowed to %s %s in namespace %s",
+			user.Username, attributes.Verb, attributes.Resource, attributes.Namespace)
+	}
+	return http.StatusOK, nil
+}
+
+func containsEqual[T any](items []T, item T) bool {
+	for _, i := range items {
+		if reflect.DeepEqual(i, item) {
+			return true
+		}
+	}
+	return false
+}
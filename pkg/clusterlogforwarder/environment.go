@@ -0,0 +1,105 @@
+package clusterlogforwarder
+
+import (
+	"fmt"
+	"strings"
+
+	loggingv1 "github.com/openshift/cluster-logging-operator/apis/logging/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/openshift/hypershift-logging-operator/api/v1alpha1"
+)
+
+// ForEnvironment returns the template tuned for the hosted clusters of the environment: the output defaults
+// of the environment replace the ones of the template and its output options are merged by output name.
+// The template is returned as is for the environments without tuning
+func ForEnvironment(template *v1alpha1.ClusterLogForwarderTemplate, environment string) *v1alpha1.ClusterLogForwarderTemplate {
+	tuning := environmentTuning(template, environment)
+	if tuning == nil {
+		return template
+	}
+
+	tuned := template.DeepCopy()
+	if tuning.OutputDefaults != nil {
+		tuned.Spec.OutputDefaults = tuning.OutputDefaults.DeepCopy()
+	}
+	for _, opts := range tuning.OutputOptions {
+		existing := tuned.Spec.GetOutputOptions(opts.Name)
+		if existing == nil {
+			tuned.Spec.OutputOptions = append(tuned.Spec.OutputOptions, *opts.DeepCopy())
+			continue
+		}
+		mergeOutputOptions(existing, opts)
+	}
+	return tuned
+}
+
+// environmentTuning returns the tuning of the environment in the template, nil if there is none
+func environmentTuning(template *v1alpha1.ClusterLogForwarderTemplate, environment string) *v1alpha1.EnvironmentTuning {
+	if environment == "" {
+		return nil
+	}
+	for i := range template.Spec.Environments {
+		if template.Spec.Environments[i].Environment == environment {
+			return &template.Spec.Environments[i]
+		}
+	}
+	return nil
+}
+
+// mergeOutputOptions sets the options of the environment on the options of the template output
+func mergeOutputOptions(opts *v1alpha1.OutputOptions, env v1alpha1.OutputOptions) {
+	if env.Compression != "" {
+		opts.Compression = env.Compression
+	}
+	if env.Timeout != nil {
+		opts.Timeout = env.Timeout.DeepCopy()
+	}
+	if env.MinRetryDuration != nil {
+		opts.MinRetryDuration = env.MinRetryDuration.DeepCopy()
+	}
+	if env.MaxRetryDuration != nil {
+		opts.MaxRetryDuration = env.MaxRetryDuration.DeepCopy()
+	}
+	if env.MaxWrite != nil {
+		maxWrite := env.MaxWrite.DeepCopy()
+		opts.MaxWrite = &maxWrite
+	}
+	if env.Fallback != "" {
+		opts.Fallback = env.Fallback
+	}
+	if env.SecretByReference {
+		opts.SecretByReference = true
+	}
+	if env.SecretNamespace != "" {
+		opts.SecretNamespace = env.SecretNamespace
+	}
+}
+
+// ValidateEnvironments validates the environments of the template are uniquely named after valid label values,
+// and the outputs of the template tuned for each environment are valid
+func ValidateEnvironments(template *v1alpha1.ClusterLogForwarderTemplate) error {
+	environments := map[string]bool{}
+	for _, tuning := range template.Spec.Environments {
+		if tuning.Environment == "" {
+			return fmt.Errorf("environment name is required")
+		}
+		if errs := validation.IsValidLabelValue(tuning.Environment); len(errs) > 0 {
+			return fmt.Errorf("invalid environment %q: %s", tuning.Environment, strings.Join(errs, "; "))
+		}
+		if environments[tuning.Environment] {
+			return fmt.Errorf("environment %s is defined more than once", tuning.Environment)
+		}
+		environments[tuning.Environment] = true
+
+		tuned := ForEnvironment(template, tuning.Environment)
+		if err := ValidateOutputOptions(tuned); err != nil {
+			return fmt.Errorf("environment %s: %w", tuning.Environment, err)
+		}
+		clf := BuildOutputsFromTemplate(tuned, &loggingv1.ClusterLogForwarder{})
+		if err := ValidateOutputs(clf.Spec.Outputs); err != nil {
+			return fmt.Errorf("environment %s: %w", tuning.Environment, err)
+		}
+	}
+	return nil
+}
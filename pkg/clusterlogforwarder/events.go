@@ -0,0 +1,66 @@
+package clusterlogforwarder
+
+import (
+	loggingv1 "github.com/openshift/cluster-logging-operator/apis/logging/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// InputEventsName is the input of the guest cluster Kubernetes events, referenced by the template pipelines
+	InputEventsName = "kubernetes-events"
+	// EventRouterComponent is the component label of the event router writing the guest cluster events to its logs
+	EventRouterComponent = "eventrouter"
+)
+
+// EventRouterLabels returns the labels of the event router pods deployed for the template
+func EventRouterLabels(templateName string) map[string]string {
+	return map[string]string{
+		"app.kubernetes.io/component": EventRouterComponent,
+		"app.kubernetes.io/instance":  templateName,
+	}
+}
+
+// InputEventsSpec returns the input collecting the logs of the event router of the template in the namespace
+func InputEventsSpec(namespace string, templateName string) loggingv1.InputSpec {
+	return loggingv1.InputSpec{
+		Name: InputEventsName,
+		Application: &loggingv1.Application{
+			Namespaces: []string{namespace},
+			Selector: &metav1.LabelSelector{
+				MatchLabels: EventRouterLabels(templateName),
+			},
+		},
+	}
+}
+
+// UsesEventsInput returns true if a pipeline of the CLF forwards the guest cluster events
+func UsesEventsInput(clf *loggingv1.ClusterLogForwarder) bool {
+	return usesInput(clf, InputEventsName)
+}
+
+// usesInput returns true if a pipeline of the CLF references the input
+func usesInput(clf *loggingv1.ClusterLogForwarder, name string) bool {
+	for _, ppl := range clf.Spec.Pipelines {
+		for _, ref := range ppl.InputRefs {
+			if ref == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// BuildEventsInput adds the input of the guest cluster events when a pipeline of the CLF references it,
+// the events are collected from the event router of the template running in the namespace of the CLF
+func BuildEventsInput(clf *loggingv1.ClusterLogForwarder, templateName string) *loggingv1.ClusterLogForwarder {
+	if !UsesEventsInput(clf) {
+		return clf
+	}
+	for _, input := range clf.Spec.Inputs {
+		if input.Name == InputEventsName {
+			return clf
+		}
+	}
+	clf.Spec.Inputs = append(clf.Spec.Inputs, InputEventsSpec(clf.Namespace, templateName))
+	return clf
+}
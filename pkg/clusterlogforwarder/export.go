@@ -0,0 +1,49 @@
+package clusterlogforwarder
+
+import (
+	loggingv1 "github.com/openshift/cluster-logging-operator/apis/logging/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/openshift/hypershift-logging-operator/pkg/constants"
+)
+
+const (
+	// ExportComponent is the component label of the ConfigMap exporting the rendered ClusterLogForwarder
+	ExportComponent = "rendered"
+	// ExportKey holds the rendered ClusterLogForwarder in YAML
+	ExportKey = "clusterlogforwarder.yaml"
+)
+
+// unexportedAnnotations are left out of the export, they change on every apply or secret rotation
+// without the rendered config changing
+var unexportedAnnotations = []string{constants.LastAppliedTimeAnnotation, constants.SecretsHashAnnotation}
+
+// RenderExport returns the CLF as YAML for review in Git: only its name, namespace, labels, annotations and spec
+// are kept, so that the export changes with the rendered config only, and the credentials of the outputs are redacted
+func RenderExport(clf *loggingv1.ClusterLogForwarder) ([]byte, error) {
+	exported := &loggingv1.ClusterLogForwarder{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: loggingv1.GroupVersion.String(),
+			Kind:       "ClusterLogForwarder",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clf.Name,
+			Namespace: clf.Namespace,
+			Labels:    clf.Labels,
+		},
+		Spec: *clf.Spec.DeepCopy(),
+	}
+	for k, v := range clf.Annotations {
+		if !contains(unexportedAnnotations, k) {
+			if exported.Annotations == nil {
+				exported.Annotations = map[string]string{}
+			}
+			exported.Annotations[k] = v
+		}
+	}
+	for i, output := range exported.Spec.Outputs {
+		exported.Spec.Outputs[i] = RedactOutput(output)
+	}
+	return yaml.Marshal(exported)
+}
@@ -0,0 +1,225 @@
+package clusterlogforwarder
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	loggingv1 "github.com/openshift/cluster-logging-operator/apis/logging/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/openshift/hypershift-logging-operator/pkg/constants"
+)
+
+// ManagedLabels returns the labels stamped on the resources generated by the operator,
+// sourceLabel records which object the resource was generated from
+func ManagedLabels(sourceLabel string, sourceName string) map[string]string {
+	return map[string]string{
+		constants.ManagedByLabel: constants.ManagedByLabelValue,
+		sourceLabel:              sourceName,
+	}
+}
+
+// CommonMetadata holds the labels and annotations stamped on all the resources generated by the operator,
+// e.g. for cost attribution or ownership
+type CommonMetadata struct {
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+// Validate returns an error if a common label or annotation collides with the operator managed ones
+func (m CommonMetadata) Validate() error {
+	for k := range m.Labels {
+		if isReservedKey(k) {
+			return fmt.Errorf("common label %s is managed by the operator", k)
+		}
+	}
+	for k := range m.Annotations {
+		if isReservedKey(k) {
+			return fmt.Errorf("common annotation %s is managed by the operator", k)
+		}
+	}
+	return nil
+}
+
+// Apply stamps the common labels and annotations on the object,
+// the operator managed keys are never overwritten
+func (m CommonMetadata) Apply(obj metav1.Object) {
+	if len(m.Labels) > 0 {
+		labels := obj.GetLabels()
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		for k, v := range m.Labels {
+			if !isReservedKey(k) {
+				labels[k] = v
+			}
+		}
+		obj.SetLabels(labels)
+	}
+
+	if len(m.Annotations) > 0 {
+		annotations := obj.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		for k, v := range m.Annotations {
+			if !isReservedKey(k) {
+				annotations[k] = v
+			}
+		}
+		obj.SetAnnotations(annotations)
+	}
+}
+
+// isReservedKey returns true for the label and annotation keys managed by the operator
+func isReservedKey(key string) bool {
+	return key == constants.ManagedByLabel || strings.HasPrefix(key, constants.ManagedKeyPrefix)
+}
+
+// SetAuditAnnotations records which source object and generation the CLF is generated from,
+// and the controller applying it
+func SetAuditAnnotations(clf *loggingv1.ClusterLogForwarder, source string, generation int64, actor string) {
+	if clf.Annotations == nil {
+		clf.Annotations = map[string]string{}
+	}
+	clf.Annotations[constants.SourceAnnotation] = source
+	clf.Annotations[constants.SourceGenerationAnnotation] = strconv.FormatInt(generation, 10)
+	clf.Annotations[constants.AppliedByAnnotation] = actor
+}
+
+// StampLastAppliedTime records the time the CLF is applied
+func StampLastAppliedTime(clf *loggingv1.ClusterLogForwarder) {
+	if clf.Annotations == nil {
+		clf.Annotations = map[string]string{}
+	}
+	clf.Annotations[constants.LastAppliedTimeAnnotation] = time.Now().UTC().Format(time.RFC3339)
+}
+
+// SecretReferences returns the templates referencing the secret copy, sorted. The copy without references
+// recorded is referenced by the template it is labeled with only
+func SecretReferences(secret metav1.Object) []string {
+	annotation, ok := secret.GetAnnotations()[constants.ReferencedByAnnotation]
+	if !ok {
+		if name := secret.GetLabels()[constants.TemplateLabel]; name != "" {
+			return []string{name}
+		}
+		return nil
+	}
+	var references []string
+	for _, name := range strings.Split(annotation, ",") {
+		if name != "" {
+			references = append(references, name)
+		}
+	}
+	sort.Strings(references)
+	return references
+}
+
+// SetSecretReferences records the templates referencing the secret copy
+func SetSecretReferences(secret metav1.Object, references []string) {
+	sorted := append([]string{}, references...)
+	sort.Strings(sorted)
+	annotations := secret.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[constants.ReferencedByAnnotation] = strings.Join(sorted, ",")
+	secret.SetAnnotations(annotations)
+}
+
+// IsUnmanaged returns true if the CLF is annotated to be managed by hand, the operator leaves it intact
+func IsUnmanaged(clf *loggingv1.ClusterLogForwarder) bool {
+	return clf.Annotations[constants.UnmanagedAnnotation] == "true"
+}
+
+// IsUpToDate returns true if the existing CLF has the desired spec and carries
+// the desired labels, annotations and owner references
+func IsUpToDate(existing *loggingv1.ClusterLogForwarder, desired *loggingv1.ClusterLogForwarder) bool {
+	if !reflect.DeepEqual(existing.Spec, desired.Spec) {
+		return false
+	}
+
+	return HasDesiredMetadata(existing, desired)
+}
+
+// HasDesiredMetadata returns true if the existing CLF carries the desired labels, annotations and owner references,
+// the last applied time is not compared
+func HasDesiredMetadata(existing *loggingv1.ClusterLogForwarder, desired *loggingv1.ClusterLogForwarder) bool {
+	for k, v := range desired.Labels {
+		if existing.Labels[k] != v {
+			return false
+		}
+	}
+
+	for k, v := range desired.Annotations {
+		if k != constants.LastAppliedTimeAnnotation && existing.Annotations[k] != v {
+			return false
+		}
+	}
+
+	// The annotation of the collector type is compared by presence, it is removed to switch back to a DaemonSet
+	if IsCollectorDeployment(existing) != IsCollectorDeployment(desired) {
+		return false
+	}
+	// The collector log level is removed to switch back to the default level
+	if existing.Annotations[CollectorLogLevelAnnotation] != desired.Annotations[CollectorLogLevelAnnotation] {
+		return false
+	}
+	// The cluster-logging version is removed once it is not detected anymore
+	if existing.Annotations[constants.LoggingVersionAnnotation] != desired.Annotations[constants.LoggingVersionAnnotation] {
+		return false
+	}
+
+	for _, ref := range desired.OwnerReferences {
+		if !hasOwnerReference(existing.OwnerReferences, ref) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// MergeMetadata copies the desired labels, annotations and owner references onto the existing CLF
+func MergeMetadata(existing *loggingv1.ClusterLogForwarder, desired *loggingv1.ClusterLogForwarder) {
+	if existing.Labels == nil {
+		existing.Labels = map[string]string{}
+	}
+	for k, v := range desired.Labels {
+		existing.Labels[k] = v
+	}
+
+	if existing.Annotations == nil {
+		existing.Annotations = map[string]string{}
+	}
+	for k, v := range desired.Annotations {
+		existing.Annotations[k] = v
+	}
+	if !IsCollectorDeployment(desired) {
+		delete(existing.Annotations, CollectorAsDeploymentAnnotation)
+	}
+	if _, ok := desired.Annotations[CollectorLogLevelAnnotation]; !ok {
+		delete(existing.Annotations, CollectorLogLevelAnnotation)
+	}
+	if _, ok := desired.Annotations[constants.LoggingVersionAnnotation]; !ok {
+		delete(existing.Annotations, constants.LoggingVersionAnnotation)
+	}
+
+	for _, ref := range desired.OwnerReferences {
+		if !hasOwnerReference(existing.OwnerReferences, ref) {
+			existing.OwnerReferences = append(existing.OwnerReferences, ref)
+		}
+	}
+}
+
+func hasOwnerReference(refs []metav1.OwnerReference, ref metav1.OwnerReference) bool {
+	for _, r := range refs {
+		if r.UID == ref.UID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package clusterlogforwarder
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/openshift/hypershift-logging-operator/api/v1alpha1"
+)
+
+// ValidateClusterLogForwarderName validates the CLF name of the template is a valid resource name,
+// its ${key} tokens standing for any valid value
+func ValidateClusterLogForwarderName(template *v1alpha1.ClusterLogForwarderTemplate) error {
+	name := template.Spec.ClusterLogForwarderName
+	if name == "" {
+		return nil
+	}
+	if errs := validation.IsDNS1123Subdomain(valueToken.ReplaceAllString(name, "x")); len(errs) > 0 {
+		return fmt.Errorf("invalid ClusterLogForwarder name %q: %s", name, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// RenderName substitutes the values of the cluster into the ${key} tokens of the name of a generated resource,
+// the name must render into a valid resource name without any token left
+func RenderName(name string, values map[string]string) (string, error) {
+	var missing []string
+	rendered := valueToken.ReplaceAllStringFunc(name, func(token string) string {
+		key := valueToken.FindStringSubmatch(token)[1]
+		value, ok := values[key]
+		if !ok {
+			missing = append(missing, key)
+			return token
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("tokens without value in the name %q: %s", name, strings.Join(missing, ", "))
+	}
+	if errs := validation.IsDNS1123Subdomain(rendered); len(errs) > 0 {
+		return "", fmt.Errorf("name %q renders into the invalid name %q: %s", name, rendered, strings.Join(errs, "; "))
+	}
+	return rendered, nil
+}
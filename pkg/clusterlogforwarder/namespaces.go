@@ -0,0 +1,111 @@
+package clusterlogforwarder
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	loggingv1 "github.com/openshift/cluster-logging-operator/apis/logging/v1"
+
+	"github.com/openshift/hypershift-logging-operator/api/v1alpha1"
+)
+
+const (
+	// namespaceField is the field of the namespace of the container records
+	namespaceField = ".kubernetes.namespace_name"
+	// SystemNamespacesFilterName is the drop filter of the application records of the system namespaces
+	SystemNamespacesFilterName = GeneratedFilterPrefix + "exclude-system-namespaces"
+)
+
+// DefaultSystemNamespaces are the namespaces whose application records are dropped unless the template
+// opts out, a trailing * matches any suffix
+var DefaultSystemNamespaces = []string{"kube-*", "openshift-*"}
+
+var (
+	namespacePattern       = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+	namespacePrefixPattern = regexp.MustCompile(`^[a-z0-9][-a-z0-9]*\*$`)
+)
+
+// ValidateNamespacePattern returns an error unless the pattern is a namespace name, or a prefix followed by *
+func ValidateNamespacePattern(pattern string) error {
+	if len(pattern) > 63 || (!namespacePattern.MatchString(pattern) && !namespacePrefixPattern.MatchString(pattern)) {
+		return fmt.Errorf("invalid namespace pattern %q, expected a namespace name optionally ending with *", pattern)
+	}
+	return nil
+}
+
+// SystemNamespaces returns the namespace patterns excluded from the application records and the ones kept
+// even if they match an excluded pattern, nothing is excluded if the template opts out
+func SystemNamespaces(opts *v1alpha1.SystemNamespacesOptions) (excluded []string, kept []string) {
+	if opts == nil {
+		return DefaultSystemNamespaces, nil
+	}
+	if opts.Disabled {
+		return nil, nil
+	}
+	for _, ns := range append(append([]string{}, DefaultSystemNamespaces...), opts.Add...) {
+		if !contains(opts.Remove, ns) && !contains(excluded, ns) {
+			excluded = append(excluded, ns)
+		}
+	}
+	// The removed namespaces which are not default patterns are kept within the excluded patterns,
+	// e.g. openshift-monitoring within openshift-*
+	for _, ns := range opts.Remove {
+		if !contains(DefaultSystemNamespaces, ns) && !contains(opts.Add, ns) {
+			kept = append(kept, ns)
+		}
+	}
+	return excluded, kept
+}
+
+// namespacesRegexp returns the regular expression matching any of the namespace patterns
+func namespacesRegexp(patterns []string) string {
+	alternatives := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		if strings.HasSuffix(pattern, "*") {
+			alternatives = append(alternatives, regexp.QuoteMeta(strings.TrimSuffix(pattern, "*"))+".*")
+		} else {
+			alternatives = append(alternatives, regexp.QuoteMeta(pattern))
+		}
+	}
+	return fmt.Sprintf("^(%s)$", strings.Join(alternatives, "|"))
+}
+
+// BuildSystemNamespacesFilterFromTemplate adds a drop filter of the records of the system namespaces
+// to the pipelines forwarding application logs
+func BuildSystemNamespacesFilterFromTemplate(template *v1alpha1.ClusterLogForwarderTemplate,
+	clf *loggingv1.ClusterLogForwarder) *loggingv1.ClusterLogForwarder {
+
+	excluded, kept := SystemNamespaces(template.Spec.SystemNamespaces)
+	if len(excluded) == 0 {
+		return clf
+	}
+
+	filtered := false
+	for i := range clf.Spec.Pipelines {
+		ppl := &clf.Spec.Pipelines[i]
+		if !isApplicationPipeline(*ppl, clf.Spec.Inputs) {
+			continue
+		}
+		// The filter refs may be shared with the template pipeline
+		ppl.FilterRefs = append(append([]string{}, ppl.FilterRefs...), SystemNamespacesFilterName)
+		filtered = true
+	}
+	if !filtered {
+		return clf
+	}
+
+	// The conditions of a test must all match for the record to be dropped
+	conditions := []loggingv1.DropCondition{{Field: namespaceField, Matches: namespacesRegexp(excluded)}}
+	if len(kept) > 0 {
+		conditions = append(conditions, loggingv1.DropCondition{Field: namespaceField, NotMatches: namespacesRegexp(kept)})
+	}
+	clf.Spec.Filters = append(clf.Spec.Filters, loggingv1.FilterSpec{
+		Name: SystemNamespacesFilterName,
+		Type: loggingv1.FilterDrop,
+		FilterTypeSpec: loggingv1.FilterTypeSpec{
+			DropTestsSpec: &[]loggingv1.DropTest{{DropConditions: conditions}},
+		},
+	})
+	return clf
+}
@@ -0,0 +1,74 @@
+package clusterlogforwarder
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/blang/semver/v4"
+	loggingv1 "github.com/openshift/cluster-logging-operator/apis/logging/v1"
+
+	"github.com/openshift/hypershift-logging-operator/api/v1alpha1"
+)
+
+// InputNetworkLogsName is the input of the OVN network logs of the hosted cluster, e.g. the ACL audit logs,
+// referenced by the template pipelines
+const InputNetworkLogsName = "network-logs"
+
+// MinNetworkLogsVersion is the first cluster-logging version collecting the ovn audit source
+var MinNetworkLogsVersion = semver.MustParse("5.8.0")
+
+// InputNetworkLogsSpec is the audit input collecting only the ovn source
+var InputNetworkLogsSpec = loggingv1.InputSpec{
+	Name:  InputNetworkLogsName,
+	Audit: &loggingv1.Audit{Sources: []string{"ovn"}},
+}
+
+// SupportsNetworkLogs returns true if the cluster-logging version collects the network logs.
+// An empty version is assumed to be recent enough, an invalid one is not supported
+func SupportsNetworkLogs(loggingVersion string) bool {
+	return supportsVersion(loggingVersion, MinNetworkLogsVersion)
+}
+
+// UsesNetworkLogsInput returns true if a pipeline of the CLF forwards the network logs
+func UsesNetworkLogsInput(clf *loggingv1.ClusterLogForwarder) bool {
+	return usesInput(clf, InputNetworkLogsName)
+}
+
+// BuildNetworkLogsInput adds the input of the network logs when a pipeline of the CLF references it
+func BuildNetworkLogsInput(clf *loggingv1.ClusterLogForwarder) *loggingv1.ClusterLogForwarder {
+	if !UsesNetworkLogsInput(clf) {
+		return clf
+	}
+	for _, input := range clf.Spec.Inputs {
+		if input.Name == InputNetworkLogsName {
+			return clf
+		}
+	}
+	clf.Spec.Inputs = append(clf.Spec.Inputs, *InputNetworkLogsSpec.DeepCopy())
+	return clf
+}
+
+// ValidateNetworkLogs validates the network logs are forwarded by their own pipelines, apart from the other
+// inputs, and only with a cluster-logging version collecting them
+func ValidateNetworkLogs(template *v1alpha1.ClusterLogForwarderTemplate, loggingVersion string) error {
+	for _, ppl := range template.Spec.Template.Pipelines {
+		if !contains(ppl.InputRefs, InputNetworkLogsName) || !template.Spec.GetPipelineOptions(ppl.Name).IsEnabled() {
+			continue
+		}
+		if !SupportsNetworkLogs(loggingVersion) {
+			return fmt.Errorf("pipeline %s forwards the %s input, which requires cluster-logging %s or later, got %s",
+				ppl.Name, InputNetworkLogsName, MinNetworkLogsVersion, loggingVersion)
+		}
+		var others []string
+		for _, ref := range ppl.InputRefs {
+			if ref != InputNetworkLogsName {
+				others = append(others, ref)
+			}
+		}
+		if len(others) > 0 {
+			return fmt.Errorf("pipeline %s forwards the %s input along with %s, the network logs are forwarded by their own pipeline",
+				ppl.Name, InputNetworkLogsName, strings.Join(others, ", "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package clusterlogforwarder
+
+import (
+	"sort"
+
+	loggingv1 "github.com/openshift/cluster-logging-operator/apis/logging/v1"
+
+	"github.com/openshift/hypershift-logging-operator/pkg/constants"
+)
+
+const (
+	// StatusReportName is the ConfigMap in the operator namespace enumerating the ClusterLogForwarders
+	// generated for each hosted cluster, e.g. for kubectl plugins to inspect them
+	StatusReportName = "hypershift-logging-status"
+	// StatusReportKey holds the StatusReport in JSON
+	StatusReportKey = "status.json"
+)
+
+// StatusReport enumerates the ClusterLogForwarders generated by the operator, grouped by HCP namespace
+type StatusReport struct {
+	Clusters []ClusterStatus `json:"clusters"`
+}
+
+// ClusterStatus holds the ClusterLogForwarders generated in the HCP namespace of a hosted cluster
+type ClusterStatus struct {
+	Namespace  string            `json:"namespace"`
+	Forwarders []ForwarderStatus `json:"forwarders"`
+}
+
+// ForwarderStatus is the status of a generated ClusterLogForwarder
+type ForwarderStatus struct {
+	Name string `json:"name"`
+	// Source is the template or HyperShiftLogForwarder the CLF is generated from
+	Source string `json:"source,omitempty"`
+	// LastAppliedTime is when the CLF was last applied by the operator
+	LastAppliedTime string `json:"lastAppliedTime,omitempty"`
+	// Unmanaged is true if the CLF is managed by hand and left intact by the operator
+	Unmanaged  bool                 `json:"unmanaged,omitempty"`
+	Conditions loggingv1.Conditions `json:"conditions,omitempty"`
+}
+
+// BuildStatusReport groups the ClusterLogForwarders by namespace, both sorted by name so that
+// the report only changes along with the ClusterLogForwarders
+func BuildStatusReport(clfs []loggingv1.ClusterLogForwarder) StatusReport {
+	byNamespace := map[string][]ForwarderStatus{}
+	for _, clf := range clfs {
+		byNamespace[clf.Namespace] = append(byNamespace[clf.Namespace], ForwarderStatus{
+			Name:            clf.Name,
+			Source:          clf.Annotations[constants.SourceAnnotation],
+			LastAppliedTime: clf.Annotations[constants.LastAppliedTimeAnnotation],
+			Unmanaged:       IsUnmanaged(&clf),
+			Conditions:      clf.Status.Conditions,
+		})
+	}
+
+	report := StatusReport{Clusters: []ClusterStatus{}}
+	for namespace, forwarders := range byNamespace {
+		sort.Slice(forwarders, func(i, j int) bool { return forwarders[i].Name < forwarders[j].Name })
+		report.Clusters = append(report.Clusters, ClusterStatus{Namespace: namespace, Forwarders: forwarders})
+	}
+	sort.Slice(report.Clusters, func(i, j int) bool { return report.Clusters[i].Namespace < report.Clusters[j].Namespace })
+	return report
+}
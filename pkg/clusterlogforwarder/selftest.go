@@ -0,0 +1,59 @@
+package clusterlogforwarder
+
+import (
+	"fmt"
+	"time"
+
+	loggingv1 "github.com/openshift/cluster-logging-operator/apis/logging/v1"
+
+	"github.com/openshift/hypershift-logging-operator/api/v1alpha1"
+)
+
+// MinSelfTestInterval is the minimum interval between two self-tests of the log delivery of a template
+const MinSelfTestInterval = 5 * time.Minute
+
+// SelfTestMarker returns the unique message of the marker log injected by a self-test of the template
+func SelfTestMarker(templateName string, now time.Time) string {
+	return fmt.Sprintf("hlo-self-test-%s-%d", templateName, now.UnixNano())
+}
+
+// ReceiverServiceURL returns the URL of the service of the HTTP receiver of the collector of the CLF,
+// named by cluster-logging after the CLF and the input
+func ReceiverServiceURL(clf *loggingv1.ClusterLogForwarder) string {
+	return fmt.Sprintf("https://%s-%s.%s.svc:%d", clf.Name, InputHTTPServerName, clf.Namespace,
+		InputHTTPServerSpec.Receiver.HTTP.Port)
+}
+
+// ValidateSelfTest validates the self-test of the template injects the marker log through the input-httpserver
+// input and queries it from a loki output the input is forwarded to
+func ValidateSelfTest(template *v1alpha1.ClusterLogForwarderTemplate) error {
+	if !template.Spec.IsSelfTestEnabled() {
+		return nil
+	}
+	selfTest := template.Spec.SelfTest
+	if !template.Spec.IsHCPAuditEnabled() {
+		return fmt.Errorf("self-test requires the hosted control plane audit to be enabled")
+	}
+	if selfTest.Interval != nil && selfTest.Interval.Duration < MinSelfTestInterval {
+		return fmt.Errorf("self-test interval %s is less than %s", selfTest.Interval.Duration, MinSelfTestInterval)
+	}
+
+	var output *loggingv1.OutputSpec
+	for i := range template.Spec.Template.Outputs {
+		if template.Spec.Template.Outputs[i].Name == selfTest.Output {
+			output = &template.Spec.Template.Outputs[i]
+		}
+	}
+	if output == nil {
+		return fmt.Errorf("self-test refers to the unknown output %q", selfTest.Output)
+	}
+	if output.Type != loggingv1.OutputTypeLoki {
+		return fmt.Errorf("self-test cannot query the %s output %s, only the loki outputs are supported", output.Type, output.Name)
+	}
+	for _, ppl := range template.Spec.Template.Pipelines {
+		if contains(ppl.InputRefs, InputHTTPServerName) && contains(ppl.OutputRefs, output.Name) {
+			return nil
+		}
+	}
+	return fmt.Errorf("self-test output %s is not forwarded the input %s", output.Name, InputHTTPServerName)
+}
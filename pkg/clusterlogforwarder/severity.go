@@ -0,0 +1,105 @@
+package clusterlogforwarder
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	loggingv1 "github.com/openshift/cluster-logging-operator/apis/logging/v1"
+
+	"github.com/openshift/hypershift-logging-operator/api/v1alpha1"
+)
+
+// severityLevelField is the field of the normalized log level of the records
+const severityLevelField = ".level"
+
+// severityNames are the textual names of the severity levels, indexed by the syslog numeric level.
+// The trace level is less severe than debug and has no syslog numeric level
+var severityNames = [][]string{
+	{"emergency", "emerg", "panic"},
+	{"alert"},
+	{"critical", "crit"},
+	{"error", "err"},
+	{"warning", "warn"},
+	{"notice"},
+	{"info", "informational"},
+	{"debug"},
+	{"trace"},
+}
+
+// maxSyslogSeverity is the least severe level with a syslog numeric level
+const maxSyslogSeverity = 7
+
+// ParseSeverity returns the syslog numeric level of the textual or numeric severity
+func ParseSeverity(severity string) (int, error) {
+	severity = strings.ToLower(strings.TrimSpace(severity))
+	if level, err := strconv.Atoi(severity); err == nil {
+		if level < 0 || level > maxSyslogSeverity {
+			return 0, fmt.Errorf("severity %s is out of the syslog levels 0-%d", severity, maxSyslogSeverity)
+		}
+		return level, nil
+	}
+	for level, names := range severityNames {
+		for _, name := range names {
+			if name == severity {
+				return level, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("unknown severity %s", severity)
+}
+
+// lowerSeverityPattern returns the regular expression matching the levels less severe than the level,
+// both the textual and the numeric levels are matched
+func lowerSeverityPattern(level int) string {
+	var names []string
+	for l := level + 1; l < len(severityNames); l++ {
+		names = append(names, severityNames[l]...)
+		if l <= maxSyslogSeverity {
+			names = append(names, strconv.Itoa(l))
+		}
+	}
+	return fmt.Sprintf("(?i)^(%s)$", strings.Join(names, "|"))
+}
+
+// SeverityFilterName returns the name of the drop filter of the minimum severity of the pipeline
+func SeverityFilterName(pipeline string) string {
+	return fmt.Sprintf("%s%s-min-severity", GeneratedFilterPrefix, pipeline)
+}
+
+// BuildSeverityFiltersFromTemplate adds a drop filter to the pipelines with a minimum severity,
+// removing the records less severe than the minimum
+func BuildSeverityFiltersFromTemplate(template *v1alpha1.ClusterLogForwarderTemplate,
+	clf *loggingv1.ClusterLogForwarder) (*loggingv1.ClusterLogForwarder, error) {
+
+	for i := range clf.Spec.Pipelines {
+		ppl := &clf.Spec.Pipelines[i]
+		opts := template.Spec.GetPipelineOptions(ppl.Name)
+		if opts == nil || opts.MinSeverity == "" {
+			continue
+		}
+
+		level, err := ParseSeverity(opts.MinSeverity)
+		if err != nil {
+			return clf, fmt.Errorf("pipeline %s: %w", ppl.Name, err)
+		}
+
+		name := SeverityFilterName(ppl.Name)
+		clf.Spec.Filters = append(clf.Spec.Filters, loggingv1.FilterSpec{
+			Name: name,
+			Type: loggingv1.FilterDrop,
+			FilterTypeSpec: loggingv1.FilterTypeSpec{
+				DropTestsSpec: &[]loggingv1.DropTest{{
+					DropConditions: []loggingv1.DropCondition{{
+						Field:   severityLevelField,
+						Matches: lowerSeverityPattern(level),
+					}},
+				}},
+			},
+		})
+		// The filter refs may be shared with the template pipeline
+		ppl.FilterRefs = append(append([]string{}, ppl.FilterRefs...), name)
+	}
+
+	return clf, nil
+}
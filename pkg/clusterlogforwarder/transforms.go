@@ -0,0 +1,94 @@
+package clusterlogforwarder
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	loggingv1 "github.com/openshift/cluster-logging-operator/apis/logging/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/openshift/hypershift-logging-operator/api/v1alpha1"
+)
+
+// RemoveFieldsFilterName is the prune filter of the fields removed by the template transforms
+const RemoveFieldsFilterName = GeneratedFilterPrefix + "remove-fields"
+
+// fieldPathPattern matches the field paths of cluster-logging, e.g. .kubernetes.labels."app.kubernetes.io/name"
+var fieldPathPattern = regexp.MustCompile(`^(\.[a-zA-Z0-9_]+|\."[^"]+")+$`)
+
+// requiredFields are the fields the collector needs to route the records, they cannot be removed
+var requiredFields = []string{".log_type", ".message"}
+
+// ValidateFieldPath returns an error unless the path is a field path of the records, made of
+// .name or ."quoted name" segments
+func ValidateFieldPath(path string) error {
+	if !fieldPathPattern.MatchString(path) {
+		return fmt.Errorf("invalid field path %q, expected segments like .kubernetes.labels or .\"app.kubernetes.io/name\"", path)
+	}
+	return nil
+}
+
+// ValidateTransforms validates the added fields are valid labels and the removed fields are valid paths
+// of fields not required by the collector
+func ValidateTransforms(template *v1alpha1.ClusterLogForwarderTemplate) error {
+	transforms := template.Spec.Transforms
+	if transforms == nil {
+		return nil
+	}
+	for k, v := range transforms.AddFields {
+		if errs := validation.IsQualifiedName(k); len(errs) > 0 {
+			return fmt.Errorf("transforms: invalid added field %q: %s", k, strings.Join(errs, "; "))
+		}
+		if errs := validation.IsValidLabelValue(v); len(errs) > 0 {
+			return fmt.Errorf("transforms: invalid value of the added field %s: %s", k, strings.Join(errs, "; "))
+		}
+	}
+	var removed []string
+	for _, path := range transforms.RemoveFields {
+		if err := ValidateFieldPath(path); err != nil {
+			return fmt.Errorf("transforms: %w", err)
+		}
+		if contains(requiredFields, path) {
+			return fmt.Errorf("transforms: the field %s is required and cannot be removed", path)
+		}
+		if contains(removed, path) {
+			return fmt.Errorf("transforms: the field %s is removed more than once", path)
+		}
+		removed = append(removed, path)
+	}
+	return nil
+}
+
+// BuildTransformsFromTemplate adds the static fields of the template to the labels of every pipeline, and
+// the prune filter of the removed fields to every pipeline
+func BuildTransformsFromTemplate(template *v1alpha1.ClusterLogForwarderTemplate,
+	clf *loggingv1.ClusterLogForwarder) *loggingv1.ClusterLogForwarder {
+
+	transforms := template.Spec.Transforms
+	if transforms == nil || len(clf.Spec.Pipelines) == 0 {
+		return clf
+	}
+
+	for i := range clf.Spec.Pipelines {
+		ppl := &clf.Spec.Pipelines[i]
+		if len(transforms.AddFields) > 0 {
+			ppl.Labels = mergeLabels(transforms.AddFields, ppl.Labels)
+		}
+		if len(transforms.RemoveFields) > 0 {
+			// The filter refs may be shared with the template pipeline
+			ppl.FilterRefs = append(append([]string{}, ppl.FilterRefs...), RemoveFieldsFilterName)
+		}
+	}
+
+	if len(transforms.RemoveFields) > 0 {
+		clf.Spec.Filters = append(clf.Spec.Filters, loggingv1.FilterSpec{
+			Name: RemoveFieldsFilterName,
+			Type: loggingv1.FilterPrune,
+			FilterTypeSpec: loggingv1.FilterTypeSpec{
+				PruneFilterSpec: &loggingv1.PruneFilterSpec{In: append([]string{}, transforms.RemoveFields...)},
+			},
+		})
+	}
+	return clf
+}
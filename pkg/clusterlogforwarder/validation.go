@@ -0,0 +1,767 @@
+package clusterlogforwarder
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	loggingv1 "github.com/openshift/cluster-logging-operator/apis/logging/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/openshift/hypershift-logging-operator/api/v1alpha1"
+	hloerrors "github.com/openshift/hypershift-logging-operator/pkg/errors"
+)
+
+// AzureMonitorSharedKey is the key of the Azure Monitor output secret holding the workspace shared key
+const AzureMonitorSharedKey = "shared_key"
+
+// Limits caps the CLFs rendered from the templates, a zero limit is not enforced
+type Limits struct {
+	// MaxOutputs is the maximum number of outputs of a CLF
+	MaxOutputs int
+	// MaxPipelines is the maximum number of pipelines of a CLF
+	MaxPipelines int
+	// MaxSize is the maximum size of a CLF spec in bytes
+	MaxSize int
+}
+
+// insecureSchemes are the URL schemes which do not support TLS
+var insecureSchemes = map[string]bool{
+	"http": true,
+	"tcp":  true,
+	"udp":  true,
+}
+
+// Ranges of the output timeout and retry durations
+const (
+	minOutputTimeout = time.Second
+	maxOutputTimeout = 10 * time.Minute
+	minRetryDuration = time.Second
+	maxRetryDuration = time.Hour
+)
+
+// Range of the batch size of the outputs, in bytes
+var (
+	minMaxWrite = resource.MustParse("1Ki")
+	maxMaxWrite = resource.MustParse("10Mi")
+)
+
+// allowedCollectionSources are the sources the template may collect for each type of input,
+// the host paths are not allowed
+var allowedCollectionSources = map[string][]string{
+	loggingv1.InputNameInfrastructure: {"container", "node"},
+	loggingv1.InputNameAudit:          {"auditd", "kubeAPI", "openshiftAPI", "ovn"},
+}
+
+// reservedInputNames are the inputs defined by the ClusterLogForwarder or the operator
+var reservedInputNames = []string{
+	loggingv1.InputNameApplication,
+	loggingv1.InputNameInfrastructure,
+	loggingv1.InputNameAudit,
+	InputHTTPServerName,
+	InputEventsName,
+	InputNetworkLogsName,
+}
+
+// supportedCompression are the compression algorithms supported by each output type,
+// the outputs of the other types do not support compression
+var supportedCompression = map[string][]string{
+	loggingv1.OutputTypeElasticsearch: {"gzip", "zlib"},
+	loggingv1.OutputTypeHttp:          {"gzip", "snappy", "zlib"},
+	loggingv1.OutputTypeKafka:         {"gzip", "snappy", "zstd", "lz4"},
+	loggingv1.OutputTypeLoki:          {"gzip", "snappy"},
+}
+
+// IsSupportedCompression returns true if the output type supports the compression algorithm
+func IsSupportedCompression(outputType string, compression string) bool {
+	if compression == "" || compression == "none" {
+		return true
+	}
+	for _, c := range supportedCompression[outputType] {
+		if c == compression {
+			return true
+		}
+	}
+	return false
+}
+
+// IsInsecureURL returns true if the URL uses a scheme without TLS
+func IsInsecureURL(u string) bool {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return false
+	}
+	return insecureSchemes[parsed.Scheme]
+}
+
+// ValidateTemplate validates the CLF rendered from the template before it is applied
+func ValidateTemplate(template *v1alpha1.ClusterLogForwarderTemplate) error {
+	if err := ValidateNames(template); err != nil {
+		return err
+	}
+
+	if err := ValidateClusterLogForwarderName(template); err != nil {
+		return err
+	}
+
+	if err := ValidatePipelineOptions(template); err != nil {
+		return err
+	}
+
+	if err := ValidatePipelines(template); err != nil {
+		return err
+	}
+
+	if err := ValidateMultiline(template); err != nil {
+		return err
+	}
+
+	if err := ValidateCollectionSources(template); err != nil {
+		return err
+	}
+
+	if err := ValidateNamespaceRateLimits(template); err != nil {
+		return err
+	}
+
+	if err := ValidatePodSelectors(template); err != nil {
+		return err
+	}
+
+	if err := ValidateSystemNamespaces(template); err != nil {
+		return err
+	}
+
+	if err := ValidateTransforms(template); err != nil {
+		return err
+	}
+
+	if err := ValidateOutputOptions(template); err != nil {
+		return err
+	}
+
+	if err := ValidateCABundle(template); err != nil {
+		return err
+	}
+
+	if err := ValidateEnvironments(template); err != nil {
+		return err
+	}
+
+	if err := ValidateSelfTest(template); err != nil {
+		return err
+	}
+
+	if err := ValidateCollectorLogLevel(template); err != nil {
+		return err
+	}
+
+	clf := BuildOutputsFromTemplate(template, &loggingv1.ClusterLogForwarder{})
+	if err := ValidateOutputs(clf.Spec.Outputs); err != nil {
+		return err
+	}
+
+	return ValidatePlatformOutputs(template, clf.Spec.Outputs)
+}
+
+// ValidateNames validates the outputs, the named pipelines and the filters of the template are unique and the
+// filters do not use GeneratedFilterPrefix, the outputs of each platform are validated along with the template outputs
+func ValidateNames(template *v1alpha1.ClusterLogForwarderTemplate) error {
+	outputs := map[string]bool{}
+	for _, output := range template.Spec.Template.Outputs {
+		if outputs[output.Name] {
+			return fmt.Errorf("output %s is defined more than once", output.Name)
+		}
+		outputs[output.Name] = true
+	}
+	for _, po := range template.Spec.PlatformOutputs {
+		platformOutputs := map[string]bool{}
+		for _, output := range po.Outputs {
+			if platformOutputs[output.Name] {
+				return fmt.Errorf("output %s of the platform %s is defined more than once", output.Name, po.Platform)
+			}
+			platformOutputs[output.Name] = true
+		}
+	}
+
+	pipelines := map[string]bool{}
+	for _, ppl := range template.Spec.Template.Pipelines {
+		if ppl.Name == "" {
+			continue
+		}
+		if pipelines[ppl.Name] {
+			return fmt.Errorf("pipeline %s is defined more than once", ppl.Name)
+		}
+		pipelines[ppl.Name] = true
+	}
+
+	// The filters added by the operator are prefixed, the template filters cannot collide with them
+	filters := map[string]bool{}
+	for _, filter := range template.Spec.Template.Filters {
+		if strings.HasPrefix(filter.Name, GeneratedFilterPrefix) {
+			return fmt.Errorf("filter %s uses the prefix %s reserved for the filters added by the operator", filter.Name, GeneratedFilterPrefix)
+		}
+		if filters[filter.Name] {
+			return fmt.Errorf("filter %s is defined more than once", filter.Name)
+		}
+		filters[filter.Name] = true
+	}
+
+	return nil
+}
+
+// ValidateLimits estimates the CLF rendered from the template and validates it does not exceed the limits of
+// the outputs and of the pipelines, the outputs of the platform with the most outputs are counted and the disabled
+// pipelines, which are not rendered, are not. The size is validated on the rendered CLF by ValidateSize
+func ValidateLimits(template *v1alpha1.ClusterLogForwarderTemplate, limits Limits) error {
+	platformOutputs := 0
+	for _, po := range template.Spec.PlatformOutputs {
+		if len(po.Outputs) > platformOutputs {
+			platformOutputs = len(po.Outputs)
+		}
+	}
+	outputs := len(template.Spec.Template.Outputs) + platformOutputs
+	if limits.MaxOutputs > 0 && outputs > limits.MaxOutputs {
+		return fmt.Errorf("template renders %d outputs, exceeding the limit of %d outputs", outputs, limits.MaxOutputs)
+	}
+
+	pipelines := 0
+	for _, ppl := range template.Spec.Template.Pipelines {
+		if template.Spec.GetPipelineOptions(ppl.Name).IsEnabled() {
+			pipelines++
+		}
+	}
+	if limits.MaxPipelines > 0 && pipelines > limits.MaxPipelines {
+		return fmt.Errorf("template renders %d pipelines, exceeding the limit of %d pipelines", pipelines, limits.MaxPipelines)
+	}
+
+	return nil
+}
+
+// ValidateSize validates the spec of the CLF rendered for a hosted cluster does not exceed the size limit
+func ValidateSize(clf *loggingv1.ClusterLogForwarder, limits Limits) error {
+	if limits.MaxSize <= 0 {
+		return nil
+	}
+	data, err := json.Marshal(clf.Spec)
+	if err != nil {
+		return fmt.Errorf("failed to measure the size of the CLF %s: %w", clf.Name, err)
+	}
+	if len(data) > limits.MaxSize {
+		return fmt.Errorf("CLF %s renders %d bytes, exceeding the limit of %d bytes", clf.Name, len(data), limits.MaxSize)
+	}
+	return nil
+}
+
+// OrphanedOutputs returns the outputs of the template and of its platform outputs referenced by no pipeline,
+// neither directly nor as the fallback of a referenced output. The disabled pipelines count as references
+func OrphanedOutputs(template *v1alpha1.ClusterLogForwarderTemplate) []string {
+	referenced := map[string]bool{}
+	for _, ppl := range template.Spec.Template.Pipelines {
+		for _, ref := range ppl.OutputRefs {
+			referenced[ref] = true
+		}
+	}
+	for _, opts := range template.Spec.OutputOptions {
+		if referenced[opts.Name] && opts.Fallback != "" {
+			referenced[opts.Fallback] = true
+		}
+	}
+
+	outputs := template.Spec.Template.Outputs
+	for _, po := range template.Spec.PlatformOutputs {
+		outputs = append(outputs, po.Outputs...)
+	}
+	var orphaned []string
+	for _, output := range outputs {
+		if !referenced[output.Name] && !contains(orphaned, output.Name) {
+			orphaned = append(orphaned, output.Name)
+		}
+	}
+	return orphaned
+}
+
+// DisabledOutputs returns the outputs of the template referenced by its disabled pipelines only, directly or as the
+// fallback of a referenced output. They are rendered but forward nothing, unlike the orphaned outputs left unset
+func DisabledOutputs(template *v1alpha1.ClusterLogForwarderTemplate) map[string]bool {
+	enabled, disabled := map[string]bool{}, map[string]bool{}
+	for _, ppl := range template.Spec.Template.Pipelines {
+		referenced := enabled
+		if !template.Spec.GetPipelineOptions(ppl.Name).IsEnabled() {
+			referenced = disabled
+		}
+		for _, ref := range ppl.OutputRefs {
+			referenced[ref] = true
+			if opts := template.Spec.GetOutputOptions(ref); opts != nil && opts.Fallback != "" {
+				referenced[opts.Fallback] = true
+			}
+		}
+	}
+	for name := range enabled {
+		delete(disabled, name)
+	}
+	return disabled
+}
+
+// ValidateOrphanedOutputs validates every output of the template is referenced by a pipeline
+func ValidateOrphanedOutputs(template *v1alpha1.ClusterLogForwarderTemplate) error {
+	if orphaned := OrphanedOutputs(template); len(orphaned) > 0 {
+		return fmt.Errorf("outputs referenced by no pipeline: %s", strings.Join(orphaned, ", "))
+	}
+	return nil
+}
+
+// ValidatePlatformOutputs validates the outputs of each platform once merged with the template outputs
+func ValidatePlatformOutputs(template *v1alpha1.ClusterLogForwarderTemplate, templateOutputs []loggingv1.OutputSpec) error {
+	platforms := map[string]bool{}
+	for _, po := range template.Spec.PlatformOutputs {
+		if platforms[po.Platform] {
+			return fmt.Errorf("outputs of the platform %s are defined more than once", po.Platform)
+		}
+		platforms[po.Platform] = true
+
+		clf, err := BuildPlatformOutputsFromTemplate(template, &loggingv1.ClusterLogForwarder{}, po.Platform)
+		if err != nil {
+			return err
+		}
+		for _, output := range clf.Spec.Outputs {
+			for _, to := range templateOutputs {
+				if output.Name == to.Name {
+					return hloerrors.Wrap(hloerrors.ErrMergeConflict,
+						fmt.Errorf("output %s of the platform %s is already defined in the template", output.Name, po.Platform))
+				}
+			}
+		}
+		if err := ValidateOutputs(clf.Spec.Outputs); err != nil {
+			return fmt.Errorf("platform %s: %w", po.Platform, err)
+		}
+	}
+
+	return nil
+}
+
+// ValidatePipelines validates the template renders at least one enabled pipeline, the inputs of each enabled
+// pipeline are forwarded to at least one output and every input of the template is referenced by an enabled
+// pipeline, so that every log type of the template reaches a log store
+func ValidatePipelines(template *v1alpha1.ClusterLogForwarderTemplate) error {
+	enabled := 0
+	referenced := map[string]bool{}
+	for i, ppl := range template.Spec.Template.Pipelines {
+		if !template.Spec.GetPipelineOptions(ppl.Name).IsEnabled() {
+			continue
+		}
+		enabled++
+		for _, ref := range ppl.InputRefs {
+			referenced[ref] = true
+		}
+		name := ppl.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i)
+		}
+		if len(ppl.InputRefs) == 0 {
+			return fmt.Errorf("pipeline %s has no input", name)
+		}
+		if len(ppl.OutputRefs) == 0 {
+			return fmt.Errorf("pipeline %s forwards the inputs %s to no output", name, strings.Join(ppl.InputRefs, ", "))
+		}
+		if contains(ppl.InputRefs, InputHTTPServerName) && !template.Spec.IsHCPAuditEnabled() {
+			return fmt.Errorf("pipeline %s forwards the input %s of the hosted control plane audit, which is not enabled", name, InputHTTPServerName)
+		}
+	}
+	if enabled == 0 {
+		return fmt.Errorf("template %s has no enabled pipeline, it would forward no logs", template.Name)
+	}
+	for _, input := range template.Spec.Template.Inputs {
+		if !referenced[input.Name] {
+			return fmt.Errorf("input %s is forwarded by no enabled pipeline", input.Name)
+		}
+	}
+
+	return nil
+}
+
+// ValidatePipelineOptions validates the pipeline options refer to pipelines of the template
+func ValidatePipelineOptions(template *v1alpha1.ClusterLogForwarderTemplate) error {
+	pipelines := map[string]bool{}
+	for _, ppl := range template.Spec.Template.Pipelines {
+		if ppl.Name != "" {
+			pipelines[ppl.Name] = true
+		}
+	}
+
+	for _, opts := range template.Spec.PipelineOptions {
+		if !pipelines[opts.Name] {
+			return fmt.Errorf("pipeline options refer to the unknown pipeline %s", opts.Name)
+		}
+		if opts.MinSeverity != "" {
+			if _, err := ParseSeverity(opts.MinSeverity); err != nil {
+				return fmt.Errorf("pipeline options of %s: %w", opts.Name, err)
+			}
+		}
+		for k, v := range opts.Labels {
+			if errs := validation.IsQualifiedName(k); len(errs) > 0 {
+				return fmt.Errorf("pipeline options of %s: invalid label key %q: %s", opts.Name, k, strings.Join(errs, "; "))
+			}
+			if errs := validation.IsValidLabelValue(v); len(errs) > 0 {
+				return fmt.Errorf("pipeline options of %s: invalid value of the label %s: %s", opts.Name, k, strings.Join(errs, "; "))
+			}
+		}
+		// A filter ordered twice would be applied at two contradicting positions
+		for i, name := range opts.FilterOrder {
+			if contains(opts.FilterOrder[:i], name) {
+				return fmt.Errorf("pipeline options of %s: the filter %s is ordered more than once", opts.Name, name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ValidateOutputOptions validates the output options refer to outputs of the template or of the platform outputs
+// and set the timeout and the retry durations within their ranges
+func ValidateOutputOptions(template *v1alpha1.ClusterLogForwarderTemplate) error {
+	// The platform outputs may share a name with a different type
+	outputs := map[string][]string{}
+	for _, output := range template.Spec.Template.Outputs {
+		outputs[output.Name] = append(outputs[output.Name], output.Type)
+	}
+	for _, po := range template.Spec.PlatformOutputs {
+		for _, output := range po.Outputs {
+			outputs[output.Name] = append(outputs[output.Name], output.Type)
+		}
+	}
+
+	for _, opts := range template.Spec.OutputOptions {
+		types, ok := outputs[opts.Name]
+		if !ok {
+			return fmt.Errorf("output options refer to the unknown output %s", opts.Name)
+		}
+		if err := validateOutputTimeouts(opts, types); err != nil {
+			return fmt.Errorf("output options of %s: %w", opts.Name, err)
+		}
+		if err := validateMaxWrite(opts.MaxWrite); err != nil {
+			return fmt.Errorf("output options of %s: %w", opts.Name, err)
+		}
+		if err := validateFallback(template, opts, outputs); err != nil {
+			return fmt.Errorf("output options of %s: %w", opts.Name, err)
+		}
+		if err := validateSecretByReference(template, opts); err != nil {
+			return fmt.Errorf("output options of %s: %w", opts.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// validateFallback validates the fallback of the output is another known output without a fallback itself
+func validateFallback(template *v1alpha1.ClusterLogForwarderTemplate, opts v1alpha1.OutputOptions, outputs map[string][]string) error {
+	if opts.Fallback == "" {
+		return nil
+	}
+	if opts.Fallback == opts.Name {
+		return fmt.Errorf("the output cannot be its own fallback")
+	}
+	if _, ok := outputs[opts.Fallback]; !ok {
+		return fmt.Errorf("unknown fallback output %s", opts.Fallback)
+	}
+	if fallbackOpts := template.Spec.GetOutputOptions(opts.Fallback); fallbackOpts != nil && fallbackOpts.Fallback != "" {
+		return fmt.Errorf("the fallback output %s cannot have a fallback itself", opts.Fallback)
+	}
+	return nil
+}
+
+// validateSecretByReference validates the outputs of the name reference a secret, by themselves or by the output
+// defaults, when their secret is used by reference. A secret used by reference is not copied from any namespace
+func validateSecretByReference(template *v1alpha1.ClusterLogForwarderTemplate, opts v1alpha1.OutputOptions) error {
+	if !opts.SecretByReference {
+		return nil
+	}
+	if opts.SecretNamespace != "" {
+		return fmt.Errorf("the secret is used by reference, it cannot be copied from the namespace %s", opts.SecretNamespace)
+	}
+	outputs := template.Spec.Template.Outputs
+	for _, po := range template.Spec.PlatformOutputs {
+		outputs = append(outputs, po.Outputs...)
+	}
+	for _, output := range outputs {
+		if output.Name != opts.Name {
+			continue
+		}
+		if MergeOutputDefaults(output, template.Spec.OutputDefaults).Secret == nil {
+			return fmt.Errorf("the secret is used by reference but the output references no secret")
+		}
+	}
+	return nil
+}
+
+// ValidateSecretNamespaces validates the output secrets of the template, tuned for each of its environments,
+// are copied from the template namespace or one of the secret namespaces of the operator
+func ValidateSecretNamespaces(template *v1alpha1.ClusterLogForwarderTemplate, namespaces []string) error {
+	environments := []string{""}
+	for _, tuning := range template.Spec.Environments {
+		environments = append(environments, tuning.Environment)
+	}
+	for _, environment := range environments {
+		for _, opts := range ForEnvironment(template, environment).Spec.OutputOptions {
+			if opts.SecretNamespace == "" || opts.SecretNamespace == template.Namespace || contains(namespaces, opts.SecretNamespace) {
+				continue
+			}
+			err := fmt.Errorf("output options of %s: the secret namespace %s is not a secret namespace of the operator",
+				opts.Name, opts.SecretNamespace)
+			if environment != "" {
+				return fmt.Errorf("environment %s: %w", environment, err)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// validateMaxWrite validates the batch size of the output is within its range
+func validateMaxWrite(maxWrite *resource.Quantity) error {
+	if maxWrite == nil {
+		return nil
+	}
+	if maxWrite.Cmp(minMaxWrite) < 0 || maxWrite.Cmp(maxMaxWrite) > 0 {
+		return fmt.Errorf("maxWrite %s is out of the range %s-%s", maxWrite, &minMaxWrite, &maxMaxWrite)
+	}
+	return nil
+}
+
+// validateOutputTimeouts validates the timeout is only set on http outputs and the durations are within their ranges
+func validateOutputTimeouts(opts v1alpha1.OutputOptions, outputTypes []string) error {
+	if opts.Timeout != nil {
+		for _, t := range outputTypes {
+			if t != loggingv1.OutputTypeHttp {
+				return fmt.Errorf("timeout is not supported by the %s outputs", t)
+			}
+		}
+		if err := validateDurationRange("timeout", opts.Timeout, minOutputTimeout, maxOutputTimeout); err != nil {
+			return err
+		}
+	}
+	if err := validateDurationRange("minRetryDuration", opts.MinRetryDuration, minRetryDuration, maxRetryDuration); err != nil {
+		return err
+	}
+	if err := validateDurationRange("maxRetryDuration", opts.MaxRetryDuration, minRetryDuration, maxRetryDuration); err != nil {
+		return err
+	}
+	if opts.MinRetryDuration != nil && opts.MaxRetryDuration != nil &&
+		opts.MinRetryDuration.Duration > opts.MaxRetryDuration.Duration {
+		return fmt.Errorf("minRetryDuration %s is longer than maxRetryDuration %s",
+			opts.MinRetryDuration.Duration, opts.MaxRetryDuration.Duration)
+	}
+	return nil
+}
+
+// validateDurationRange validates the duration, if set, is between min and max
+func validateDurationRange(name string, d *metav1.Duration, min time.Duration, max time.Duration) error {
+	if d == nil {
+		return nil
+	}
+	if d.Duration < min || d.Duration > max {
+		return fmt.Errorf("%s %s is out of the range %s-%s", name, d.Duration, min, max)
+	}
+	return nil
+}
+
+// ValidateMultiline validates the multiline pipeline patterns are valid regular expressions
+func ValidateMultiline(template *v1alpha1.ClusterLogForwarderTemplate) error {
+	if template.Spec.Multiline == nil {
+		return nil
+	}
+
+	for _, pattern := range template.Spec.Multiline.PipelinePatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid multiline pipeline pattern %q: %w", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+// ValidateCollectionSources validates the extra collection sources of the template are uniquely named
+// and only collect the allowed sources of their type
+func ValidateCollectionSources(template *v1alpha1.ClusterLogForwarderTemplate) error {
+	names := map[string]bool{}
+	for _, source := range template.Spec.CollectionSources {
+		if source.Name == "" {
+			return fmt.Errorf("collection source name is required")
+		}
+		if isReservedInputName(source.Name) {
+			return fmt.Errorf("collection source name %s is reserved", source.Name)
+		}
+		if names[source.Name] {
+			return fmt.Errorf("collection source %s is defined more than once", source.Name)
+		}
+		names[source.Name] = true
+
+		allowed, ok := allowedCollectionSources[source.Type]
+		if !ok {
+			return fmt.Errorf("collection source %s has unsupported type %q", source.Name, source.Type)
+		}
+		if len(source.Sources) == 0 {
+			return fmt.Errorf("collection source %s has no sources", source.Name)
+		}
+		for _, src := range source.Sources {
+			if !contains(allowed, src) {
+				return fmt.Errorf("collection source %s: source %q is not allowed for %s logs, allowed sources are %s",
+					source.Name, src, source.Type, strings.Join(allowed, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateNamespaceRateLimits validates the namespace rate limits of the template are uniquely named inputs,
+// distinct from the collection sources, each capping a single valid namespace with a positive rate
+func ValidateNamespaceRateLimits(template *v1alpha1.ClusterLogForwarderTemplate) error {
+	names := map[string]bool{}
+	for _, source := range template.Spec.CollectionSources {
+		names[source.Name] = true
+	}
+	namespaces := map[string]bool{}
+	for _, limit := range template.Spec.NamespaceRateLimits {
+		if limit.Name == "" {
+			return fmt.Errorf("namespace rate limit name is required")
+		}
+		if isReservedInputName(limit.Name) {
+			return fmt.Errorf("namespace rate limit name %s is reserved", limit.Name)
+		}
+		if names[limit.Name] {
+			return fmt.Errorf("input %s of the namespace rate limit is defined more than once", limit.Name)
+		}
+		names[limit.Name] = true
+
+		if errs := validation.IsDNS1123Label(limit.Namespace); len(errs) > 0 {
+			return fmt.Errorf("namespace rate limit %s: invalid namespace %q: %s", limit.Name, limit.Namespace, strings.Join(errs, "; "))
+		}
+		if namespaces[limit.Namespace] {
+			return fmt.Errorf("namespace %s is rate limited more than once", limit.Namespace)
+		}
+		namespaces[limit.Namespace] = true
+
+		if limit.MaxRecordsPerSecond <= 0 {
+			return fmt.Errorf("namespace rate limit %s must allow a positive number of records per second, got %d",
+				limit.Name, limit.MaxRecordsPerSecond)
+		}
+	}
+	return nil
+}
+
+// ValidatePodSelectors validates the pod selectors of the template are uniquely named inputs, distinct from
+// the other inputs of the template, each selecting the pods by valid labels in valid namespaces
+func ValidatePodSelectors(template *v1alpha1.ClusterLogForwarderTemplate) error {
+	names := map[string]bool{}
+	for _, source := range template.Spec.CollectionSources {
+		names[source.Name] = true
+	}
+	for _, limit := range template.Spec.NamespaceRateLimits {
+		names[limit.Name] = true
+	}
+	for _, selector := range template.Spec.PodSelectors {
+		if selector.Name == "" {
+			return fmt.Errorf("pod selector name is required")
+		}
+		if isReservedInputName(selector.Name) {
+			return fmt.Errorf("pod selector name %s is reserved", selector.Name)
+		}
+		if names[selector.Name] {
+			return fmt.Errorf("input %s of the pod selector is defined more than once", selector.Name)
+		}
+		names[selector.Name] = true
+
+		// The empty selector would collect all the pods, as the application input does
+		if len(selector.MatchLabels) == 0 {
+			return fmt.Errorf("pod selector %s selects no label", selector.Name)
+		}
+		if _, err := labels.ValidatedSelectorFromSet(selector.MatchLabels); err != nil {
+			return fmt.Errorf("pod selector %s: invalid labels: %w", selector.Name, err)
+		}
+		for _, ns := range selector.Namespaces {
+			if errs := validation.IsDNS1123Label(ns); len(errs) > 0 {
+				return fmt.Errorf("pod selector %s: invalid namespace %q: %s", selector.Name, ns, strings.Join(errs, "; "))
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateSystemNamespaces validates the namespace patterns added to or removed from the system namespaces
+func ValidateSystemNamespaces(template *v1alpha1.ClusterLogForwarderTemplate) error {
+	opts := template.Spec.SystemNamespaces
+	if opts == nil {
+		return nil
+	}
+	for _, ns := range append(append([]string{}, opts.Add...), opts.Remove...) {
+		if err := ValidateNamespacePattern(ns); err != nil {
+			return fmt.Errorf("system namespaces: %w", err)
+		}
+	}
+	return nil
+}
+
+func isReservedInputName(name string) bool {
+	return contains(reservedInputNames, name)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateOutputs validates the outputs once merged with the template defaults
+func ValidateOutputs(outputs []loggingv1.OutputSpec) error {
+	for _, output := range outputs {
+		// The URL holding tokens is only known once the values of the cluster are substituted
+		if output.URL != "" && !HasValueTokens(output.URL) {
+			if _, err := url.Parse(output.URL); err != nil {
+				return fmt.Errorf("output %s has an invalid URL: %w", output.Name, err)
+			}
+		}
+		if output.TLS != nil && IsInsecureURL(output.URL) {
+			return fmt.Errorf("output %s sets TLS options on the insecure URL %s", output.Name, output.URL)
+		}
+		if output.Secret != nil && output.Secret.Name == "" {
+			return fmt.Errorf("output %s references a secret without name", output.Name)
+		}
+		if output.Limit != nil && output.Limit.MaxRecordsPerSecond < 0 {
+			return fmt.Errorf("output %s has a negative limit of %d records per second", output.Name, output.Limit.MaxRecordsPerSecond)
+		}
+		if output.Tuning != nil && !IsSupportedCompression(output.Type, output.Tuning.Compression) {
+			return fmt.Errorf("output %s of type %s does not support the %s compression", output.Name, output.Type, output.Tuning.Compression)
+		}
+		if output.Type == loggingv1.OutputTypeAzureMonitor {
+			if err := validateAzureMonitor(output); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateAzureMonitor validates the Azure Monitor output sets the workspace ID, the log type
+// and the secret holding the shared key
+func validateAzureMonitor(output loggingv1.OutputSpec) error {
+	if output.AzureMonitor == nil || output.AzureMonitor.CustomerId == "" {
+		return fmt.Errorf("azure monitor output %s requires the workspace ID as customerId", output.Name)
+	}
+	if output.AzureMonitor.LogType == "" {
+		return fmt.Errorf("azure monitor output %s requires the log type", output.Name)
+	}
+	if output.Secret == nil {
+		return fmt.Errorf("azure monitor output %s requires a secret holding the %s", output.Name, AzureMonitorSharedKey)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package clusterlogforwarder
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	loggingv1 "github.com/openshift/cluster-logging-operator/apis/logging/v1"
+)
+
+// valueToken matches the ${key} interpolation tokens of the templates
+var valueToken = regexp.MustCompile(`\$\{([A-Za-z0-9_.-]+)\}`)
+
+// HasValueTokens returns true if the string holds ${key} tokens substituted at render time
+func HasValueTokens(s string) bool {
+	return valueToken.MatchString(s)
+}
+
+// SubstituteValues replaces the ${key} tokens in the CLF spec with the values of the cluster.
+// The tokens without value are left intact and their keys are returned
+func SubstituteValues(clf *loggingv1.ClusterLogForwarder, values map[string]string) (*loggingv1.ClusterLogForwarder, []string, error) {
+	spec, err := json.Marshal(clf.Spec)
+	if err != nil {
+		return clf, nil, fmt.Errorf("failed to render the template values: %w", err)
+	}
+
+	missing := map[string]bool{}
+	spec = valueToken.ReplaceAllFunc(spec, func(token []byte) []byte {
+		key := string(valueToken.FindSubmatch(token)[1])
+		value, ok := values[key]
+		if !ok {
+			missing[key] = true
+			return token
+		}
+		// The value is escaped to be embedded in a JSON string
+		escaped, _ := json.Marshal(value)
+		return escaped[1 : len(escaped)-1]
+	})
+
+	substituted := loggingv1.ClusterLogForwarderSpec{}
+	if err := json.Unmarshal(spec, &substituted); err != nil {
+		return clf, nil, fmt.Errorf("failed to render the template values: %w", err)
+	}
+	clf.Spec = substituted
+
+	keys := make([]string, 0, len(missing))
+	for key := range missing {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return clf, keys, nil
+}
+
+// MergeValues returns the values merged in order, the later values take precedence
+func MergeValues(values ...map[string]string) map[string]string {
+	merged := map[string]string{}
+	for _, v := range values {
+		for key, value := range v {
+			merged[key] = value
+		}
+	}
+	return merged
+}
+
+// ValidateSubstitutedURLs validates the URLs of the outputs once the values are substituted
+// are absolute URLs with a well formed host, the URLs still holding tokens without value are skipped
+func ValidateSubstitutedURLs(outputs []loggingv1.OutputSpec) error {
+	for _, output := range outputs {
+		if output.URL == "" || HasValueTokens(output.URL) || !strings.Contains(output.URL, "://") {
+			continue
+		}
+		parsed, err := url.Parse(output.URL)
+		if err != nil {
+			return fmt.Errorf("output %s has an invalid URL: %w", output.Name, err)
+		}
+		host := parsed.Hostname()
+		if host == "" || strings.HasPrefix(host, ".") || strings.HasSuffix(host, ".") || strings.Contains(host, "..") {
+			return fmt.Errorf("output %s has an invalid host in the URL %s", output.Name, output.URL)
+		}
+	}
+	return nil
+}
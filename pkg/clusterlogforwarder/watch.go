@@ -0,0 +1,75 @@
+package clusterlogforwarder
+
+import (
+	loggingv1 "github.com/openshift/cluster-logging-operator/apis/logging/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"github.com/openshift/hypershift-logging-operator/pkg/constants"
+)
+
+// SourceName returns the name of the object a resource managed by the operator was generated from,
+// false if the resource is not managed or not generated from the kind of object of sourceLabel
+func SourceName(obj client.Object, sourceLabel string) (string, bool) {
+	labels := obj.GetLabels()
+	if labels[constants.ManagedByLabel] != constants.ManagedByLabelValue || labels[sourceLabel] == "" {
+		return "", false
+	}
+	return labels[sourceLabel], true
+}
+
+// DeletedPredicate passes only the deletions of the resources generated from the kind of object of sourceLabel,
+// so that the resources deleted by hand are generated again
+func DeletedPredicate(sourceLabel string) predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc:  func(event.CreateEvent) bool { return false },
+		UpdateFunc:  func(event.UpdateEvent) bool { return false },
+		GenericFunc: func(event.GenericEvent) bool { return false },
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			_, ok := SourceName(e.Object, sourceLabel)
+			return ok
+		},
+	}
+}
+
+// ReadyCondition is the condition cluster-logging sets on the ClusterLogForwarder it accepts
+const ReadyCondition loggingv1.ConditionType = "Ready"
+
+// IsReady returns true if cluster-logging reports the ClusterLogForwarder ready
+func IsReady(clf *loggingv1.ClusterLogForwarder) bool {
+	return clf.Status.Conditions.IsTrueFor(ReadyCondition)
+}
+
+// ReadinessChangedPredicate passes only the updates of the resources generated from the kind of object
+// of sourceLabel changing the readiness reported by cluster-logging
+func ReadinessChangedPredicate(sourceLabel string) predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc:  func(event.CreateEvent) bool { return false },
+		DeleteFunc:  func(event.DeleteEvent) bool { return false },
+		GenericFunc: func(event.GenericEvent) bool { return false },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			if _, ok := SourceName(e.ObjectNew, sourceLabel); !ok {
+				return false
+			}
+			oldClf, ok := e.ObjectOld.(*loggingv1.ClusterLogForwarder)
+			if !ok {
+				return false
+			}
+			newClf, ok := e.ObjectNew.(*loggingv1.ClusterLogForwarder)
+			if !ok {
+				return false
+			}
+			return readiness(oldClf) != readiness(newClf)
+		},
+	}
+}
+
+// readiness returns the status of the ReadyCondition of the ClusterLogForwarder, empty if not reported
+func readiness(clf *loggingv1.ClusterLogForwarder) corev1.ConditionStatus {
+	if condition := clf.Status.Conditions.GetCondition(ReadyCondition); condition != nil {
+		return condition.Status
+	}
+	return ""
+}
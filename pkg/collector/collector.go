@@ -0,0 +1,125 @@
+package collector
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	loggingv1 "github.com/openshift/cluster-logging-operator/apis/logging/v1"
+	"github.com/prometheus/common/expfmt"
+)
+
+const (
+	// requestTimeout bounds the read of the metrics of a collector
+	requestTimeout = 10 * time.Second
+	// metricsPort is the port of the metrics endpoint of the collectors deployed by cluster-logging
+	metricsPort = 24231
+	// componentErrorsMetric counts the errors of the vector components, the sinks being the outputs of the CLF
+	componentErrorsMetric = "vector_component_errors_total"
+	// maxMetricsSize bounds the metrics read from a collector
+	maxMetricsSize = 8 << 20
+)
+
+// invalidComponentChars are replaced by cluster-logging in the IDs of the vector components
+var invalidComponentChars = regexp.MustCompile(`[^a-z0-9_]`)
+
+// ErrorReader reads the delivery errors reported by the collector of a CLF
+type ErrorReader interface {
+	// DeliveryErrors returns the number of errors of each output of the CLF since its collector started,
+	// e.g. the records rejected by the backend. The outputs without error are left out
+	DeliveryErrors(ctx context.Context, clf *loggingv1.ClusterLogForwarder) (map[string]int64, error)
+}
+
+var _ ErrorReader = &MetricsReader{}
+
+// MetricsReader reads the delivery errors from the errors of the sinks in the metrics of the vector collectors
+type MetricsReader struct {
+	// RootCAs are trusted by the metrics endpoints, the system roots if nil
+	RootCAs *x509.CertPool
+	// MetricsURL returns the URL of the metrics of the collector of the CLF, MetricsServiceURL if nil
+	MetricsURL func(clf *loggingv1.ClusterLogForwarder) string
+}
+
+// MetricsServiceURL returns the URL of the metrics of the collector of the CLF, served by the service named
+// by cluster-logging after the CLF
+func MetricsServiceURL(clf *loggingv1.ClusterLogForwarder) string {
+	return fmt.Sprintf("https://%s.%s.svc:%d/metrics", clf.Name, clf.Namespace, metricsPort)
+}
+
+// DeliveryErrors sums the errors of the sink of each output of the CLF reported by the collector
+func (m *MetricsReader) DeliveryErrors(ctx context.Context, clf *loggingv1.ClusterLogForwarder) (map[string]int64, error) {
+	metricsURL := MetricsServiceURL
+	if m.MetricsURL != nil {
+		metricsURL = m.MetricsURL
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metricsURL(clf), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := m.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the collector metrics: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("the collector rejected the read of its metrics with status %d", resp.StatusCode)
+	}
+
+	parser := expfmt.TextParser{}
+	families, err := parser.TextToMetricFamilies(io.LimitReader(resp.Body, maxMetricsSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the collector metrics: %w", err)
+	}
+	family, ok := families[componentErrorsMetric]
+	if !ok {
+		return nil, nil
+	}
+
+	// The sinks are named after the outputs, with the output_ prefix since cluster-logging 6
+	sinks := map[string]string{}
+	for _, output := range clf.Spec.Outputs {
+		id := SinkID(output.Name)
+		sinks[id] = output.Name
+		sinks["output_"+id] = output.Name
+	}
+	errors := map[string]int64{}
+	for _, metric := range family.GetMetric() {
+		labels := map[string]string{}
+		for _, label := range metric.GetLabel() {
+			labels[label.GetName()] = label.GetValue()
+		}
+		if labels["component_kind"] != "sink" {
+			continue
+		}
+		output, ok := sinks[labels["component_id"]]
+		if !ok {
+			continue
+		}
+		if value := int64(metric.GetCounter().GetValue()); value > 0 {
+			errors[output] += value
+		}
+	}
+	return errors, nil
+}
+
+// SinkID returns the ID of the vector component of the output as rendered by cluster-logging, lowercased
+// with the characters other than letters, digits and underscores replaced
+func SinkID(output string) string {
+	return invalidComponentChars.ReplaceAllString(strings.ToLower(output), "_")
+}
+
+// client returns the HTTP client trusting the root CAs
+func (m *MetricsReader) client() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: m.RootCAs, MinVersion: tls.VersionTLS12}
+	return &http.Client{Transport: transport}
+}
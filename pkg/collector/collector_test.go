@@ -0,0 +1,124 @@
+package collector
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	loggingv1 "github.com/openshift/cluster-logging-operator/apis/logging/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// stubCollector serves the metrics of a vector collector
+type stubCollector struct {
+	metrics string
+	status  int
+}
+
+func (c *stubCollector) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if c.status != 0 {
+		w.WriteHeader(c.status)
+		return
+	}
+	if req.URL.Path != "/metrics" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	_, _ = w.Write([]byte(c.metrics))
+}
+
+const testMetrics = `# HELP vector_component_errors_total The total number of errors encountered by the component.
+# TYPE vector_component_errors_total counter
+vector_component_errors_total{component_id="loki_app",component_kind="sink",component_type="loki",error_type="request_failed"} 3
+vector_component_errors_total{component_id="loki_app",component_kind="sink",component_type="loki",error_type="encoder_failed"} 2
+vector_component_errors_total{component_id="output_es",component_kind="sink",component_type="elasticsearch",error_type="request_failed"} 7
+vector_component_errors_total{component_id="cloudwatch",component_kind="sink",component_type="aws_cloudwatch_logs",error_type="request_failed"} 0
+vector_component_errors_total{component_id="loki_app",component_kind="transform",component_type="remap",error_type="conversion_failed"} 11
+vector_component_errors_total{component_id="unknown",component_kind="sink",component_type="http",error_type="request_failed"} 5
+# HELP vector_component_sent_events_total The total number of events emitted by this component.
+# TYPE vector_component_sent_events_total counter
+vector_component_sent_events_total{component_id="loki_app",component_kind="sink",component_type="loki"} 100
+`
+
+func TestDeliveryErrors(t *testing.T) {
+	clf := &loggingv1.ClusterLogForwarder{
+		ObjectMeta: metav1.ObjectMeta{Name: "instance", Namespace: "clusters-test"},
+		Spec: loggingv1.ClusterLogForwarderSpec{
+			Outputs: []loggingv1.OutputSpec{
+				{Name: "loki-app", Type: loggingv1.OutputTypeLoki},
+				{Name: "es", Type: loggingv1.OutputTypeElasticsearch},
+				{Name: "cloudwatch", Type: loggingv1.OutputTypeCloudwatch},
+			},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		collector *stubCollector
+		expected  map[string]int64
+		expectErr bool
+	}{
+		{
+			name:      "errors of the sinks of the outputs",
+			collector: &stubCollector{metrics: testMetrics},
+			expected:  map[string]int64{"loki-app": 5, "es": 7},
+		},
+		{
+			name:      "collector without component errors",
+			collector: &stubCollector{metrics: "# TYPE vector_started_total counter\nvector_started_total 1\n"},
+		},
+		{
+			name:      "collector metrics unavailable",
+			collector: &stubCollector{status: http.StatusServiceUnavailable},
+			expectErr: true,
+		},
+		{
+			name:      "invalid metrics",
+			collector: &stubCollector{metrics: "vector_component_errors_total{component_id=\n"},
+			expectErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(test.collector)
+			defer server.Close()
+			reader := &MetricsReader{
+				MetricsURL: func(*loggingv1.ClusterLogForwarder) string { return server.URL + "/metrics" },
+			}
+
+			errors, err := reader.DeliveryErrors(context.TODO(), clf)
+			if (err != nil) != test.expectErr {
+				t.Fatalf("mismatched err, expected %v, got %v", test.expectErr, err)
+			}
+			if len(errors) > 0 || len(test.expected) > 0 {
+				if !reflect.DeepEqual(errors, test.expected) {
+					t.Errorf("mismatched delivery errors, expected %v, got %v", test.expected, errors)
+				}
+			}
+		})
+	}
+}
+
+func TestMetricsServiceURL(t *testing.T) {
+	clf := &loggingv1.ClusterLogForwarder{ObjectMeta: metav1.ObjectMeta{Name: "instance", Namespace: "clusters-test"}}
+	expected := "https://instance.clusters-test.svc:24231/metrics"
+	if url := MetricsServiceURL(clf); url != expected {
+		t.Errorf("mismatched metrics URL, expected %s, got %s", expected, url)
+	}
+}
+
+func TestSinkID(t *testing.T) {
+	for output, expected := range map[string]string{
+		"loki":           "loki",
+		"Loki-App":       "loki_app",
+		"es.remote-1":    "es_remote_1",
+		"already_valid2": "already_valid2",
+	} {
+		if id := SinkID(output); id != expected {
+			t.Errorf("mismatched sink ID of %s, expected %s, got %s", output, expected, id)
+		}
+	}
+}
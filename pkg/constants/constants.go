@@ -11,4 +11,81 @@ const (
 	TokenRefreshDuration          = time.Minute * 30
 	CloudWatchSecretName          = "cloudwatch-credentials"
 	CollectorCloudWatchSecretName = "collector-cloudwatch-credentials"
+	// EventRouterServiceAccountName is the service account of the guest cluster the event routers read the events
+	// with, it is granted to read the events only. It lives in MintServiceAccountNamespace
+	EventRouterServiceAccountName = "hypershift-logging-eventrouter"
+	// EventRouterKubeConfigSecretName is the secret of the HCP namespace holding the kubeconfig and the token of
+	// EventRouterServiceAccountName, mounted in the event routers at EventRouterKubeConfigPath
+	EventRouterKubeConfigSecretName = "hypershift-logging-eventrouter-kubeconfig"
+	EventRouterKubeConfigPath       = "/etc/kubernetes/kubeconfig"
+	// TemplateValuesConfigMapName is the ConfigMap in the HCP namespace holding the values substituted into the templates
+	TemplateValuesConfigMapName = "hypershift-logging-template-values"
+	// PauseConfigMapName is the ConfigMap in the operator namespace pausing the reconciliation of all the forwarders
+	// while its PausedKey is "true"
+	PauseConfigMapName = "hypershift-logging-pause"
+	PausedKey          = "paused"
+	// PausedRequeueInterval is how often the paused forwarders check whether the reconciliation is resumed
+	PausedRequeueInterval = time.Minute
+
+	// ManagedKeyPrefix is the prefix of the labels and annotations managed by the operator
+	ManagedKeyPrefix = "logging.managed.openshift.io/"
+
+	// Labels stamped on the generated resources so they can be tracked back to their source
+	ManagedByLabel              = "app.kubernetes.io/managed-by"
+	ManagedByLabelValue         = "hypershift-logging-operator"
+	TemplateLabel               = "logging.managed.openshift.io/template"
+	HyperShiftLogForwarderLabel = "logging.managed.openshift.io/hypershiftlogforwarder"
+
+	// Annotations recording the audit trail of the generated resources
+	SourceAnnotation           = "logging.managed.openshift.io/source"
+	SourceGenerationAnnotation = "logging.managed.openshift.io/source-generation"
+	AppliedByAnnotation        = "logging.managed.openshift.io/applied-by"
+	LastAppliedTimeAnnotation  = "logging.managed.openshift.io/last-applied-time"
+	// LoggingVersionAnnotation records on a HostedCluster the version of cluster-logging detected in the guest
+	// cluster, and on a CLF the version of cluster-logging it is rendered for
+	LoggingVersionAnnotation = "logging.managed.openshift.io/logging-version"
+	// LoggingOperatorCSVPrefix is the prefix of the names of the CSVs of the cluster-logging operator,
+	// e.g. cluster-logging.v5.8.0
+	LoggingOperatorCSVPrefix = "cluster-logging."
+	// ReferencedByAnnotation records on a secret copy the comma separated templates referencing it, the copy shared
+	// by templates is deleted once no template references it anymore
+	ReferencedByAnnotation = "logging.managed.openshift.io/referenced-by"
+	// SecretsHashAnnotation records the hash of the output secrets copied for the CLF, it changes when they rotate
+	SecretsHashAnnotation = "logging.managed.openshift.io/secrets-hash"
+
+	// UnmanagedAnnotation set to "true" on a generated resource stops the operator from reconciling it
+	UnmanagedAnnotation = "logging.managed.openshift.io/unmanaged"
+
+	// ForceDeleteAnnotation set to "true" on a template allows deleting it while it is still applied to clusters
+	ForceDeleteAnnotation = "logging.managed.openshift.io/force-delete"
+
+	// ShadowAnnotation set to "true" on a template applies it to a shadow ClusterLogForwarder, named after the template
+	// with ShadowSuffix and labeled with ShadowLabel, while the ClusterLogForwarder of the template is left as last applied
+	ShadowAnnotation = "logging.managed.openshift.io/shadow"
+	ShadowLabel      = "logging.managed.openshift.io/shadow"
+	ShadowSuffix     = "-shadow"
+
+	// HCPNamespaceAnnotation records on a HostedCluster the HCP namespace resolved by the operator for it
+	HCPNamespaceAnnotation = "logging.managed.openshift.io/hcp-namespace"
+
+	// EnvironmentLabel on a HostedCluster selects the environment tuning of the templates, e.g. prod or dev
+	EnvironmentLabel = "logging.managed.openshift.io/environment"
+	// DisabledLabel set to "true" on a HostedCluster excludes it from all logging, its forwarding is torn down
+	// and it is not onboarded. The default of the label configured with --disabled-label
+	DisabledLabel = "logging.managed.openshift.io/disabled"
+	// HostedClusterAnnotation on a HostedControlPlane is set by HyperShift to the namespace/name of its HostedCluster
+	HostedClusterAnnotation = "hypershift.openshift.io/cluster"
+
+	// SkipDefaultTemplatesAnnotation set to "true" on a HostedControlPlane opts the hosted cluster out of the default templates
+	SkipDefaultTemplatesAnnotation = "logging.managed.openshift.io/skip-default-templates"
+
+	// Condition recording on the HostedCluster whether the operator is permitted to onboard it
+	PermissionsCondition     = "HyperShiftLoggingPermissions"
+	PermissionsDeniedReason  = "PermissionsDenied"
+	PermissionsGrantedReason = "PermissionsGranted"
+
+	// Condition recording on the HostedCluster whether it is suspended after consecutive failures
+	SuspendedCondition        = "HyperShiftLoggingSuspended"
+	ConsecutiveFailuresReason = "ConsecutiveFailures"
+	RecoveredReason           = "Recovered"
 )
@@ -0,0 +1,72 @@
+package errors
+
+import (
+	"errors"
+	"net"
+
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+)
+
+var (
+	// ErrGuestUnreachable is returned when the API server of the guest cluster cannot be reached, it is transient
+	ErrGuestUnreachable = errors.New("guest cluster unreachable")
+	// ErrKubeconfigMissing is returned when the kubeconfig secret of the guest cluster is not published yet,
+	// early in the provisioning of the hosted cluster
+	ErrKubeconfigMissing = errors.New("guest kubeconfig missing")
+	// ErrPermissionDenied is returned when the operator lacks a permission, retried until it is granted
+	ErrPermissionDenied = errors.New("permission denied")
+	// ErrInvalidTemplate is returned when a template cannot be rendered, retrying does not help until it is changed
+	ErrInvalidTemplate = errors.New("invalid template")
+	// ErrStrictValidation is returned in strict mode when the CLF of a hosted cluster would only be applied best-effort,
+	// e.g. without the options the cluster-logging version does not support. It is terminal as ErrInvalidTemplate
+	ErrStrictValidation = errors.New("strict validation failed")
+	// ErrInterpolation is returned when the values of a hosted cluster cannot be substituted into a template,
+	// e.g. a token without value in the name of the CLF. It is wrapped in ErrInvalidTemplate or ErrStrictValidation
+	ErrInterpolation = errors.New("interpolation failed")
+	// ErrMergeConflict is returned when the settings merged into a CLF conflict, e.g. a platform output named as
+	// an output of the template or a secret copied from two namespaces. It is wrapped in ErrInvalidTemplate
+	ErrMergeConflict = errors.New("merge conflict")
+)
+
+// categorizedError is an error of one of the categories above, its message is the one of the wrapped error
+type categorizedError struct {
+	category error
+	err      error
+}
+
+func (e *categorizedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *categorizedError) Unwrap() error {
+	return e.err
+}
+
+func (e *categorizedError) Is(target error) bool {
+	return target == e.category
+}
+
+// Wrap returns err in the category, nil if err is nil. errors.Is matches both the category and the errors wrapped by err
+func Wrap(category error, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &categorizedError{category: category, err: err}
+}
+
+// IsTerminal returns true if retrying cannot fix the error until the configuration is changed,
+// the reconcile of such an error is not requeued
+func IsTerminal(err error) bool {
+	return errors.Is(err, ErrInvalidTemplate) || errors.Is(err, ErrStrictValidation)
+}
+
+// IsUnreachable returns true if the API server could not be reached, the error is in the ErrGuestUnreachable
+// category or a connection failure of the client, e.g. refused, reset or timed out
+func IsUnreachable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var netErr net.Error
+	return errors.Is(err, ErrGuestUnreachable) || errors.As(err, &netErr) ||
+		utilnet.IsConnectionRefused(err) || utilnet.IsConnectionReset(err) || utilnet.IsProbableEOF(err)
+}
@@ -0,0 +1,92 @@
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"syscall"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestWrap(t *testing.T) {
+	notFound := apierrors.NewNotFound(schema.GroupResource{Resource: "secrets"}, "admin-kubeconfig")
+	err := Wrap(ErrKubeconfigMissing, fmt.Errorf("failed to get the kubeconfig: %w", notFound))
+
+	if !errors.Is(err, ErrKubeconfigMissing) {
+		t.Errorf("expected the %v category, got %v", ErrKubeconfigMissing, err)
+	}
+	if errors.Is(err, ErrGuestUnreachable) {
+		t.Errorf("unexpected %v category", ErrGuestUnreachable)
+	}
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("expected the wrapped error to be matched, got %v", err)
+	}
+	expected := `failed to get the kubeconfig: secrets "admin-kubeconfig" not found`
+	if err.Error() != expected {
+		t.Errorf("mismatched message, expected %q, got %q", expected, err.Error())
+	}
+	// The nested categories are matched along with the outer one
+	nested := Wrap(ErrInvalidTemplate, Wrap(ErrInterpolation, fmt.Errorf("token without value")))
+	if !errors.Is(nested, ErrInvalidTemplate) || !errors.Is(nested, ErrInterpolation) {
+		t.Errorf("expected the %v and %v categories, got %v", ErrInvalidTemplate, ErrInterpolation, nested)
+	}
+	if Wrap(ErrKubeconfigMissing, nil) != nil {
+		t.Error("expected nil for a nil error")
+	}
+}
+
+func TestIsTerminal(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{err: Wrap(ErrInvalidTemplate, fmt.Errorf("unknown pipeline")), expected: true},
+		{err: fmt.Errorf("reconcile: %w", Wrap(ErrInvalidTemplate, fmt.Errorf("unknown pipeline"))), expected: true},
+		{err: Wrap(ErrStrictValidation, fmt.Errorf("unsupported option")), expected: true},
+		{err: Wrap(ErrInvalidTemplate, Wrap(ErrMergeConflict, fmt.Errorf("output defined twice"))), expected: true},
+		{err: Wrap(ErrGuestUnreachable, fmt.Errorf("connection refused")), expected: false},
+		{err: Wrap(ErrKubeconfigMissing, fmt.Errorf("not found")), expected: false},
+		{err: Wrap(ErrPermissionDenied, fmt.Errorf("denied")), expected: false},
+		{err: fmt.Errorf("conflict"), expected: false},
+	}
+
+	for _, test := range tests {
+		if IsTerminal(test.err) != test.expected {
+			t.Errorf("mismatched terminal %q, expected %v, got %v", test.err, test.expected, !test.expected)
+		}
+	}
+}
+
+func TestIsUnreachable(t *testing.T) {
+	refused := &url.Error{
+		Op:  "Get",
+		URL: "https://api.guest:6443/api",
+		Err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED},
+	}
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{name: "connection refused", err: refused, expected: true},
+		{name: "wrapped connection refused", err: fmt.Errorf("failed to get the HLF: %w", refused), expected: true},
+		{name: "unknown host", err: &url.Error{Op: "Get", URL: "https://api.guest:6443/api", Err: &net.DNSError{Err: "no such host", Name: "api.guest"}}, expected: true},
+		{name: "connection reset", err: syscall.ECONNRESET, expected: true},
+		{name: "guest unreachable", err: Wrap(ErrGuestUnreachable, fmt.Errorf("discovery failed")), expected: true},
+		{name: "not found", err: apierrors.NewNotFound(schema.GroupResource{Resource: "secrets"}, "admin-kubeconfig"), expected: false},
+		{name: "conflict", err: fmt.Errorf("conflict"), expected: false},
+		{name: "nil", err: nil, expected: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if IsUnreachable(test.err) != test.expected {
+				t.Errorf("mismatched unreachable %v, expected %v, got %v", test.err, test.expected, !test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package hostedcluster
+
+import (
+	"context"
+	"fmt"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Permission is an access the operator requires to onboard a hosted cluster
+type Permission struct {
+	Group    string
+	Resource string
+	Verb     string
+	Name     string
+	// Namespace of the resource, the HCP namespace if empty
+	Namespace string
+}
+
+// String returns the permission in a readable "verb group/resource/name" form
+func (p Permission) String() string {
+	resource := p.Resource
+	if p.Group != "" {
+		resource = fmt.Sprintf("%s.%s", p.Resource, p.Group)
+	}
+	if p.Name != "" {
+		resource = fmt.Sprintf("%s/%s", resource, p.Name)
+	}
+	if p.Namespace != "" {
+		return fmt.Sprintf("%s %s in namespace %s", p.Verb, resource, p.Namespace)
+	}
+	return fmt.Sprintf("%s %s", p.Verb, resource)
+}
+
+// RequiredPermissions are the permissions needed in the HCP namespace to onboard a hosted cluster,
+// on top of reading the kubeconfig secret
+var RequiredPermissions = []Permission{
+	{Group: "hypershift.openshift.io", Resource: "hostedcontrolplanes", Verb: "list"},
+	{Group: "logging.openshift.io", Resource: "clusterlogforwarders", Verb: "get"},
+	{Group: "logging.openshift.io", Resource: "clusterlogforwarders", Verb: "create"},
+	{Group: "logging.openshift.io", Resource: "clusterlogforwarders", Verb: "update"},
+	{Group: "logging.openshift.io", Resource: "clusterlogforwarders", Verb: "delete"},
+}
+
+// CheckPermissions runs a SelfSubjectAccessReview for the kubeconfig secret and each of the
+// required permissions in the HCP namespace and returns the denied ones
+func CheckPermissions(
+	c client.Client,
+	ctx context.Context,
+	hcpNamespace string,
+	kubeConfigSecret types.NamespacedName,
+) ([]Permission, error) {
+
+	secretPermission := Permission{Resource: "secrets", Verb: "get", Name: kubeConfigSecret.Name}
+	if kubeConfigSecret.Namespace != hcpNamespace {
+		secretPermission.Namespace = kubeConfigSecret.Namespace
+	}
+
+	var denied []Permission
+	for _, p := range append([]Permission{secretPermission}, RequiredPermissions...) {
+		namespace := hcpNamespace
+		if p.Namespace != "" {
+			namespace = p.Namespace
+		}
+		review := &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Namespace: namespace,
+					Verb:      p.Verb,
+					Group:     p.Group,
+					Resource:  p.Resource,
+					Name:      p.Name,
+				},
+			},
+		}
+		if err := c.Create(ctx, review); err != nil {
+			return nil, fmt.Errorf("reviewing access to %s: %w", p, err)
+		}
+		if !review.Status.Allowed {
+			denied = append(denied, p)
+		}
+	}
+
+	return denied, nil
+}
@@ -4,17 +4,24 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/go-logr/logr"
 	ocroutev1 "github.com/openshift/api/route/v1"
 	hyperv1beta1 "github.com/openshift/hypershift/api/v1beta1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/openshift/hypershift-logging-operator/pkg/constants"
+	hloerrors "github.com/openshift/hypershift-logging-operator/pkg/errors"
 )
 
 const (
@@ -51,6 +58,25 @@ func GetHostedControlPlanes(
 	return hcpList.Items, nil
 }
 
+// GetHostedControlPlane returns the hostedcontrolplane living in the given HCP namespace
+func GetHostedControlPlane(
+	c client.Client,
+	ctx context.Context,
+	hcpNamespace string,
+) (*hyperv1beta1.HostedControlPlane, error) {
+
+	hcpList := new(hyperv1beta1.HostedControlPlaneList)
+	if err := c.List(ctx, hcpList, &client.ListOptions{Namespace: hcpNamespace}); err != nil {
+		return nil, err
+	}
+
+	if len(hcpList.Items) == 0 {
+		return nil, fmt.Errorf("no hostedcontrolplane found in namespace %s", hcpNamespace)
+	}
+
+	return &hcpList.Items[0], nil
+}
+
 // GetHostedClusters returns a list of all HostedClusters based on search criteria
 func GetHostedClusters(
 	c client.Client,
@@ -111,21 +137,126 @@ func IsReadyHostedCluster(hostedCluster hyperv1beta1.HostedCluster) bool {
 	return false
 }
 
-// BuildGuestKubeConfig builds the kubeconfig for client to access the hosted cluster from the secrets in HCP namespace
+// HasTrueConditions returns true if each of the conditions of the hosted cluster is true
+func HasTrueConditions(hostedCluster *hyperv1beta1.HostedCluster, conditions []string) bool {
+	for _, condition := range conditions {
+		if !meta.IsStatusConditionTrue(hostedCluster.Status.Conditions, condition) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsEligibleHostedCluster returns true if the hosted cluster is ready and each of the required conditions is true,
+// e.g. ClusterVersionSucceeding to onboard the hosted clusters completely provisioned only
+func IsEligibleHostedCluster(hostedCluster hyperv1beta1.HostedCluster, required []string) bool {
+	return IsReadyHostedCluster(hostedCluster) && HasTrueConditions(&hostedCluster, required)
+}
+
+// IsLoggingDisabled returns true if the label is set to "true" on the hosted cluster, never if the label is empty
+func IsLoggingDisabled(hostedCluster *hyperv1beta1.HostedCluster, label string) bool {
+	return label != "" && hostedCluster.Labels[label] == "true"
+}
+
+// GuestVersion returns the most recent version completely rolled out to the hosted cluster,
+// it is empty if no rollout has completed yet
+func GuestVersion(status *hyperv1beta1.ClusterVersionStatus) string {
+	if status == nil {
+		return ""
+	}
+	for _, history := range status.History {
+		if string(history.State) == HostedClusterVersionCompletedStatus {
+			return history.Version
+		}
+	}
+	return ""
+}
+
+// HCPNamespace returns the HCP namespace of the hosted cluster, the one recorded in the HCPNamespaceAnnotation
+// or the conventional <namespace>-<name> until it is recorded
+func HCPNamespace(hostedCluster *hyperv1beta1.HostedCluster) string {
+	if hcpNamespace := hostedCluster.Annotations[constants.HCPNamespaceAnnotation]; hcpNamespace != "" {
+		return hcpNamespace
+	}
+	return fmt.Sprintf("%s-%s", hostedCluster.Namespace, hostedCluster.Name)
+}
+
+// ReadySince returns when the hosted cluster last became available, zero if it is not available
+func ReadySince(hostedCluster *hyperv1beta1.HostedCluster) time.Time {
+	for _, c := range hostedCluster.Status.Conditions {
+		if c.Type == HostedClusterAvailableCondition && c.Status == v1.ConditionTrue {
+			return c.LastTransitionTime.Time
+		}
+	}
+	return time.Time{}
+}
+
+// Keys of the values of the hosted control plane substituted into the templates
+const (
+	RegionValueKey     = "region"
+	BaseDomainValueKey = "baseDomain"
+)
+
+// TemplateValues returns the values of the hosted control plane substituted into the templates,
+// e.g. the region of the cloud platform and the base domain. The values unknown for the platform are omitted
+func TemplateValues(hcp *hyperv1beta1.HostedControlPlane) map[string]string {
+	values := map[string]string{}
+
+	platform := hcp.Spec.Platform
+	region := ""
+	switch {
+	case platform.AWS != nil:
+		region = platform.AWS.Region
+	case platform.Azure != nil:
+		region = platform.Azure.Location
+	case platform.PowerVS != nil:
+		region = platform.PowerVS.Region
+	}
+	if region != "" {
+		values[RegionValueKey] = region
+	}
+	if hcp.Spec.DNS.BaseDomain != "" {
+		values[BaseDomainValueKey] = hcp.Spec.DNS.BaseDomain
+	}
+
+	return values
+}
+
+// GuestKubeConfigSecret returns the secret holding the admin kubeconfig of the hosted cluster,
+// it is read from the HostedCluster status when available, otherwise the conventional secret in HCP namespace is used
+func GuestKubeConfigSecret(hostedCluster *hyperv1beta1.HostedCluster, hcpNamespace string) types.NamespacedName {
+	if hostedCluster.Status.KubeConfig != nil && hostedCluster.Status.KubeConfig.Name != "" {
+		return types.NamespacedName{Name: hostedCluster.Status.KubeConfig.Name, Namespace: hostedCluster.Namespace}
+	}
+	return types.NamespacedName{Name: KubeConfigSecret, Namespace: hcpNamespace}
+}
+
+// BuildGuestKubeConfig builds the kubeconfig for client to access the hosted cluster from the kubeconfig secret,
+// the API calls carry the given user agent so they can be recognized in the guest cluster audit logs
 func BuildGuestKubeConfig(
 	c client.Client,
+	kubeConfigSecret types.NamespacedName,
 	hcpNamespace string,
+	userAgent string,
 	log logr.Logger,
 ) (*rest.Config, error) {
 
 	secret := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      KubeConfigSecret,
-			Namespace: hcpNamespace,
+			Name:      kubeConfigSecret.Name,
+			Namespace: kubeConfigSecret.Namespace,
 		},
 	}
 	if err := c.Get(context.Background(), client.ObjectKeyFromObject(secret), secret); err != nil {
-		return nil, fmt.Errorf("failed to get hostedcluster admin kubeconfig: %w", err)
+		err = fmt.Errorf("failed to get hostedcluster admin kubeconfig: %w", err)
+		if errors.IsNotFound(err) {
+			return nil, hloerrors.Wrap(hloerrors.ErrKubeconfigMissing, err)
+		}
+		return nil, err
+	}
+	if len(secret.Data["kubeconfig"]) == 0 {
+		return nil, hloerrors.Wrap(hloerrors.ErrKubeconfigMissing,
+			fmt.Errorf("no kubeconfig in the secret %s", client.ObjectKeyFromObject(secret)))
 	}
 
 	kubeconfigFile, err := os.CreateTemp(os.TempDir(), "kubeconfig-")
@@ -160,18 +291,21 @@ func BuildGuestKubeConfig(
 	if err != nil {
 		return nil, fmt.Errorf("failed to serialize kubeconfig: %w", err)
 	}
+	if userAgent != "" {
+		restConfig.UserAgent = userAgent
+	}
 
 	return restConfig, nil
 }
 
 // Validate kube config
-func ValidateKubeConfig(c client.Client, hcpNamespace string) (bool, error) {
+func ValidateKubeConfig(c client.Client, kubeConfigSecret types.NamespacedName) (bool, error) {
 
 	//check the secrets
 	secret := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      KubeConfigSecret,
-			Namespace: hcpNamespace,
+			Name:      kubeConfigSecret.Name,
+			Namespace: kubeConfigSecret.Namespace,
 		},
 	}
 
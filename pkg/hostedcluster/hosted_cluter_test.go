@@ -17,14 +17,25 @@ package hostedcluster
 
 import (
 	"context"
+	"errors"
+	"reflect"
 	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
 
 	loggingv1 "github.com/openshift/cluster-logging-operator/apis/logging/v1"
 
 	hlov1alpha1 "github.com/openshift/hypershift-logging-operator/api/v1alpha1"
+	"github.com/openshift/hypershift-logging-operator/pkg/constants"
+	hloerrors "github.com/openshift/hypershift-logging-operator/pkg/errors"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
@@ -98,6 +109,424 @@ func TestGetHostedControlPlanes(t *testing.T) {
 	}
 }
 
+func TestGuestKubeConfigSecret(t *testing.T) {
+	tests := []struct {
+		name       string
+		kubeConfig *corev1.LocalObjectReference
+		expected   types.NamespacedName
+	}{
+		{
+			name:       "secret from the hosted cluster status",
+			kubeConfig: &corev1.LocalObjectReference{Name: "test-admin-kubeconfig"},
+			expected:   types.NamespacedName{Name: "test-admin-kubeconfig", Namespace: "clusters"},
+		},
+		{
+			name:     "conventional secret without status reference",
+			expected: types.NamespacedName{Name: KubeConfigSecret, Namespace: "clusters-test"},
+		},
+		{
+			name:       "conventional secret with empty status reference",
+			kubeConfig: &corev1.LocalObjectReference{},
+			expected:   types.NamespacedName{Name: KubeConfigSecret, Namespace: "clusters-test"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hc := &hyperv1beta1.HostedCluster{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "clusters"},
+				Status:     hyperv1beta1.HostedClusterStatus{KubeConfig: test.kubeConfig},
+			}
+
+			secret := GuestKubeConfigSecret(hc, "clusters-test")
+			if secret != test.expected {
+				t.Errorf("mismatched secret, expected %v, got %v", test.expected, secret)
+			}
+		})
+	}
+}
+
+func TestIsEligibleHostedCluster(t *testing.T) {
+	condition := func(conditionType string, status metav1.ConditionStatus) metav1.Condition {
+		return metav1.Condition{Type: conditionType, Status: status}
+	}
+	tests := []struct {
+		name       string
+		conditions []metav1.Condition
+		required   []string
+		expected   bool
+	}{
+		{
+			name:       "not available",
+			conditions: []metav1.Condition{condition(HostedClusterAvailableCondition, metav1.ConditionFalse)},
+			expected:   false,
+		},
+		{
+			name:       "available without required conditions",
+			conditions: []metav1.Condition{condition(HostedClusterAvailableCondition, metav1.ConditionTrue)},
+			expected:   true,
+		},
+		{
+			name: "completely provisioned",
+			conditions: []metav1.Condition{
+				condition(HostedClusterAvailableCondition, metav1.ConditionTrue),
+				condition("ClusterVersionSucceeding", metav1.ConditionTrue),
+			},
+			required: []string{"ClusterVersionSucceeding"},
+			expected: true,
+		},
+		{
+			name: "partially provisioned",
+			conditions: []metav1.Condition{
+				condition(HostedClusterAvailableCondition, metav1.ConditionTrue),
+				condition("ClusterVersionSucceeding", metav1.ConditionFalse),
+			},
+			required: []string{"ClusterVersionSucceeding"},
+			expected: false,
+		},
+		{
+			name:       "required condition not reported yet",
+			conditions: []metav1.Condition{condition(HostedClusterAvailableCondition, metav1.ConditionTrue)},
+			required:   []string{"ClusterVersionSucceeding"},
+			expected:   false,
+		},
+		{
+			name: "one of the required conditions unknown",
+			conditions: []metav1.Condition{
+				condition(HostedClusterAvailableCondition, metav1.ConditionTrue),
+				condition("ClusterVersionSucceeding", metav1.ConditionTrue),
+				condition("InfrastructureReady", metav1.ConditionUnknown),
+			},
+			required: []string{"ClusterVersionSucceeding", "InfrastructureReady"},
+			expected: false,
+		},
+		{
+			name: "required conditions of an unavailable cluster",
+			conditions: []metav1.Condition{
+				condition(HostedClusterAvailableCondition, metav1.ConditionFalse),
+				condition("ClusterVersionSucceeding", metav1.ConditionTrue),
+			},
+			required: []string{"ClusterVersionSucceeding"},
+			expected: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hc := hyperv1beta1.HostedCluster{Status: hyperv1beta1.HostedClusterStatus{Conditions: test.conditions}}
+			if eligible := IsEligibleHostedCluster(hc, test.required); eligible != test.expected {
+				t.Errorf("mismatched eligibility, expected %v, got %v", test.expected, eligible)
+			}
+		})
+	}
+}
+
+func TestIsLoggingDisabled(t *testing.T) {
+	tests := []struct {
+		name     string
+		labels   map[string]string
+		label    string
+		expected bool
+	}{
+		{
+			name:     "labeled",
+			labels:   map[string]string{constants.DisabledLabel: "true"},
+			label:    constants.DisabledLabel,
+			expected: true,
+		},
+		{
+			name:     "not labeled",
+			label:    constants.DisabledLabel,
+			expected: false,
+		},
+		{
+			name:     "label not true",
+			labels:   map[string]string{constants.DisabledLabel: "false"},
+			label:    constants.DisabledLabel,
+			expected: false,
+		},
+		{
+			name:     "custom label",
+			labels:   map[string]string{constants.DisabledLabel: "true", "example.com/no-logging": "true"},
+			label:    "example.com/no-logging",
+			expected: true,
+		},
+		{
+			name:     "label not configured",
+			labels:   map[string]string{constants.DisabledLabel: "true"},
+			expected: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hc := &hyperv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Labels: test.labels}}
+			if disabled := IsLoggingDisabled(hc, test.label); disabled != test.expected {
+				t.Errorf("mismatched disabled, expected %v, got %v", test.expected, disabled)
+			}
+		})
+	}
+}
+
+func TestTemplateValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     hyperv1beta1.HostedControlPlaneSpec
+		expected map[string]string
+	}{
+		{
+			name: "aws region and base domain",
+			spec: hyperv1beta1.HostedControlPlaneSpec{
+				Platform: hyperv1beta1.PlatformSpec{AWS: &hyperv1beta1.AWSPlatformSpec{Region: "us-east-1"}},
+				DNS:      hyperv1beta1.DNSSpec{BaseDomain: "example.com"},
+			},
+			expected: map[string]string{RegionValueKey: "us-east-1", BaseDomainValueKey: "example.com"},
+		},
+		{
+			name: "azure location",
+			spec: hyperv1beta1.HostedControlPlaneSpec{
+				Platform: hyperv1beta1.PlatformSpec{Azure: &hyperv1beta1.AzurePlatformSpec{Location: "eastus"}},
+			},
+			expected: map[string]string{RegionValueKey: "eastus"},
+		},
+		{
+			name:     "platform without region",
+			spec:     hyperv1beta1.HostedControlPlaneSpec{Platform: hyperv1beta1.PlatformSpec{Type: hyperv1beta1.NonePlatform}},
+			expected: map[string]string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values := TemplateValues(&hyperv1beta1.HostedControlPlane{Spec: test.spec})
+			if !reflect.DeepEqual(values, test.expected) {
+				t.Errorf("mismatched values, expected %v, got %v", test.expected, values)
+			}
+		})
+	}
+}
+
+func TestJitterInterval(t *testing.T) {
+	tests := []struct {
+		name     string
+		fraction float64
+	}{
+		{name: "no jitter", fraction: 0},
+		{name: "negative jitter", fraction: -0.5},
+		{name: "jitter", fraction: 0.1},
+		{name: "full jitter", fraction: 1},
+	}
+
+	const interval = 10 * time.Minute
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			max := interval
+			if test.fraction > 0 {
+				max = interval + time.Duration(float64(interval)*test.fraction)
+			}
+			for i := 0; i < 1000; i++ {
+				got := JitterInterval(interval, test.fraction)
+				if got < interval || got > max {
+					t.Fatalf("mismatched interval, expected within [%v, %v], got %v", interval, max, got)
+				}
+			}
+		})
+	}
+}
+
+func TestGuestVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   *hyperv1beta1.ClusterVersionStatus
+		expected string
+	}{
+		{
+			name:     "no version status",
+			expected: "",
+		},
+		{
+			name: "upgrade in progress",
+			status: &hyperv1beta1.ClusterVersionStatus{
+				History: []configv1.UpdateHistory{
+					{State: configv1.PartialUpdate, Version: "4.14.2"},
+					{State: configv1.CompletedUpdate, Version: "4.14.1"},
+				},
+			},
+			expected: "4.14.1",
+		},
+		{
+			name: "no completed rollout",
+			status: &hyperv1beta1.ClusterVersionStatus{
+				History: []configv1.UpdateHistory{{State: configv1.PartialUpdate, Version: "4.14.1"}},
+			},
+			expected: "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			version := GuestVersion(test.status)
+			if version != test.expected {
+				t.Errorf("mismatched version, expected %v, got %v", test.expected, version)
+			}
+		})
+	}
+}
+
+// newCSV returns the CSV of the operator in the namespace, at the version and in the phase
+func newCSV(namespace, name, version, phase string) *unstructured.Unstructured {
+	csv := NewClusterServiceVersion()
+	csv.SetNamespace(namespace)
+	csv.SetName(name)
+	csv.Object["spec"] = map[string]interface{}{"version": version}
+	csv.Object["status"] = map[string]interface{}{"phase": phase}
+	return csv
+}
+
+func TestLoggingVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		csvs     []client.Object
+		expected string
+	}{
+		{
+			name:     "not installed",
+			expected: "",
+		},
+		{
+			name: "installed",
+			csvs: []client.Object{
+				newCSV(constants.HLFWatchedNamespace, "cluster-logging.v5.8.0", "5.8.0", "Succeeded"),
+			},
+			expected: "5.8.0",
+		},
+		{
+			name: "upgrade in progress",
+			csvs: []client.Object{
+				newCSV(constants.HLFWatchedNamespace, "cluster-logging.v5.7.3", "5.7.3", "Succeeded"),
+				newCSV(constants.HLFWatchedNamespace, "cluster-logging.v5.8.0", "5.8.0", "Installing"),
+			},
+			expected: "5.7.3",
+		},
+		{
+			name: "other operators",
+			csvs: []client.Object{
+				newCSV(constants.HLFWatchedNamespace, "loki-operator.v5.8.0", "5.8.0", "Succeeded"),
+				newCSV("openshift-operators", "cluster-logging.v5.6.0", "5.6.0", "Succeeded"),
+			},
+			expected: "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mock, err := NewMock(test.csvs...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			version, err := LoggingVersion(context.TODO(), mock.Client)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if version != test.expected {
+				t.Errorf("mismatched version, expected %v, got %v", test.expected, version)
+			}
+		})
+	}
+}
+
+func TestBuildGuestKubeConfigUserAgent(t *testing.T) {
+	kubeConfig := clientcmdapi.NewConfig()
+	kubeConfig.Clusters["guest"] = &clientcmdapi.Cluster{Server: "https://api.test.example.com:6443"}
+	kubeConfig.AuthInfos["admin"] = &clientcmdapi.AuthInfo{Token: "token"}
+	kubeConfig.Contexts["admin"] = &clientcmdapi.Context{Cluster: "guest", AuthInfo: "admin"}
+	kubeConfig.CurrentContext = "admin"
+	data, err := clientcmd.Write(*kubeConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: KubeConfigSecret, Namespace: "clusters-test"},
+		Data:       map[string][]byte{"kubeconfig": data},
+	}
+
+	tests := []struct {
+		name      string
+		userAgent string
+		expected  string
+	}{
+		{
+			name:      "user agent from the flag",
+			userAgent: "hypershift-logging-operator/v0.1.0",
+			expected:  "hypershift-logging-operator/v0.1.0",
+		},
+		{
+			name:     "default user agent",
+			expected: "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := NewTestMock(t, secret).Client
+
+			restConfig, err := BuildGuestKubeConfig(c, client.ObjectKeyFromObject(secret), "clusters-test", test.userAgent, logr.Discard())
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if restConfig.UserAgent != test.expected {
+				t.Errorf("mismatched user agent, expected %v, got %v", test.expected, restConfig.UserAgent)
+			}
+		})
+	}
+}
+
+func TestBuildGuestKubeConfigErrors(t *testing.T) {
+	key := types.NamespacedName{Name: KubeConfigSecret, Namespace: "clusters-test"}
+	tests := []struct {
+		name            string
+		secret          *corev1.Secret
+		expectedMissing bool
+	}{
+		{
+			name:            "secret not published yet",
+			expectedMissing: true,
+		},
+		{
+			name: "secret without kubeconfig",
+			secret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+			},
+			expectedMissing: true,
+		},
+		{
+			name: "invalid kubeconfig",
+			secret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+				Data:       map[string][]byte{"kubeconfig": []byte("invalid")},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var objs []client.Object
+			if test.secret != nil {
+				objs = append(objs, test.secret)
+			}
+			c := NewTestMock(t, objs...).Client
+
+			_, err := BuildGuestKubeConfig(c, key, "clusters-test", "", logr.Discard())
+			if err == nil {
+				t.Fatal("expected err, got nil")
+			}
+			if missing := errors.Is(err, hloerrors.ErrKubeconfigMissing); missing != test.expectedMissing {
+				t.Errorf("mismatched %v, expected %v, got %v: %v", hloerrors.ErrKubeconfigMissing, test.expectedMissing, missing, err)
+			}
+		})
+	}
+}
+
 type MockKubeClient struct {
 	Client client.Client
 }
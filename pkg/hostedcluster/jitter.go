@@ -0,0 +1,17 @@
+package hostedcluster
+
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// JitterInterval spreads a periodic requeue of a hosted cluster over [interval, interval*(1+fraction)] so that
+// the hosted clusters, e.g. onboarded together, are not resynced at the same time. The interval is left intact
+// if fraction is 0
+func JitterInterval(interval time.Duration, fraction float64) time.Duration {
+	if fraction <= 0 {
+		return interval
+	}
+	return wait.Jitter(interval, fraction)
+}
@@ -0,0 +1,25 @@
+package hostedcluster
+
+import "sync"
+
+// clusterLocks serializes the applies of the controllers to the ClusterLogForwarders of each hosted cluster,
+// keyed by HCP namespace
+var clusterLocks = struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}{locks: map[string]*sync.Mutex{}}
+
+// LockCluster locks the ClusterLogForwarders of the hosted cluster living in the HCP namespace, e.g. so that
+// the templates and the HyperShiftLogForwarders are not applied concurrently. The returned func unlocks them
+func LockCluster(hcpNamespace string) (unlock func()) {
+	clusterLocks.mu.Lock()
+	lock, ok := clusterLocks.locks[hcpNamespace]
+	if !ok {
+		lock = &sync.Mutex{}
+		clusterLocks.locks[hcpNamespace] = lock
+	}
+	clusterLocks.mu.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}
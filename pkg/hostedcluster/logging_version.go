@@ -0,0 +1,79 @@
+package hostedcluster
+
+import (
+	"context"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"github.com/openshift/hypershift-logging-operator/pkg/constants"
+)
+
+// ClusterServiceVersionGVK is the kind of the OLM CSVs, read as unstructured not to depend on the OLM types
+var ClusterServiceVersionGVK = schema.GroupVersionKind{
+	Group:   "operators.coreos.com",
+	Version: "v1alpha1",
+	Kind:    "ClusterServiceVersion",
+}
+
+// csvSucceededPhase is the phase of a CSV whose operator is installed and running
+const csvSucceededPhase = "Succeeded"
+
+// ServesClusterServiceVersions returns true if the CSVs are served by the cluster, OLM is not installed otherwise
+func ServesClusterServiceVersions(mapper meta.RESTMapper) (bool, error) {
+	_, err := mapper.RESTMapping(ClusterServiceVersionGVK.GroupKind(), ClusterServiceVersionGVK.Version)
+	if meta.IsNoMatchError(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// NewClusterServiceVersion returns an empty unstructured CSV, e.g. to watch the CSVs
+func NewClusterServiceVersion() *unstructured.Unstructured {
+	csv := &unstructured.Unstructured{}
+	csv.SetGroupVersionKind(ClusterServiceVersionGVK)
+	return csv
+}
+
+// IsLoggingOperatorCSV returns true if the object is a CSV of the cluster-logging operator
+func IsLoggingOperatorCSV(obj client.Object) bool {
+	return obj.GetNamespace() == constants.HLFWatchedNamespace &&
+		strings.HasPrefix(obj.GetName(), constants.LoggingOperatorCSVPrefix)
+}
+
+// LoggingOperatorCSVPredicate filters the events of the CSVs of the cluster-logging operator
+func LoggingOperatorCSVPredicate() predicate.Predicate {
+	return predicate.NewPredicateFuncs(IsLoggingOperatorCSV)
+}
+
+// LoggingVersion returns the version of the cluster-logging operator running in the guest cluster, read from its
+// succeeded CSV in the openshift-logging namespace. It is empty if the operator is not installed, or is being
+// installed, or if OLM is not installed in the guest cluster
+func LoggingVersion(ctx context.Context, c client.Reader) (string, error) {
+	csvList := &unstructured.UnstructuredList{}
+	csvList.SetGroupVersionKind(ClusterServiceVersionGVK.GroupVersion().WithKind(ClusterServiceVersionGVK.Kind + "List"))
+	if err := c.List(ctx, csvList, client.InNamespace(constants.HLFWatchedNamespace)); err != nil {
+		if meta.IsNoMatchError(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	for i := range csvList.Items {
+		csv := &csvList.Items[i]
+		if !IsLoggingOperatorCSV(csv) {
+			continue
+		}
+		// The CSV replaced by an upgrade lingers until the new one succeeds
+		if phase, _, _ := unstructured.NestedString(csv.Object, "status", "phase"); phase != csvSucceededPhase {
+			continue
+		}
+		if version, _, _ := unstructured.NestedString(csv.Object, "spec", "version"); version != "" {
+			return version, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,28 @@
+package hostedcluster
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/openshift/hypershift-logging-operator/pkg/constants"
+	"github.com/openshift/hypershift-logging-operator/pkg/metrics"
+)
+
+// IsPaused returns true if the reconciliation of all the forwarders is paused, either by the paused flag of the
+// operator or by the PauseConfigMapName ConfigMap of the operator namespace. The paused state is recorded in the metrics
+func IsPaused(ctx context.Context, c client.Reader, paused bool) (bool, error) {
+	if !paused {
+		cm := &corev1.ConfigMap{}
+		err := c.Get(ctx, types.NamespacedName{Name: constants.PauseConfigMapName, Namespace: constants.OperatorNamespace}, cm)
+		if err != nil && !errors.IsNotFound(err) {
+			return false, err
+		}
+		paused = err == nil && cm.Data[constants.PausedKey] == "true"
+	}
+	metrics.SetPaused(paused)
+	return paused, nil
+}
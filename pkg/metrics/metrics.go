@@ -0,0 +1,371 @@
+package metrics
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// buildInfo reports the build of the running operator, it is always set to 1
+var buildInfo = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "hlo_build_info",
+		Help: "Build information of the hypershift logging operator, always 1.",
+	},
+	[]string{"version", "commit", "goversion"},
+)
+
+// clusterOnboardSeconds is the latency from a hosted cluster becoming ready to its guest manager
+// running with the forwarder applied
+var clusterOnboardSeconds = prometheus.NewHistogram(
+	prometheus.HistogramOpts{
+		Name:    "hlo_cluster_onboard_seconds",
+		Help:    "Time from a hosted cluster becoming ready to its forwarder being applied, in seconds.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+	},
+)
+
+// certificateExpiry is the expiry of the TLS certificates of the output secrets
+var certificateExpiry = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "hlo_output_certificate_expiry_timestamp_seconds",
+		Help: "Expiry of the TLS certificate of an output secret, in seconds since the epoch.",
+	},
+	[]string{"namespace", "secret"},
+)
+
+// paused is 1 while the reconciliation of all the forwarders is paused
+var paused = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "hlo_reconcile_paused",
+		Help: "Whether the reconciliation of all the forwarders is paused, 1 if paused.",
+	},
+)
+
+// templatePendingApplies is the number of hosted clusters the CLF of each template is applied to but not yet
+// accepted by cluster-logging
+var templatePendingApplies = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "hlo_template_pending_applies",
+		Help: "Number of hosted clusters the ClusterLogForwarder of a template is applied to but not yet accepted.",
+	},
+	[]string{"template"},
+)
+
+// queuedClusters is the number of ready hosted clusters waiting for a guest manager beyond the maximum
+// of managed hosted clusters
+var queuedClusters = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "hlo_queued_clusters",
+		Help: "Number of ready hosted clusters queued beyond the maximum of managed hosted clusters.",
+	},
+)
+
+// Reasons of the template render errors
+const (
+	// ValidationRenderError is a template rejected by the validation, e.g. of its outputs or of the limits
+	ValidationRenderError = "validation"
+	// InterpolationRenderError is a template whose tokens cannot be substituted with the values of a hosted cluster
+	InterpolationRenderError = "interpolation"
+	// MergeConflictRenderError is a template whose settings conflict once merged into the CLF of a hosted cluster
+	MergeConflictRenderError = "merge-conflict"
+)
+
+// templateRenderErrors counts the templates failing to render, by reason
+var templateRenderErrors = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "hlo_template_render_errors_total",
+		Help: "Number of reconciles of a template failing to render it, by reason.",
+	},
+	[]string{"reason"},
+)
+
+// outputDeliveryErrors is the number of delivery errors of each output of the CLF of a template reported by the
+// collector of an HCP namespace, a gauge as the collector counts them since it started
+var outputDeliveryErrors = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "hlo_output_delivery_errors",
+		Help: "Number of delivery errors of an output of a template reported by the collector of an HCP namespace since it started.",
+	},
+	[]string{"template", "namespace", "output"},
+)
+
+// workqueueDepth is the number of reconcile requests waiting in the workqueues of each kind of controller of the
+// operator, the controllers of the guest managers are summed over the hosted clusters
+var workqueueDepth = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "hlo_workqueue_depth",
+		Help: "Number of reconcile requests waiting in the workqueues of a kind of controller of the operator.",
+	},
+	[]string{"controller"},
+)
+
+// recordedWorkqueues are the kinds of controller whose workqueue depth is recorded, the kinds gone are deleted
+var recordedWorkqueues = struct {
+	mu    sync.Mutex
+	kinds map[string]struct{}
+}{kinds: map[string]struct{}{}}
+
+// The kinds of controller run by the guest manager of each hosted cluster, named <kind>_<cluster>
+const (
+	HyperShiftLogForwarderController = "hypershift_log_forwarder"
+	ServiceAccountController         = "service_account"
+	EventRouterAccessController      = "event_router_access"
+	LoggingVersionController         = "logging_version"
+)
+
+var guestControllers = []string{
+	HyperShiftLogForwarderController,
+	ServiceAccountController,
+	EventRouterAccessController,
+	LoggingVersionController,
+}
+
+// GuestControllerName returns the name of the controller of the kind in the guest manager of the hosted cluster
+func GuestControllerName(kind string, cluster string) string {
+	return kind + "_" + cluster
+}
+
+// controllerKind returns the kind of the controller, the name of the controllers out of the guest managers
+func controllerKind(name string) string {
+	for _, kind := range guestControllers {
+		if strings.HasPrefix(name, kind+"_") {
+			return kind
+		}
+	}
+	return name
+}
+
+const (
+	// baseWorkqueueDepth is the workqueue depth of controller-runtime, its name label is the controller name
+	baseWorkqueueDepth = "workqueue_depth"
+	// DefaultWorkqueueDepthInterval is how often the depth of the workqueues is recorded
+	DefaultWorkqueueDepthInterval = 15 * time.Second
+)
+
+const (
+	// DefaultClusterLabelLimit is the number of hosted clusters labeled by name unless another limit is set
+	DefaultClusterLabelLimit = 200
+	// OtherClusterLabel aggregates the hosted clusters beyond the limit of the cluster label
+	OtherClusterLabel = "other"
+)
+
+// clusterReconciles counts the reconciles of the CLFs of each hosted cluster, by result
+var clusterReconciles = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "hlo_cluster_forwarder_reconciles_total",
+		Help: "Number of reconciles of the ClusterLogForwarders of a hosted cluster, by result.",
+	},
+	[]string{"cluster", "result"},
+)
+
+// clusterLastReconciled is when the CLFs of each hosted cluster were last reconciled successfully
+var clusterLastReconciled = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "hlo_cluster_forwarder_last_reconcile_timestamp_seconds",
+		Help: "Last successful reconcile of the ClusterLogForwarders of a hosted cluster, in seconds since the epoch.",
+	},
+	[]string{"cluster"},
+)
+
+// clusterLabels caps the distinct values of the cluster label, the hosted clusters beyond the limit
+// are aggregated under OtherClusterLabel
+var clusterLabels = &clusterLabelGuard{limit: DefaultClusterLabelLimit, clusters: map[string]struct{}{}}
+
+type clusterLabelGuard struct {
+	mu       sync.Mutex
+	limit    int
+	clusters map[string]struct{}
+}
+
+// label returns the value of the cluster label of the hosted cluster, the first hosted clusters up to
+// the limit keep their own value
+func (g *clusterLabelGuard) label(cluster string) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := g.clusters[cluster]; ok {
+		return cluster
+	}
+	if len(g.clusters) >= g.limit {
+		return OtherClusterLabel
+	}
+	g.clusters[cluster] = struct{}{}
+	return cluster
+}
+
+// forget releases the value of the hosted cluster, true if it was labeled by its own value
+func (g *clusterLabelGuard) forget(cluster string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	_, ok := g.clusters[cluster]
+	delete(g.clusters, cluster)
+	return ok
+}
+
+// processStart is when the operator started, the hosted clusters ready before are not observed
+var processStart = time.Now()
+
+func init() {
+	metrics.Registry.MustRegister(buildInfo, clusterOnboardSeconds, certificateExpiry, clusterReconciles, clusterLastReconciled, paused,
+		templatePendingApplies, queuedClusters, templateRenderErrors, workqueueDepth, outputDeliveryErrors)
+	// The reasons are exported from zero, so that the first error of a reason is seen as an increase
+	for _, reason := range []string{ValidationRenderError, InterpolationRenderError, MergeConflictRenderError} {
+		templateRenderErrors.WithLabelValues(reason)
+	}
+}
+
+// SetBuildInfo records the version and the commit the operator is built from
+func SetBuildInfo(version string, commit string) {
+	buildInfo.Reset()
+	buildInfo.WithLabelValues(version, commit, runtime.Version()).Set(1)
+}
+
+// ObserveClusterOnboard records the onboarding latency of a hosted cluster ready since the given time.
+// The hosted clusters ready before the operator started are not observed, their latency would include
+// the downtime of the operator
+func ObserveClusterOnboard(readySince time.Time) {
+	if readySince.IsZero() || readySince.Before(processStart) {
+		return
+	}
+	clusterOnboardSeconds.Observe(time.Since(readySince).Seconds())
+}
+
+// SetCertificateExpiry records the expiry of the TLS certificate of the output secret
+func SetCertificateExpiry(namespace string, secret string, expiry time.Time) {
+	certificateExpiry.WithLabelValues(namespace, secret).Set(float64(expiry.Unix()))
+}
+
+// SetClusterLabelLimit sets how many hosted clusters are labeled by name, the hosted clusters already
+// labeled keep their value
+func SetClusterLabelLimit(limit int) {
+	clusterLabels.mu.Lock()
+	defer clusterLabels.mu.Unlock()
+	clusterLabels.limit = limit
+}
+
+// ObserveClusterReconcile records a reconcile of a CLF of the hosted cluster of the HCP namespace, failed if err is not nil
+func ObserveClusterReconcile(cluster string, err error) {
+	label := clusterLabels.label(cluster)
+	if err != nil {
+		clusterReconciles.WithLabelValues(label, "failure").Inc()
+		return
+	}
+	clusterReconciles.WithLabelValues(label, "success").Inc()
+	clusterLastReconciled.WithLabelValues(label).SetToCurrentTime()
+}
+
+// ForgetCluster removes the metrics of a hosted cluster gone from the management cluster, its value of the
+// cluster label is released for another hosted cluster. The hosted clusters aggregated under OtherClusterLabel
+// leave their samples in the aggregate
+func ForgetCluster(cluster string) {
+	if !clusterLabels.forget(cluster) {
+		return
+	}
+	clusterReconciles.DeletePartialMatch(prometheus.Labels{"cluster": cluster})
+	clusterLastReconciled.DeleteLabelValues(cluster)
+}
+
+// SetPaused records whether the reconciliation of all the forwarders is paused
+func SetPaused(isPaused bool) {
+	if isPaused {
+		paused.Set(1)
+		return
+	}
+	paused.Set(0)
+}
+
+// SetTemplatePendingApplies records the number of hosted clusters the CLF of the template is pending in
+func SetTemplatePendingApplies(template string, pending int) {
+	templatePendingApplies.WithLabelValues(template).Set(float64(pending))
+}
+
+// ForgetTemplate removes the metrics of a deleted template
+func ForgetTemplate(template string) {
+	templatePendingApplies.DeleteLabelValues(template)
+	outputDeliveryErrors.DeletePartialMatch(prometheus.Labels{"template": template})
+}
+
+// SetQueuedClusters records the number of hosted clusters queued beyond the maximum of managed hosted clusters
+func SetQueuedClusters(queued int) {
+	queuedClusters.Set(float64(queued))
+}
+
+// ObserveTemplateRenderError records a template failing to render for the reason
+func ObserveTemplateRenderError(reason string) {
+	templateRenderErrors.WithLabelValues(reason).Inc()
+}
+
+// SetOutputDeliveryErrors records the delivery errors of the outputs of the template reported by the collector of
+// the HCP namespace, the outputs without error are removed
+func SetOutputDeliveryErrors(template string, namespace string, errors map[string]int64) {
+	outputDeliveryErrors.DeletePartialMatch(prometheus.Labels{"template": template, "namespace": namespace})
+	for output, count := range errors {
+		outputDeliveryErrors.WithLabelValues(template, namespace, output).Set(float64(count))
+	}
+}
+
+// RecordWorkqueueDepth records the depth of the workqueues of each kind of controller from the base metrics of
+// controller-runtime gathered from the gatherer, the kinds without a workqueue anymore are deleted
+func RecordWorkqueueDepth(gatherer prometheus.Gatherer) error {
+	families, err := gatherer.Gather()
+	if err != nil {
+		return err
+	}
+	depths := map[string]float64{}
+	for _, family := range families {
+		if family.GetName() != baseWorkqueueDepth {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if label.GetName() == "name" {
+					depths[controllerKind(label.GetValue())] += m.GetGauge().GetValue()
+				}
+			}
+		}
+	}
+
+	recordedWorkqueues.mu.Lock()
+	defer recordedWorkqueues.mu.Unlock()
+	for kind := range recordedWorkqueues.kinds {
+		if _, ok := depths[kind]; !ok {
+			workqueueDepth.DeleteLabelValues(kind)
+			delete(recordedWorkqueues.kinds, kind)
+		}
+	}
+	for kind, depth := range depths {
+		workqueueDepth.WithLabelValues(kind).Set(depth)
+		recordedWorkqueues.kinds[kind] = struct{}{}
+	}
+	return nil
+}
+
+// WorkqueueDepthRecorder is a runnable of the manager recording the depth of the workqueues of the controllers
+// every interval, the controllers of the manager and of the guest managers share the registry of controller-runtime
+type WorkqueueDepthRecorder struct {
+	Interval time.Duration
+}
+
+// NeedLeaderElection makes the manager run the recorder on the elected leader only, the controllers are only
+// started by the leader
+func (w *WorkqueueDepthRecorder) NeedLeaderElection() bool {
+	return true
+}
+
+// Start records the depth of the workqueues until the context is cancelled, a failure is logged and retried
+// at the next interval
+func (w *WorkqueueDepthRecorder) Start(ctx context.Context) error {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := RecordWorkqueueDepth(metrics.Registry); err != nil {
+			ctrllog.FromContext(ctx).WithName("metrics").Error(err, "failed to record the workqueue depth")
+		}
+	}, w.Interval)
+	return nil
+}
@@ -0,0 +1,189 @@
+package metrics
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+func TestSetBuildInfo(t *testing.T) {
+	SetBuildInfo("v0.1.0", "abc1234")
+
+	expected := fmt.Sprintf(`
+# HELP hlo_build_info Build information of the hypershift logging operator, always 1.
+# TYPE hlo_build_info gauge
+hlo_build_info{commit="abc1234",goversion="%s",version="v0.1.0"} 1
+`, runtime.Version())
+	if err := testutil.GatherAndCompare(metrics.Registry, strings.NewReader(expected), "hlo_build_info"); err != nil {
+		t.Errorf("mismatched build info, %v", err)
+	}
+}
+
+func TestSetCertificateExpiry(t *testing.T) {
+	SetCertificateExpiry("openshift-logging", "loki-tls", time.Unix(1700000000, 0))
+
+	expected := `
+# HELP hlo_output_certificate_expiry_timestamp_seconds Expiry of the TLS certificate of an output secret, in seconds since the epoch.
+# TYPE hlo_output_certificate_expiry_timestamp_seconds gauge
+hlo_output_certificate_expiry_timestamp_seconds{namespace="openshift-logging",secret="loki-tls"} 1.7e+09
+`
+	if err := testutil.GatherAndCompare(metrics.Registry, strings.NewReader(expected), "hlo_output_certificate_expiry_timestamp_seconds"); err != nil {
+		t.Errorf("mismatched certificate expiry, %v", err)
+	}
+}
+
+func TestObserveClusterReconcileLimit(t *testing.T) {
+	clusterLabels = &clusterLabelGuard{limit: DefaultClusterLabelLimit, clusters: map[string]struct{}{}}
+	clusterReconciles.Reset()
+	clusterLastReconciled.Reset()
+	t.Cleanup(func() {
+		clusterLabels = &clusterLabelGuard{limit: DefaultClusterLabelLimit, clusters: map[string]struct{}{}}
+		clusterReconciles.Reset()
+		clusterLastReconciled.Reset()
+	})
+	SetClusterLabelLimit(2)
+
+	ObserveClusterReconcile("clusters-a", nil)
+	ObserveClusterReconcile("clusters-b", nil)
+	ObserveClusterReconcile("clusters-c", nil)
+	ObserveClusterReconcile("clusters-d", fmt.Errorf("failed"))
+	ObserveClusterReconcile("clusters-a", fmt.Errorf("failed"))
+
+	expected := `
+# HELP hlo_cluster_forwarder_reconciles_total Number of reconciles of the ClusterLogForwarders of a hosted cluster, by result.
+# TYPE hlo_cluster_forwarder_reconciles_total counter
+hlo_cluster_forwarder_reconciles_total{cluster="clusters-a",result="failure"} 1
+hlo_cluster_forwarder_reconciles_total{cluster="clusters-a",result="success"} 1
+hlo_cluster_forwarder_reconciles_total{cluster="clusters-b",result="success"} 1
+hlo_cluster_forwarder_reconciles_total{cluster="other",result="failure"} 1
+hlo_cluster_forwarder_reconciles_total{cluster="other",result="success"} 1
+`
+	if err := testutil.GatherAndCompare(metrics.Registry, strings.NewReader(expected), "hlo_cluster_forwarder_reconciles_total"); err != nil {
+		t.Errorf("mismatched reconciles, %v", err)
+	}
+	if count := testutil.CollectAndCount(clusterLastReconciled); count != 3 {
+		t.Errorf("mismatched last reconcile series, expected %v, got %v", 3, count)
+	}
+
+	// The label of a removed hosted cluster is released for the next one
+	ForgetCluster("clusters-a")
+	ForgetCluster("clusters-c")
+	ObserveClusterReconcile("clusters-e", nil)
+
+	expected = `
+# HELP hlo_cluster_forwarder_reconciles_total Number of reconciles of the ClusterLogForwarders of a hosted cluster, by result.
+# TYPE hlo_cluster_forwarder_reconciles_total counter
+hlo_cluster_forwarder_reconciles_total{cluster="clusters-b",result="success"} 1
+hlo_cluster_forwarder_reconciles_total{cluster="clusters-e",result="success"} 1
+hlo_cluster_forwarder_reconciles_total{cluster="other",result="failure"} 1
+hlo_cluster_forwarder_reconciles_total{cluster="other",result="success"} 1
+`
+	if err := testutil.GatherAndCompare(metrics.Registry, strings.NewReader(expected), "hlo_cluster_forwarder_reconciles_total"); err != nil {
+		t.Errorf("mismatched reconciles after the cluster is forgotten, %v", err)
+	}
+}
+
+func TestSetPaused(t *testing.T) {
+	for _, test := range []struct {
+		paused   bool
+		expected float64
+	}{
+		{paused: true, expected: 1},
+		{paused: false, expected: 0},
+	} {
+		SetPaused(test.paused)
+		if value := testutil.ToFloat64(paused); value != test.expected {
+			t.Errorf("mismatched paused, expected %v, got %v", test.expected, value)
+		}
+	}
+}
+
+func TestObserveTemplateRenderError(t *testing.T) {
+	before := testutil.ToFloat64(templateRenderErrors.WithLabelValues(InterpolationRenderError))
+	ObserveTemplateRenderError(InterpolationRenderError)
+	if value := testutil.ToFloat64(templateRenderErrors.WithLabelValues(InterpolationRenderError)); value != before+1 {
+		t.Errorf("mismatched render errors, expected %v, got %v", before+1, value)
+	}
+	// All the reasons are exported, the ones without error at zero
+	if count := testutil.CollectAndCount(templateRenderErrors); count != 3 {
+		t.Errorf("mismatched render error reasons, expected %v, got %v", 3, count)
+	}
+}
+
+func TestSetTemplatePendingApplies(t *testing.T) {
+	SetTemplatePendingApplies("instance", 3)
+	if value := testutil.ToFloat64(templatePendingApplies.WithLabelValues("instance")); value != 3 {
+		t.Errorf("mismatched pending applies, expected %v, got %v", 3, value)
+	}
+
+	ForgetTemplate("instance")
+	if count := testutil.CollectAndCount(templatePendingApplies); count != 0 {
+		t.Errorf("mismatched pending applies after the template is forgotten, expected no sample, got %v", count)
+	}
+}
+
+func TestRecordWorkqueueDepth(t *testing.T) {
+	// The workqueues of the controllers are instrumented by controller-runtime
+	queue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "test-controller")
+	defer queue.ShutDown()
+	for _, item := range []string{"a", "b", "c"} {
+		queue.Add(item)
+	}
+
+	if err := RecordWorkqueueDepth(metrics.Registry); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if depth := testutil.ToFloat64(workqueueDepth.WithLabelValues("test-controller")); depth != 3 {
+		t.Errorf("mismatched workqueue depth, expected %v, got %v", 3, depth)
+	}
+
+	item, _ := queue.Get()
+	queue.Done(item)
+	if err := RecordWorkqueueDepth(metrics.Registry); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if depth := testutil.ToFloat64(workqueueDepth.WithLabelValues("test-controller")); depth != 2 {
+		t.Errorf("mismatched workqueue depth, expected %v, got %v", 2, depth)
+	}
+}
+
+func TestRecordWorkqueueDepthByKind(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	base := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: baseWorkqueueDepth}, []string{"name"})
+	registry.MustRegister(base)
+	base.WithLabelValues("hostedcluster").Set(1)
+	base.WithLabelValues(GuestControllerName(ServiceAccountController, "a")).Set(2)
+	base.WithLabelValues(GuestControllerName(ServiceAccountController, "b")).Set(3)
+	base.WithLabelValues(GuestControllerName(HyperShiftLogForwarderController, "a")).Set(4)
+
+	// The controllers of the guest managers are summed by kind
+	if err := RecordWorkqueueDepth(registry); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	expected := map[string]float64{"hostedcluster": 1, ServiceAccountController: 5, HyperShiftLogForwarderController: 4}
+	for kind, depth := range expected {
+		if got := testutil.ToFloat64(workqueueDepth.WithLabelValues(kind)); got != depth {
+			t.Errorf("mismatched workqueue depth of %s, expected %v, got %v", kind, depth, got)
+		}
+	}
+	if count := testutil.CollectAndCount(workqueueDepth); count != len(expected) {
+		t.Errorf("mismatched workqueue depth series, expected %v, got %v", len(expected), count)
+	}
+
+	// The kinds without a workqueue anymore are deleted
+	base.Reset()
+	base.WithLabelValues("hostedcluster").Set(0)
+	if err := RecordWorkqueueDepth(registry); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if count := testutil.CollectAndCount(workqueueDepth); count != 1 {
+		t.Errorf("mismatched workqueue depth series, expected %v, got %v", 1, count)
+	}
+}
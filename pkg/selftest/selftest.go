@@ -0,0 +1,179 @@
+package selftest
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	loggingv1 "github.com/openshift/cluster-logging-operator/apis/logging/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/openshift/hypershift-logging-operator/pkg/clusterlogforwarder"
+)
+
+// requestTimeout bounds the injection and the queries of the marker logs
+const requestTimeout = 10 * time.Second
+
+// Keys of the output secret used to query the output, as read by cluster-logging
+const (
+	tokenKey    = "token"
+	usernameKey = "username"
+	passwordKey = "password"
+	caBundleKey = "ca-bundle.crt"
+)
+
+// Tester injects the marker log of a self-test into the collector of a CLF and queries it from an output
+type Tester interface {
+	// Inject sends the marker log to the HTTP receiver of the collector of the CLF
+	Inject(ctx context.Context, clf *loggingv1.ClusterLogForwarder, marker string) error
+	// Delivered returns true if the output stores the marker log, queried with the credentials of the secret if not nil
+	Delivered(ctx context.Context, output loggingv1.OutputSpec, secret *corev1.Secret, marker string) (bool, error)
+}
+
+var _ Tester = &HTTPTester{}
+
+// HTTPTester injects the marker logs as audit events posted to the HTTP receiver of the collectors,
+// and queries them from the loki API of the outputs
+type HTTPTester struct {
+	// RootCAs are trusted by the HTTP receivers and the outputs, the system roots if nil
+	RootCAs *x509.CertPool
+	// ReceiverURL returns the URL the marker log of the CLF is posted to, ReceiverServiceURL if nil
+	ReceiverURL func(clf *loggingv1.ClusterLogForwarder) string
+}
+
+// NewHTTPTester returns a tester trusting the PEM encoded CA bundle along with the system roots
+func NewHTTPTester(caBundle []byte) (*HTTPTester, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if len(caBundle) > 0 && !pool.AppendCertsFromPEM(caBundle) {
+		return nil, fmt.Errorf("no certificate found in the CA bundle")
+	}
+	return &HTTPTester{RootCAs: pool}, nil
+}
+
+// Inject posts the marker log as an audit event in the format of the kubeAPIAudit HTTP receiver
+func (t *HTTPTester) Inject(ctx context.Context, clf *loggingv1.ClusterLogForwarder, marker string) error {
+	receiverURL := clusterlogforwarder.ReceiverServiceURL
+	if t.ReceiverURL != nil {
+		receiverURL = t.ReceiverURL
+	}
+	body, err := json.Marshal(auditEvent(marker))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, receiverURL(clf), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := t.client(nil).Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post the marker log: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("the HTTP receiver rejected the marker log with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Delivered queries the marker log among the audit logs of the loki output
+func (t *HTTPTester) Delivered(
+	ctx context.Context,
+	output loggingv1.OutputSpec,
+	secret *corev1.Secret,
+	marker string,
+) (bool, error) {
+	if output.Type != loggingv1.OutputTypeLoki {
+		return false, fmt.Errorf("the %s outputs cannot be queried", output.Type)
+	}
+	query := url.Values{}
+	query.Set("query", fmt.Sprintf(`{log_type="audit"} |= %q`, marker))
+	query.Set("limit", "1")
+	queryURL := strings.TrimSuffix(output.URL, "/") + "/loki/api/v1/query_range?" + query.Encode()
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, queryURL, nil)
+	if err != nil {
+		return false, err
+	}
+	if secret != nil {
+		if token := secret.Data[tokenKey]; len(token) > 0 {
+			req.Header.Set("Authorization", "Bearer "+string(token))
+		} else if username := secret.Data[usernameKey]; len(username) > 0 {
+			req.SetBasicAuth(string(username), string(secret.Data[passwordKey]))
+		}
+	}
+	resp, err := t.client(secret).Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to query the output %s: %w", output.Name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("the output %s rejected the query with status %d", output.Name, resp.StatusCode)
+	}
+
+	result := struct {
+		Data struct {
+			Result []json.RawMessage `json:"result"`
+		} `json:"data"`
+	}{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&result); err != nil {
+		return false, fmt.Errorf("failed to decode the query result of the output %s: %w", output.Name, err)
+	}
+	return len(result.Data.Result) > 0, nil
+}
+
+// client returns the HTTP client trusting the root CAs, along with the CA bundle of the output secret if any
+func (t *HTTPTester) client(secret *corev1.Secret) *http.Client {
+	pool := t.RootCAs
+	if secret != nil && len(secret.Data[caBundleKey]) > 0 {
+		if pool != nil {
+			pool = pool.Clone()
+		} else {
+			pool = x509.NewCertPool()
+		}
+		pool.AppendCertsFromPEM(secret.Data[caBundleKey])
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	return &http.Client{Transport: transport}
+}
+
+// auditEvent returns the audit event list carrying the marker, as sent by the API server audit webhook
+func auditEvent(marker string) map[string]interface{} {
+	return map[string]interface{}{
+		"kind":       "EventList",
+		"apiVersion": "audit.k8s.io/v1",
+		"items": []map[string]interface{}{{
+			"kind":       "Event",
+			"apiVersion": "audit.k8s.io/v1",
+			"level":      "Metadata",
+			"auditID":    marker,
+			"stage":      "ResponseComplete",
+			"requestURI": "/" + marker,
+			"verb":       "get",
+			"user":       map[string]interface{}{"username": "hypershift-logging-operator"},
+			"userAgent":  "hypershift-logging-operator/self-test",
+			"responseStatus": map[string]interface{}{
+				"code": http.StatusOK,
+			},
+			"requestReceivedTimestamp": time.Now().UTC().Format(time.RFC3339Nano),
+			"stageTimestamp":           time.Now().UTC().Format(time.RFC3339Nano),
+		}},
+	}
+}
@@ -0,0 +1,203 @@
+package selftest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	loggingv1 "github.com/openshift/cluster-logging-operator/apis/logging/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const testMarker = "hlo-self-test-instance-1"
+
+// stubBackend is a loki backend storing the audit logs posted to its HTTP receiver
+type stubBackend struct {
+	received []string
+	status   int
+	token    string
+}
+
+func (b *stubBackend) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if b.status != 0 {
+		w.WriteHeader(b.status)
+		return
+	}
+	switch req.URL.Path {
+	case "/receiver":
+		if req.Method != http.MethodPost || req.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		events := struct {
+			Kind  string `json:"kind"`
+			Items []struct {
+				AuditID string `json:"auditID"`
+			} `json:"items"`
+		}{}
+		if err := json.NewDecoder(req.Body).Decode(&events); err != nil || events.Kind != "EventList" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for _, item := range events.Items {
+			b.received = append(b.received, item.AuditID)
+		}
+	case "/loki/api/v1/query_range":
+		if b.token != "" && req.Header.Get("Authorization") != "Bearer "+b.token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var result []map[string]interface{}
+		for _, marker := range b.received {
+			if strings.Contains(req.URL.Query().Get("query"), marker) {
+				result = append(result, map[string]interface{}{"values": [][]string{{"1", marker}}})
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": "success",
+			"data":   map[string]interface{}{"resultType": "streams", "result": result},
+		})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTestTester(server *httptest.Server) *HTTPTester {
+	return &HTTPTester{
+		ReceiverURL: func(*loggingv1.ClusterLogForwarder) string { return server.URL + "/receiver" },
+	}
+}
+
+func TestInject(t *testing.T) {
+	tests := []struct {
+		name             string
+		status           int
+		expectedReceived []string
+		expectErr        bool
+	}{
+		{
+			name:             "marker received",
+			expectedReceived: []string{testMarker},
+		},
+		{
+			name:      "marker rejected by the receiver",
+			status:    http.StatusServiceUnavailable,
+			expectErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			backend := &stubBackend{status: test.status}
+			server := httptest.NewServer(backend)
+			defer server.Close()
+
+			err := newTestTester(server).Inject(context.TODO(), &loggingv1.ClusterLogForwarder{}, testMarker)
+			if test.expectErr && err == nil {
+				t.Error("expected err, got nil")
+			}
+			if !test.expectErr && err != nil {
+				t.Errorf("expected no err, got %v", err)
+			}
+			if strings.Join(backend.received, ",") != strings.Join(test.expectedReceived, ",") {
+				t.Errorf("mismatched markers received, expected %v, got %v", test.expectedReceived, backend.received)
+			}
+		})
+	}
+}
+
+func TestDelivered(t *testing.T) {
+	tests := []struct {
+		name       string
+		outputType string
+		received   []string
+		token      string
+		secret     *corev1.Secret
+		expected   bool
+		expectErr  bool
+	}{
+		{
+			name:       "marker stored by the output",
+			outputType: loggingv1.OutputTypeLoki,
+			received:   []string{"hlo-self-test-other-1", testMarker},
+			expected:   true,
+		},
+		{
+			name:       "marker not stored yet",
+			outputType: loggingv1.OutputTypeLoki,
+			received:   []string{"hlo-self-test-other-1"},
+			expected:   false,
+		},
+		{
+			name:       "output queried with the token of the secret",
+			outputType: loggingv1.OutputTypeLoki,
+			received:   []string{testMarker},
+			token:      "secret-token",
+			secret:     &corev1.Secret{Data: map[string][]byte{tokenKey: []byte("secret-token")}},
+			expected:   true,
+		},
+		{
+			name:       "output rejecting the query",
+			outputType: loggingv1.OutputTypeLoki,
+			received:   []string{testMarker},
+			token:      "secret-token",
+			expectErr:  true,
+		},
+		{
+			name:       "output type without query API",
+			outputType: loggingv1.OutputTypeKafka,
+			received:   []string{testMarker},
+			expectErr:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			backend := &stubBackend{received: test.received, token: test.token}
+			server := httptest.NewServer(backend)
+			defer server.Close()
+
+			output := loggingv1.OutputSpec{Name: "loki", Type: test.outputType, URL: server.URL + "/"}
+			delivered, err := newTestTester(server).Delivered(context.TODO(), output, test.secret, testMarker)
+			if test.expectErr && err == nil {
+				t.Error("expected err, got nil")
+			}
+			if !test.expectErr && err != nil {
+				t.Errorf("expected no err, got %v", err)
+			}
+			if delivered != test.expected {
+				t.Errorf("mismatched delivered, expected %v, got %v", test.expected, delivered)
+			}
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	backend := &stubBackend{}
+	server := httptest.NewServer(backend)
+	defer server.Close()
+	tester := newTestTester(server)
+	output := loggingv1.OutputSpec{Name: "loki", Type: loggingv1.OutputTypeLoki, URL: server.URL}
+
+	if delivered, err := tester.Delivered(context.TODO(), output, nil, testMarker); err != nil || delivered {
+		t.Fatalf("expected the marker not to be delivered before the injection, got %v, %v", delivered, err)
+	}
+	if err := tester.Inject(context.TODO(), &loggingv1.ClusterLogForwarder{}, testMarker); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if delivered, err := tester.Delivered(context.TODO(), output, nil, testMarker); err != nil || !delivered {
+		t.Errorf("expected the marker to be delivered after the injection, got %v, %v", delivered, err)
+	}
+}
+
+func TestNewHTTPTester(t *testing.T) {
+	if _, err := NewHTTPTester(nil); err != nil {
+		t.Errorf("expected no err without CA bundle, got %v", err)
+	}
+	if _, err := NewHTTPTester([]byte("not a certificate")); err == nil {
+		t.Error("expected err for an invalid CA bundle, got nil")
+	}
+}